@@ -0,0 +1,209 @@
+package actions
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/pop/v6"
+	"github.com/gobuffalo/validate/v3"
+	"github.com/pkg/errors"
+
+	"event_planner/models"
+)
+
+// AccountForm is the payload of the forms on the account page. Each form
+// fills in the fields it needs; CurrentPassword is always required, unless
+// the user just signed in through single sign-on.
+type AccountForm struct {
+	Email                string `form:"Email"`
+	CurrentPassword      string `form:"CurrentPassword"`
+	Password             string `form:"Password"`
+	PasswordConfirmation string `form:"PasswordConfirmation"`
+}
+
+// UserPage shows the current user's account: their details, the forms to
+// change them and the events they run or attend.
+func UserPage(c buffalo.Context) error {
+	return renderUserPage(c, http.StatusOK, nil)
+}
+
+// renderUserPage renders the account page with verrs shown above the
+// forms.
+func renderUserPage(c buffalo.Context, status int, verrs *validate.Errors) error {
+	tx := c.Value("tx").(*pop.Connection)
+	u := currentUser(c)
+
+	owned, err := models.OwnedEvents(tx, u.ID)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	organized, err := models.OrganizedEvents(tx, u.ID)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	undeletable, err := u.UndeletableEvents(tx, time.Now().UTC())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	// Reservations are made by email without an account, so they are only
+	// shown once the user has proved the address is theirs.
+	attending := models.Events{}
+	if u.IsVerified() {
+		g, err := models.FindGuestByEmail(tx, u.Email)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return errors.WithStack(err)
+		}
+		if err == nil {
+			err = g.LoadAttendingEvents(tx)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			attending = g.AttendingEvents
+		}
+	}
+
+	if verrs == nil {
+		verrs = validate.NewErrors()
+	}
+	c.Set("errors", verrs)
+	c.Set("owned", owned)
+	c.Set("organized", organized)
+	c.Set("attending", attending)
+	c.Set("undeletable", undeletable)
+	return c.Render(status, r.HTML("users/show.plush.html"))
+}
+
+// wrongPassword re-renders the account page for a form sent with the wrong
+// current password.
+func wrongPassword(c buffalo.Context) error {
+	verrs := validate.NewErrors()
+	verrs.Add("current_password", "Your current password was not correct.")
+	return renderUserPage(c, http.StatusUnprocessableEntity, verrs)
+}
+
+// UserEmailUpdate moves the current user to a new email address. The new
+// address needs confirming again, and the old one is told about the
+// change.
+func UserEmailUpdate(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	u := currentUser(c)
+
+	req := &AccountForm{}
+	if err := c.Bind(req); err != nil {
+		return errors.WithStack(err)
+	}
+	if !confirmIdentity(c, u, req.CurrentPassword) {
+		return wrongPassword(c)
+	}
+
+	old := u.Email
+	verrs, err := u.ChangeEmail(tx, req.Email)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if verrs.HasAny() {
+		return renderUserPage(c, http.StatusUnprocessableEntity, verrs)
+	}
+	if u.Email == old {
+		return c.Redirect(http.StatusSeeOther, "/user")
+	}
+
+	err = sendVerification(c, u)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	err = queueMail(c, map[string]interface{}{
+		"template":       "account_changed",
+		"subject":        "Your email address was changed",
+		"change":         "The email address of your event planner account was changed to " + u.Email + ".",
+		"receiver_email": old,
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	audit(c, models.AuditEmailChanged, u.Email, u, "from "+old)
+
+	c.Flash().Add("success", "Your email address is now "+u.Email+". We've sent a link to confirm it.")
+	return c.Redirect(http.StatusSeeOther, "/user")
+}
+
+// UserPasswordUpdate changes the current user's password.
+func UserPasswordUpdate(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	u := currentUser(c)
+
+	req := &AccountForm{}
+	if err := c.Bind(req); err != nil {
+		return errors.WithStack(err)
+	}
+	if !confirmIdentity(c, u, req.CurrentPassword) {
+		return wrongPassword(c)
+	}
+
+	u.Password = req.Password
+	u.PasswordConfirmation = req.PasswordConfirmation
+	if u.Password == "" {
+		verrs := validate.NewErrors()
+		verrs.Add("password", "Password can not be blank.")
+		return renderUserPage(c, http.StatusUnprocessableEntity, verrs)
+	}
+	verrs, err := u.Update(tx)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if verrs.HasAny() {
+		return renderUserPage(c, http.StatusUnprocessableEntity, verrs)
+	}
+
+	// Other devices have to log in with the new password.
+	_, err = models.RevokeUserSessions(tx, u.ID, currentSession(c).ID, time.Now().UTC())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = queueMail(c, map[string]interface{}{
+		"template":       "account_changed",
+		"subject":        "Your password was changed",
+		"change":         "The password of your event planner account was changed.",
+		"receiver_email": u.Email,
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	audit(c, models.AuditPasswordChanged, u.Email, u, "")
+
+	c.Flash().Add("success", "Your password was changed.")
+	return c.Redirect(http.StatusSeeOther, "/user")
+}
+
+// UserDestroy deletes the current user's account and logs them out. See
+// models.User.Destroy for what happens to the events they own.
+func UserDestroy(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	u := currentUser(c)
+
+	req := &AccountForm{}
+	if err := c.Bind(req); err != nil {
+		return errors.WithStack(err)
+	}
+	if !confirmIdentity(c, u, req.CurrentPassword) {
+		return wrongPassword(c)
+	}
+
+	err := u.Destroy(tx, time.Now().UTC())
+	if errors.Is(err, models.ErrOwnsUpcomingEvents) {
+		c.Flash().Add("danger", "Hand your upcoming events to a co-organizer, or cancel them, before deleting your account.")
+		return c.Redirect(http.StatusSeeOther, "/user")
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	audit(c, models.AuditAccountDeleted, u.Email, nil, "")
+
+	c.Session().Clear()
+	c.Flash().Add("info", "Your account was deleted.")
+	return c.Redirect(http.StatusSeeOther, "/")
+}
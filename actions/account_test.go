@@ -0,0 +1,108 @@
+package actions
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/gobuffalo/nulls"
+
+	"event_planner/models"
+)
+
+func (as *ActionSuite) Test_User_Page() {
+	res := as.HTML("/user").Get()
+	as.Equal(http.StatusFound, res.Code)
+
+	u, err := as.createUser()
+	as.NoError(err)
+	e := as.createEvent()
+	e.OwnerID = nulls.NewUUID(u.ID)
+	as.NoError(as.DB.Update(e))
+
+	as.signIn(u)
+	res = as.HTML("/user").Get()
+	as.Equal(http.StatusOK, res.Code)
+	as.Contains(res.Body.String(), u.Email)
+	as.Contains(res.Body.String(), e.Title)
+}
+
+func (as *ActionSuite) Test_User_ChangeEmail() {
+	u, err := as.createUser()
+	as.NoError(err)
+	as.signIn(u)
+
+	res := as.HTML("/user/email").Post(&AccountForm{Email: "new@example.com", CurrentPassword: "wrong"})
+	as.Equal(http.StatusUnprocessableEntity, res.Code)
+	as.NoError(as.DB.Reload(u))
+	as.Equal("mark@example.com", u.Email)
+
+	res = as.HTML("/user/email").Post(&AccountForm{Email: "new@example.com", CurrentPassword: "password"})
+	as.Equal(http.StatusSeeOther, res.Code)
+	as.NoError(as.DB.Reload(u))
+	as.Equal("new@example.com", u.Email)
+	as.False(u.IsVerified())
+
+	messages := []models.OutboundMessage{}
+	as.NoError(as.DB.Order("created_at asc").All(&messages))
+	as.Len(messages, 2)
+	templates := map[string]string{}
+	for _, m := range messages {
+		data, err := m.Data()
+		as.NoError(err)
+		templates[data["template"].(string)] = data["receiver_email"].(string)
+	}
+	as.Equal("new@example.com", templates["verify_email"])
+	as.Equal("mark@example.com", templates["account_changed"])
+
+	// The new address has to be confirmed before creating events again.
+	res = as.HTML("/events/new").Get()
+	as.Equal("/users/verify", res.Location())
+}
+
+func (as *ActionSuite) Test_User_ChangePassword() {
+	u, err := as.createUser()
+	as.NoError(err)
+	as.signIn(u)
+
+	res := as.HTML("/user/password").Post(&AccountForm{CurrentPassword: "wrong", Password: "newpassword", PasswordConfirmation: "newpassword"})
+	as.Equal(http.StatusUnprocessableEntity, res.Code)
+
+	res = as.HTML("/user/password").Post(&AccountForm{CurrentPassword: "password", Password: "newpassword", PasswordConfirmation: "different"})
+	as.Equal(http.StatusUnprocessableEntity, res.Code)
+
+	res = as.HTML("/user/password").Post(&AccountForm{CurrentPassword: "password", Password: "newpassword", PasswordConfirmation: "newpassword"})
+	as.Equal(http.StatusSeeOther, res.Code)
+	as.NoError(as.DB.Reload(u))
+	as.True(u.CheckPassword("newpassword"))
+}
+
+func (as *ActionSuite) Test_User_Destroy() {
+	u, err := as.createUser()
+	as.NoError(err)
+	e := as.createEvent()
+	e.OwnerID = nulls.NewUUID(u.ID)
+	as.NoError(as.DB.Update(e))
+	as.signIn(u)
+
+	// An upcoming event with nobody else to run it blocks the deletion.
+	res := as.HTML("/user").Post(url.Values{"_method": {"DELETE"}, "CurrentPassword": {"password"}})
+	as.Equal(http.StatusSeeOther, res.Code)
+	as.Equal("/user", res.Location())
+	exists, err := as.DB.Where("id = ?", u.ID).Exists(&models.User{})
+	as.NoError(err)
+	as.True(exists)
+
+	helper := as.createUserWithRole("helper@example.com", models.RoleOrganizer)
+	as.NoError(as.DB.Create(&models.EventOrganizer{EventID: e.ID, UserID: helper.ID}))
+
+	res = as.HTML("/user").Post(url.Values{"_method": {"DELETE"}, "CurrentPassword": {"password"}})
+	as.Equal(http.StatusSeeOther, res.Code)
+	as.Equal("/", res.Location())
+	exists, err = as.DB.Where("id = ?", u.ID).Exists(&models.User{})
+	as.NoError(err)
+	as.False(exists)
+	as.Nil(as.Session.Get("current_user_id"))
+
+	as.NoError(as.DB.Reload(e))
+	as.Equal(helper.ID, e.OwnerID.UUID)
+}
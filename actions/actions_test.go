@@ -1,17 +1,40 @@
 package actions
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
 
+	"github.com/gobuffalo/envy"
 	"github.com/gobuffalo/suite/v4"
+
+	"event_planner/oidcstub"
 )
 
 type ActionSuite struct {
 	*suite.Action
 }
 
+// testIdP is the identity provider single sign-on talks to in tests.
+var testIdP *oidcstub.Provider
+
 func Test_ActionSuite(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		testIdP.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	var err error
+	testIdP, err = oidcstub.New(srv.URL, "event-planner", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	envy.Set("OIDC_ISSUER", srv.URL)
+	envy.Set("OIDC_CLIENT_ID", "event-planner")
+	envy.Set("OIDC_CLIENT_SECRET", "secret")
+	envy.Set("OIDC_NAME", "Acme ID")
+
 	action, err := suite.NewActionWithFixtures(App(), os.DirFS("../fixtures"))
 	if err != nil {
 		t.Fatal(err)
@@ -0,0 +1,601 @@
+package actions
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/pop/v6"
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+
+	"event_planner/models"
+)
+
+// AdminBulkForm is the payload for the bulk actions on the admin tables:
+// the checked rows, and the target event when moving reservations.
+type AdminBulkForm struct {
+	IDs     []string `form:"IDs"`
+	EventID string   `form:"EventID"`
+}
+
+// adminQuery starts a paginated query from the page and per_page params,
+// with q available as a search pattern.
+func adminQuery(c buffalo.Context) (*pop.Query, string) {
+	tx := c.Value("tx").(*pop.Connection)
+	c.Set("q", c.Param("q"))
+	return tx.PaginateFromParams(c.Params()), models.SearchPattern(c.Param("q"))
+}
+
+// AdminIndex returns GET for the back-office landing page with totals.
+func AdminIndex(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+
+	counts := map[string]int{}
+	for _, table := range []string{"users", "events", "guests", "event_attendees"} {
+		n, err := tx.Count(table)
+		if err != nil {
+			log.Printf("error counting %s %s", table, err)
+			return c.Redirect(301, "/")
+		}
+		counts[table] = n
+	}
+
+	c.Set("counts", counts)
+	return c.Render(http.StatusOK, r.HTML("admin/index"))
+}
+
+// AdminUsersIndex returns GET for the users table, searchable by email.
+func AdminUsersIndex(c buffalo.Context) error {
+	q, pattern := adminQuery(c)
+	users := models.Users{}
+
+	err := q.Where("email LIKE ?", pattern).Order("email").All(&users)
+	if err != nil {
+		log.Printf("error listing users %s", err)
+		return c.Redirect(301, "/")
+	}
+
+	c.Set("users", users)
+	c.Set("roles", models.Roles)
+	c.Set("pagination", q.Paginator)
+	return c.Render(http.StatusOK, r.HTML("admin/users"))
+}
+
+// AdminUserHandler returns GET for one user with the events they own and
+// organize.
+func AdminUserHandler(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	u := &models.User{}
+
+	err := tx.Find(u, c.Param("id"))
+	if err != nil {
+		log.Printf("error finding user %s", err)
+		c.Flash().Add("warning", "User not found.")
+		return c.Redirect(http.StatusSeeOther, "/admin/users")
+	}
+
+	owned, err := models.OwnedEvents(tx, u.ID)
+	if err != nil {
+		log.Printf("error listing events %s", err)
+		return c.Redirect(301, "/")
+	}
+
+	organized, err := models.OrganizedEvents(tx, u.ID)
+	if err != nil {
+		log.Printf("error listing events %s", err)
+		return c.Redirect(301, "/")
+	}
+
+	audits := models.AuditEvents{}
+	err = tx.Where("user_id = ? OR email = ?", u.ID, u.Email).Order("created_at desc").Limit(20).All(&audits)
+	if err != nil {
+		log.Printf("error listing audit events %s", err)
+		return c.Redirect(301, "/")
+	}
+
+	locked, err := lockedUntil(c, accountKey(u.Email), recoveryKey(u.Email))
+	if err != nil {
+		log.Printf("error checking lockout %s", err)
+		return c.Redirect(301, "/")
+	}
+
+	c.Set("user", u)
+	c.Set("roles", models.Roles)
+	c.Set("audits", audits)
+	c.Set("locked_until", locked)
+	c.Set("owned", owned)
+	c.Set("organized", organized)
+	return c.Render(http.StatusOK, r.HTML("admin/user"))
+}
+
+// AdminRoleForm is the payload for changing a user's role.
+type AdminRoleForm struct {
+	Role string `form:"Role"`
+}
+
+// AdminUserRoleHandler responds to POST to change a user's role. Admins
+// can't change their own role, so there is always one left.
+func AdminUserRoleHandler(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	u := &models.User{}
+	back := "/admin/users/" + c.Param("id")
+
+	err := tx.Find(u, c.Param("id"))
+	if err != nil {
+		log.Printf("error finding user %s", err)
+		c.Flash().Add("warning", "User not found.")
+		return c.Redirect(http.StatusSeeOther, "/admin/users")
+	}
+
+	if u.ID == currentUser(c).ID {
+		c.Flash().Add("warning", "You can't change your own role.")
+		return c.Redirect(http.StatusSeeOther, back)
+	}
+
+	req := &AdminRoleForm{}
+	err = c.Bind(req)
+	if err != nil {
+		log.Printf("form error %s", err)
+		return c.Redirect(301, "/")
+	}
+
+	u.Role = req.Role
+	verrs, err := tx.ValidateAndUpdate(u)
+	if err != nil {
+		log.Printf("error updating user %s", err)
+		return c.Redirect(301, "/")
+	}
+	if verrs.HasAny() {
+		c.Flash().Add("danger", verrs.Error())
+		return c.Redirect(http.StatusSeeOther, back)
+	}
+
+	c.Flash().Add("info", u.Email+" is now "+u.Role)
+	return c.Redirect(http.StatusSeeOther, back)
+}
+
+// AdminUserUnlockHandler responds to POST to lift a user's login and
+// recovery lockouts.
+func AdminUserUnlockHandler(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	u := &models.User{}
+
+	err := tx.Find(u, c.Param("id"))
+	if err != nil {
+		log.Printf("error finding user %s", err)
+		c.Flash().Add("warning", "User not found.")
+		return c.Redirect(http.StatusSeeOther, "/admin/users")
+	}
+
+	err = throttle(c).Reset(accountKey(u.Email), recoveryKey(u.Email), recoveryRequestKey(u.Email))
+	if err != nil {
+		log.Printf("error unlocking user %s", err)
+		return c.Redirect(301, "/")
+	}
+	audit(c, models.AuditUnlocked, u.Email, u, "by "+currentUser(c).Email)
+
+	c.Flash().Add("info", u.Email+" can log in again")
+	return c.Redirect(http.StatusSeeOther, "/admin/users/"+c.Param("id"))
+}
+
+// AdminUserTwoFactorResetHandler responds to POST to turn off a user's
+// two-factor authentication, for users who lost their device and their
+// backup codes.
+func AdminUserTwoFactorResetHandler(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	u := &models.User{}
+
+	err := tx.Find(u, c.Param("id"))
+	if err != nil {
+		log.Printf("error finding user %s", err)
+		c.Flash().Add("warning", "User not found.")
+		return c.Redirect(http.StatusSeeOther, "/admin/users")
+	}
+
+	err = u.DisableTwoFactor(tx)
+	if err != nil {
+		log.Printf("error resetting two-factor %s", err)
+		return c.Redirect(301, "/")
+	}
+	audit(c, models.AuditTwoFactorReset, u.Email, u, "by "+currentUser(c).Email)
+
+	c.Flash().Add("info", u.Email+" can log in with their password alone")
+	return c.Redirect(http.StatusSeeOther, "/admin/users/"+c.Param("id"))
+}
+
+// AdminUsersResetRecoveryHandler responds to POST to discard the pending
+// recovery codes of the checked users.
+func AdminUsersResetRecoveryHandler(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+
+	req := &AdminBulkForm{}
+	err := c.Bind(req)
+	if err != nil {
+		log.Printf("form error %s", err)
+		return c.Redirect(301, "/")
+	}
+
+	users := models.Users{}
+	if len(req.IDs) > 0 {
+		err = tx.Where("id IN (?)", req.IDs).All(&users)
+		if err != nil {
+			log.Printf("error finding users %s", err)
+			return c.Redirect(301, "/")
+		}
+	}
+
+	for i := range users {
+		err = users[i].ResetRecovery(tx)
+		if err != nil {
+			log.Printf("error resetting recovery %s", err)
+			return c.Redirect(301, "/")
+		}
+	}
+
+	c.Flash().Add("info", fmt.Sprintf("Recovery reset for %d user(s)", len(users)))
+	return c.Redirect(http.StatusSeeOther, adminBack(c, "/admin/users"))
+}
+
+// AdminAuditIndex returns GET for the audit log, searchable by email and
+// IP address.
+func AdminAuditIndex(c buffalo.Context) error {
+	q, pattern := adminQuery(c)
+	audits := models.AuditEvents{}
+
+	err := q.Where("email LIKE ? OR ip LIKE ?", pattern, pattern).Order("created_at desc").All(&audits)
+	if err != nil {
+		log.Printf("error listing audit events %s", err)
+		return c.Redirect(301, "/")
+	}
+
+	c.Set("audits", audits)
+	c.Set("pagination", q.Paginator)
+	return c.Render(http.StatusOK, r.HTML("admin/audit"))
+}
+
+// AdminEventsIndex returns GET for every event, whoever owns it. It takes
+// the same params as the public list.
+func AdminEventsIndex(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+
+	events, pagination, err := listEvents(c)
+	if err != nil {
+		log.Printf("error listing events %s", err)
+		return c.Redirect(301, "/")
+	}
+
+	// Owner emails for the page, keyed by user ID.
+	owners := map[string]string{}
+	ids := []uuid.UUID{}
+	for _, e := range events {
+		if e.OwnerID.Valid {
+			ids = append(ids, e.OwnerID.UUID)
+		}
+	}
+	if len(ids) > 0 {
+		users := models.Users{}
+		err = tx.Where("id IN (?)", ids).All(&users)
+		if err != nil {
+			log.Printf("error listing owners %s", err)
+			return c.Redirect(301, "/")
+		}
+		for _, u := range users {
+			owners[u.ID.String()] = u.Email
+		}
+	}
+
+	err = setEventListing(c, events, pagination)
+	if err != nil {
+		log.Print(err)
+		return c.Redirect(301, "/")
+	}
+	c.Set("owners", owners)
+	return c.Render(http.StatusOK, r.HTML("admin/events"))
+}
+
+// AdminGuestsIndex returns GET for the guests table, searchable by email
+// and name.
+func AdminGuestsIndex(c buffalo.Context) error {
+	q, pattern := adminQuery(c)
+	guests := models.Guests{}
+
+	err := q.Where("email LIKE ? OR full_name LIKE ?", pattern, pattern).Order("email").All(&guests)
+	if err != nil {
+		log.Printf("error listing guests %s", err)
+		return c.Redirect(301, "/")
+	}
+
+	c.Set("guests", guests)
+	c.Set("pagination", q.Paginator)
+	return c.Render(http.StatusOK, r.HTML("admin/guests"))
+}
+
+// AdminGuestHandler returns GET for one guest and their reservations.
+func AdminGuestHandler(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	guest := &models.Guest{}
+
+	err := tx.Find(guest, c.Param("id"))
+	if err != nil {
+		log.Printf("error finding guest %s", err)
+		c.Flash().Add("warning", "Guest not found.")
+		return c.Redirect(http.StatusSeeOther, "/admin/guests")
+	}
+
+	reservations := models.EventAttendees{}
+	err = tx.Eager("Event").Where("guest_id = ?", guest.ID).Order("created_at desc").All(&reservations)
+	if err != nil {
+		log.Printf("error listing reservations %s", err)
+		return c.Redirect(301, "/")
+	}
+
+	c.Set("guest", guest)
+	c.Set("reservations", reservations)
+	return c.Render(http.StatusOK, r.HTML("admin/guest"))
+}
+
+// AdminGuestsDeleteHandler responds to POST to delete the checked guests
+// along with their reservations.
+func AdminGuestsDeleteHandler(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+
+	req := &AdminBulkForm{}
+	err := c.Bind(req)
+	if err != nil {
+		log.Printf("form error %s", err)
+		return c.Redirect(301, "/")
+	}
+
+	guests := models.Guests{}
+	if len(req.IDs) > 0 {
+		err = tx.Where("id IN (?)", req.IDs).All(&guests)
+		if err != nil {
+			log.Printf("error finding guests %s", err)
+			return c.Redirect(301, "/")
+		}
+	}
+
+	for i := range guests {
+		err = guests[i].Destroy(tx)
+		if err != nil {
+			log.Printf("error deleting guest %s", err)
+			return c.Redirect(301, "/")
+		}
+	}
+
+	c.Flash().Add("info", fmt.Sprintf("%d guest(s) deleted", len(guests)))
+	return c.Redirect(http.StatusSeeOther, "/admin/guests")
+}
+
+// AdminGuestDuplicatesHandler returns GET for the groups of guests that
+// share an email address and can be merged.
+func AdminGuestDuplicatesHandler(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+
+	groups, err := models.DuplicateGuests(tx)
+	if err != nil {
+		log.Printf("error finding duplicate guests %s", err)
+		return c.Redirect(301, "/")
+	}
+
+	c.Set("groups", groups)
+	return c.Render(http.StatusOK, r.HTML("admin/guest_duplicates"))
+}
+
+// AdminMergeForm is the payload for merging guests: the checked IDs are
+// merged into Into, or into the oldest of them if Into is empty.
+type AdminMergeForm struct {
+	IDs  []string `form:"IDs"`
+	Into string   `form:"Into"`
+}
+
+// AdminGuestsMergeHandler responds to POST to merge the checked guests
+// into one.
+func AdminGuestsMergeHandler(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+
+	req := &AdminMergeForm{}
+	err := c.Bind(req)
+	if err != nil {
+		log.Printf("form error %s", err)
+		return c.Redirect(301, "/")
+	}
+	back := adminBack(c, "/admin/guests")
+
+	ids := req.IDs
+	if req.Into != "" {
+		ids = append(ids, req.Into)
+	}
+	guests := models.Guests{}
+	if len(ids) > 0 {
+		err = tx.Where("id IN (?)", ids).Order("created_at asc").All(&guests)
+		if err != nil {
+			log.Printf("error finding guests %s", err)
+			return c.Redirect(301, "/")
+		}
+	}
+	if len(guests) < 2 {
+		c.Flash().Add("warning", "Choose at least two guests to merge.")
+		return c.Redirect(http.StatusSeeOther, back)
+	}
+
+	into := &guests[0]
+	for i := range guests {
+		if guests[i].ID.String() == req.Into {
+			into = &guests[i]
+		}
+	}
+	for i := range guests {
+		if guests[i].ID == into.ID {
+			continue
+		}
+		err = models.MergeGuests(tx, into, &guests[i])
+		if err != nil {
+			log.Printf("error merging guests %s", err)
+			return c.Redirect(301, "/")
+		}
+	}
+
+	c.Flash().Add("info", fmt.Sprintf("%d guest(s) merged into %s", len(guests)-1, into.Email))
+	return c.Redirect(http.StatusSeeOther, "/admin/guests/"+into.ID.String())
+}
+
+// AdminReservationsIndex returns GET for the reservations table. q matches
+// the guest's email or name and the event title; event_id, status and rsvp
+// narrow it further.
+func AdminReservationsIndex(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	q, pattern := adminQuery(c)
+	reservations := models.EventAttendees{}
+
+	q = q.Eager("Guest", "Event").
+		Join("guests", "guests.id = event_attendees.guest_id").
+		Join("events", "events.id = event_attendees.event_id").
+		Where("(guests.email LIKE ? OR guests.full_name LIKE ? OR events.title LIKE ?)", pattern, pattern, pattern)
+	filters := map[string]string{}
+	for _, f := range []string{"event_id", "status", "rsvp"} {
+		if v := c.Param(f); v != "" {
+			q = q.Where("event_attendees."+f+" = ?", v)
+			filters[f] = v
+		}
+	}
+
+	err := q.Order("event_attendees.created_at desc").All(&reservations)
+	if err != nil {
+		log.Printf("error listing reservations %s", err)
+		return c.Redirect(301, "/")
+	}
+
+	events, err := adminMoveTargets(tx, uuid.Nil)
+	if err != nil {
+		log.Printf("error listing events %s", err)
+		return c.Redirect(301, "/")
+	}
+
+	c.Set("reservations", reservations)
+	c.Set("events", events)
+	c.Set("rsvps", models.RSVPs)
+	c.Set("filters", filters)
+	c.Set("pagination", q.Paginator)
+	return c.Render(http.StatusOK, r.HTML("admin/reservations"))
+}
+
+// AdminReservationHandler returns GET for one reservation.
+func AdminReservationHandler(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	res := &models.EventAttendee{}
+
+	err := tx.Eager("Guest", "Event").Find(res, c.Param("id"))
+	if err != nil {
+		log.Printf("error finding reservation %s", err)
+		c.Flash().Add("warning", "Reservation not found.")
+		return c.Redirect(http.StatusSeeOther, "/admin/reservations")
+	}
+
+	events, err := adminMoveTargets(tx, res.EventID)
+	if err != nil {
+		log.Printf("error listing events %s", err)
+		return c.Redirect(301, "/")
+	}
+
+	c.Set("reservation", res)
+	c.Set("events", events)
+	return c.Render(http.StatusOK, r.HTML("admin/reservation"))
+}
+
+// AdminReservationsMoveHandler responds to POST to move the checked
+// reservations to another event. Guests who already have a reservation
+// there are skipped.
+func AdminReservationsMoveHandler(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+
+	req := &AdminBulkForm{}
+	err := c.Bind(req)
+	if err != nil {
+		log.Printf("form error %s", err)
+		return c.Redirect(301, "/")
+	}
+	back := adminBack(c, "/admin/reservations")
+
+	target := &models.Event{}
+	err = tx.Find(target, req.EventID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.Flash().Add("warning", "Choose an event to move the reservations to.")
+			return c.Redirect(http.StatusSeeOther, back)
+		}
+		log.Printf("error finding event %s", err)
+		return c.Redirect(301, "/")
+	}
+	// The picker only offers upcoming events; hold posted IDs to the same.
+	if target.IsCancelled() || target.HasEnded(time.Now()) {
+		c.Flash().Add("warning", "Reservations can only be moved to an upcoming event.")
+		return c.Redirect(http.StatusSeeOther, back)
+	}
+
+	reservations := models.EventAttendees{}
+	if len(req.IDs) > 0 {
+		err = tx.Where("id IN (?)", req.IDs).All(&reservations)
+		if err != nil {
+			log.Printf("error finding reservations %s", err)
+			return c.Redirect(301, "/")
+		}
+	}
+
+	moved, skipped := 0, 0
+	for i := range reservations {
+		_, err = models.MoveReservation(tx, &reservations[i], target.ID)
+		if errors.Is(err, models.ErrAlreadyReserved) {
+			skipped++
+			continue
+		}
+		if err != nil {
+			log.Printf("error moving reservation %s", err)
+			return c.Redirect(301, "/")
+		}
+		moved++
+	}
+
+	c.Flash().Add("info", fmt.Sprintf("%d reservation(s) moved to %s", moved, target.Title))
+	if skipped > 0 {
+		c.Flash().Add("warning", fmt.Sprintf("%d skipped: the guest already has a reservation for %s", skipped, target.Title))
+	}
+	return c.Redirect(http.StatusSeeOther, back)
+}
+
+// adminMoveTargets returns the events reservations can be moved to: the
+// next page of upcoming ones, soonest first, leaving out except.
+func adminMoveTargets(tx *pop.Connection, except uuid.UUID) (models.Events, error) {
+	events, _, err := models.ListEvents(tx, models.EventListOptions{PerPage: models.MaxEventsPerPage}, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	targets := models.Events{}
+	for _, e := range events {
+		if e.ID != except {
+			targets = append(targets, e)
+		}
+	}
+	return targets, nil
+}
+
+// adminBack returns the page a bulk form was posted from, so the table
+// keeps its search and page. It falls back to path unless back is a path
+// on this site: browsers read "//host" and "/\host" as another host.
+func adminBack(c buffalo.Context, path string) string {
+	back := c.Param("back")
+	if !strings.HasPrefix(back, "/") || strings.HasPrefix(back, "//") || strings.Contains(back, "\\") {
+		return path
+	}
+	u, err := url.Parse(back)
+	if err != nil || u.Scheme != "" || u.Host != "" {
+		return path
+	}
+	return back
+}
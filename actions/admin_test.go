@@ -0,0 +1,306 @@
+package actions
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gobuffalo/nulls"
+	"github.com/gofrs/uuid"
+
+	"event_planner/models"
+)
+
+func (as *ActionSuite) createUserWithRole(email, role string) *models.User {
+	u := &models.User{
+		Email:                email,
+		Password:             "password",
+		PasswordConfirmation: "password",
+		Role:                 role,
+		VerifiedAt:           nulls.NewTime(time.Now()),
+	}
+	verrs, err := u.Create(as.DB)
+	as.NoError(err)
+	as.False(verrs.HasAny(), "validation error: %v", verrs)
+	return u
+}
+
+func (as *ActionSuite) Test_Roles_MemberCannotCreateEvents() {
+	member := as.createUserWithRole("member@example.com", models.RoleMember)
+	as.signIn(member)
+
+	res := as.HTML("/events/new").Get()
+	as.Equal(http.StatusFound, res.Code)
+	as.Equal("/", res.Location())
+
+	jres := as.JSON("/api/v1/events").Post(map[string]string{"title": "Nope"})
+	as.Equal(http.StatusForbidden, jres.Code)
+
+	res = as.HTML("/admin/users").Get()
+	as.Equal(http.StatusFound, res.Code)
+}
+
+func (as *ActionSuite) Test_Admin_Users() {
+	admin := as.createUserWithRole("admin@example.com", models.RoleAdmin)
+	member := as.createUserWithRole("member@example.com", models.RoleMember)
+	as.signIn(admin)
+
+	res := as.HTML("/admin/users").Get()
+	as.Equal(http.StatusOK, res.Code)
+	as.Contains(res.Body.String(), "member@example.com")
+
+	res = as.HTML("/admin/users/%s/role", member.ID).Post(&AdminRoleForm{Role: models.RoleOrganizer})
+	as.Equal(http.StatusSeeOther, res.Code)
+	as.NoError(as.DB.Reload(member))
+	as.Equal(models.RoleOrganizer, member.Role)
+
+	res = as.HTML("/admin/users/%s/role", admin.ID).Post(&AdminRoleForm{Role: models.RoleMember})
+	as.Equal(http.StatusSeeOther, res.Code)
+	as.NoError(as.DB.Reload(admin))
+	as.Equal(models.RoleAdmin, admin.Role)
+}
+
+func (as *ActionSuite) Test_Admin_NoTokens() {
+	admin := as.createUserWithRole("admin@example.com", models.RoleAdmin)
+	member := as.createUserWithRole("member@example.com", models.RoleMember)
+	_, token, _, err := models.NewAPIToken(as.DB, admin.ID, "deploy", []string{models.ScopeRead, models.ScopeManageEvents}, nulls.Time{})
+	as.NoError(err)
+
+	req := as.HTML("/admin/users")
+	req.Headers["Authorization"] = "Bearer " + token
+	res := req.Get()
+	as.Equal(http.StatusForbidden, res.Code)
+
+	req = as.HTML("/admin/users/%s/role", member.ID)
+	req.Headers["Authorization"] = "Bearer " + token
+	res = req.Post(&AdminRoleForm{Role: models.RoleAdmin})
+	as.Equal(http.StatusForbidden, res.Code)
+	as.NoError(as.DB.Reload(member))
+	as.Equal(models.RoleMember, member.Role)
+}
+
+func (as *ActionSuite) Test_Admin_ManagesAnyEvent() {
+	owner := as.createUserWithRole("owner@example.com", models.RoleOrganizer)
+	admin := as.createUserWithRole("admin@example.com", models.RoleAdmin)
+
+	e := as.createEvent()
+	e.OwnerID = nulls.NewUUID(owner.ID)
+	as.NoError(as.DB.Update(e))
+
+	as.signIn(admin)
+	res := as.HTML("/admin/events").Get()
+	as.Equal(http.StatusOK, res.Code)
+	as.Contains(res.Body.String(), "owner@example.com")
+
+	res = as.HTML("/events/%s/edit", e.ID).Get()
+	as.Equal(http.StatusOK, res.Code)
+
+	res = as.HTML("/events/%s", e.ID).Delete()
+	as.Equal(http.StatusSeeOther, res.Code)
+}
+
+func (as *ActionSuite) Test_Admin_Dashboard() {
+	admin := as.createUserWithRole("admin@example.com", models.RoleAdmin)
+	as.signIn(admin)
+
+	for _, path := range []string{"/admin", "/admin/guests", "/admin/reservations"} {
+		res := as.HTML(path).Get()
+		as.Equal(http.StatusOK, res.Code, path)
+	}
+
+	member := as.createUserWithRole("member@example.com", models.RoleMember)
+	as.signIn(member)
+	res := as.HTML("/admin").Get()
+	as.Equal(http.StatusFound, res.Code)
+}
+
+func (as *ActionSuite) Test_Admin_SearchUsers() {
+	admin := as.createUserWithRole("admin@example.com", models.RoleAdmin)
+	as.createUserWithRole("alice@example.com", models.RoleMember)
+	as.createUserWithRole("bob@example.com", models.RoleMember)
+	as.signIn(admin)
+
+	res := as.HTML("/admin/users?q=alice").Get()
+	as.Equal(http.StatusOK, res.Code)
+	as.Contains(res.Body.String(), "alice@example.com")
+	as.NotContains(res.Body.String(), "bob@example.com")
+}
+
+func (as *ActionSuite) Test_Admin_ResetRecovery() {
+	admin := as.createUserWithRole("admin@example.com", models.RoleAdmin)
+	member := as.createUserWithRole("member@example.com", models.RoleMember)
+	_, _, err := member.StartRecovery(as.DB, time.Now().UTC())
+	as.NoError(err)
+	as.signIn(admin)
+
+	res := as.HTML("/admin/users/%s", member.ID).Get()
+	as.Equal(http.StatusOK, res.Code)
+	as.Contains(res.Body.String(), "Code pending")
+
+	res = as.HTML("/admin/users/reset-recovery").Post(url.Values{"IDs": {member.ID.String()}})
+	as.Equal(http.StatusSeeOther, res.Code)
+	as.NoError(as.DB.Reload(member))
+	as.False(member.HasPendingRecovery())
+}
+
+func (as *ActionSuite) Test_Admin_DeleteGuests() {
+	admin := as.createUserWithRole("admin@example.com", models.RoleAdmin)
+	as.signIn(admin)
+
+	e := as.createEvent()
+	g := &models.Guest{Email: "bob@example.com", FullName: "Bob"}
+	as.NoError(as.DB.Create(g))
+	_, err := models.Reserve(as.DB, e.ID, g.ID)
+	as.NoError(err)
+
+	res := as.HTML("/admin/guests/%s", g.ID).Get()
+	as.Equal(http.StatusOK, res.Code)
+	as.Contains(res.Body.String(), e.Title)
+
+	res = as.HTML("/admin/guests/delete").Post(url.Values{"IDs": {g.ID.String()}})
+	as.Equal(http.StatusSeeOther, res.Code)
+
+	count, err := as.DB.Where("guest_id = ?", g.ID).Count(&models.EventAttendee{})
+	as.NoError(err)
+	as.Equal(0, count)
+	count, err = as.DB.Where("id = ?", g.ID).Count(&models.Guest{})
+	as.NoError(err)
+	as.Equal(0, count)
+}
+
+func (as *ActionSuite) Test_Admin_MergeGuests() {
+	admin := as.createUserWithRole("admin@example.com", models.RoleAdmin)
+	as.signIn(admin)
+
+	e := as.createEvent()
+	bob := &models.Guest{Email: "bob@example.com", FullName: "Bob"}
+	as.NoError(as.DB.Create(bob))
+	// A duplicate from before emails were normalized.
+	as.NoError(as.DB.RawQuery("INSERT INTO guests (id, email, full_name, created_at, updated_at) VALUES (?, ?, ?, ?, ?)",
+		uuid.Must(uuid.NewV4()), "BOB@example.com", "Robert", time.Now(), time.Now()).Exec())
+	dup := &models.Guest{}
+	as.NoError(as.DB.Where("email = ?", "BOB@example.com").First(dup))
+	_, err := models.Reserve(as.DB, e.ID, dup.ID)
+	as.NoError(err)
+
+	res := as.HTML("/admin/guests/duplicates").Get()
+	as.Equal(http.StatusOK, res.Code)
+	as.Contains(res.Body.String(), "BOB@example.com")
+
+	res = as.HTML("/admin/guests/merge").Post(url.Values{"IDs": {bob.ID.String(), dup.ID.String()}, "Into": {bob.ID.String()}})
+	as.Equal(http.StatusSeeOther, res.Code)
+	as.Equal("/admin/guests/"+bob.ID.String(), res.Location())
+
+	count, err := as.DB.Where("guest_id = ?", bob.ID).Count(&models.EventAttendee{})
+	as.NoError(err)
+	as.Equal(1, count)
+	count, err = as.DB.Count("guests")
+	as.NoError(err)
+	as.Equal(1, count)
+}
+
+func (as *ActionSuite) Test_Admin_MoveReservations() {
+	admin := as.createUserWithRole("admin@example.com", models.RoleAdmin)
+	as.signIn(admin)
+
+	from := as.createEvent()
+	to := as.createEvent()
+	bob := &models.Guest{Email: "bob@example.com", FullName: "Bob"}
+	as.NoError(as.DB.Create(bob))
+	ann := &models.Guest{Email: "ann@example.com", FullName: "Ann"}
+	as.NoError(as.DB.Create(ann))
+
+	moving, err := models.Reserve(as.DB, from.ID, bob.ID)
+	as.NoError(err)
+	staying, err := models.Reserve(as.DB, from.ID, ann.ID)
+	as.NoError(err)
+	_, err = models.Reserve(as.DB, to.ID, ann.ID)
+	as.NoError(err)
+
+	res := as.HTML("/admin/reservations?q=bob").Get()
+	as.Equal(http.StatusOK, res.Code)
+	as.Contains(res.Body.String(), "bob@example.com")
+	as.NotContains(res.Body.String(), "ann@example.com")
+
+	res = as.HTML("/admin/reservations/move").Post(url.Values{
+		"IDs":     {moving.ID.String(), staying.ID.String()},
+		"EventID": {to.ID.String()},
+	})
+	as.Equal(http.StatusSeeOther, res.Code)
+
+	as.NoError(as.DB.Reload(moving))
+	as.Equal(to.ID, moving.EventID)
+	as.NoError(as.DB.Reload(staying))
+	as.Equal(from.ID, staying.EventID)
+
+	// Only this site's pages are taken as the way back.
+	for _, back := range []string{"//evil.com", "/\\evil.com", "https://evil.com/"} {
+		res = as.HTML("/admin/reservations/move").Post(url.Values{
+			"IDs":     {moving.ID.String()},
+			"EventID": {from.ID.String()},
+			"back":    {back},
+		})
+		as.Equal(http.StatusSeeOther, res.Code)
+		as.Equal("/admin/reservations", res.Header().Get("Location"))
+	}
+}
+
+func (as *ActionSuite) Test_Admin_MoveTargets() {
+	admin := as.createUserWithRole("admin@example.com", models.RoleAdmin)
+	as.signIn(admin)
+
+	current := as.createEvent()
+	past := as.createEvent()
+	past.Title = "Old picnic"
+	past.Date = time.Now().AddDate(-1, 0, 0)
+	as.NoError(as.DB.Update(past))
+	next := as.createEvent()
+	next.Title = "Quiz night"
+	as.NoError(as.DB.Update(next))
+	g := &models.Guest{Email: "bob@example.com", FullName: "Bob"}
+	as.NoError(as.DB.Create(g))
+	res, err := models.Reserve(as.DB, current.ID, g.ID)
+	as.NoError(err)
+
+	page := as.HTML("/admin/reservations/%s", res.ID).Get()
+	as.Equal(http.StatusOK, page.Code)
+	as.Contains(page.Body.String(), "Quiz night")
+	as.NotContains(page.Body.String(), "Old picnic")
+	as.NotContains(page.Body.String(), `value="`+current.ID.String()+`"`)
+
+	// Past and cancelled events are refused even when posted directly.
+	cancelled := as.createEvent()
+	cancelled.Cancel("Rain")
+	as.NoError(as.DB.Update(cancelled))
+	for _, target := range []*models.Event{past, cancelled} {
+		page = as.HTML("/admin/reservations/move").Post(url.Values{
+			"IDs":     {res.ID.String()},
+			"EventID": {target.ID.String()},
+		})
+		as.Equal(http.StatusSeeOther, page.Code)
+		as.NoError(as.DB.Reload(res))
+		as.Equal(current.ID, res.EventID)
+	}
+}
+
+func (as *ActionSuite) Test_Admin_Unlock() {
+	admin := as.createUserWithRole("admin@example.com", models.RoleAdmin)
+	member := as.createUserWithRole("member@example.com", models.RoleMember)
+
+	for i := 0; i < accountLockout.MaxFailures; i++ {
+		as.HTML("/login").Post(&models.User{Email: member.Email, Password: "wrong"})
+	}
+
+	as.signIn(admin)
+	res := as.HTML("/admin/users/%s", member.ID).Get()
+	as.Equal(http.StatusOK, res.Code)
+	as.Contains(res.Body.String(), "Locked until")
+	as.Contains(res.Body.String(), models.AuditAccountLocked)
+
+	res = as.HTML("/admin/users/%s/unlock", member.ID).Post(url.Values{})
+	as.Equal(http.StatusSeeOther, res.Code)
+
+	as.Session.Clear()
+	res = as.HTML("/login").Post(&models.User{Email: member.Email, Password: "password"})
+	as.Equal(http.StatusFound, res.Code)
+}
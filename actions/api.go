@@ -0,0 +1,122 @@
+package actions
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/pop/v6"
+	"github.com/gobuffalo/validate/v3"
+	"github.com/pkg/errors"
+
+	"event_planner/models"
+)
+
+// APIError is the body of every error response from /api/v1. Fields holds
+// validation messages keyed by field name.
+type APIError struct {
+	Error  string              `json:"error"`
+	Fields map[string][]string `json:"fields,omitempty"`
+}
+
+// apiFail renders an error response with the given status.
+func apiFail(c buffalo.Context, status int, msg string) error {
+	return c.Render(status, r.JSON(APIError{Error: msg}))
+}
+
+// apiInvalid renders the field errors from a failed validation.
+func apiInvalid(c buffalo.Context, verrs *validate.Errors) error {
+	return c.Render(http.StatusUnprocessableEntity, r.JSON(APIError{
+		Error:  "validation failed",
+		Fields: verrs.Errors,
+	}))
+}
+
+// apiServerError logs err and renders a 500 without leaking details.
+func apiServerError(c buffalo.Context, err error) error {
+	log.Printf("api error %s", err)
+	return apiFail(c, http.StatusInternalServerError, "internal server error")
+}
+
+// apiLookupFailed turns a failed Find into a 404, or a 500 when the query
+// itself broke.
+func apiLookupFailed(c buffalo.Context, err error, what string) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return apiFail(c, http.StatusNotFound, what+" not found")
+	}
+	return apiServerError(c, err)
+}
+
+// apiBind decodes the request body, answering 400 when it can't be read.
+func apiBind(c buffalo.Context, v interface{}) error {
+	err := c.Bind(v)
+	if err != nil {
+		log.Printf("api bind error %s", err)
+		return apiFail(c, http.StatusBadRequest, "request body could not be read")
+	}
+	return nil
+}
+
+// APIAuthorize is Authorize for API routes: it answers 401 instead of
+// sending the client to the login page.
+func APIAuthorize(next buffalo.Handler) buffalo.Handler {
+	return func(c buffalo.Context) error {
+		if currentUser(c) == nil {
+			return apiFail(c, http.StatusUnauthorized, "authentication required")
+		}
+		return next(c)
+	}
+}
+
+// APIRequireRole is RequireRole for API routes, answering 403.
+func APIRequireRole(role string) buffalo.MiddlewareFunc {
+	return func(next buffalo.Handler) buffalo.Handler {
+		return func(c buffalo.Context) error {
+			if !currentUser(c).HasRole(role) {
+				return apiFail(c, http.StatusForbidden, "requires the "+role+" role")
+			}
+			return next(c)
+		}
+	}
+}
+
+// APIRequireVerified is RequireVerified for API routes.
+func APIRequireVerified(next buffalo.Handler) buffalo.Handler {
+	return func(c buffalo.Context) error {
+		if !currentUser(c).IsVerified() {
+			return apiFail(c, http.StatusForbidden, "email address not confirmed")
+		}
+		return next(c)
+	}
+}
+
+// APIEventManager is AuthorizeEventManager for API routes. The event is
+// stored in the context as "event".
+func APIEventManager(next buffalo.Handler) buffalo.Handler {
+	return apiAuthorizeEvent(next, models.Event.CanManage)
+}
+
+// APIEventOwner is AuthorizeEventOwner for API routes. The event is stored
+// in the context as "event".
+func APIEventOwner(next buffalo.Handler) buffalo.Handler {
+	return apiAuthorizeEvent(next, models.Event.HasOwnerRights)
+}
+
+func apiAuthorizeEvent(next buffalo.Handler, allowed func(models.Event, *models.User) bool) buffalo.Handler {
+	return func(c buffalo.Context) error {
+		tx := c.Value("tx").(*pop.Connection)
+		event := &models.Event{}
+
+		err := tx.Eager("Organizers").Find(event, c.Param("id"))
+		if err != nil {
+			return apiLookupFailed(c, err, "event")
+		}
+
+		if !allowed(*event, currentUser(c)) {
+			return apiFail(c, http.StatusForbidden, "not allowed to manage this event")
+		}
+		c.Set("event", event)
+		return next(c)
+	}
+}
@@ -0,0 +1,66 @@
+package actions
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/pop/v6"
+	"github.com/pkg/errors"
+
+	"event_planner/models"
+)
+
+// APIEventCheckInsShow returns GET for how many of an event's seated guests
+// have arrived.
+func APIEventCheckInsShow(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	event := c.Value("event").(*models.Event)
+
+	count, err := models.CountCheckIns(tx, event.ID)
+	if err != nil {
+		return apiServerError(c, err)
+	}
+	return c.Render(http.StatusOK, r.JSON(count))
+}
+
+// APICheckInForm is the payload for checking a guest in. Token may be the
+// bare check-in token or the URL from the ticket's QR code.
+type APICheckInForm struct {
+	Token string `json:"token"`
+}
+
+// APIEventCheckInsCreate responds to POST to check in the guest holding a
+// ticket for the event. A ticket scanned a second time gets a 409.
+func APIEventCheckInsCreate(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	event := c.Value("event").(*models.Event)
+
+	req := &APICheckInForm{}
+	if err := apiBind(c, req); err != nil {
+		return err
+	}
+
+	res, err := models.FindReservationByCheckInToken(tx, ticketToken(req.Token))
+	if err != nil {
+		return apiLookupFailed(c, err, "ticket")
+	}
+	if res.EventID != event.ID {
+		return apiFail(c, http.StatusNotFound, "ticket not found")
+	}
+
+	if event.IsCancelled() {
+		return apiFail(c, http.StatusConflict, "event has been cancelled")
+	}
+
+	err = models.CheckIn(tx, res, time.Now())
+	switch {
+	case errors.Is(err, models.ErrAlreadyCheckedIn):
+		return apiFail(c, http.StatusConflict, "already checked in at "+res.CheckedInAt.Time.UTC().Format(time.RFC3339))
+	case errors.Is(err, models.ErrNotAdmitted):
+		return apiFail(c, http.StatusConflict, "reservation does not hold a seat")
+	case err != nil:
+		return apiServerError(c, err)
+	}
+	return c.Render(http.StatusOK, r.JSON(res))
+}
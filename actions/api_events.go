@@ -0,0 +1,228 @@
+package actions
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/nulls"
+	"github.com/gobuffalo/pop/v6"
+	"github.com/gobuffalo/validate/v3"
+
+	"event_planner/models"
+	"event_planner/rrule"
+)
+
+// APIEventForm is the body for creating or changing an event: the event's
+// fields plus how it repeats. Recurrence is an RRULE such as
+// "FREQ=WEEKLY;BYDAY=MO;COUNT=10" and ExDates the YYYY-MM-DD dates it
+// skips. Scope "future" on an occurrence applies the change to it and
+// every later date, with the new recurrence if one is given.
+type APIEventForm struct {
+	*models.Event
+	Recurrence string   `json:"recurrence"`
+	ExDates    []string `json:"exdates"`
+	Scope      string   `json:"scope"`
+}
+
+// rule reads the recurrence and exceptions from the form. An empty
+// recurrence keeps the series' rule, if there is one; likewise for
+// exceptions. Either way the rule can't end before the event's date.
+func (f APIEventForm) rule(series *models.EventSeries) (rrule.Rule, models.DateList, *validate.Errors) {
+	verrs := validate.NewErrors()
+	rule, exdates := rrule.Rule{}, models.DateList{}
+
+	if f.Recurrence != "" {
+		var err error
+		rule, err = rrule.Parse(f.Recurrence)
+		if err != nil {
+			verrs.Add("recurrence", err.Error())
+		}
+	} else if series != nil {
+		rule, _ = series.Rule()
+	}
+	if !rule.Until.IsZero() && rule.Until.Before(f.Event.Date) {
+		verrs.Add("recurrence", "UNTIL can't be before the event's date.")
+	}
+
+	if f.ExDates != nil {
+		var err error
+		exdates, err = models.ParseDateList(strings.Join(f.ExDates, ","))
+		if err != nil {
+			verrs.Add("exdates", err.Error())
+		}
+	} else if series != nil {
+		exdates = series.ExDates.From(f.Event.RecurrenceID.Time.In(series.Zone()))
+	}
+	return rule, exdates, verrs
+}
+
+// APIEventsList returns GET for a page of events. It takes the same
+// filter, sort and paging params as the HTML list.
+func APIEventsList(c buffalo.Context) error {
+	events, pagination, err := listEvents(c)
+	if err != nil {
+		return apiServerError(c, err)
+	}
+	return c.Render(http.StatusOK, r.JSON(EventsPage{Events: events, Pagination: pagination}))
+}
+
+// APIEventsShow returns GET for one event.
+func APIEventsShow(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	event := &models.Event{}
+
+	err := tx.Eager("Attendees").Find(event, c.Param("id"))
+	if err != nil {
+		return apiLookupFailed(c, err, "event")
+	}
+
+	err = event.LoadSeries(tx)
+	if err != nil {
+		return apiServerError(c, err)
+	}
+
+	event.CountRSVPs()
+	return c.Render(http.StatusOK, r.JSON(event))
+}
+
+// APIEventsCreate responds to POST to create an event owned by the current
+// user.
+func APIEventsCreate(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	event := &models.Event{Duration: models.DefaultEventDuration, TimeZone: models.DefaultTimeZone}
+	req := &APIEventForm{Event: event}
+
+	if err := apiBind(c, req); err != nil {
+		return err
+	}
+	event.Status = models.EventStatusScheduled
+	event.CancelReason, event.CancelledAt = nulls.String{}, nulls.Time{}
+	event.OwnerID = nulls.NewUUID(currentUser(c).ID)
+	event.Sequence = 0
+	event.CreatedAt, event.UpdatedAt = time.Time{}, time.Time{}
+	event.SeriesID, event.RecurrenceID, event.Series = nulls.UUID{}, nulls.Time{}, nil
+
+	rule, exdates, verrs := req.rule(nil)
+	if !verrs.HasAny() {
+		var err error
+		verrs, err = tx.ValidateAndCreate(event)
+		if err != nil {
+			return apiServerError(c, err)
+		}
+	}
+	if verrs.HasAny() {
+		return apiInvalid(c, verrs)
+	}
+
+	if req.Recurrence != "" {
+		_, err := models.StartSeries(tx, event, rule, exdates, time.Now())
+		if err != nil {
+			return apiServerError(c, err)
+		}
+	}
+	return c.Render(http.StatusCreated, r.JSON(event))
+}
+
+// APIEventsUpdate responds to PUT or PATCH to change an event. Fields left
+// out of the body keep their values.
+func APIEventsUpdate(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	event := c.Value("event").(*models.Event)
+
+	// As with the HTML form, status, ownership and the series have their
+	// own flows, and the creation time is the server's.
+	id, status, owner, seq, createdAt := event.ID, event.Status, event.OwnerID, event.Sequence, event.CreatedAt
+	reason, cancelledAt := event.CancelReason, event.CancelledAt
+	series, recurrenceID := event.SeriesID, event.RecurrenceID
+
+	err := event.LoadSeries(tx)
+	if err != nil {
+		return apiServerError(c, err)
+	}
+	loaded := event.Series
+
+	req := &APIEventForm{Event: event}
+	if err := apiBind(c, req); err != nil {
+		return err
+	}
+	event.ID, event.Status, event.OwnerID, event.Sequence, event.CreatedAt = id, status, owner, seq, createdAt
+	event.CancelReason, event.CancelledAt = reason, cancelledAt
+	event.SeriesID, event.RecurrenceID, event.Series = series, recurrenceID, loaded
+
+	rule, exdates, verrs := rrule.Rule{}, models.DateList{}, validate.NewErrors()
+	switch {
+	case req.Scope == ScopeFuture && !event.IsOccurrence():
+		verrs.Add("scope", "Only a repeating event's dates can be changed together.")
+	case req.Scope == ScopeFuture || (!event.IsOccurrence() && req.Recurrence != ""):
+		rule, exdates, verrs = req.rule(loaded)
+	}
+
+	if !verrs.HasAny() {
+		verrs, err = tx.ValidateAndUpdate(event)
+		if err != nil {
+			return apiServerError(c, err)
+		}
+	}
+	if verrs.HasAny() {
+		return apiInvalid(c, verrs)
+	}
+
+	repeat := RecurrenceForm{Repeat: rule.Freq, Scope: req.Scope}
+	repeated, err := applyRecurrence(tx, event, repeat, rule, exdates)
+	if err != nil {
+		return apiServerError(c, err)
+	}
+
+	if !repeated && !event.IsCancelled() {
+		_, err = models.PromoteWaitlist(tx, event.ID)
+		if err != nil {
+			return apiServerError(c, err)
+		}
+	}
+	return c.Render(http.StatusOK, r.JSON(event))
+}
+
+// APIEventCancelForm is the payload for cancelling an event.
+type APIEventCancelForm struct {
+	Reason string `json:"reason"`
+}
+
+// APIEventsCancel responds to POST to cancel an event.
+func APIEventsCancel(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	event := c.Value("event").(*models.Event)
+
+	if event.IsCancelled() {
+		return apiFail(c, http.StatusConflict, "event is already cancelled")
+	}
+
+	req := &APIEventCancelForm{}
+	if err := apiBind(c, req); err != nil {
+		return err
+	}
+
+	event.Cancel(req.Reason)
+	verrs, err := tx.ValidateAndUpdate(event)
+	if err != nil {
+		return apiServerError(c, err)
+	}
+	if verrs.HasAny() {
+		return apiInvalid(c, verrs)
+	}
+	return c.Render(http.StatusOK, r.JSON(event))
+}
+
+// APIEventsDestroy responds to DELETE to remove an event and its
+// reservations.
+func APIEventsDestroy(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	event := c.Value("event").(*models.Event)
+
+	err := event.Destroy(tx)
+	if err != nil {
+		return apiServerError(c, err)
+	}
+	return c.Render(http.StatusNoContent, nil)
+}
@@ -0,0 +1,111 @@
+package actions
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/pop/v6"
+	"github.com/gobuffalo/validate/v3"
+	"github.com/gofrs/uuid"
+
+	"event_planner/models"
+)
+
+// APIGuestsList returns GET for all guests.
+func APIGuestsList(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	guests := models.Guests{}
+
+	err := tx.Order("email").All(&guests)
+	if err != nil {
+		return apiServerError(c, err)
+	}
+	return c.Render(http.StatusOK, r.JSON(guests))
+}
+
+// APIGuestsShow returns GET for one guest.
+func APIGuestsShow(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	guest := &models.Guest{}
+
+	err := tx.Find(guest, c.Param("id"))
+	if err != nil {
+		return apiLookupFailed(c, err, "guest")
+	}
+	return c.Render(http.StatusOK, r.JSON(guest))
+}
+
+// APIGuestsCreate responds to POST to add a guest. Emails are unique.
+func APIGuestsCreate(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	guest := &models.Guest{}
+
+	if err := apiBind(c, guest); err != nil {
+		return err
+	}
+	guest.ID = uuid.Nil
+
+	return saveAPIGuest(c, tx, guest, tx.ValidateAndCreate, http.StatusCreated)
+}
+
+// APIGuestsUpdate responds to PUT or PATCH to change a guest. Fields left
+// out of the body keep their values.
+func APIGuestsUpdate(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	guest := &models.Guest{}
+
+	err := tx.Find(guest, c.Param("id"))
+	if err != nil {
+		return apiLookupFailed(c, err, "guest")
+	}
+
+	id := guest.ID
+	if err := apiBind(c, guest); err != nil {
+		return err
+	}
+	guest.ID = id
+
+	return saveAPIGuest(c, tx, guest, tx.ValidateAndUpdate, http.StatusOK)
+}
+
+// saveAPIGuest checks that no other guest has the email, however it is
+// spelled, then saves with save and renders the guest.
+func saveAPIGuest(c buffalo.Context, tx *pop.Connection, guest *models.Guest, save func(interface{}, ...string) (*validate.Errors, error), status int) error {
+	guest.Email = strings.TrimSpace(guest.Email)
+
+	exists, err := tx.Where("id <> ? AND LOWER(TRIM(email)) = ?", guest.ID, models.NormalizeEmail(guest.Email)).Exists(&models.Guest{})
+	if err != nil {
+		return apiServerError(c, err)
+	}
+	if exists {
+		return apiFail(c, http.StatusConflict, "a guest with that email already exists")
+	}
+
+	verrs, err := save(guest)
+	if err != nil {
+		return apiServerError(c, err)
+	}
+	if verrs.HasAny() {
+		return apiInvalid(c, verrs)
+	}
+	return c.Render(status, r.JSON(guest))
+}
+
+// APIGuestsDestroy responds to DELETE to remove a guest and their
+// reservations.
+func APIGuestsDestroy(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	guest := &models.Guest{}
+
+	err := tx.Find(guest, c.Param("id"))
+	if err != nil {
+		return apiLookupFailed(c, err, "guest")
+	}
+
+	err = guest.Destroy(tx)
+	if err != nil {
+		return apiServerError(c, err)
+	}
+	return c.Render(http.StatusNoContent, nil)
+}
@@ -0,0 +1,149 @@
+package actions
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/pop/v6"
+	"github.com/gobuffalo/validate/v3"
+	"github.com/gobuffalo/validate/v3/validators"
+	"github.com/pkg/errors"
+
+	"event_planner/models"
+)
+
+// APIEventReservationsList returns GET for an event's reservations, in the
+// order guests signed up.
+func APIEventReservationsList(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	event := c.Value("event").(*models.Event)
+	reservations := models.EventAttendees{}
+
+	err := tx.Eager("Guest").Where("event_id = ?", event.ID).Order("created_at, id").All(&reservations)
+	if err != nil {
+		return apiServerError(c, err)
+	}
+	return c.Render(http.StatusOK, r.JSON(reservations))
+}
+
+// APIReservationForm is the payload for booking a guest onto an event.
+type APIReservationForm struct {
+	Email    string `json:"email"`
+	FullName string `json:"full_name"`
+}
+
+// APIEventReservationsCreate responds to POST to book a guest onto an
+// event. Like the public forms it needs no login; the guest is mailed a
+// link to manage the reservation.
+func APIEventReservationsCreate(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	event := &models.Event{}
+
+	err := tx.Find(event, c.Param("id"))
+	if err != nil {
+		return apiLookupFailed(c, err, "event")
+	}
+
+	req := &APIReservationForm{}
+	if err := apiBind(c, req); err != nil {
+		return err
+	}
+	req.Email = strings.TrimSpace(req.Email)
+
+	verrs := validate.Validate(
+		&validators.EmailIsPresent{Field: req.Email, Name: "Email"},
+		&validators.StringLengthInRange{Field: req.FullName, Name: "FullName", Max: 255},
+	)
+	if verrs.HasAny() {
+		return apiInvalid(c, verrs)
+	}
+
+	if event.IsCancelled() {
+		return apiFail(c, http.StatusConflict, "event has been cancelled")
+	}
+
+	guest, res, err := reserveGuest(tx, event, req.Email, req.FullName)
+	if err != nil {
+		if errors.Is(err, errDuplicateReservation) {
+			return apiFail(c, http.StatusConflict, "a reservation already exists for "+req.Email)
+		}
+		return apiServerError(c, err)
+	}
+
+	sendReservationLink(c, event, guest, res)
+
+	res.Guest = guest
+	return c.Render(http.StatusCreated, r.JSON(res))
+}
+
+// apiReservation loads the reservation in the id param, with its guest and
+// event, if the current user manages that event.
+func apiReservation(next func(buffalo.Context, *models.EventAttendee) error) buffalo.Handler {
+	return func(c buffalo.Context) error {
+		tx := c.Value("tx").(*pop.Connection)
+		res := &models.EventAttendee{}
+
+		err := tx.Eager("Guest", "Event.Organizers").Find(res, c.Param("id"))
+		if err != nil {
+			return apiLookupFailed(c, err, "reservation")
+		}
+
+		if !res.Event.CanManage(currentUser(c)) {
+			return apiFail(c, http.StatusForbidden, "not allowed to manage this event")
+		}
+		return next(c, res)
+	}
+}
+
+// APIReservationsShow returns GET for one reservation.
+func APIReservationsShow(c buffalo.Context) error {
+	return apiReservation(func(c buffalo.Context, res *models.EventAttendee) error {
+		return c.Render(http.StatusOK, r.JSON(res))
+	})(c)
+}
+
+// APIReservationUpdateForm is the payload for changing an RSVP.
+type APIReservationUpdateForm struct {
+	RSVP string `json:"rsvp"`
+}
+
+// APIReservationsUpdate responds to PUT or PATCH to change a reservation's
+// RSVP. Seats freed up go to the waitlist.
+func APIReservationsUpdate(c buffalo.Context) error {
+	return apiReservation(func(c buffalo.Context, res *models.EventAttendee) error {
+		tx := c.Value("tx").(*pop.Connection)
+
+		req := &APIReservationUpdateForm{}
+		if err := apiBind(c, req); err != nil {
+			return err
+		}
+
+		if res.Event.IsCancelled() {
+			return apiFail(c, http.StatusConflict, "event has been cancelled")
+		}
+
+		_, err := models.SetRSVP(tx, res, req.RSVP)
+		if err != nil {
+			var verrs *validate.Errors
+			if errors.As(err, &verrs) {
+				return apiInvalid(c, verrs)
+			}
+			return apiServerError(c, err)
+		}
+		return c.Render(http.StatusOK, r.JSON(res))
+	})(c)
+}
+
+// APIReservationsDestroy responds to DELETE to drop a reservation.
+func APIReservationsDestroy(c buffalo.Context) error {
+	return apiReservation(func(c buffalo.Context, res *models.EventAttendee) error {
+		tx := c.Value("tx").(*pop.Connection)
+
+		_, err := models.CancelReservation(tx, res)
+		if err != nil {
+			return apiServerError(c, err)
+		}
+		return c.Render(http.StatusNoContent, nil)
+	})(c)
+}
@@ -0,0 +1,150 @@
+package actions
+
+import (
+	"net/http"
+
+	"github.com/gobuffalo/nulls"
+
+	"event_planner/models"
+)
+
+func (as *ActionSuite) Test_API_Events_CRUD() {
+	res := as.JSON("/api/v1/events").Post(map[string]interface{}{"title": "Quiz night"})
+	as.Equal(http.StatusUnauthorized, res.Code)
+	as.Contains(res.Body.String(), `"error":"authentication required"`)
+
+	u, err := as.createUser()
+	as.NoError(err)
+	as.signIn(u)
+
+	res = as.JSON("/api/v1/events").Post(map[string]interface{}{"description": "No title"})
+	as.Equal(http.StatusUnprocessableEntity, res.Code)
+	as.Contains(res.Body.String(), `"title":[`)
+
+	event := &models.Event{}
+	res = as.JSON("/api/v1/events").Post(map[string]interface{}{
+		"title":  "Quiz night",
+		"date":   "2030-01-02T19:00:00Z",
+		"status": models.EventStatusCancelled,
+	})
+	as.Equal(http.StatusCreated, res.Code)
+	res.Bind(event)
+	as.Equal("Quiz night", event.Title)
+	as.Equal(models.EventStatusScheduled, event.Status)
+	as.NotContains(res.Body.String(), "owner_id")
+	as.NoError(as.DB.Reload(event))
+	as.Equal(u.ID, event.OwnerID.UUID)
+	createdAt := event.CreatedAt
+
+	res = as.JSON("/api/v1/events/%s", event.ID).Patch(map[string]interface{}{"location": "The Crown", "created_at": "2001-01-01T00:00:00Z"})
+	as.Equal(http.StatusOK, res.Code)
+	as.NoError(as.DB.Reload(event))
+	as.Equal("The Crown", event.Location)
+	as.Equal("Quiz night", event.Title)
+	as.Equal(createdAt, event.CreatedAt)
+
+	res = as.JSON("/api/v1/events/%s", event.ID).Delete()
+	as.Equal(http.StatusNoContent, res.Code)
+
+	res = as.JSON("/api/v1/events/%s", event.ID).Get()
+	as.Equal(http.StatusNotFound, res.Code)
+	as.Contains(res.Body.String(), `"error":"event not found"`)
+}
+
+func (as *ActionSuite) Test_API_Events_Forbidden() {
+	owner, err := as.createUser()
+	as.NoError(err)
+	stranger := &models.User{Email: "stranger@example.com", Password: "password", PasswordConfirmation: "password"}
+	verrs, err := stranger.Create(as.DB)
+	as.NoError(err)
+	as.False(verrs.HasAny())
+
+	e := as.createEvent()
+	e.OwnerID = nulls.NewUUID(owner.ID)
+	as.NoError(as.DB.Update(e))
+
+	as.signIn(stranger)
+	res := as.JSON("/api/v1/events/%s", e.ID).Put(map[string]interface{}{"title": "Mine now"})
+	as.Equal(http.StatusForbidden, res.Code)
+
+	res = as.JSON("/api/v1/events/%s/reservations", e.ID).Get()
+	as.Equal(http.StatusForbidden, res.Code)
+}
+
+func (as *ActionSuite) Test_API_Reservations() {
+	e := as.createEvent()
+	e.Capacity = 1
+	as.NoError(as.DB.Update(e))
+
+	res := as.JSON("/api/v1/events/%s/reservations", e.ID).Post(&APIReservationForm{Email: "nope"})
+	as.Equal(http.StatusUnprocessableEntity, res.Code)
+	as.Contains(res.Body.String(), `"email":[`)
+
+	first := &models.EventAttendee{}
+	res = as.JSON("/api/v1/events/%s/reservations", e.ID).Post(&APIReservationForm{Email: "a@example.com", FullName: "A"})
+	as.Equal(http.StatusCreated, res.Code)
+	res.Bind(first)
+	as.Equal(models.AttendeeStatusConfirmed, first.Status)
+
+	second := &models.EventAttendee{}
+	res = as.JSON("/api/v1/events/%s/reservations", e.ID).Post(&APIReservationForm{Email: "b@example.com", FullName: "B"})
+	as.Equal(http.StatusCreated, res.Code)
+	res.Bind(second)
+	as.Equal(models.AttendeeStatusWaitlisted, second.Status)
+
+	res = as.JSON("/api/v1/events/%s/reservations", e.ID).Post(&APIReservationForm{Email: "a@example.com"})
+	as.Equal(http.StatusConflict, res.Code)
+
+	u, err := as.createUser()
+	as.NoError(err)
+	as.signIn(u)
+
+	res = as.JSON("/api/v1/reservations/%s", first.ID).Put(&APIReservationUpdateForm{RSVP: "sometimes"})
+	as.Equal(http.StatusUnprocessableEntity, res.Code)
+
+	res = as.JSON("/api/v1/reservations/%s", first.ID).Put(&APIReservationUpdateForm{RSVP: models.RSVPDeclined})
+	as.Equal(http.StatusOK, res.Code)
+
+	as.NoError(as.DB.Reload(second))
+	as.Equal(models.AttendeeStatusConfirmed, second.Status)
+
+	res = as.JSON("/api/v1/reservations/%s", second.ID).Delete()
+	as.Equal(http.StatusNoContent, res.Code)
+}
+
+func (as *ActionSuite) Test_API_Guests() {
+	u, err := as.createUser()
+	as.NoError(err)
+	as.signIn(u)
+
+	res := as.JSON("/api/v1/guests").Get()
+	as.Equal(http.StatusForbidden, res.Code)
+
+	admin := as.createUserWithRole("admin@example.com", models.RoleAdmin)
+	as.signIn(admin)
+
+	guest := &models.Guest{}
+	res = as.JSON("/api/v1/guests").Post(map[string]string{"email": "bob@example.com", "full_name": "Bob"})
+	as.Equal(http.StatusCreated, res.Code)
+	res.Bind(guest)
+
+	res = as.JSON("/api/v1/guests").Post(map[string]string{"email": "bob@example.com"})
+	as.Equal(http.StatusConflict, res.Code)
+
+	res = as.JSON("/api/v1/guests/%s", guest.ID).Patch(map[string]string{"full_name": "Robert"})
+	as.Equal(http.StatusOK, res.Code)
+	as.NoError(as.DB.Reload(guest))
+	as.Equal("Robert", guest.FullName)
+	as.Equal("bob@example.com", guest.Email)
+
+	e := as.createEvent()
+	_, err = models.Reserve(as.DB, e.ID, guest.ID)
+	as.NoError(err)
+
+	res = as.JSON("/api/v1/guests/%s", guest.ID).Delete()
+	as.Equal(http.StatusNoContent, res.Code)
+
+	count, err := as.DB.Count("event_attendees")
+	as.NoError(err)
+	as.Equal(0, count)
+}
@@ -5,6 +5,7 @@ import (
 	"sync"
 
 	"event_planner/locales"
+	"event_planner/lockout"
 	"event_planner/models"
 	"event_planner/public"
 
@@ -14,7 +15,7 @@ import (
 	"github.com/gobuffalo/middleware/forcessl"
 	"github.com/gobuffalo/middleware/i18n"
 	"github.com/gobuffalo/middleware/paramlogger"
-	csrf "github.com/gobuffalo/mw-csrf"
+	"github.com/pkg/errors"
 	"github.com/unrolled/secure"
 )
 
@@ -48,6 +49,11 @@ func App() *buffalo.App {
 			SessionName: "_event_planner_session",
 		})
 
+		// Signed links (reservation management, etc.) need a real secret.
+		if len(signingKey()) == 0 {
+			app.Stop(errors.New("SESSION_SECRET must be set to sign links"))
+		}
+
 		// Automatically redirect to SSL
 		app.Use(forceSSL())
 
@@ -55,8 +61,9 @@ func App() *buffalo.App {
 		app.Use(paramlogger.ParameterLogger)
 
 		// Protect against CSRF attacks. https://www.owasp.org/index.php/Cross-Site_Request_Forgery_(CSRF)
-		// Remove to disable this.
-		app.Use(csrf.New)
+		// Remove to disable this. Requests authenticated with an API token
+		// are exempt.
+		app.Use(csrfUnlessToken)
 
 		// Wraps each request in a transaction.
 		app.Use(popmw.Transaction(models.DB))
@@ -67,41 +74,193 @@ func App() *buffalo.App {
 		app.GET("/events", EventsListHandler)
 		app.GET("/events-remote", EventsRemoteHandler)
 		app.GET("/events/json", EventsListJSONHandler) // JSON route only to feed the Vue component
-		app.GET("/events/new", Authorize(EventNewHandler))
-		app.POST("/events/new", Authorize(EventCreateHandler))
+		app.GET("/events.ics", EventsICSHandler)
+		app.GET("/events/new", Authorize(RequireRole(models.RoleOrganizer)(RequireVerified(EventNewHandler))))
+		app.POST("/events/new", Authorize(RequireRole(models.RoleOrganizer)(RequireVerified(EventCreateHandler))))
+		app.GET("/events/{id}/edit", Authorize(AuthorizeEventManager(EventEditHandler)))
+		app.POST("/events/{id}/edit", Authorize(AuthorizeEventManager(EventUpdateHandler)))
+		app.POST("/events/{id}/cancel", Authorize(AuthorizeEventManager(EventCancelHandler)))
+		app.DELETE("/events/{id}", Authorize(AuthorizeEventOwner(EventDeleteHandler)))
+		app.DELETE("/events/{id}/guests/{guest_id}", Authorize(AuthorizeEventManager(EventRemoveGuestHandler)))
+		app.POST("/events/{id}/organizers", Authorize(AuthorizeEventOwner(EventAddOrganizerHandler)))
+		app.DELETE("/events/{id}/organizers/{organizer_id}", Authorize(AuthorizeEventOwner(EventRemoveOrganizerHandler)))
+		app.GET("/events/{id}/guests/import", Authorize(AuthorizeEventManager(EventImportGuestsHandler)))
+		app.POST("/events/{id}/guests/import", Authorize(AuthorizeEventManager(EventImportGuestsCreateHandler)))
+		app.GET("/events/{id}/guests.csv", Authorize(AuthorizeEventManager(EventGuestsCSVHandler)))
+		app.GET("/events/{id}/guests.xlsx", Authorize(AuthorizeEventManager(EventGuestsXLSXHandler)))
+		app.GET("/events/{id}/check-in", Authorize(AuthorizeEventManager(EventCheckInHandler)))
+		app.POST("/events/{id}/check-in", Authorize(AuthorizeEventManager(EventCheckInCreateHandler)))
+		app.GET("/events/{id}/check-in.json", Authorize(AuthorizeEventManager(EventCheckInCountsHandler)))
 		app.GET("/events/{id}/add-guest", EventNewGuestHandler)
 		app.POST("/events/{id}/add-guest", EventAddGuestHandler)
+		app.GET("/events/{id}.ics", EventICSHandler) // must come before /events/{id}
 		app.GET("/events/{id}", EventDetailHandler)
 
+		app.GET("/reservations/{id}", ReservationHandler)
+		app.POST("/reservations/{id}", ReservationUpdateHandler)
+		app.POST("/reservations/{id}/name", ReservationNameHandler)
+		app.GET("/guests/{id}/calendar.ics", GuestCalendarHandler)
+		app.GET("/tickets/{token}", TicketHandler)
+		app.GET("/check-in/{token}", Authorize(CheckInGuestHandler))
+
 		app.GET("/app", AppHandler)
 		app.POST("/app/add-guest", AppFormHandler)
 
 		// AuthMiddleware
-		s := MockSender{}
+		s, err := NewRecoverySender()
+		if err != nil {
+			app.Stop(err)
+		}
 		app.Use(SetupRecoverySender(s))
+
+		// Mail is queued in the database and delivered through the sender
+		// by a background job.
+		if err := registerOutboxWorker(app.Worker, s); err != nil {
+			app.Stop(err)
+		}
+
+		// Guests are reminded of their events by another job, which sends
+		// straight through the sender so a reminder is never repeated.
+		offsets, err := NewReminderOffsets()
+		if err != nil {
+			app.Stop(err)
+		}
+		if err := registerReminderWorker(app.Worker, s, offsets); err != nil {
+			app.Stop(err)
+		}
+
+		// Repeating events with no end are generated a year ahead, and
+		// topped up by a job.
+		if err := registerSeriesWorker(app.Worker); err != nil {
+			app.Stop(err)
+		}
+
+		// Logins are recorded server-side and time out.
+		policy, err := NewSessionPolicy()
+		if err != nil {
+			app.Stop(err)
+		}
+		app.Use(SetupSessionPolicy(policy))
 		app.Use(SetCurrentUser)
 		// app.Use(Authorize)
 
+		// Failed logins and recovery codes lock accounts and addresses out
+		// for a while.
+		attempts, err := NewAttemptStore()
+		if err != nil {
+			app.Stop(err)
+		}
+		app.Use(SetupThrottle(lockout.Throttle{Store: attempts}))
+
+		// Single sign-on through an OpenID Connect provider, next to or
+		// instead of passwords.
+		sso, err := NewOIDCLogin()
+		if err != nil {
+			app.Stop(err)
+		}
+		if sso == nil && !passwordLogin {
+			app.Stop(errors.New("PASSWORD_LOGIN=false needs OIDC_ISSUER to be set"))
+		}
+		app.Use(SetupOIDC(sso))
+
 		// Routes for Auth
 		auth := app.Group("/login")
 		auth.GET("/", AuthNew)
-		auth.POST("/", AuthCreate)
+		auth.POST("/", RequirePasswordLogin(AuthCreate))
 		auth.DELETE("/", AuthDestroy)
+		auth.GET("/two-factor", AuthTwoFactorNew)
+		auth.POST("/two-factor", AuthTwoFactor)
+		auth.GET("/oidc", OIDCStart)
+		auth.GET("/oidc/callback", OIDCCallback)
 
 		// Password recovery
-		app.GET("/password_reset", PasswordResetForm)
-		app.POST("/password_reset", PasswordReset)
-		app.GET("/account_recovery", AccountRecoveryForm)
-		app.POST("/account_recovery", AccountRecovery)
+		app.GET("/password_reset", RequirePasswordLogin(PasswordResetForm))
+		app.POST("/password_reset", RequirePasswordLogin(PasswordReset))
+		app.GET("/account_recovery", RequirePasswordLogin(AccountRecoveryForm))
+		app.POST("/account_recovery", RequirePasswordLogin(AccountRecovery))
+		app.GET("/account_recovery/{token}", RequirePasswordLogin(AccountRecoveryLinkForm))
+		app.POST("/account_recovery/{token}", RequirePasswordLogin(AccountRecoveryLink))
 		// auth.Middleware.Skip(Authorize, AuthLanding, AuthNew, AuthCreate, PasswordResetForm, PasswordReset, AccountRecoveryForm, AccountRecovery)
 
+		// The current user's account.
+		app.GET("/user", Authorize(RequireSession(UserPage)))
+		app.POST("/user/email", Authorize(RequireSession(UserEmailUpdate)))
+		app.POST("/user/password", Authorize(RequireSession(RequirePasswordLogin(UserPasswordUpdate))))
+		app.DELETE("/user", Authorize(RequireSession(UserDestroy)))
+
 		// Routes for User registration
-		// app.GET("/user", UserPage) // this is behind auth. Shows current user.
 		users := app.Group("/users")
-		users.GET("/new", UsersNew)
-		users.POST("/", UsersCreate)
+		users.GET("/new", RequirePasswordLogin(UsersNew))
+		users.POST("/", RequirePasswordLogin(UsersCreate))
+		users.GET("/verify", Authorize(UsersVerifyPage))
+		users.POST("/verify", Authorize(UsersVerifyResend))
+		users.GET("/verify/{id}", UsersVerify)
 		// users.Middleware.Remove(Authorize)
 
+		// Personal access tokens for scripts and API clients.
+		app.GET("/account/tokens", Authorize(RequireSession(TokensIndex)))
+		app.POST("/account/tokens", Authorize(RequireSession(TokensCreate)))
+		app.DELETE("/account/tokens/{id}", Authorize(RequireSession(TokensRevoke)))
+
+		// Active logins, with revoke buttons.
+		app.GET("/account/sessions", Authorize(RequireSession(SessionsIndex)))
+		app.DELETE("/account/sessions", Authorize(RequireSession(SessionsRevokeAll)))
+		app.DELETE("/account/sessions/{id}", Authorize(RequireSession(SessionsRevoke)))
+
+		// Optional two-factor authentication.
+		app.GET("/account/two-factor", Authorize(RequireSession(TwoFactorIndex)))
+		app.POST("/account/two-factor", Authorize(RequireSession(TwoFactorSetup)))
+		app.POST("/account/two-factor/enable", Authorize(RequireSession(TwoFactorEnable)))
+		app.POST("/account/two-factor/backup-codes", Authorize(RequireSession(TwoFactorBackupCodes)))
+		app.DELETE("/account/two-factor", Authorize(RequireSession(TwoFactorDisable)))
+
+		// Back office. Admins can also manage every event through the
+		// regular event pages. API tokens don't reach it.
+		admin := app.Group("/admin")
+		admin.Use(Authorize, RequireSession, RequireRole(models.RoleAdmin))
+		admin.GET("/", AdminIndex)
+		admin.GET("/users", AdminUsersIndex)
+		admin.POST("/users/reset-recovery", AdminUsersResetRecoveryHandler)
+		admin.GET("/users/{id}", AdminUserHandler)
+		admin.POST("/users/{id}/role", AdminUserRoleHandler)
+		admin.POST("/users/{id}/unlock", AdminUserUnlockHandler)
+		admin.POST("/users/{id}/two-factor/reset", AdminUserTwoFactorResetHandler)
+		admin.GET("/events", AdminEventsIndex)
+		admin.GET("/guests", AdminGuestsIndex)
+		admin.POST("/guests/delete", AdminGuestsDeleteHandler)
+		admin.GET("/guests/duplicates", AdminGuestDuplicatesHandler)
+		admin.POST("/guests/merge", AdminGuestsMergeHandler)
+		admin.GET("/guests/{id}", AdminGuestHandler)
+		admin.GET("/reservations", AdminReservationsIndex)
+		admin.POST("/reservations/move", AdminReservationsMoveHandler)
+		admin.GET("/reservations/{id}", AdminReservationHandler)
+		admin.GET("/audit", AdminAuditIndex)
+
+		// JSON API. Errors come back as APIError bodies with proper status
+		// codes rather than redirects.
+		api := app.Group("/api/v1")
+		api.GET("/events", APIEventsList)
+		api.POST("/events", APIAuthorize(APIRequireRole(models.RoleOrganizer)(APIRequireVerified(APIEventsCreate))))
+		api.GET("/events/{id}", APIEventsShow)
+		api.PUT("/events/{id}", APIAuthorize(APIEventManager(APIEventsUpdate)))
+		api.PATCH("/events/{id}", APIAuthorize(APIEventManager(APIEventsUpdate)))
+		api.POST("/events/{id}/cancel", APIAuthorize(APIEventManager(APIEventsCancel)))
+		api.DELETE("/events/{id}", APIAuthorize(APIEventOwner(APIEventsDestroy)))
+		api.GET("/events/{id}/reservations", APIAuthorize(APIEventManager(APIEventReservationsList)))
+		api.POST("/events/{id}/reservations", APIEventReservationsCreate)
+		api.GET("/events/{id}/check-ins", APIAuthorize(APIEventManager(APIEventCheckInsShow)))
+		api.POST("/events/{id}/check-ins", APIAuthorize(APIEventManager(APIEventCheckInsCreate)))
+		api.GET("/reservations/{id}", APIAuthorize(APIReservationsShow))
+		api.PUT("/reservations/{id}", APIAuthorize(APIReservationsUpdate))
+		api.PATCH("/reservations/{id}", APIAuthorize(APIReservationsUpdate))
+		api.DELETE("/reservations/{id}", APIAuthorize(APIReservationsDestroy))
+		api.GET("/guests", APIAuthorize(APIRequireRole(models.RoleAdmin)(APIGuestsList)))
+		api.POST("/guests", APIAuthorize(APIRequireRole(models.RoleAdmin)(APIGuestsCreate)))
+		api.GET("/guests/{id}", APIAuthorize(APIRequireRole(models.RoleAdmin)(APIGuestsShow)))
+		api.PUT("/guests/{id}", APIAuthorize(APIRequireRole(models.RoleAdmin)(APIGuestsUpdate)))
+		api.PATCH("/guests/{id}", APIAuthorize(APIRequireRole(models.RoleAdmin)(APIGuestsUpdate)))
+		api.DELETE("/guests/{id}", APIAuthorize(APIRequireRole(models.RoleAdmin)(APIGuestsDestroy)))
+
 		app.ServeFiles("/", http.FS(public.FS())) // serve files from the public directory
 	})
 
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gobuffalo/buffalo"
 	"github.com/gobuffalo/pop/v6"
@@ -33,25 +34,51 @@ func AuthCreate(c buffalo.Context) error {
 	}
 
 	tx := c.Value("tx").(*pop.Connection)
-
-	// find a user with the email
-	err := tx.Where("email = ?", strings.ToLower(strings.TrimSpace(u.Email))).First(u)
+	email := strings.ToLower(strings.TrimSpace(u.Email))
+	keys := []string{accountKey(email), ipKey(clientIP(c))}
 
 	// helper function to handle bad attempts
-	bad := func() error {
+	bad := func(status int, msg string) error {
 		verrs := validate.NewErrors()
-		verrs.Add("email", "invalid email/password")
+		verrs.Add("email", msg)
 
 		c.Set("errors", verrs)
 		c.Set("user", u)
 
-		return c.Render(http.StatusUnauthorized, r.HTML("auth/new.plush.html"))
+		return c.Render(status, r.HTML("auth/new.plush.html"))
 	}
 
+	// Locked out accounts and addresses don't get a password check, so
+	// guesses made during a lockout are worthless.
+	until, err := lockedUntil(c, keys...)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if !until.IsZero() {
+		audit(c, models.AuditLoginBlocked, email, nil, "")
+		return bad(http.StatusTooManyRequests, waitMessage(until))
+	}
+
+	// failed counts the attempt against the account and the address.
+	failed := func(found *models.User) error {
+		audit(c, models.AuditLoginFailed, email, found, "")
+		_, err := failAttempt(c, keys[0], accountLockout, models.AuditAccountLocked, email, found)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		_, err = failAttempt(c, keys[1], ipLockout, models.AuditIPLocked, email, found)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		return bad(http.StatusUnauthorized, "invalid email/password")
+	}
+
+	// find a user with the email
+	err = tx.Where("email = ?", email).First(u)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			// Couldn't find an user with the supplied email address.
-			return bad()
+			return failed(nil)
 		}
 		return errors.WithStack(err)
 	}
@@ -59,9 +86,35 @@ func AuthCreate(c buffalo.Context) error {
 	// Confirm that the given password matches the hashed password from the db.
 	err = bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(u.Password))
 	if err != nil {
-		return bad()
+		return failed(u)
+	}
+
+	// The failure count is only cleared once the second step passes, so
+	// knowing the password doesn't buy more guesses at the code.
+	if u.HasTwoFactor() {
+		return startTwoFactor(c, u, "password")
+	}
+
+	return logIn(c, u, "password")
+}
+
+// logIn starts a session for u once every login step has passed. The
+// address keeps its failure count, or one valid account would let a client
+// wipe it between guesses at others.
+func logIn(c buffalo.Context, u *models.User, method string) error {
+	err := throttle(c).Reset(accountKey(u.Email))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	audit(c, models.AuditLoginSucceeded, u.Email, u, method)
+
+	c.Session().Delete(pendingUserKey)
+	c.Session().Delete(pendingAtKey)
+	c.Session().Delete(pendingMethodKey)
+	err = startSession(c, u, method)
+	if err != nil {
+		return errors.WithStack(err)
 	}
-	c.Session().Set("current_user_id", u.ID)
 	c.Flash().Add("success", "Welcome Back to event-planner!")
 
 	redirectURL := "/"
@@ -74,6 +127,13 @@ func AuthCreate(c buffalo.Context) error {
 
 // AuthDestroy clears the session and logs a user out
 func AuthDestroy(c buffalo.Context) error {
+	if s := currentSession(c); s != nil {
+		tx := c.Value("tx").(*pop.Connection)
+		err := s.Revoke(tx, time.Now().UTC())
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
 	c.Session().Clear()
 	c.Flash().Add("success", "You have been logged out!")
 	return c.Redirect(http.StatusFound, "/")
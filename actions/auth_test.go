@@ -1,7 +1,11 @@
 package actions
 
 import (
+	"fmt"
 	"net/http"
+	"time"
+
+	"github.com/gobuffalo/nulls"
 
 	"event_planner/models"
 )
@@ -11,6 +15,8 @@ func (as *ActionSuite) createUser() (*models.User, error) {
 		Email:                "mark@example.com",
 		Password:             "password",
 		PasswordConfirmation: "password",
+		Role:                 models.RoleOrganizer,
+		VerifiedAt:           nulls.NewTime(time.Now()),
 	}
 
 	verrs, err := u.Create(as.DB)
@@ -20,6 +26,14 @@ func (as *ActionSuite) createUser() (*models.User, error) {
 	return u, err
 }
 
+// signIn logs u in as if through the login form.
+func (as *ActionSuite) signIn(u *models.User) {
+	s, err := models.NewUserSession(as.DB, u.ID, "test", "127.0.0.1", "password", time.Now().UTC())
+	as.NoError(err)
+	as.Session.Set("current_user_id", u.ID)
+	as.Session.Set(sessionIDKey, s.ID)
+}
+
 func (as *ActionSuite) Test_Auth_Signin() {
 	res := as.HTML("/auth/").Get()
 	as.Equal(http.StatusOK, res.Code)
@@ -88,3 +102,61 @@ func (as *ActionSuite) Test_Auth_Redirect() {
 		})
 	}
 }
+
+func (as *ActionSuite) Test_Auth_Lockout() {
+	u, err := as.createUser()
+	as.NoError(err)
+
+	for i := 0; i < accountLockout.MaxFailures; i++ {
+		res := as.HTML("/login").Post(&models.User{Email: u.Email, Password: "wrong"})
+		as.Equal(http.StatusUnauthorized, res.Code)
+	}
+
+	// The right password doesn't help while the account is locked.
+	res := as.HTML("/login").Post(&models.User{Email: " MARK@example.com", Password: "password"})
+	as.Equal(http.StatusTooManyRequests, res.Code)
+	as.Contains(res.Body.String(), "Too many failed attempts")
+
+	count, err := as.DB.Where("action = ? AND user_id = ?", models.AuditAccountLocked, u.ID).Count(&models.AuditEvent{})
+	as.NoError(err)
+	as.Equal(1, count)
+	count, err = as.DB.Where("action = ?", models.AuditLoginBlocked).Count(&models.AuditEvent{})
+	as.NoError(err)
+	as.Equal(1, count)
+
+	// Unknown accounts lock the same way, so lockouts don't tell which
+	// emails exist.
+	for i := 0; i < accountLockout.MaxFailures; i++ {
+		as.HTML("/login").Post(&models.User{Email: "nobody@example.com", Password: "wrong"})
+	}
+	res = as.HTML("/login").Post(&models.User{Email: "nobody@example.com", Password: "wrong"})
+	as.Equal(http.StatusTooManyRequests, res.Code)
+}
+
+func (as *ActionSuite) Test_Auth_LockoutPerIP() {
+	u, err := as.createUser()
+	as.NoError(err)
+
+	for i := 0; i < ipLockout.MaxFailures; i++ {
+		res := as.HTML("/login").Post(&models.User{Email: fmt.Sprintf("user%d@example.com", i), Password: "wrong"})
+		as.Equal(http.StatusUnauthorized, res.Code)
+	}
+
+	res := as.HTML("/login").Post(&models.User{Email: u.Email, Password: "password"})
+	as.Equal(http.StatusTooManyRequests, res.Code)
+}
+
+func (as *ActionSuite) Test_Auth_SuccessResetsFailures() {
+	u, err := as.createUser()
+	as.NoError(err)
+
+	for i := 0; i < accountLockout.MaxFailures-1; i++ {
+		as.HTML("/login").Post(&models.User{Email: u.Email, Password: "wrong"})
+	}
+	res := as.HTML("/login").Post(&models.User{Email: u.Email, Password: "password"})
+	as.Equal(http.StatusFound, res.Code)
+
+	as.Session.Clear()
+	res = as.HTML("/login").Post(&models.User{Email: u.Email, Password: "wrong"})
+	as.Equal(http.StatusUnauthorized, res.Code)
+}
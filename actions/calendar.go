@@ -0,0 +1,116 @@
+package actions
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/gobuffalo/pop/v6"
+	"github.com/pkg/errors"
+
+	"event_planner/ical"
+	"event_planner/models"
+)
+
+const calendarTokenPurpose = "calendar"
+
+// calendarURL is the guest's personal feed. Like the reservation link it
+// is only mailed to the guest.
+func calendarURL(guest *models.Guest) string {
+	id := guest.ID.String()
+	return absoluteURL("/guests/" + id + "/calendar.ics?token=" + signToken(calendarTokenPurpose, id))
+}
+
+// icalEvent maps an event onto a VEVENT. The UID is derived from the event
+// ID so every feed and download refers to the same calendar entry.
+func icalEvent(e models.Event) ical.Event {
+	status := ical.StatusConfirmed
+	if e.IsCancelled() {
+		status = ical.StatusCancelled
+	}
+	return ical.Event{
+		UID:          e.ID.String() + "@event_planner",
+		Sequence:     e.Sequence,
+		Start:        e.Date,
+		End:          e.EndsAt(),
+		Summary:      e.Title,
+		Description:  e.Description,
+		Location:     e.Location,
+		URL:          absoluteURL(e.ToLink()),
+		Status:       status,
+		Created:      e.CreatedAt,
+		LastModified: e.UpdatedAt,
+	}
+}
+
+// renderCalendar writes the events as an iCalendar file named filename.
+func renderCalendar(c buffalo.Context, name, filename string, events models.Events) error {
+	cal := ical.Calendar{Name: name, Method: "PUBLISH"}
+	for _, e := range events {
+		cal.Events = append(cal.Events, icalEvent(e))
+	}
+
+	c.Response().Header().Set("Content-Disposition", `inline; filename="`+filename+`"`)
+	return c.Render(http.StatusOK, r.Func(ical.ContentType, func(w io.Writer, _ render.Data) error {
+		_, err := cal.WriteTo(w)
+		return err
+	}))
+}
+
+// EventICSHandler returns GET for one event as an .ics file.
+func EventICSHandler(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	event := models.Event{}
+
+	err := tx.Find(&event, c.Param("id"))
+	if err != nil {
+		log.Printf("error finding event %s", err)
+		return c.Error(http.StatusNotFound, err)
+	}
+
+	return renderCalendar(c, event.Title, "event-"+event.ID.String()+".ics", models.Events{event})
+}
+
+// EventsICSHandler returns GET for a subscribable feed of upcoming events.
+// Cancelled events stay in the feed so subscribers see them called off.
+func EventsICSHandler(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	events := models.Events{}
+
+	// Keep a day of history so events in progress don't drop out.
+	err := tx.Where("event_date >= ?", time.Now().Add(-24*time.Hour)).Order("event_date").All(&events)
+	if err != nil {
+		log.Print(err)
+		return c.Error(http.StatusInternalServerError, err)
+	}
+
+	return renderCalendar(c, "Upcoming events", "events.ics", events)
+}
+
+// GuestCalendarHandler returns GET for a guest's personal feed of the
+// events they are attending. The link is signed since guests have no login.
+func GuestCalendarHandler(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	guest := &models.Guest{}
+
+	if !verifyToken(calendarTokenPurpose, c.Param("id"), c.Param("token")) {
+		return c.Error(http.StatusNotFound, errors.New("invalid calendar token"))
+	}
+
+	err := tx.Find(guest, c.Param("id"))
+	if err != nil {
+		log.Printf("error finding guest %s", err)
+		return c.Error(http.StatusNotFound, err)
+	}
+
+	err = guest.LoadAttendingEvents(tx)
+	if err != nil {
+		log.Print(err)
+		return c.Error(http.StatusInternalServerError, err)
+	}
+
+	return renderCalendar(c, "My events", "my-events.ics", guest.AttendingEvents)
+}
@@ -0,0 +1,50 @@
+package actions
+
+import (
+	"net/http"
+
+	"event_planner/models"
+)
+
+func (as *ActionSuite) Test_Calendar_Event() {
+	e := as.createEvent()
+
+	res := as.HTML("/events/%s.ics", e.ID).Get()
+	as.Equal(http.StatusOK, res.Code)
+	as.Contains(res.Header().Get("Content-Type"), "text/calendar")
+	as.Contains(res.Body.String(), "UID:"+e.ID.String()+"@event_planner")
+	as.Contains(res.Body.String(), "SEQUENCE:0")
+
+	e.Cancel("Snow")
+	as.NoError(as.DB.Update(e))
+
+	res = as.HTML("/events/%s.ics", e.ID).Get()
+	as.Contains(res.Body.String(), "SEQUENCE:1")
+	as.Contains(res.Body.String(), "STATUS:CANCELLED")
+
+	res = as.HTML("/events.ics").Get()
+	as.Equal(http.StatusOK, res.Code)
+	as.Contains(res.Body.String(), e.ID.String())
+}
+
+func (as *ActionSuite) Test_Calendar_GuestFeed() {
+	going := as.createEvent()
+	declined := as.createEvent()
+	g := &models.Guest{Email: "bob@example.com", FullName: "Bob"}
+	as.NoError(as.DB.Create(g))
+	_, err := models.Reserve(as.DB, going.ID, g.ID)
+	as.NoError(err)
+	r2, err := models.Reserve(as.DB, declined.ID, g.ID)
+	as.NoError(err)
+	_, err = models.SetRSVP(as.DB, r2, models.RSVPDeclined)
+	as.NoError(err)
+
+	res := as.HTML("/guests/%s/calendar.ics?token=forged", g.ID).Get()
+	as.Equal(http.StatusNotFound, res.Code)
+
+	token := signToken(calendarTokenPurpose, g.ID.String())
+	res = as.HTML("/guests/%s/calendar.ics?token=%s", g.ID, token).Get()
+	as.Equal(http.StatusOK, res.Code)
+	as.Contains(res.Body.String(), going.ID.String())
+	as.NotContains(res.Body.String(), declined.ID.String())
+}
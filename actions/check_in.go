@@ -0,0 +1,208 @@
+package actions
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/pop/v6"
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+
+	"event_planner/models"
+	"event_planner/qrcode"
+)
+
+// ticketURL is the guest's ticket page. The check-in token in it is the
+// ticket, so like the reservation link it is only mailed to the guest.
+func ticketURL(res *models.EventAttendee) string {
+	return absoluteURL("/tickets/" + res.CheckInToken)
+}
+
+// checkInURL is what the ticket's QR code holds. An organizer scanning it
+// with their phone lands on the page to check the guest in.
+func checkInURL(res *models.EventAttendee) string {
+	return absoluteURL("/check-in/" + res.CheckInToken)
+}
+
+// ticketToken picks the check-in token out of what a scanner read, which
+// may be the whole URL from the QR code or the bare token.
+func ticketToken(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexAny(s, "?#"); i >= 0 {
+		s = s[:i]
+	}
+	return s[strings.LastIndex(s, "/")+1:]
+}
+
+// TicketHandler returns GET for a guest's ticket, with the QR code to show
+// at the door.
+func TicketHandler(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+
+	res, err := models.FindReservationByCheckInToken(tx, c.Param("token"))
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("error finding ticket %s", err)
+		}
+		c.Flash().Add("danger", "That ticket is not valid.")
+		return c.Redirect(http.StatusFound, "/")
+	}
+
+	if res.IsAdmitted() && !res.Event.IsCancelled() {
+		qr, err := qrcode.DataURI(checkInURL(res), 240)
+		if err != nil {
+			log.Printf("error drawing QR code %s", err)
+			return c.Redirect(301, "/")
+		}
+		c.Set("qr_code", qr)
+	}
+
+	setViewerTime(c, *res.Event)
+	c.Set("reservation", res)
+	return c.Render(http.StatusOK, r.HTML("tickets/show"))
+}
+
+// CheckInGuestHandler returns GET for the page a scanned ticket opens: who
+// the guest is and a button to check them in.
+func CheckInGuestHandler(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+
+	res, err := models.FindReservationByCheckInToken(tx, ticketToken(c.Param("token")))
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("error finding ticket %s", err)
+		}
+		c.Flash().Add("danger", "That ticket is not valid.")
+		return c.Redirect(http.StatusFound, "/")
+	}
+
+	if !res.Event.CanManage(currentUser(c)) {
+		c.Flash().Add("danger", "You are not allowed to manage this event")
+		return c.Redirect(http.StatusFound, res.Event.ToLink())
+	}
+
+	c.Set("reservation", res)
+	return c.Render(http.StatusOK, r.HTML("events/check-in-guest"))
+}
+
+// EventCheckInHandler returns GET for an event's door list: arrivals so
+// far and the seated guests, optionally filtered by name or email.
+func EventCheckInHandler(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	event := models.Event{}
+
+	err := tx.Find(&event, c.Param("id"))
+	if err != nil {
+		log.Printf("error finding event %s", err)
+		return c.Redirect(301, "/")
+	}
+
+	count, err := models.CountCheckIns(tx, event.ID)
+	if err != nil {
+		log.Printf("error counting check-ins %s", err)
+		return c.Redirect(301, "/")
+	}
+
+	q := tx.Eager("Guest").
+		Where("event_attendees.event_id = ? AND event_attendees.status = ? AND event_attendees.rsvp IN (?)",
+			event.ID, models.AttendeeStatusConfirmed, []string{models.RSVPGoing, models.RSVPMaybe}).
+		Join("guests", "guests.id = event_attendees.guest_id").
+		Order("guests.full_name, guests.email")
+	search := strings.TrimSpace(c.Param("q"))
+	if search != "" {
+		pattern := models.SearchPattern(search)
+		q = q.Where("(guests.email LIKE ? OR guests.full_name LIKE ?)", pattern, pattern)
+	}
+	attendees := models.EventAttendees{}
+	err = q.All(&attendees)
+	if err != nil {
+		log.Printf("error listing guests %s", err)
+		return c.Redirect(301, "/")
+	}
+
+	c.Set("event", event)
+	c.Set("count", count)
+	c.Set("attendees", attendees)
+	c.Set("q", search)
+	return c.Render(http.StatusOK, r.HTML("events/check-in"))
+}
+
+// EventCheckInCountsHandler returns GET for an event's arrival counts as
+// JSON, which the door list polls.
+func EventCheckInCountsHandler(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+
+	eventID, err := uuid.FromString(c.Param("id"))
+	if err != nil {
+		return c.Error(http.StatusNotFound, err)
+	}
+
+	count, err := models.CountCheckIns(tx, eventID)
+	if err != nil {
+		log.Printf("error counting check-ins %s", err)
+		return c.Error(http.StatusInternalServerError, err)
+	}
+	return c.Render(http.StatusOK, r.JSON(count))
+}
+
+// CheckInForm is the payload for checking a guest in: their ticket's token
+// or the URL from its QR code.
+type CheckInForm struct {
+	Token string `form:"Token"`
+}
+
+// EventCheckInCreateHandler responds to POST to check in the guest holding
+// a ticket for the event.
+func EventCheckInCreateHandler(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	checkInPath := "/events/" + c.Param("id") + "/check-in"
+
+	req := &CheckInForm{}
+	err := c.Bind(req)
+	if err != nil {
+		log.Printf("form error %s", err)
+		return c.Redirect(301, "/")
+	}
+
+	res, err := models.FindReservationByCheckInToken(tx, ticketToken(req.Token))
+	if err != nil || res.EventID.String() != c.Param("id") {
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("error finding ticket %s", err)
+			return c.Redirect(301, "/")
+		}
+		c.Flash().Add("danger", "That isn't a ticket for this event.")
+		return c.Redirect(http.StatusSeeOther, checkInPath)
+	}
+
+	if res.Event.IsCancelled() {
+		c.Flash().Add("warning", "This event has been cancelled.")
+		return c.Redirect(http.StatusSeeOther, checkInPath)
+	}
+
+	who := res.Guest.Email
+	if res.Guest.FullName != "" {
+		who = res.Guest.FullName + " (" + res.Guest.Email + ")"
+	}
+
+	err = models.CheckIn(tx, res, time.Now())
+	switch {
+	case errors.Is(err, models.ErrAlreadyCheckedIn):
+		c.Flash().Add("warning", who+" was already checked in at "+res.Event.FormatTime(res.CheckedInAt.Time, "3:04 PM")+".")
+	case errors.Is(err, models.ErrNotAdmitted):
+		reason := res.RSVP
+		if res.HoldsSpot() {
+			reason = "on the waitlist"
+		}
+		c.Flash().Add("danger", who+" doesn't have a seat: "+reason+".")
+	case err != nil:
+		log.Printf("error checking in %s", err)
+		return c.Redirect(301, "/")
+	default:
+		c.Flash().Add("success", "Checked in "+who+".")
+	}
+	return c.Redirect(http.StatusSeeOther, checkInPath)
+}
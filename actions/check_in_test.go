@@ -0,0 +1,107 @@
+package actions
+
+import (
+	"net/http"
+	"net/url"
+
+	"event_planner/models"
+)
+
+func (as *ActionSuite) Test_Ticket() {
+	e := as.createEvent()
+	g := &models.Guest{Email: "bob@example.com", FullName: "Bob"}
+	as.NoError(as.DB.Create(g))
+	res, err := models.Reserve(as.DB, e.ID, g.ID)
+	as.NoError(err)
+
+	page := as.HTML("/tickets/%s", res.CheckInToken).Get()
+	as.Equal(http.StatusOK, page.Code)
+	as.Contains(page.Body.String(), "data:image/png;base64,")
+
+	page = as.HTML("/tickets/%s", "forged").Get()
+	as.Equal(http.StatusFound, page.Code)
+	as.Equal("/", page.Location())
+}
+
+func (as *ActionSuite) Test_CheckIn() {
+	e := as.createManagedEvent()
+	g := &models.Guest{Email: "bob@example.com", FullName: "Bob"}
+	as.NoError(as.DB.Create(g))
+	res, err := models.Reserve(as.DB, e.ID, g.ID)
+	as.NoError(err)
+
+	// Scanning the QR code opens the guest's check-in page.
+	page := as.HTML("/check-in/%s", res.CheckInToken).Get()
+	as.Equal(http.StatusOK, page.Code)
+	as.Contains(page.Body.String(), "bob@example.com")
+
+	page = as.HTML("/events/%s/check-in", e.ID).Post(url.Values{"Token": {checkInURL(res)}})
+	as.Equal(http.StatusSeeOther, page.Code)
+	as.NoError(as.DB.Reload(res))
+	as.True(res.IsCheckedIn())
+
+	// A second scan doesn't check them in again.
+	checkedInAt := res.CheckedInAt.Time
+	page = as.HTML("/events/%s/check-in", e.ID).Post(url.Values{"Token": {res.CheckInToken}})
+	as.Equal(http.StatusSeeOther, page.Code)
+	as.NoError(as.DB.Reload(res))
+	as.Equal(checkedInAt, res.CheckedInAt.Time)
+
+	jres := as.JSON("/events/%s/check-in.json", e.ID).Get()
+	as.Equal(http.StatusOK, jres.Code)
+	as.Contains(jres.Body.String(), `"checked_in":1`)
+	as.Contains(jres.Body.String(), `"expected":1`)
+
+	// Tickets for other events don't work here.
+	other := as.createEvent()
+	res2, err := models.Reserve(as.DB, other.ID, g.ID)
+	as.NoError(err)
+	as.HTML("/events/%s/check-in", e.ID).Post(url.Values{"Token": {res2.CheckInToken}})
+	as.NoError(as.DB.Reload(res2))
+	as.False(res2.IsCheckedIn())
+}
+
+func (as *ActionSuite) Test_CheckIn_ManagersOnly() {
+	e := as.createEvent()
+	g := &models.Guest{Email: "bob@example.com", FullName: "Bob"}
+	as.NoError(as.DB.Create(g))
+	res, err := models.Reserve(as.DB, e.ID, g.ID)
+	as.NoError(err)
+
+	page := as.HTML("/check-in/%s", res.CheckInToken).Get()
+	as.Equal(http.StatusFound, page.Code)
+
+	stranger, err := as.createUser()
+	as.NoError(err)
+	as.signIn(stranger)
+	page = as.HTML("/check-in/%s", res.CheckInToken).Get()
+	as.Equal(http.StatusFound, page.Code)
+	as.Equal(e.ToLink(), page.Location())
+
+	as.HTML("/events/%s/check-in", e.ID).Post(url.Values{"Token": {res.CheckInToken}})
+	as.NoError(as.DB.Reload(res))
+	as.False(res.IsCheckedIn())
+}
+
+func (as *ActionSuite) Test_API_CheckIns() {
+	e := as.createManagedEvent()
+	g := &models.Guest{Email: "bob@example.com", FullName: "Bob"}
+	as.NoError(as.DB.Create(g))
+	res, err := models.Reserve(as.DB, e.ID, g.ID)
+	as.NoError(err)
+
+	jres := as.JSON("/api/v1/events/%s/check-ins", e.ID).Post(&APICheckInForm{Token: res.CheckInToken})
+	as.Equal(http.StatusOK, jres.Code)
+	as.Contains(jres.Body.String(), `"checked_in_at":"`)
+
+	jres = as.JSON("/api/v1/events/%s/check-ins", e.ID).Post(&APICheckInForm{Token: res.CheckInToken})
+	as.Equal(http.StatusConflict, jres.Code)
+	as.Contains(jres.Body.String(), "already checked in")
+
+	jres = as.JSON("/api/v1/events/%s/check-ins", e.ID).Post(&APICheckInForm{Token: "forged"})
+	as.Equal(http.StatusNotFound, jres.Code)
+
+	jres = as.JSON("/api/v1/events/%s/check-ins", e.ID).Get()
+	as.Equal(http.StatusOK, jres.Code)
+	as.Contains(jres.Body.String(), `"checked_in":1`)
+}
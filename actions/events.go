@@ -7,21 +7,96 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/nulls"
 	"github.com/gobuffalo/pop/v6"
+	"github.com/gobuffalo/validate/v3"
+	"github.com/gobuffalo/validate/v3/validators"
 	"github.com/gofrs/uuid"
 	"github.com/pkg/errors"
+
+	"event_planner/rrule"
 )
 
-// EventsListHandler returns GET for list of all events.
-func EventsListHandler(c buffalo.Context) error {
+// EventsPage is the JSON body of an event listing: one page of events and
+// the totals needed to page through the rest.
+type EventsPage struct {
+	Events     models.Events  `json:"events"`
+	Pagination *pop.Paginator `json:"pagination"`
+}
+
+// eventListOptions reads the listing params shared by every event list:
+// when (upcoming, past or all), from and to (YYYY-MM-DD, to inclusive), q,
+// sort, page and per_page. Values that don't parse fall back to defaults.
+func eventListOptions(c buffalo.Context) models.EventListOptions {
+	o := models.EventListOptions{
+		When:   c.Param("when"),
+		Search: c.Param("q"),
+		Sort:   c.Param("sort"),
+	}
+	o.Page, _ = strconv.Atoi(c.Param("page"))
+	o.PerPage, _ = strconv.Atoi(c.Param("per_page"))
+
+	if from, err := time.Parse("2006-01-02", c.Param("from")); err == nil {
+		o.From = from
+	}
+	if to, err := time.Parse("2006-01-02", c.Param("to")); err == nil {
+		o.To = to.AddDate(0, 0, 1)
+	}
+	return o.Normalize()
+}
+
+// listEvents loads the page of events asked for in the request params,
+// with their RSVP counts.
+func listEvents(c buffalo.Context) (models.Events, *pop.Paginator, error) {
 	tx := c.Value("tx").(*pop.Connection)
-	events := models.Events{}
 
-	err := tx.All(&events)
+	events, pagination, err := models.ListEvents(tx, eventListOptions(c), time.Now())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = events.LoadRSVPCounts(tx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = events.LoadSeries(tx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return events, pagination, nil
+}
+
+// setEventListing exposes a listing to the templates.
+func setEventListing(c buffalo.Context, events models.Events, pagination *pop.Paginator) error {
+	// Marshal to JSON so the Vue app can read it.
+	data, err := json.Marshal(events)
+	if err != nil {
+		return err
+	}
+	c.Set("events", string(data))
+	c.Set("eventsGo", events)
+	c.Set("pagination", pagination)
+
+	o := eventListOptions(c)
+	c.Set("filters", map[string]string{
+		"when": o.When,
+		"q":    o.Search,
+		"sort": o.Sort,
+		"from": c.Param("from"),
+		"to":   c.Param("to"),
+	})
+	return nil
+}
+
+// EventsListHandler returns GET for a page of events.
+func EventsListHandler(c buffalo.Context) error {
+	events, pagination, err := listEvents(c)
 	if err != nil {
 		log.Print(err)
 		return c.Redirect(301, "/")
@@ -29,33 +104,26 @@ func EventsListHandler(c buffalo.Context) error {
 
 	ct, _ := c.Value("contentType").(string)
 	if ct == "application/json" {
-		return c.Render(http.StatusOK, r.JSON(events))
+		return c.Render(http.StatusOK, r.JSON(EventsPage{Events: events, Pagination: pagination}))
 	}
 
-	// Marshal to JSON so the Vue app can read it.
-	data, err := json.Marshal(events)
+	err = setEventListing(c, events, pagination)
 	if err != nil {
 		log.Print(err)
 		return c.Redirect(301, "/")
 	}
-	c.Set("events", string(data))
-	c.Set("eventsGo", events)
 	return c.Render(http.StatusOK, r.HTML("events/all"))
 }
 
-// EventsListHandler returns JSON list of all events.
+// EventsListHandler returns JSON for a page of events.
 func EventsListJSONHandler(c buffalo.Context) error {
-	tx := c.Value("tx").(*pop.Connection)
-	events := models.Events{}
-
-	err := tx.All(&events)
+	events, pagination, err := listEvents(c)
 	if err != nil {
-		log.Print(err)
-		return c.Redirect(301, "/")
+		return apiServerError(c, err)
 	}
 
 	// r.JSON handles Marshal for us.
-	return c.Render(http.StatusOK, r.JSON(events))
+	return c.Render(http.StatusOK, r.JSON(EventsPage{Events: events, Pagination: pagination}))
 }
 
 // EventDetailHandler returns GET for detail on one event.
@@ -64,14 +132,37 @@ func EventDetailHandler(c buffalo.Context) error {
 	event := models.Event{}
 	eventID := c.Param("id")
 
-	err := tx.Eager().Find(&event, eventID)
+	err := tx.Eager("EventGuests", "Organizers", "Attendees.Guest").Find(&event, eventID)
 	if err != nil {
 		log.Print(err)
 		return c.Redirect(301, "/")
 	}
 
+	event.CountRSVPs()
+
+	// Occurrences list the other dates guests can pick from.
+	occurrences := models.Events{}
+	if event.IsOccurrence() {
+		err = event.LoadSeries(tx)
+		if err == nil {
+			occurrences, err = models.SeriesOccurrences(tx, event.SeriesID.UUID, time.Now(), 10)
+		}
+		if err != nil {
+			log.Print(err)
+			return c.Redirect(301, "/")
+		}
+	}
+	c.Set("occurrences", occurrences)
+	setViewerTime(c, event)
+
+	// Managers get the full guest list with emails; everyone else sees the
+	// public view.
+	c.Set("canManage", event.CanManage(currentUser(c)))
+	c.Set("isOwner", event.HasOwnerRights(currentUser(c)))
+
 	g := &models.Guest{} // for partial form
 	c.Set("guest", g)
+	c.Set("rsvps", models.RSVPs)
 	c.Set("event", event)
 	return c.Render(http.StatusOK, r.HTML("events/detail"))
 }
@@ -79,9 +170,12 @@ func EventDetailHandler(c buffalo.Context) error {
 // EventNewHandler returns GET for create form.
 func EventNewHandler(c buffalo.Context) error {
 	e := models.Event{}
-	e.Date = time.Now()
+	e.TimeZone = defaultTimeZone(c)
+	e.Date = time.Now().In(e.Zone())
+	e.Duration = models.DefaultEventDuration
 	c.Set("event", e)
-	c.Set("tFormat", "2006-01-02T15:04")
+	c.Set("recurrence", newRecurrenceForm())
+	setEventFormData(c)
 	return c.Render(http.StatusOK, r.HTML("events/new"))
 }
 
@@ -91,6 +185,8 @@ func EventCreateHandler(c buffalo.Context) error {
 	event := &models.Event{}
 
 	event.Date = time.Now()
+	event.TimeZone = models.DefaultTimeZone
+	event.Duration = models.DefaultEventDuration
 	event.EventGuests = make([]models.Guest, 0)
 
 	err := c.Bind(event)
@@ -98,17 +194,325 @@ func EventCreateHandler(c buffalo.Context) error {
 		fmt.Printf("bad bind %s", err)
 		return c.Redirect(301, "/")
 	}
+	// The form's time is in the event's zone.
+	event.Date = models.InZone(event.Date, event.Zone())
+	event.Status = models.EventStatusScheduled
+	event.SeriesID, event.RecurrenceID = nulls.UUID{}, nulls.Time{}
+	if u := currentUser(c); u != nil {
+		event.OwnerID = nulls.NewUUID(u.ID)
+	}
 
-	err = tx.Create(event)
+	repeat := newRecurrenceForm()
+	err = c.Bind(&repeat)
+	if err != nil {
+		fmt.Printf("bad bind %s", err)
+		return c.Redirect(301, "/")
+	}
+	rule, exdates, rerrs := repeat.Rule(event.LocalDate())
+
+	verrs, err := event.Validate(tx)
 	if err != nil {
 		fmt.Printf("bad create %s", err)
 		return c.Redirect(301, "/")
 	}
+	verrs.Append(rerrs)
+	if !verrs.HasAny() {
+		verrs, err = tx.ValidateAndCreate(event)
+		if err != nil {
+			fmt.Printf("bad create %s", err)
+			return c.Redirect(301, "/")
+		}
+	}
+
+	if verrs.HasAny() {
+		c.Set("event", event)
+		c.Set("recurrence", repeat)
+		c.Set("errors", verrs)
+		setEventFormData(c)
+		return c.Render(http.StatusUnprocessableEntity, r.HTML("events/new"))
+	}
+
+	// An error status rolls back the event too, rather than leaving it
+	// saved without its series.
+	_, err = applyRecurrence(tx, event, repeat, rule, exdates)
+	if err != nil {
+		log.Printf("error creating series %s", err)
+		return c.Error(http.StatusInternalServerError, err)
+	}
 
 	c.Flash().Add("info", "Event created")
 	return c.Redirect(301, "/events/"+event.ID.String())
 }
 
+// EventEditHandler returns GET for edit form.
+func EventEditHandler(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	event := models.Event{}
+
+	err := tx.Find(&event, c.Param("id"))
+	if err != nil {
+		log.Printf("error finding event %s", err)
+		return c.Redirect(301, "/")
+	}
+
+	err = event.LoadSeries(tx)
+	if err != nil {
+		log.Printf("error finding series %s", err)
+		return c.Redirect(301, "/")
+	}
+
+	c.Set("event", event)
+	c.Set("recurrence", recurrenceFormFor(&event))
+	c.Set("isOwner", event.HasOwnerRights(currentUser(c)))
+	setEventFormData(c)
+	return c.Render(http.StatusOK, r.HTML("events/edit"))
+}
+
+// EventUpdateHandler responds to POST to update an event.
+func EventUpdateHandler(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	event := &models.Event{}
+
+	err := tx.Find(event, c.Param("id"))
+	if err != nil {
+		log.Printf("error finding event %s", err)
+		return c.Redirect(301, "/")
+	}
+
+	// Status is only changed through the cancel flow, so keep it out of
+	// reach of the bound form along with the ID, owner, revision and
+	// series.
+	id, status, owner, seq := event.ID, event.Status, event.OwnerID, event.Sequence
+	reason, cancelledAt := event.CancelReason, event.CancelledAt
+	series, recurrenceID := event.SeriesID, event.RecurrenceID
+
+	err = c.Bind(event)
+	if err != nil {
+		log.Printf("form error %s", err)
+		return c.Redirect(301, "/")
+	}
+	event.ID, event.Status, event.OwnerID, event.Sequence = id, status, owner, seq
+	event.CancelReason, event.CancelledAt = reason, cancelledAt
+	event.SeriesID, event.RecurrenceID = series, recurrenceID
+	event.Date = models.InZone(event.Date, event.Zone())
+
+	repeat := newRecurrenceForm()
+	err = c.Bind(&repeat)
+	if err != nil {
+		log.Printf("form error %s", err)
+		return c.Redirect(301, "/")
+	}
+	// Changing a single occurrence leaves its series alone.
+	rule, exdates, verrs := rrule.Rule{}, models.DateList{}, validate.NewErrors()
+	if !event.IsOccurrence() || repeat.Scope == ScopeFuture {
+		rule, exdates, verrs = repeat.Rule(event.LocalDate())
+	}
+
+	if !verrs.HasAny() {
+		verrs, err = tx.ValidateAndUpdate(event)
+		if err != nil {
+			log.Printf("error updating event %s", err)
+			return c.Redirect(301, "/")
+		}
+	}
+
+	if verrs.HasAny() {
+		err = event.LoadSeries(tx)
+		if err != nil {
+			log.Printf("error finding series %s", err)
+			return c.Redirect(301, "/")
+		}
+		c.Set("event", event)
+		c.Set("recurrence", repeat)
+		c.Set("errors", verrs)
+		c.Set("isOwner", event.HasOwnerRights(currentUser(c)))
+		setEventFormData(c)
+		return c.Render(http.StatusUnprocessableEntity, r.HTML("events/edit"))
+	}
+
+	repeated, err := applyRecurrence(tx, event, repeat, rule, exdates)
+	if err != nil {
+		log.Printf("error updating series %s", err)
+		return c.Error(http.StatusInternalServerError, err)
+	}
+	if repeated && series.Valid {
+		c.Flash().Add("info", "Event and later dates updated")
+		return c.Redirect(http.StatusSeeOther, event.ToLink())
+	}
+
+	if !event.IsCancelled() {
+		_, err = models.PromoteWaitlist(tx, event.ID)
+		if err != nil {
+			log.Printf("error promoting waitlist %s", err)
+			return c.Redirect(301, "/")
+		}
+	}
+
+	c.Flash().Add("info", "Event updated")
+	return c.Redirect(http.StatusSeeOther, event.ToLink())
+}
+
+// EventCancelForm is the payload for cancelling an event.
+type EventCancelForm struct {
+	Reason string `form:"Reason"`
+}
+
+// EventCancelHandler responds to POST to cancel an event. Reservations are
+// kept and the event stays listed, marked as cancelled.
+func EventCancelHandler(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	event := &models.Event{}
+
+	err := tx.Find(event, c.Param("id"))
+	if err != nil {
+		log.Printf("error finding event %s", err)
+		return c.Redirect(301, "/")
+	}
+
+	if event.IsCancelled() {
+		c.Flash().Add("warning", "This event is already cancelled.")
+		return c.Redirect(http.StatusSeeOther, event.ToLink())
+	}
+
+	req := &EventCancelForm{}
+	err = c.Bind(req)
+	if err != nil {
+		log.Printf("form error %s", err)
+		return c.Redirect(301, "/")
+	}
+
+	event.Cancel(req.Reason)
+	verrs, err := tx.ValidateAndUpdate(event)
+	if err != nil {
+		log.Printf("error cancelling event %s", err)
+		return c.Redirect(301, "/")
+	}
+
+	if verrs.HasAny() {
+		c.Flash().Add("danger", verrs.Error())
+		return c.Redirect(http.StatusSeeOther, "/events/"+event.ID.String()+"/edit")
+	}
+
+	c.Flash().Add("info", "Event cancelled")
+	return c.Redirect(http.StatusSeeOther, event.ToLink())
+}
+
+// EventDeleteHandler responds to DELETE to remove an event and its reservations.
+func EventDeleteHandler(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	event := &models.Event{}
+
+	err := tx.Find(event, c.Param("id"))
+	if err != nil {
+		log.Printf("error finding event %s", err)
+		return c.Redirect(301, "/")
+	}
+
+	err = event.Destroy(tx)
+	if err != nil {
+		log.Printf("error deleting event %s", err)
+		return c.Redirect(301, "/")
+	}
+
+	c.Flash().Add("info", "Event deleted")
+	return c.Redirect(http.StatusSeeOther, "/events")
+}
+
+// EventRemoveGuestHandler responds to DELETE to drop a guest's reservation.
+func EventRemoveGuestHandler(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	res := &models.EventAttendee{}
+	eventPath := "/events/" + c.Param("id")
+
+	err := tx.Where("event_id = ? AND guest_id = ?", c.Param("id"), c.Param("guest_id")).First(res)
+	if err != nil {
+		log.Printf("error finding reservation %s", err)
+		c.Flash().Add("warning", "That guest has no reservation for this event.")
+		return c.Redirect(http.StatusSeeOther, eventPath)
+	}
+
+	promoted, err := models.CancelReservation(tx, res)
+	if err != nil {
+		log.Printf("error removing reservation %s", err)
+		return c.Redirect(301, "/")
+	}
+
+	c.Flash().Add("info", "Guest removed")
+	if len(promoted) > 0 {
+		c.Flash().Add("info", fmt.Sprintf("%d guest(s) moved off the waitlist", len(promoted)))
+	}
+	return c.Redirect(http.StatusSeeOther, eventPath)
+}
+
+// EventOrganizerForm is the payload for adding a co-organizer.
+type EventOrganizerForm struct {
+	Email string `form:"Email"`
+}
+
+// EventAddOrganizerHandler responds to POST to add a co-organizer by email.
+func EventAddOrganizerHandler(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	eventPath := "/events/" + c.Param("id")
+
+	req := &EventOrganizerForm{}
+	err := c.Bind(req)
+	if err != nil {
+		log.Printf("form error %s", err)
+		return c.Redirect(301, "/")
+	}
+
+	u := &models.User{}
+	err = tx.Where("email = ?", strings.ToLower(strings.TrimSpace(req.Email))).First(u)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.Flash().Add("warning", "No account found for "+req.Email)
+			return c.Redirect(http.StatusSeeOther, eventPath)
+		}
+		log.Printf("user lookup error %s", err)
+		return c.Redirect(301, "/")
+	}
+
+	event := &models.Event{}
+	err = tx.Find(event, c.Param("id"))
+	if err != nil {
+		log.Printf("error finding event %s", err)
+		return c.Redirect(301, "/")
+	}
+
+	if event.IsOwner(u) {
+		c.Flash().Add("warning", u.Email+" already owns this event.")
+		return c.Redirect(http.StatusSeeOther, eventPath)
+	}
+
+	err = tx.Create(&models.EventOrganizer{EventID: event.ID, UserID: u.ID})
+	if err != nil {
+		if strings.Contains(err.Error(), "Duplicate entry") {
+			c.Flash().Add("warning", u.Email+" is already an organizer.")
+			return c.Redirect(http.StatusSeeOther, eventPath)
+		}
+		log.Printf("error adding organizer %s", err)
+		return c.Redirect(301, "/")
+	}
+
+	c.Flash().Add("info", "Organizer added: "+u.Email)
+	return c.Redirect(http.StatusSeeOther, eventPath)
+}
+
+// EventRemoveOrganizerHandler responds to DELETE to remove a co-organizer.
+func EventRemoveOrganizerHandler(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	eventPath := "/events/" + c.Param("id")
+
+	err := tx.RawQuery("DELETE FROM event_organizers WHERE event_id = ? AND user_id = ?", c.Param("id"), c.Param("organizer_id")).Exec()
+	if err != nil {
+		log.Printf("error removing organizer %s", err)
+		return c.Redirect(301, "/")
+	}
+
+	c.Flash().Add("info", "Organizer removed")
+	return c.Redirect(http.StatusSeeOther, eventPath)
+}
+
 // EventNewGuestHandler returns GET for add-guest form.
 func EventNewGuestHandler(c buffalo.Context) error {
 	tx := c.Value("tx").(*pop.Connection)
@@ -140,6 +544,11 @@ func EventAddGuestHandler(c buffalo.Context) error {
 		return c.Redirect(301, "/")
 	}
 
+	if event.IsCancelled() {
+		c.Flash().Add("warning", "This event has been cancelled.")
+		return c.Redirect(http.StatusSeeOther, event.ToLink())
+	}
+
 	// Find and validate guest.
 	guest := &models.Guest{}
 	err = c.Bind(guest)
@@ -148,60 +557,88 @@ func EventAddGuestHandler(c buffalo.Context) error {
 		return c.Redirect(301, "/")
 	}
 
-	foundGuest := &models.Guest{}
-	err = tx.Where("email = ?", guest.Email).First(foundGuest)
-	if err != nil && !errors.Is(err, sql.ErrNoRows) {
-		log.Printf("guest lookup error %s", err)
+	foundGuest, res, err := reserveGuest(tx, event, guest.Email, guest.FullName)
+	if err != nil {
+		if errors.Is(err, errDuplicateReservation) {
+			c.Flash().Add("warning", "A reservation already exists for that person.")
+			return c.Redirect(301, "/events/"+event.ID.String())
+		}
+		log.Printf("error making reservation %s", err)
 		return c.Redirect(301, "/")
 	}
 
-	if foundGuest.ID.IsNil() {
-		// Try to create new guest.
-		foundGuest.Email = guest.Email
-		foundGuest.FullName = guest.FullName
+	sendReservationLink(c, event, foundGuest, res)
 
-		err = tx.Create(foundGuest)
-		if err != nil {
-			log.Printf("error creating guest %s", err)
-			return c.Redirect(301, "/")
-		}
+	if nameKept(foundGuest, guest.FullName) {
+		c.Flash().Add("info", nameKeptMessage)
+	}
+	if res.IsWaitlisted() {
+		c.Flash().Add("warning", "The event is full. "+foundGuest.Email+" has been added to the waitlist.")
+		return c.Redirect(301, "/events/"+event.ID.String())
+	}
+
+	c.Flash().Add("info", "Reservation complete for "+foundGuest.Email)
+	return c.Redirect(301, "/events/"+event.ID.String())
+}
+
+var errDuplicateReservation = errors.New("reservation already exists")
+
+const nameKeptMessage = "We already have a name for this email address. The guest can change it from the link in their email."
+
+// nameKept reports whether a name given with a sign-up was left unused
+// because the guest already has a different one.
+func nameKept(g *models.Guest, fullName string) bool {
+	fullName = strings.TrimSpace(fullName)
+	return fullName != "" && fullName != g.FullName
+}
+
+// reserveGuest finds the guest by email, creating them if needed, and books
+// them onto the event. The reservation may end up on the waitlist. An
+// existing guest's name is only filled in, see models.FindOrCreateGuest.
+func reserveGuest(tx *pop.Connection, event *models.Event, email, fullName string) (*models.Guest, *models.EventAttendee, error) {
+	foundGuest, err := models.FindOrCreateGuest(tx, email, fullName)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "finding guest")
 	}
 
+	// A guest who declined or cancelled earlier signs up again through
+	// their existing reservation.
 	res := &models.EventAttendee{}
-	res.GuestID = foundGuest.ID
-	res.EventID = event.ID
+	err = tx.Where("event_id = ? AND guest_id = ?", event.ID, foundGuest.ID).First(res)
+	if err == nil {
+		if res.HoldsSpot() {
+			return foundGuest, nil, errDuplicateReservation
+		}
+		_, err = models.SetRSVP(tx, res, models.RSVPGoing)
+		return foundGuest, res, err
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, errors.Wrap(err, "reservation lookup")
+	}
 
-	err = tx.Create(res)
+	res, err = models.Reserve(tx, event.ID, foundGuest.ID)
 	if err != nil {
 		if strings.Contains(err.Error(), "Duplicate entry") {
-			c.Flash().Add("warning", "A reservation already exists for that person.")
-			return c.Redirect(301, "/events/"+event.ID.String())
+			return foundGuest, nil, errDuplicateReservation
 		}
-		log.Printf("error making reservation %s", err)
-		return c.Redirect(301, "/")
+		return nil, nil, err
 	}
-
-	c.Flash().Add("info", "Reservation complete for "+foundGuest.Email)
-	return c.Redirect(301, "/events/"+event.ID.String())
+	return foundGuest, res, nil
 }
 
 // AppHandler returns GET for Vue form.
 func AppHandler(c buffalo.Context) error {
-	tx := c.Value("tx").(*pop.Connection)
-	events := &models.Events{}
-
-	err := tx.All(events)
+	events, pagination, err := listEvents(c)
 	if err != nil {
 		log.Printf("error getting events %s", err)
 		return c.Redirect(301, "/")
 	}
 
-	eventData, err := json.Marshal(events)
+	err = setEventListing(c, events, pagination)
 	if err != nil {
 		log.Print(err)
 		return c.Redirect(301, "/")
 	}
-	c.Set("events", string(eventData))
 	return c.Render(http.StatusOK, r.HTML("app"))
 }
 
@@ -218,50 +655,82 @@ func AppFormHandler(c buffalo.Context) error {
 	err := c.Bind(req)
 	if err != nil {
 		log.Printf("form bind error %s", err)
-		return c.Render(400, r.String("form binding error"))
+		return apiFail(c, http.StatusBadRequest, "form binding error")
+	}
+	req.Email = strings.TrimSpace(req.Email)
+
+	verrs := validate.Validate(&validators.EmailIsPresent{Field: req.Email, Name: "Email"})
+	if verrs.HasAny() {
+		return apiInvalid(c, verrs)
 	}
 
 	event := &models.Event{}
 	err = tx.Find(event, req.EventID)
 	if err != nil {
-		log.Printf("error finding event")
-		return c.Render(404, r.String("event not found "+req.EventID.String()))
+		return apiLookupFailed(c, err, "event")
 	}
 
-	foundGuest := &models.Guest{}
-	err = tx.Where("email = ?", req.Email).First(foundGuest)
-	if err != nil && !errors.Is(err, sql.ErrNoRows) {
-		log.Printf("guest lookup error %s", err)
-		return c.Render(404, r.String("guest not found with email: "+req.Email))
+	if event.IsCancelled() {
+		return apiFail(c, http.StatusConflict, "event has been cancelled")
 	}
 
-	if foundGuest.ID.IsNil() {
-		// Try to create new guest.
-		foundGuest.Email = req.Email
-		foundGuest.FullName = req.FullName
-
-		err = tx.Create(foundGuest)
-		if err != nil {
-			log.Printf("error creating guest %s", err)
-			return c.Render(500, r.String("error creating guest"))
+	foundGuest, res, err := reserveGuest(tx, event, req.Email, req.FullName)
+	if err != nil {
+		if errors.Is(err, errDuplicateReservation) {
+			return apiFail(c, http.StatusConflict, "a reservation already exists for "+req.Email)
 		}
+		return apiServerError(c, err)
 	}
 
-	res := &models.EventAttendee{}
-	res.GuestID = foundGuest.ID
-	res.EventID = event.ID
+	sendReservationLink(c, event, foundGuest, res)
 
-	err = tx.Create(res)
-	if err != nil {
-		log.Printf("error making reservation %s", err)
-		return c.Render(500, r.String("error making reservation"))
+	msg := "Reservation complete."
+	if res.IsWaitlisted() {
+		msg = "The event is full. " + foundGuest.Email + " has been added to the waitlist."
+	}
+	if nameKept(foundGuest, req.FullName) {
+		msg += " " + nameKeptMessage
 	}
 
 	log.Printf("reservation made for %s", event.ID.String())
-	return c.Render(204, r.String(""))
+	return c.Render(http.StatusCreated, r.JSON(map[string]string{
+		"status":  res.Status,
+		"message": msg,
+	}))
 }
 
 // EventsRemoteHandler renders the Vue page that makes a remote request to load event list.
 func EventsRemoteHandler(c buffalo.Context) error {
 	return c.Render(http.StatusOK, r.HTML("events/list-remote"))
 }
+
+// AuthorizeEventManager requires the current user to be the owner or a
+// co-organizer of the event in the id param.
+func AuthorizeEventManager(next buffalo.Handler) buffalo.Handler {
+	return authorizeEvent(next, models.Event.CanManage)
+}
+
+// AuthorizeEventOwner requires the current user to own the event in the id
+// param.
+func AuthorizeEventOwner(next buffalo.Handler) buffalo.Handler {
+	return authorizeEvent(next, models.Event.HasOwnerRights)
+}
+
+func authorizeEvent(next buffalo.Handler, allowed func(models.Event, *models.User) bool) buffalo.Handler {
+	return func(c buffalo.Context) error {
+		tx := c.Value("tx").(*pop.Connection)
+		event := models.Event{}
+
+		err := tx.Eager("Organizers").Find(&event, c.Param("id"))
+		if err != nil {
+			log.Printf("error finding event %s", err)
+			return c.Redirect(301, "/")
+		}
+
+		if !allowed(event, currentUser(c)) {
+			c.Flash().Add("danger", "You are not allowed to manage this event")
+			return c.Redirect(http.StatusFound, event.ToLink())
+		}
+		return next(c)
+	}
+}
@@ -0,0 +1,178 @@
+package actions
+
+import (
+	"net/http"
+	"time"
+
+	"event_planner/models"
+
+	"github.com/gobuffalo/nulls"
+)
+
+func (as *ActionSuite) createEvent() *models.Event {
+	e := &models.Event{
+		Title:       "Board games night",
+		Description: "Bring a game",
+		Date:        time.Now().Add(24 * time.Hour),
+		Duration:    models.DefaultEventDuration,
+		Status:      models.EventStatusScheduled,
+	}
+	verrs, err := as.DB.ValidateAndCreate(e)
+	as.NoError(err)
+	as.False(verrs.HasAny(), "validation error: %v", verrs)
+	return e
+}
+
+func (as *ActionSuite) Test_Event_Edit_RequiresLogin() {
+	e := as.createEvent()
+
+	res := as.HTML("/events/%s/edit", e.ID).Get()
+	as.Equal(http.StatusFound, res.Code)
+}
+
+func (as *ActionSuite) Test_Event_Cancel() {
+	u, err := as.createUser()
+	as.NoError(err)
+	as.signIn(u)
+
+	e := as.createEvent()
+	g := &models.Guest{Email: "bob@example.com", FullName: "Bob"}
+	as.NoError(as.DB.Create(g))
+	as.NoError(as.DB.Create(&models.EventAttendee{EventID: e.ID, GuestID: g.ID}))
+
+	res := as.HTML("/events/%s/cancel", e.ID).Post(&EventCancelForm{Reason: "Venue closed"})
+	as.Equal(http.StatusSeeOther, res.Code)
+
+	as.NoError(as.DB.Reload(e))
+	as.True(e.IsCancelled())
+	as.Equal("Venue closed", e.CancelReason.String)
+
+	count, err := as.DB.Where("event_id = ?", e.ID).Count(&models.EventAttendee{})
+	as.NoError(err)
+	as.Equal(1, count)
+
+	jres := as.JSON("/events/json").Get()
+	as.Equal(http.StatusOK, jres.Code)
+	as.Contains(jres.Body.String(), `"status":"cancelled"`)
+}
+
+func (as *ActionSuite) Test_Event_Delete() {
+	u, err := as.createUser()
+	as.NoError(err)
+	as.signIn(u)
+
+	e := as.createEvent()
+	g := &models.Guest{Email: "bob@example.com", FullName: "Bob"}
+	as.NoError(as.DB.Create(g))
+	as.NoError(as.DB.Create(&models.EventAttendee{EventID: e.ID, GuestID: g.ID}))
+
+	res := as.HTML("/events/%s", e.ID).Delete()
+	as.Equal(http.StatusSeeOther, res.Code)
+
+	count, err := as.DB.Count("events")
+	as.NoError(err)
+	as.Equal(0, count)
+
+	count, err = as.DB.Count("event_attendees")
+	as.NoError(err)
+	as.Equal(0, count)
+}
+
+func (as *ActionSuite) Test_Event_Manage_OwnerOnly() {
+	owner, err := as.createUser()
+	as.NoError(err)
+
+	stranger := &models.User{
+		Email:                "stranger@example.com",
+		Password:             "password",
+		PasswordConfirmation: "password",
+	}
+	verrs, err := stranger.Create(as.DB)
+	as.NoError(err)
+	as.False(verrs.HasAny())
+
+	e := as.createEvent()
+	e.OwnerID = nulls.NewUUID(owner.ID)
+	as.NoError(as.DB.Update(e))
+
+	g := &models.Guest{Email: "bob@example.com", FullName: "Bob"}
+	as.NoError(as.DB.Create(g))
+	as.NoError(as.DB.Create(&models.EventAttendee{EventID: e.ID, GuestID: g.ID}))
+
+	as.signIn(stranger)
+	res := as.HTML("/events/%s/edit", e.ID).Get()
+	as.Equal(http.StatusFound, res.Code)
+	as.Equal(e.ToLink(), res.Location())
+
+	res = as.HTML("/events/%s", e.ID).Get()
+	as.Equal(http.StatusOK, res.Code)
+	as.Contains(res.Body.String(), "Bob")
+	as.NotContains(res.Body.String(), "bob@example.com")
+
+	as.signIn(owner)
+	res = as.HTML("/events/%s", e.ID).Get()
+	as.Equal(http.StatusOK, res.Code)
+	as.Contains(res.Body.String(), "bob@example.com")
+
+	res = as.HTML("/events/%s/guests/%s", e.ID, g.ID).Delete()
+	as.Equal(http.StatusSeeOther, res.Code)
+	count, err := as.DB.Count("event_attendees")
+	as.NoError(err)
+	as.Equal(0, count)
+}
+
+func (as *ActionSuite) Test_Event_AddGuest_Waitlist() {
+	e := as.createEvent()
+	e.Capacity = 1
+	as.NoError(as.DB.Update(e))
+
+	res := as.HTML("/events/%s/add-guest", e.ID).Post(&models.Guest{Email: "a@example.com", FullName: "A"})
+	as.Equal(http.StatusMovedPermanently, res.Code)
+
+	jres := as.HTML("/app/add-guest").Post(&AppForm{EventID: e.ID, Email: "b@example.com", FullName: "B"})
+	as.Equal(http.StatusCreated, jres.Code)
+	as.Contains(jres.Body.String(), `"status":"waitlisted"`)
+}
+
+func (as *ActionSuite) Test_Event_AddGuest_NormalizesEmail() {
+	e := as.createEvent()
+	other := as.createEvent()
+
+	res := as.HTML("/events/%s/add-guest", e.ID).Post(&models.Guest{Email: "Bob@Example.com ", FullName: "Bob"})
+	as.Equal(http.StatusMovedPermanently, res.Code)
+
+	jres := as.HTML("/app/add-guest").Post(&AppForm{EventID: other.ID, Email: "bob@example.com", FullName: "Robert"})
+	as.Equal(http.StatusCreated, jres.Code)
+	as.Contains(jres.Body.String(), "We already have a name")
+
+	guests := models.Guests{}
+	as.NoError(as.DB.All(&guests))
+	as.Len(guests, 1)
+	as.Equal("Bob", guests[0].FullName)
+
+	// The same person signing up twice for one event is a duplicate.
+	jres = as.HTML("/app/add-guest").Post(&AppForm{EventID: e.ID, Email: "BOB@example.com"})
+	as.Equal(http.StatusConflict, jres.Code)
+}
+
+func (as *ActionSuite) Test_Events_List_Paged() {
+	for i := 0; i < 3; i++ {
+		as.createEvent()
+	}
+
+	res := as.JSON("/events/json?per_page=2&page=2").Get()
+	as.Equal(http.StatusOK, res.Code)
+	page := &EventsPage{}
+	res.Bind(page)
+	as.Len(page.Events, 1)
+	as.Equal(3, page.Pagination.TotalEntriesSize)
+	as.Equal(2, page.Pagination.TotalPages)
+
+	res = as.JSON("/events/json?when=past").Get()
+	res.Bind(page)
+	as.Len(page.Events, 0)
+
+	hres := as.HTML("/events?q=board").Get()
+	as.Equal(http.StatusOK, hres.Code)
+	as.Contains(hres.Body.String(), "3 event(s) found")
+}
@@ -0,0 +1,250 @@
+package actions
+
+import (
+	"encoding/csv"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/gobuffalo/pop/v6"
+	"github.com/pkg/errors"
+
+	"event_planner/models"
+	"event_planner/xlsx"
+)
+
+// maxImportBytes caps the size of an uploaded guest list.
+const maxImportBytes = 1 << 20
+
+// GuestImportForm is the payload for importing guests. The CSV comes either
+// as an uploaded file or, when confirming a preview, as text.
+type GuestImportForm struct {
+	CSV    string `form:"CSV"`
+	Commit bool   `form:"Commit"`
+	Notify bool   `form:"Notify"`
+}
+
+// EventImportGuestsHandler returns GET for the guest import form.
+func EventImportGuestsHandler(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	event := models.Event{}
+
+	err := tx.Find(&event, c.Param("id"))
+	if err != nil {
+		log.Printf("error finding event %s", err)
+		return c.Redirect(301, "/")
+	}
+
+	c.Set("event", event)
+	c.Set("maxRows", models.MaxGuestImportRows)
+	return c.Render(http.StatusOK, r.HTML("events/import"))
+}
+
+// EventImportGuestsCreateHandler responds to POST with a guest list. Without
+// Commit it only previews the import; with it the guests are added, all or
+// nothing, and a report of every row is shown.
+func EventImportGuestsCreateHandler(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	event := &models.Event{}
+	importPath := "/events/" + c.Param("id") + "/guests/import"
+
+	err := tx.Find(event, c.Param("id"))
+	if err != nil {
+		log.Printf("error finding event %s", err)
+		return c.Redirect(301, "/")
+	}
+
+	if event.IsCancelled() {
+		c.Flash().Add("warning", "This event has been cancelled.")
+		return c.Redirect(http.StatusSeeOther, event.ToLink())
+	}
+
+	req := &GuestImportForm{}
+	err = c.Bind(req)
+	if err != nil {
+		log.Printf("form error %s", err)
+		return c.Redirect(301, "/")
+	}
+
+	text, problem := importText(c, req)
+	if problem != "" {
+		c.Flash().Add("warning", problem)
+		return c.Redirect(http.StatusSeeOther, importPath)
+	}
+
+	rows, err := models.ParseGuestCSV(strings.NewReader(text))
+	if err != nil {
+		if errors.Is(err, models.ErrTooManyImportRows) {
+			c.Flash().Add("warning", "That file has too many guests to import at once.")
+		} else {
+			c.Flash().Add("warning", "That file couldn't be read as CSV: "+errors.Cause(err).Error())
+		}
+		return c.Redirect(http.StatusSeeOther, importPath)
+	}
+	if len(rows) == 0 {
+		c.Flash().Add("warning", "No guests found in that file.")
+		return c.Redirect(http.StatusSeeOther, importPath)
+	}
+
+	if !req.Commit {
+		result, err := models.PreviewGuestImport(tx, event.ID, rows)
+		if err != nil {
+			log.Printf("error previewing guest import %s", err)
+			return c.Redirect(301, "/")
+		}
+		c.Set("event", event)
+		c.Set("result", result)
+		c.Set("csv", text)
+		c.Set("notify", req.Notify)
+		return c.Render(http.StatusOK, r.HTML("events/import-preview"))
+	}
+
+	// An error status rolls the transaction back, so a failed import
+	// leaves nothing behind.
+	result, err := models.ImportGuests(tx, event.ID, rows)
+	if err != nil {
+		log.Printf("error importing guests %s", err)
+		return c.Error(http.StatusInternalServerError, err)
+	}
+
+	if req.Notify {
+		for _, row := range result.Rows {
+			if row.Result == models.ImportReserved {
+				sendReservationLink(c, event, row.Guest, row.Reservation)
+			}
+		}
+	}
+
+	c.Set("event", event)
+	c.Set("result", result)
+	return c.Render(http.StatusOK, r.HTML("events/import-report"))
+}
+
+// importText returns the CSV from the uploaded file, or from the form when
+// a preview is being confirmed. If there is none it returns a message for
+// the user instead.
+func importText(c buffalo.Context, req *GuestImportForm) (string, string) {
+	if req.CSV != "" {
+		if len(req.CSV) > maxImportBytes {
+			return "", "That file is too large to import."
+		}
+		return req.CSV, ""
+	}
+
+	f, err := c.File("File")
+	if err != nil || f.File == nil {
+		return "", "Choose a CSV file to import."
+	}
+	defer f.Close()
+
+	b, err := io.ReadAll(io.LimitReader(f, maxImportBytes+1))
+	if err != nil {
+		log.Printf("error reading upload %s", err)
+		return "", "The file couldn't be uploaded."
+	}
+	if len(b) > maxImportBytes {
+		return "", "That file is too large to import."
+	}
+	return string(b), ""
+}
+
+// guestListHeader titles the columns of guest list exports.
+var guestListHeader = []string{"Email", "Name", "RSVP", "Status", "Reserved at", "Updated at"}
+
+// findGuestList loads the event in the id param with its reservations.
+func findGuestList(c buffalo.Context) (*models.Event, error) {
+	tx := c.Value("tx").(*pop.Connection)
+	event := &models.Event{}
+	err := tx.Eager("Attendees.Guest").Find(event, c.Param("id"))
+	return event, err
+}
+
+// EventGuestsCSVHandler returns GET for an event's guest list as CSV.
+// Times are in the event's zone, with their UTC offset.
+func EventGuestsCSVHandler(c buffalo.Context) error {
+	event, err := findGuestList(c)
+	if err != nil {
+		log.Printf("error finding event %s", err)
+		return c.Error(http.StatusNotFound, err)
+	}
+
+	loc := event.Zone()
+	c.Response().Header().Set("Content-Disposition", `attachment; filename="guests-`+event.ID.String()+`.csv"`)
+	return c.Render(http.StatusOK, r.Func("text/csv; charset=utf-8", func(w io.Writer, _ render.Data) error {
+		cw := csv.NewWriter(w)
+		err := cw.Write(guestListHeader)
+		if err != nil {
+			return err
+		}
+		for _, a := range event.Attendees {
+			err = cw.Write([]string{
+				csvSafe(a.Guest.Email),
+				csvSafe(a.Guest.FullName),
+				a.RSVP,
+				a.Status,
+				a.CreatedAt.In(loc).Format(time.RFC3339),
+				a.UpdatedAt.In(loc).Format(time.RFC3339),
+			})
+			if err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	}))
+}
+
+// EventGuestsXLSXHandler returns GET for an event's guest list as an Excel
+// workbook. Times are in the event's zone, named in the header.
+func EventGuestsXLSXHandler(c buffalo.Context) error {
+	event, err := findGuestList(c)
+	if err != nil {
+		log.Printf("error finding event %s", err)
+		return c.Error(http.StatusNotFound, err)
+	}
+
+	loc := event.Zone()
+	sheet := xlsx.Sheet{Name: "Guests", Header: true}
+	header := []interface{}{}
+	for _, title := range guestListHeader {
+		header = append(header, title+headerUnit(title, loc))
+	}
+	sheet.Rows = append(sheet.Rows, header)
+	for _, a := range event.Attendees {
+		sheet.Rows = append(sheet.Rows, []interface{}{
+			a.Guest.Email,
+			a.Guest.FullName,
+			a.RSVP,
+			a.Status,
+			a.CreatedAt.In(loc),
+			a.UpdatedAt.In(loc),
+		})
+	}
+
+	c.Response().Header().Set("Content-Disposition", `attachment; filename="guests-`+event.ID.String()+`.xlsx"`)
+	return c.Render(http.StatusOK, r.Func(xlsx.ContentType, func(w io.Writer, _ render.Data) error {
+		return sheet.Write(w)
+	}))
+}
+
+// headerUnit notes the zone of time columns, which spreadsheets can't
+// carry in the cell itself.
+func headerUnit(title string, loc *time.Location) string {
+	if strings.HasSuffix(title, " at") {
+		return " (" + loc.String() + ")"
+	}
+	return ""
+}
+
+// csvSafe stops spreadsheet programs from reading a guest-supplied value
+// as a formula.
+func csvSafe(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
@@ -0,0 +1,146 @@
+package actions
+
+import (
+	"archive/zip"
+	"bytes"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gobuffalo/httptest"
+	"github.com/gobuffalo/nulls"
+
+	"event_planner/models"
+)
+
+// createManagedEvent creates an event owned by a signed-in user.
+func (as *ActionSuite) createManagedEvent() *models.Event {
+	u, err := as.createUser()
+	as.NoError(err)
+	as.signIn(u)
+
+	e := as.createEvent()
+	e.OwnerID = nulls.NewUUID(u.ID)
+	as.NoError(as.DB.Update(e))
+	return e
+}
+
+func (as *ActionSuite) Test_Event_ImportGuests() {
+	e := as.createManagedEvent()
+	existing := &models.Guest{Email: "ann@example.com", FullName: "Ann"}
+	as.NoError(as.DB.Create(existing))
+	_, err := models.Reserve(as.DB, e.ID, existing.ID)
+	as.NoError(err)
+
+	csv := "Email,Name\nANN@example.com,Ann\nbob@example.com,Bob\nnope,Nobody\nBob@example.com,Bobby\n"
+
+	// Uploading shows a preview and saves nothing.
+	res, err := as.HTML("/events/%s/guests/import", e.ID).MultiPartPost(url.Values{}, httptest.File{
+		ParamName: "File",
+		FileName:  "guests.csv",
+		Reader:    strings.NewReader(csv),
+	})
+	as.NoError(err)
+	as.Equal(http.StatusOK, res.Code)
+	body := res.Body.String()
+	as.Contains(body, "Nothing has been saved yet")
+	as.Contains(body, "Already on the guest list")
+	as.Contains(body, "Not a valid email address")
+	as.Contains(body, "Repeats line 3")
+
+	count, err := as.DB.Count("guests")
+	as.NoError(err)
+	as.Equal(1, count)
+
+	// Confirming imports it.
+	res = as.HTML("/events/%s/guests/import", e.ID).Post(url.Values{
+		"CSV":    {csv},
+		"Commit": {"true"},
+		"Notify": {"true"},
+	})
+	as.Equal(http.StatusOK, res.Code)
+	as.Contains(res.Body.String(), "1 guest(s) added")
+
+	bob, err := models.FindGuestByEmail(as.DB, "bob@example.com")
+	as.NoError(err)
+	as.Equal("Bob", bob.FullName)
+	count, err = as.DB.Where("event_id = ?", e.ID).Count(&models.EventAttendee{})
+	as.NoError(err)
+	as.Equal(2, count)
+
+	// Only the new guest is emailed.
+	messages := models.OutboundMessages{}
+	as.NoError(as.DB.All(&messages))
+	as.Len(messages, 1)
+	data, err := messages[0].Data()
+	as.NoError(err)
+	as.Equal("reservation", data["template"])
+	as.Equal("bob@example.com", data["receiver_email"])
+}
+
+func (as *ActionSuite) Test_Event_ImportGuests_RollsBack() {
+	e := as.createManagedEvent()
+
+	// The second name is too long for the column, so its row fails after
+	// the first guest was added.
+	csv := "Email,Name\ncara@example.com,Cara\ndan@example.com," + strings.Repeat("x", 300) + "\n"
+	res := as.HTML("/events/%s/guests/import", e.ID).Post(url.Values{
+		"CSV":    {csv},
+		"Commit": {"true"},
+	})
+	as.Equal(http.StatusInternalServerError, res.Code)
+
+	_, err := models.FindGuestByEmail(as.DB, "cara@example.com")
+	as.Error(err)
+	count, err := as.DB.Where("event_id = ?", e.ID).Count(&models.EventAttendee{})
+	as.NoError(err)
+	as.Equal(0, count)
+}
+
+func (as *ActionSuite) Test_Event_ImportGuests_BadFile() {
+	e := as.createManagedEvent()
+
+	res := as.HTML("/events/%s/guests/import", e.ID).Post(url.Values{"CSV": {"\"unterminated\n"}})
+	as.Equal(http.StatusSeeOther, res.Code)
+	as.Equal("/events/"+e.ID.String()+"/guests/import", res.Location())
+
+	res = as.HTML("/events/%s/guests/import", e.ID).Post(url.Values{})
+	as.Equal(http.StatusSeeOther, res.Code)
+}
+
+func (as *ActionSuite) Test_Event_ImportGuests_ManagersOnly() {
+	e := as.createEvent()
+
+	res := as.HTML("/events/%s/guests/import", e.ID).Get()
+	as.Equal(http.StatusFound, res.Code)
+
+	res = as.HTML("/events/%s/guests.csv", e.ID).Get()
+	as.Equal(http.StatusFound, res.Code)
+}
+
+func (as *ActionSuite) Test_Event_ExportGuests() {
+	e := as.createManagedEvent()
+	g := &models.Guest{Email: "bob@example.com", FullName: "=cmd()"}
+	as.NoError(as.DB.Create(g))
+	_, err := models.Reserve(as.DB, e.ID, g.ID)
+	as.NoError(err)
+
+	res := as.HTML("/events/%s/guests.csv", e.ID).Get()
+	as.Equal(http.StatusOK, res.Code)
+	as.Contains(res.Header().Get("Content-Type"), "text/csv")
+	lines := strings.Split(strings.TrimSpace(res.Body.String()), "\n")
+	as.Len(lines, 2)
+	as.Equal("Email,Name,RSVP,Status,Reserved at,Updated at", lines[0])
+	as.True(strings.HasPrefix(lines[1], "bob@example.com,'=cmd(),going,confirmed,"), lines[1])
+
+	res = as.HTML("/events/%s/guests.xlsx", e.ID).Get()
+	as.Equal(http.StatusOK, res.Code)
+	b := res.Body.Bytes()
+	z, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	as.NoError(err)
+	found := false
+	for _, f := range z.File {
+		found = found || f.Name == "xl/worksheets/sheet1.xml"
+	}
+	as.True(found)
+}
@@ -21,7 +21,7 @@ func (as *ActionSuite) Test_HomeHandler_LoggedIn() {
 	verrs, err := u.Create(as.DB)
 	as.NoError(err)
 	as.False(verrs.HasAny())
-	as.Session.Set("current_user_id", u.ID)
+	as.signIn(u)
 
 	res := as.HTML("/auth").Get()
 	as.Equal(http.StatusOK, res.Code)
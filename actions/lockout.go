@@ -0,0 +1,174 @@
+package actions
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/envy"
+	"github.com/gobuffalo/nulls"
+	"github.com/pkg/errors"
+
+	"event_planner/lockout"
+	"event_planner/models"
+)
+
+// Lockout policies for password logins and recovery codes. Every failure
+// also counts against the client's IP, which catches one client trying
+// many accounts.
+var (
+	accountLockout = lockout.Policy{
+		MaxFailures: 5,
+		BaseLockout: time.Minute,
+		MaxLockout:  time.Hour,
+		Window:      24 * time.Hour,
+	}
+	ipLockout = lockout.Policy{
+		MaxFailures: 20,
+		BaseLockout: time.Minute,
+		MaxLockout:  time.Hour,
+		Window:      24 * time.Hour,
+	}
+	// After MaxFailures wrong codes the pending code is discarded as well,
+	// so a new one has to be requested.
+	recoveryLockout = lockout.Policy{
+		MaxFailures: 5,
+		BaseLockout: 15 * time.Minute,
+		MaxLockout:  24 * time.Hour,
+		Window:      24 * time.Hour,
+	}
+	// Every reset request counts as a failure, so the form can't be used
+	// to flood an inbox or keep replacing the code its owner is typing.
+	recoveryRequests = lockout.Policy{
+		MaxFailures: 3,
+		BaseLockout: 10 * time.Minute,
+		MaxLockout:  time.Hour,
+		Window:      time.Hour,
+	}
+	recoveryRequestsIP = lockout.Policy{
+		MaxFailures: 20,
+		BaseLockout: 10 * time.Minute,
+		MaxLockout:  time.Hour,
+		Window:      time.Hour,
+	}
+)
+
+// trustProxy makes clientIP believe X-Forwarded-For. Only set it when the
+// app is behind a proxy that overwrites that header.
+var trustProxy = envy.Get("TRUST_PROXY", "false") == "true"
+
+// NewAttemptStore picks where failed attempts are counted from
+// LOCKOUT_STORE: "db" (the default) shares them between app instances
+// through the database, "memory" keeps them in the process.
+func NewAttemptStore() (lockout.Store, error) {
+	switch envy.Get("LOCKOUT_STORE", "db") {
+	case "db":
+		return lockout.DBStore{DB: models.DB}, nil
+	case "memory":
+		return lockout.NewMemoryStore(), nil
+	default:
+		return nil, errors.Errorf("unknown LOCKOUT_STORE %q", envy.Get("LOCKOUT_STORE", ""))
+	}
+}
+
+// SetupThrottle sets the login throttle on the context.
+func SetupThrottle(t lockout.Throttle) buffalo.MiddlewareFunc {
+	return func(next buffalo.Handler) buffalo.Handler {
+		return func(c buffalo.Context) error {
+			c.Set("throttle", t)
+			return next(c)
+		}
+	}
+}
+
+func throttle(c buffalo.Context) lockout.Throttle {
+	return c.Value("throttle").(lockout.Throttle)
+}
+
+// Throttle keys. Emails are normalized so case and spacing don't give an
+// attacker fresh counters.
+func accountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func recoveryKey(email string) string {
+	return "recovery:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func recoveryRequestKey(email string) string {
+	return "recovery-request:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+func recoveryRequestIPKey(ip string) string {
+	return "recovery-request-ip:" + ip
+}
+
+// clientIP returns the address the request came from.
+func clientIP(c buffalo.Context) string {
+	req := c.Request()
+	if trustProxy {
+		if fwd := req.Header.Get("X-Forwarded-For"); fwd != "" {
+			return strings.TrimSpace(strings.Split(fwd, ",")[0])
+		}
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// audit records action for the account typed as email. It writes outside
+// the request's transaction so failed attempts are kept, and only logs its
+// own errors: auditing must not block a login.
+func audit(c buffalo.Context, action, email string, u *models.User, detail string) {
+	a := &models.AuditEvent{
+		Action: action,
+		Email:  strings.ToLower(strings.TrimSpace(email)),
+		IP:     clientIP(c),
+		Detail: detail,
+	}
+	if u != nil {
+		a.UserID = nulls.NewUUID(u.ID)
+	}
+	err := models.RecordAudit(models.DB, a)
+	if err != nil {
+		log.Printf("error recording %s audit for %s %s", action, a.Email, err)
+	}
+}
+
+// lockedUntil returns until when any of the keys is locked out.
+func lockedUntil(c buffalo.Context, keys ...string) (time.Time, error) {
+	return throttle(c).LockedUntil(time.Now().UTC(), keys...)
+}
+
+// failAttempt counts a failure against key and audits the lockout it
+// causes, if any.
+func failAttempt(c buffalo.Context, key string, p lockout.Policy, action, email string, u *models.User) (lockout.Attempt, error) {
+	now := time.Now().UTC()
+	a, err := throttle(c).Fail(key, p, now)
+	if err != nil {
+		return a, err
+	}
+	if a.IsLocked(now) {
+		audit(c, action, email, u, fmt.Sprintf("%d failures, locked until %s", a.Failures, a.LockedUntil.Format(time.RFC3339)))
+	}
+	return a, nil
+}
+
+// waitMessage tells the user how long a lockout lasts, in whole minutes.
+func waitMessage(until time.Time) string {
+	minutes := int(math.Ceil(time.Until(until).Minutes()))
+	if minutes <= 1 {
+		return "Too many failed attempts. Try again in a minute."
+	}
+	return fmt.Sprintf("Too many failed attempts. Try again in %d minutes.", minutes)
+}
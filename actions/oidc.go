@@ -0,0 +1,278 @@
+package actions
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/envy"
+	"github.com/gobuffalo/pop/v6"
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+
+	"event_planner/models"
+)
+
+// passwordLogin allows signing in and registering with a password. Set
+// PASSWORD_LOGIN=false for deployments where everyone signs in through
+// the identity provider.
+var passwordLogin = envy.Get("PASSWORD_LOGIN", "true") != "false"
+
+// Session keys for a sign-in in progress at the identity provider.
+const (
+	oidcStateKey    = "oidc_state"
+	oidcNonceKey    = "oidc_nonce"
+	oidcVerifierKey = "oidc_verifier"
+	oidcAtKey       = "oidc_started_at"
+)
+
+// oidcLoginTTL is how long the provider may take to send someone back.
+const oidcLoginTTL = 10 * time.Minute
+
+// ssoReauthWindow is how long after signing in at the provider a user can
+// confirm account changes without a password; accounts created through
+// the provider don't have one they know.
+const ssoReauthWindow = 15 * time.Minute
+
+// OIDCLogin is single sign-on through an OpenID Connect provider. The
+// provider is discovered on first use, so the app starts even when it is
+// unreachable.
+type OIDCLogin struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// Name is shown on the sign-in button.
+	Name string
+	// RedirectURL is registered at the provider. It defaults to
+	// /login/oidc/callback on the app's host.
+	RedirectURL string
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+// NewOIDCLogin configures single sign-on from OIDC_ISSUER, OIDC_CLIENT_ID,
+// OIDC_CLIENT_SECRET, OIDC_NAME and OIDC_REDIRECT_URL. It returns nil when
+// OIDC_ISSUER is not set.
+func NewOIDCLogin() (*OIDCLogin, error) {
+	issuer := envy.Get("OIDC_ISSUER", "")
+	if issuer == "" {
+		return nil, nil
+	}
+
+	o := &OIDCLogin{
+		Issuer:       issuer,
+		ClientID:     envy.Get("OIDC_CLIENT_ID", ""),
+		ClientSecret: envy.Get("OIDC_CLIENT_SECRET", ""),
+		Name:         envy.Get("OIDC_NAME", "single sign-on"),
+		RedirectURL:  envy.Get("OIDC_REDIRECT_URL", ""),
+	}
+	if o.ClientID == "" || o.ClientSecret == "" {
+		return nil, errors.New("OIDC_CLIENT_ID and OIDC_CLIENT_SECRET must be set with OIDC_ISSUER")
+	}
+	return o, nil
+}
+
+// config discovers the provider if needed and returns the client settings
+// for it.
+func (o *OIDCLogin) config(ctx context.Context) (*oidc.Provider, oauth2.Config, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.provider == nil {
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		p, err := oidc.NewProvider(ctx, o.Issuer)
+		if err != nil {
+			return nil, oauth2.Config{}, errors.Wrap(err, "discovering OIDC provider")
+		}
+		o.provider = p
+	}
+
+	redirect := o.RedirectURL
+	if redirect == "" {
+		redirect = absoluteURL("/login/oidc/callback")
+	}
+	return o.provider, oauth2.Config{
+		ClientID:     o.ClientID,
+		ClientSecret: o.ClientSecret,
+		RedirectURL:  redirect,
+		Endpoint:     o.provider.Endpoint(),
+		Scopes:       []string{oidc.ScopeOpenID, "email", "profile"},
+	}, nil
+}
+
+// SetupOIDC sets the single sign-on configuration, which may be nil, on
+// the context, along with what the sign-in page offers.
+func SetupOIDC(o *OIDCLogin) buffalo.MiddlewareFunc {
+	return func(next buffalo.Handler) buffalo.Handler {
+		return func(c buffalo.Context) error {
+			name := ""
+			if o != nil {
+				name = o.Name
+			}
+			c.Set("oidc", o)
+			c.Set("sso_name", name)
+			c.Set("password_login", passwordLogin)
+			return next(c)
+		}
+	}
+}
+
+func oidcLogin(c buffalo.Context) *OIDCLogin {
+	o, _ := c.Value("oidc").(*OIDCLogin)
+	return o
+}
+
+// RequirePasswordLogin turns away the password sign-in, registration and
+// recovery pages when password login is disabled.
+func RequirePasswordLogin(next buffalo.Handler) buffalo.Handler {
+	return func(c buffalo.Context) error {
+		if !passwordLogin {
+			c.Flash().Add("warning", "Password login is disabled here, please use single sign-on.")
+			return c.Redirect(http.StatusSeeOther, "/login")
+		}
+		return next(c)
+	}
+}
+
+// OIDCStart sends the browser to the identity provider.
+func OIDCStart(c buffalo.Context) error {
+	o := oidcLogin(c)
+	if o == nil {
+		return c.Error(http.StatusNotFound, errors.New("single sign-on is not configured"))
+	}
+
+	_, cfg, err := o.config(c.Request().Context())
+	if err != nil {
+		log.Printf("error starting single sign-on %s", err)
+		c.Flash().Add("danger", "The sign-in service is not reachable, please try again later.")
+		return c.Redirect(http.StatusSeeOther, "/login")
+	}
+
+	state, err := randomToken()
+	if err != nil {
+		return err
+	}
+	nonce, err := randomToken()
+	if err != nil {
+		return err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	c.Session().Set(oidcStateKey, state)
+	c.Session().Set(oidcNonceKey, nonce)
+	c.Session().Set(oidcVerifierKey, verifier)
+	c.Session().Set(oidcAtKey, time.Now().Unix())
+	return c.Redirect(http.StatusFound, cfg.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)))
+}
+
+// OIDCCallback finishes a sign-in at the identity provider. The user is
+// found by their provider identity, or linked or created by their verified
+// email address, and then goes through two-factor authentication like a
+// password login.
+func OIDCCallback(c buffalo.Context) error {
+	o := oidcLogin(c)
+	if o == nil {
+		return c.Error(http.StatusNotFound, errors.New("single sign-on is not configured"))
+	}
+
+	state, _ := c.Session().Get(oidcStateKey).(string)
+	nonce, _ := c.Session().Get(oidcNonceKey).(string)
+	verifier, _ := c.Session().Get(oidcVerifierKey).(string)
+	at, _ := c.Session().Get(oidcAtKey).(int64)
+	for _, k := range []string{oidcStateKey, oidcNonceKey, oidcVerifierKey, oidcAtKey} {
+		c.Session().Delete(k)
+	}
+
+	// failed sends the browser back to the sign-in page.
+	failed := func(email, reason, msg string) error {
+		audit(c, models.AuditLoginFailed, email, nil, "oidc: "+reason)
+		c.Flash().Add("danger", msg)
+		return c.Redirect(http.StatusSeeOther, "/login")
+	}
+
+	if e := c.Param("error"); e != "" {
+		return failed("", e, "Sign-in was cancelled.")
+	}
+	if state == "" || c.Param("state") != state || time.Since(time.Unix(at, 0)) > oidcLoginTTL {
+		return failed("", "bad state", "Your sign-in expired, please try again.")
+	}
+
+	ctx := c.Request().Context()
+	provider, cfg, err := o.config(ctx)
+	if err != nil {
+		log.Printf("error finishing single sign-on %s", err)
+		return failed("", "discovery", "The sign-in service is not reachable, please try again later.")
+	}
+
+	tok, err := cfg.Exchange(ctx, c.Param("code"), oauth2.VerifierOption(verifier))
+	if err != nil {
+		log.Printf("error exchanging single sign-on code %s", err)
+		return failed("", "exchange", "We couldn't sign you in, please try again.")
+	}
+	raw, _ := tok.Extra("id_token").(string)
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: o.ClientID}).Verify(ctx, raw)
+	if err != nil || idToken.Nonce != nonce {
+		log.Printf("rejected single sign-on ID token %v", err)
+		return failed("", "id token", "We couldn't sign you in, please try again.")
+	}
+
+	var claims struct {
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return errors.WithStack(err)
+	}
+
+	tx := c.Value("tx").(*pop.Connection)
+	u, linked, err := models.FindOrCreateSSOUser(tx, models.SSOIdentity{
+		Issuer:        idToken.Issuer,
+		Subject:       idToken.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+	}, time.Now().UTC())
+	switch {
+	case errors.Is(err, models.ErrUnverifiedSSOEmail):
+		return failed(claims.Email, "email not verified", "Your email address isn't confirmed with "+o.Name+", so we can't sign you in.")
+	case errors.Is(err, models.ErrSSOAccountLinked):
+		return failed(claims.Email, "account linked elsewhere", "The account for "+claims.Email+" is linked to another "+o.Name+" identity.")
+	case err != nil:
+		return err
+	}
+	if linked {
+		audit(c, models.AuditSSOLinked, u.Email, u, idToken.Issuer)
+	}
+
+	if u.HasTwoFactor() {
+		return startTwoFactor(c, u, "oidc")
+	}
+	return logIn(c, u, "oidc")
+}
+
+// confirmIdentity reports whether the current user may make a sensitive
+// account change: they gave their password, or signed in at the identity
+// provider a moment ago.
+func confirmIdentity(c buffalo.Context, u *models.User, password string) bool {
+	if u.CheckPassword(password) {
+		return true
+	}
+	s := currentSession(c)
+	return s != nil && strings.HasPrefix(s.Method, "oidc") && time.Since(s.CreatedAt) < ssoReauthWindow
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.WithStack(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
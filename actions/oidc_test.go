@@ -0,0 +1,158 @@
+package actions
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gobuffalo/httptest"
+
+	"event_planner/models"
+	"event_planner/oidcstub"
+)
+
+// ssoLogin signs in at the test provider as id and returns the response
+// to the callback.
+func (as *ActionSuite) ssoLogin(id oidcstub.Identity) *httptest.Response {
+	testIdP.Identity = &id
+	defer func() { testIdP.Identity = nil }()
+
+	res := as.HTML("/login/oidc").Get()
+	as.Equal(http.StatusFound, res.Code)
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	idp, err := client.Get(res.Location())
+	as.NoError(err)
+	idp.Body.Close()
+	as.Equal(http.StatusFound, idp.StatusCode)
+
+	back, err := url.Parse(idp.Header.Get("Location"))
+	as.NoError(err)
+	as.Equal("/login/oidc/callback", back.Path)
+	return as.HTML(back.RequestURI()).Get()
+}
+
+func (as *ActionSuite) Test_OIDC_CreatesUser() {
+	res := as.ssoLogin(oidcstub.Identity{Subject: "s1", Email: "New@Example.com", EmailVerified: true})
+	as.Equal(http.StatusFound, res.Code)
+	as.Equal("/", res.Location())
+
+	u := &models.User{}
+	as.NoError(as.DB.Where("email = ?", "new@example.com").First(u))
+	as.Equal(u.ID, as.Session.Get("current_user_id"))
+	as.True(u.IsVerified())
+	as.Equal(models.RoleMember, u.Role)
+
+	s := &models.UserSession{}
+	as.NoError(as.DB.Find(s, as.Session.Get(sessionIDKey)))
+	as.Equal("oidc", s.Method)
+
+	// Signing in again finds the same account.
+	as.Session.Clear()
+	res = as.ssoLogin(oidcstub.Identity{Subject: "s1", Email: "new@example.com", EmailVerified: true})
+	as.Equal(http.StatusFound, res.Code)
+	as.Equal(u.ID, as.Session.Get("current_user_id"))
+	count, err := as.DB.Count("users")
+	as.NoError(err)
+	as.Equal(1, count)
+}
+
+func (as *ActionSuite) Test_OIDC_LinksByEmail() {
+	u, err := as.createUser()
+	as.NoError(err)
+
+	res := as.ssoLogin(oidcstub.Identity{Subject: "s2", Email: u.Email, EmailVerified: true})
+	as.Equal(http.StatusFound, res.Code)
+	as.Equal(u.ID, as.Session.Get("current_user_id"))
+
+	as.NoError(as.DB.Reload(u))
+	as.True(u.HasSSO())
+	count, err := as.DB.Where("action = ?", models.AuditSSOLinked).Count(&models.AuditEvent{})
+	as.NoError(err)
+	as.Equal(1, count)
+
+	// The password still works.
+	as.Session.Clear()
+	res = as.HTML("/login").Post(&models.User{Email: u.Email, Password: "password"})
+	as.Equal(http.StatusFound, res.Code)
+	as.Equal(u.ID, as.Session.Get("current_user_id"))
+}
+
+func (as *ActionSuite) Test_OIDC_UnverifiedEmail() {
+	u, err := as.createUser()
+	as.NoError(err)
+
+	res := as.ssoLogin(oidcstub.Identity{Subject: "s3", Email: u.Email})
+	as.Equal(http.StatusSeeOther, res.Code)
+	as.Equal("/login", res.Location())
+	as.Nil(as.Session.Get("current_user_id"))
+
+	as.NoError(as.DB.Reload(u))
+	as.False(u.HasSSO())
+}
+
+func (as *ActionSuite) Test_OIDC_BadState() {
+	res := as.HTML("/login/oidc").Get()
+	as.Equal(http.StatusFound, res.Code)
+
+	res = as.HTML("/login/oidc/callback?code=x&state=forged").Get()
+	as.Equal(http.StatusSeeOther, res.Code)
+	as.Equal("/login", res.Location())
+	as.Nil(as.Session.Get("current_user_id"))
+}
+
+func (as *ActionSuite) Test_OIDC_TwoFactor() {
+	u, err := as.createUser()
+	as.NoError(err)
+	as.enableTwoFactor(u)
+
+	res := as.ssoLogin(oidcstub.Identity{Subject: "s4", Email: u.Email, EmailVerified: true})
+	as.Equal(http.StatusSeeOther, res.Code)
+	as.Equal("/login/two-factor", res.Location())
+	as.Nil(as.Session.Get("current_user_id"))
+	as.Equal("oidc", as.Session.Get(pendingMethodKey))
+}
+
+func (as *ActionSuite) Test_OIDC_ConfirmsAccountChanges() {
+	res := as.ssoLogin(oidcstub.Identity{Subject: "s5", Email: "sso@example.com", EmailVerified: true})
+	as.Equal(http.StatusFound, res.Code)
+
+	// A fresh sign-in at the provider stands in for the password nobody
+	// knows.
+	res = as.HTML("/user/email").Post(&AccountForm{Email: "moved@example.com"})
+	as.Equal(http.StatusSeeOther, res.Code)
+
+	as.NoError(as.DB.RawQuery("UPDATE user_sessions SET created_at = ?", time.Now().UTC().Add(-time.Hour)).Exec())
+	res = as.HTML("/user/email").Post(&AccountForm{Email: "again@example.com"})
+	as.Equal(http.StatusUnprocessableEntity, res.Code)
+}
+
+func (as *ActionSuite) Test_PasswordLogin_Disabled() {
+	passwordLogin = false
+	defer func() { passwordLogin = true }()
+
+	u, err := as.createUser()
+	as.NoError(err)
+
+	res := as.HTML("/login").Get()
+	as.Equal(http.StatusOK, res.Code)
+	as.Contains(res.Body.String(), "Sign in with Acme ID")
+	as.NotContains(res.Body.String(), `name="Password"`)
+
+	res = as.HTML("/login").Post(&models.User{Email: u.Email, Password: "password"})
+	as.Equal(http.StatusSeeOther, res.Code)
+	as.Nil(as.Session.Get("current_user_id"))
+
+	for _, path := range []string{"/users/new", "/password_reset", "/account_recovery"} {
+		res = as.HTML(path).Get()
+		as.Equal(http.StatusSeeOther, res.Code, path)
+		as.Equal("/login", res.Location(), path)
+	}
+
+	// Single sign-on still works.
+	res = as.ssoLogin(oidcstub.Identity{Subject: "s6", Email: u.Email, EmailVerified: true})
+	as.Equal(http.StatusFound, res.Code)
+	as.Equal(u.ID, as.Session.Get("current_user_id"))
+}
@@ -0,0 +1,113 @@
+package actions
+
+import (
+	"log"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/worker"
+	"github.com/gobuffalo/events"
+	"github.com/gobuffalo/pop/v6"
+	"github.com/pkg/errors"
+
+	"event_planner/models"
+)
+
+const deliverOutboxJob = "deliver_outbox"
+
+const (
+	// outboxPollInterval is how often the worker looks for due messages.
+	outboxPollInterval = 10 * time.Second
+	// outboxBatchSize caps the messages sent in one run.
+	outboxBatchSize = 50
+	// outboxLease is how long a claimed message is hidden from other
+	// workers while it is being sent.
+	outboxLease = 5 * time.Minute
+)
+
+// queueMail stores a message for the outbox worker to send through the
+// app's Sender. It runs in the request's transaction, so nothing goes out
+// for a request that fails.
+func queueMail(c buffalo.Context, data map[string]interface{}) error {
+	tx := c.Value("tx").(*pop.Connection)
+	_, err := models.EnqueueMessage(tx, data)
+	return err
+}
+
+// DeliverDueMessages sends every message that is due through s and records
+// the outcome of each attempt. It returns how many were sent.
+func DeliverDueMessages(db *pop.Connection, s Sender, now time.Time) (int, error) {
+	messages, err := models.DueMessages(db, now, outboxBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for i := range messages {
+		m := &messages[i]
+
+		ok, err := models.ClaimMessage(db, m, now, outboxLease)
+		if err != nil {
+			return sent, err
+		}
+		if !ok {
+			continue
+		}
+
+		data, err := m.Data()
+		if err == nil {
+			err = s.Send(data)
+		}
+		if err != nil {
+			log.Printf("error sending message %s (attempt %d) %s", m.ID, m.Attempts+1, err)
+			m.MarkFailed(err, now)
+		} else {
+			m.MarkSent(now)
+			sent++
+		}
+
+		err = db.Update(m)
+		if err != nil {
+			return sent, errors.WithStack(err)
+		}
+	}
+	return sent, nil
+}
+
+// registerOutboxWorker adds the delivery job to w.
+func registerOutboxWorker(w worker.Worker, s Sender) error {
+	return registerPollingJob(w, deliverOutboxJob, outboxPollInterval, func(now time.Time) error {
+		_, err := DeliverDueMessages(models.DB, s, now)
+		return err
+	})
+}
+
+// registerPollingJob adds a job to w that runs every interval. The job
+// reschedules itself after every run; the first run is kicked off when the
+// app starts its worker, so tasks and tests that never serve the app don't
+// poll.
+func registerPollingJob(w worker.Worker, name string, interval time.Duration, run func(now time.Time) error) error {
+	job := worker.Job{Handler: name}
+
+	err := w.Register(name, func(worker.Args) error {
+		defer func() {
+			if err := w.PerformIn(job, interval); err != nil {
+				log.Printf("error scheduling %s %s", name, err)
+			}
+		}()
+		return run(time.Now().UTC())
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = events.Listen(func(e events.Event) {
+		if e.Kind != buffalo.EvtWorkerStart {
+			return
+		}
+		if err := w.PerformIn(job, 0); err != nil {
+			log.Printf("error starting %s %s", name, err)
+		}
+	})
+	return err
+}
@@ -0,0 +1,72 @@
+package actions
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"event_planner/models"
+)
+
+type failingSender struct{}
+
+func (failingSender) Send(map[string]interface{}) error {
+	return errors.New("smtp: connection refused")
+}
+
+func (as *ActionSuite) Test_Outbox_PasswordResetQueues() {
+	u, err := as.createUser()
+	as.NoError(err)
+
+	res := as.HTML("/password_reset").Post(&RecoveryRequest{Email: u.Email})
+	as.Equal(http.StatusSeeOther, res.Code)
+
+	messages := models.OutboundMessages{}
+	as.NoError(as.DB.All(&messages))
+	as.Len(messages, 1)
+	as.Equal(u.Email, messages[0].Recipient())
+
+	// Once sent, the code and link are gone from the outbox.
+	data, err := messages[0].Data()
+	as.NoError(err)
+	code, _ := data["code"].(string)
+	resetURL, _ := data["reset_url"].(string)
+	as.NotEmpty(code)
+	as.NotEmpty(resetURL)
+
+	sent, err := DeliverDueMessages(as.DB, MockSender{}, time.Now().UTC().Add(time.Second))
+	as.NoError(err)
+	as.Equal(1, sent)
+	as.NoError(as.DB.Reload(&messages[0]))
+	as.Equal(models.MessageStatusSent, messages[0].Status)
+	as.NotContains(messages[0].Payload, code)
+	as.NotContains(messages[0].Payload, resetURL)
+}
+
+func (as *ActionSuite) Test_Outbox_Deliver() {
+	_, err := models.EnqueueMessage(as.DB, map[string]interface{}{"receiver_email": "mark@example.com"})
+	as.NoError(err)
+	now := time.Now().UTC().Add(time.Second)
+
+	sent, err := DeliverDueMessages(as.DB, failingSender{}, now)
+	as.NoError(err)
+	as.Equal(0, sent)
+
+	m := &models.OutboundMessage{}
+	as.NoError(as.DB.First(m))
+	as.Equal(1, m.Attempts)
+	as.Equal(models.MessageStatusPending, m.Status)
+	as.True(m.NextAttemptAt.After(now))
+
+	// Not due again until the backoff has passed.
+	sent, err = DeliverDueMessages(as.DB, MockSender{}, now)
+	as.NoError(err)
+	as.Equal(0, sent)
+
+	sent, err = DeliverDueMessages(as.DB, MockSender{}, m.NextAttemptAt.Add(time.Second))
+	as.NoError(err)
+	as.Equal(1, sent)
+
+	as.NoError(as.DB.Reload(m))
+	as.Equal(models.MessageStatusSent, m.Status)
+}
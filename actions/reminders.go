@@ -0,0 +1,138 @@
+package actions
+
+import (
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/buffalo/worker"
+	"github.com/gobuffalo/envy"
+	"github.com/gobuffalo/pop/v6"
+	"github.com/pkg/errors"
+
+	"event_planner/models"
+)
+
+const sendRemindersJob = "send_reminders"
+
+const (
+	// reminderPollInterval is how often the worker looks for due reminders.
+	reminderPollInterval = time.Minute
+	// reminderBatchSize caps the reminders sent per offset in one run.
+	reminderBatchSize = 100
+)
+
+// NewReminderOffsets reads how long before an event guests are reminded
+// from REMINDER_OFFSETS, a comma-separated list of Go durations in whole
+// minutes (default "24h,1h"). An empty list turns reminders off. The
+// offsets come back shortest first.
+func NewReminderOffsets() ([]time.Duration, error) {
+	offsets := []time.Duration{}
+	seen := map[time.Duration]bool{}
+	for _, s := range strings.Split(envy.Get("REMINDER_OFFSETS", "24h,1h"), ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, errors.Wrap(err, "REMINDER_OFFSETS")
+		}
+		if d < time.Minute || d%time.Minute != 0 {
+			return nil, errors.Errorf("REMINDER_OFFSETS: %s is not a whole number of minutes", s)
+		}
+		if !seen[d] {
+			seen[d] = true
+			offsets = append(offsets, d)
+		}
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	return offsets, nil
+}
+
+// SendDueReminders sends the reminders that are due at each offset
+// through s and returns how many were sent. The shortest offsets go
+// first, so a guest owed several reminders at once, say after the worker
+// was down, only gets the latest. Each reminder is claimed before it is
+// sent and never retried, so none goes out twice.
+func SendDueReminders(db *pop.Connection, s Sender, offsets []time.Duration, now time.Time) (int, error) {
+	sent := 0
+	for _, offset := range offsets {
+		due, err := models.DueReminders(db, offset, now, reminderBatchSize)
+		if err != nil {
+			return sent, err
+		}
+
+		for i := range due {
+			res := &due[i]
+
+			reminder, ok, err := models.ClaimReminder(db, res, offset)
+			if err != nil {
+				return sent, err
+			}
+			if !ok {
+				continue
+			}
+
+			err = s.Send(reminderMailData(res, now))
+			if err != nil {
+				log.Printf("error sending reminder %s %s", reminder.ID, err)
+				reminder.MarkFailed(err)
+			} else {
+				reminder.MarkSent(now)
+				sent++
+			}
+
+			err = db.Update(reminder)
+			if err != nil {
+				return sent, errors.WithStack(err)
+			}
+		}
+	}
+	return sent, nil
+}
+
+// reminderMailData builds the reminder for a reservation with its guest
+// and event loaded.
+func reminderMailData(res *models.EventAttendee, now time.Time) map[string]interface{} {
+	data := eventMailData(res.Event)
+	when := startsIn(res.Event.Date.Sub(now))
+	data["template"] = "reminder"
+	data["subject"] = "Reminder: " + res.Event.Title + " starts " + when
+	data["receiver_email"] = res.Guest.Email
+	data["starts_in"] = when
+	data["manage_url"] = reservationURL(res)
+	data["ticket_url"] = ticketURL(res)
+	data["qr_code"] = checkInURL(res)
+	return data
+}
+
+// startsIn describes how far off an event is, rounded to a unit that
+// reads naturally.
+func startsIn(d time.Duration) string {
+	n, unit := int(d.Round(time.Minute)/time.Minute), "minute"
+	switch {
+	case d >= 48*time.Hour:
+		n, unit = int(d.Round(24*time.Hour)/(24*time.Hour)), "day"
+	case d >= 90*time.Minute:
+		n, unit = int(d.Round(time.Hour)/time.Hour), "hour"
+	}
+	if n != 1 {
+		unit += "s"
+	}
+	return "in " + strconv.Itoa(n) + " " + unit
+}
+
+// registerReminderWorker adds the reminder job to w. It isn't added when
+// there are no offsets.
+func registerReminderWorker(w worker.Worker, s Sender, offsets []time.Duration) error {
+	if len(offsets) == 0 {
+		return nil
+	}
+	return registerPollingJob(w, sendRemindersJob, reminderPollInterval, func(now time.Time) error {
+		_, err := SendDueReminders(models.DB, s, offsets, now)
+		return err
+	})
+}
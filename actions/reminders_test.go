@@ -0,0 +1,108 @@
+package actions
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/envy"
+
+	"event_planner/models"
+)
+
+// recordingSender keeps what it is asked to send.
+type recordingSender struct {
+	sent []map[string]interface{}
+}
+
+func (s *recordingSender) Send(data map[string]interface{}) error {
+	s.sent = append(s.sent, data)
+	return nil
+}
+
+func (as *ActionSuite) Test_Reservation_Confirmation() {
+	e := as.createEvent()
+	e.Location = "Town hall"
+	as.NoError(as.DB.Update(e))
+
+	res := as.HTML("/events/%s/add-guest", e.ID).Post(&models.Guest{Email: "bob@example.com", FullName: "Bob"})
+	as.Equal(http.StatusMovedPermanently, res.Code)
+
+	mail := as.lastMail()
+	as.Equal("reservation", mail["template"])
+	as.Equal("Town hall", mail["event_location"])
+	as.Equal("Bring a game", mail["event_description"])
+	ics := mail["ics"].(string)
+	as.True(strings.HasPrefix(ics, "BEGIN:VCALENDAR"), ics)
+	as.Contains(ics, "UID:"+e.ID.String()+"@event_planner")
+}
+
+func (as *ActionSuite) Test_Reminders() {
+	e := as.createEvent()
+	g := &models.Guest{Email: "bob@example.com", FullName: "Bob"}
+	as.NoError(as.DB.Create(g))
+	res, err := models.Reserve(as.DB, e.ID, g.ID)
+	as.NoError(err)
+	as.NoError(as.DB.RawQuery("UPDATE event_attendees SET created_at = ? WHERE id = ?", e.Date.Add(-72*time.Hour), res.ID).Exec())
+
+	offsets := []time.Duration{time.Hour, 24 * time.Hour}
+	s := &recordingSender{}
+
+	// Nothing is due two days out.
+	sent, err := SendDueReminders(as.DB, s, offsets, e.Date.Add(-48*time.Hour))
+	as.NoError(err)
+	as.Equal(0, sent)
+
+	now := e.Date.Add(-23 * time.Hour)
+	sent, err = SendDueReminders(as.DB, s, offsets, now)
+	as.NoError(err)
+	as.Equal(1, sent)
+	as.Equal("reminder", s.sent[0]["template"])
+	as.Equal("bob@example.com", s.sent[0]["receiver_email"])
+	as.Equal("in 23 hours", s.sent[0]["starts_in"])
+
+	// Running again, even from another worker, doesn't repeat it.
+	sent, err = SendDueReminders(as.DB, s, offsets, now.Add(time.Minute))
+	as.NoError(err)
+	as.Equal(0, sent)
+
+	// A failed send is recorded and not retried.
+	_, err = SendDueReminders(as.DB, failingSender{}, offsets, e.Date.Add(-30*time.Minute))
+	as.NoError(err)
+	sent, err = SendDueReminders(as.DB, s, offsets, e.Date.Add(-20*time.Minute))
+	as.NoError(err)
+	as.Equal(0, sent)
+	as.Len(s.sent, 1)
+
+	reminders := models.EventReminders{}
+	as.NoError(as.DB.Order("offset_minutes").All(&reminders))
+	as.Len(reminders, 2)
+	as.True(reminders[0].LastError.Valid)
+	as.True(reminders[1].SentAt.Valid)
+}
+
+func (as *ActionSuite) Test_ReminderOffsets() {
+	envy.Temp(func() {
+		envy.Set("REMINDER_OFFSETS", "1h, 24h,30m,1h")
+		offsets, err := NewReminderOffsets()
+		as.NoError(err)
+		as.Equal([]time.Duration{30 * time.Minute, time.Hour, 24 * time.Hour}, offsets)
+
+		envy.Set("REMINDER_OFFSETS", "")
+		offsets, err = NewReminderOffsets()
+		as.NoError(err)
+		as.Empty(offsets)
+
+		envy.Set("REMINDER_OFFSETS", "90s")
+		_, err = NewReminderOffsets()
+		as.Error(err)
+	})
+}
+
+func (as *ActionSuite) Test_StartsIn() {
+	as.Equal("in 1 minute", startsIn(50*time.Second))
+	as.Equal("in 45 minutes", startsIn(45*time.Minute))
+	as.Equal("in 2 hours", startsIn(100*time.Minute))
+	as.Equal("in 24 hours", startsIn(24*time.Hour))
+	as.Equal("in 3 days", startsIn(71*time.Hour))
+}
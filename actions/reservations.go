@@ -0,0 +1,177 @@
+package actions
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/pop/v6"
+
+	"event_planner/ical"
+	"event_planner/models"
+)
+
+const reservationTokenPurpose = "reservation"
+
+// reservationURL is the management link mailed to a guest. Anyone holding
+// it can change the RSVP, so it's only sent to the guest's own address.
+func reservationURL(res *models.EventAttendee) string {
+	id := res.ID.String()
+	return absoluteURL("/reservations/" + id + "?token=" + signToken(reservationTokenPurpose, id))
+}
+
+// eventMailData holds the event details shown in guest emails.
+func eventMailData(event *models.Event) map[string]interface{} {
+	return map[string]interface{}{
+		"event_title":       event.Title,
+		"event_when":        event.When(),
+		"event_location":    event.Location,
+		"event_description": event.Description,
+		"event_url":         absoluteURL(event.ToLink()),
+	}
+}
+
+// sendReservationLink queues the guest's confirmation: the event details
+// with an .ics file to add it to their calendar, their management link
+// and, if they have a seat, their ticket. Failures are logged; the
+// reservation itself stands.
+func sendReservationLink(c buffalo.Context, event *models.Event, guest *models.Guest, res *models.EventAttendee) {
+	data := eventMailData(event)
+	data["template"] = "reservation"
+	data["subject"] = "Your reservation for " + event.Title
+	data["receiver_email"] = guest.Email
+	data["status"] = res.Status
+	data["manage_url"] = reservationURL(res)
+	data["calendar_url"] = calendarURL(guest)
+	data["ticket_url"] = ticketURL(res)
+	data["ics"] = ical.Calendar{Method: "PUBLISH", Events: []ical.Event{icalEvent(*event)}}.String()
+	if res.IsAdmitted() {
+		data["qr_code"] = checkInURL(res)
+	}
+	err := queueMail(c, data)
+	if err != nil {
+		log.Printf("error queueing reservation link %s", err)
+	}
+}
+
+// findSignedReservation loads the reservation in the id param if the
+// request carries a valid token for it.
+func findSignedReservation(c buffalo.Context) (*models.EventAttendee, bool) {
+	tx := c.Value("tx").(*pop.Connection)
+	res := &models.EventAttendee{}
+
+	if !verifyToken(reservationTokenPurpose, c.Param("id"), c.Param("token")) {
+		return nil, false
+	}
+
+	err := tx.Eager("Event", "Guest").Find(res, c.Param("id"))
+	if err != nil {
+		log.Printf("error finding reservation %s", err)
+		return nil, false
+	}
+	return res, true
+}
+
+// ReservationHandler returns GET for a guest's RSVP page.
+func ReservationHandler(c buffalo.Context) error {
+	res, ok := findSignedReservation(c)
+	if !ok {
+		c.Flash().Add("danger", "That reservation link is not valid.")
+		return c.Redirect(http.StatusFound, "/")
+	}
+
+	setViewerTime(c, *res.Event)
+	c.Set("reservation", res)
+	c.Set("token", c.Param("token"))
+	c.Set("rsvps", models.RSVPs)
+	c.Set("calendarURL", calendarURL(res.Guest))
+	c.Set("ticketURL", ticketURL(res))
+	return c.Render(http.StatusOK, r.HTML("reservations/manage"))
+}
+
+// ReservationForm is the payload for changing an RSVP.
+type ReservationForm struct {
+	Token string `form:"token"`
+	RSVP  string `form:"RSVP"`
+}
+
+// ReservationUpdateHandler responds to POST to change a guest's RSVP.
+func ReservationUpdateHandler(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+
+	res, ok := findSignedReservation(c)
+	if !ok {
+		c.Flash().Add("danger", "That reservation link is not valid.")
+		return c.Redirect(http.StatusFound, "/")
+	}
+	manageURL := "/reservations/" + res.ID.String() + "?token=" + c.Param("token")
+
+	req := &ReservationForm{}
+	err := c.Bind(req)
+	if err != nil {
+		log.Printf("form error %s", err)
+		return c.Redirect(301, "/")
+	}
+
+	if res.Event.IsCancelled() {
+		c.Flash().Add("warning", "This event has been cancelled.")
+		return c.Redirect(http.StatusSeeOther, manageURL)
+	}
+
+	_, err = models.SetRSVP(tx, res, req.RSVP)
+	if err != nil {
+		log.Printf("error updating rsvp %s", err)
+		c.Flash().Add("danger", "Could not update your RSVP.")
+		return c.Redirect(http.StatusSeeOther, manageURL)
+	}
+
+	msg := "Your RSVP is now: " + res.RSVP
+	if res.HoldsSpot() && res.IsWaitlisted() {
+		msg += " (waitlisted)"
+	}
+	c.Flash().Add("info", msg)
+	return c.Redirect(http.StatusSeeOther, manageURL)
+}
+
+// ReservationNameForm is the payload for a guest correcting their name.
+type ReservationNameForm struct {
+	Token    string `form:"token"`
+	FullName string `form:"FullName"`
+}
+
+// ReservationNameHandler responds to POST to change the guest's name. Only
+// the guest, through their signed link, can replace a name; sign-up forms
+// just fill in a missing one.
+func ReservationNameHandler(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+
+	res, ok := findSignedReservation(c)
+	if !ok {
+		c.Flash().Add("danger", "That reservation link is not valid.")
+		return c.Redirect(http.StatusFound, "/")
+	}
+	manageURL := "/reservations/" + res.ID.String() + "?token=" + c.Param("token")
+
+	req := &ReservationNameForm{}
+	err := c.Bind(req)
+	if err != nil {
+		log.Printf("form error %s", err)
+		return c.Redirect(301, "/")
+	}
+
+	if strings.TrimSpace(req.FullName) == "" {
+		c.Flash().Add("warning", "Please enter your name.")
+		return c.Redirect(http.StatusSeeOther, manageURL)
+	}
+
+	err = res.Guest.Rename(tx, req.FullName)
+	if err != nil {
+		log.Printf("error renaming guest %s", err)
+		c.Flash().Add("danger", "Could not change your name.")
+		return c.Redirect(http.StatusSeeOther, manageURL)
+	}
+
+	c.Flash().Add("info", "Your name is now "+res.Guest.FullName)
+	return c.Redirect(http.StatusSeeOther, manageURL)
+}
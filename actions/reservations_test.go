@@ -0,0 +1,53 @@
+package actions
+
+import (
+	"net/http"
+
+	"event_planner/models"
+)
+
+func (as *ActionSuite) Test_Reservation_SignedLink() {
+	e := as.createEvent()
+	g := &models.Guest{Email: "bob@example.com", FullName: "Bob"}
+	as.NoError(as.DB.Create(g))
+	res, err := models.Reserve(as.DB, e.ID, g.ID)
+	as.NoError(err)
+
+	res2 := as.HTML("/reservations/%s?token=%s", res.ID, "forged").Get()
+	as.Equal(http.StatusFound, res2.Code)
+	as.Equal("/", res2.Location())
+
+	token := signToken(reservationTokenPurpose, res.ID.String())
+	res2 = as.HTML("/reservations/%s?token=%s", res.ID, token).Get()
+	as.Equal(http.StatusOK, res2.Code)
+	as.Contains(res2.Body.String(), "bob@example.com")
+
+	res2 = as.HTML("/reservations/%s", res.ID).Post(&ReservationForm{Token: token, RSVP: models.RSVPDeclined})
+	as.Equal(http.StatusSeeOther, res2.Code)
+
+	as.NoError(as.DB.Reload(res))
+	as.Equal(models.RSVPDeclined, res.RSVP)
+
+	jres := as.JSON("/events/json").Get()
+	as.Equal(http.StatusOK, jres.Code)
+	as.Contains(jres.Body.String(), `"declined":1`)
+}
+
+func (as *ActionSuite) Test_Reservation_Rename() {
+	e := as.createEvent()
+	g := &models.Guest{Email: "bob@example.com", FullName: "Bob"}
+	as.NoError(as.DB.Create(g))
+	res, err := models.Reserve(as.DB, e.ID, g.ID)
+	as.NoError(err)
+	token := signToken(reservationTokenPurpose, res.ID.String())
+
+	res2 := as.HTML("/reservations/%s/name", res.ID).Post(&ReservationNameForm{Token: "forged", FullName: "Mallory"})
+	as.Equal(http.StatusFound, res2.Code)
+	as.NoError(as.DB.Reload(g))
+	as.Equal("Bob", g.FullName)
+
+	res2 = as.HTML("/reservations/%s/name", res.ID).Post(&ReservationNameForm{Token: token, FullName: "Robert Smith"})
+	as.Equal(http.StatusSeeOther, res2.Code)
+	as.NoError(as.DB.Reload(g))
+	as.Equal("Robert Smith", g.FullName)
+}
@@ -0,0 +1,180 @@
+package actions
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/buffalo/worker"
+	"github.com/gobuffalo/pop/v6"
+	"github.com/gobuffalo/validate/v3"
+
+	"event_planner/models"
+	"event_planner/rrule"
+)
+
+// Which occurrences an edit to a repeating event applies to.
+const (
+	ScopeThis   = "this"
+	ScopeFuture = "future"
+)
+
+// How a repeating event ends, in the form.
+const (
+	RepeatEndsNever = "never"
+	RepeatEndsCount = "count"
+	RepeatEndsUntil = "until"
+)
+
+// RecurrenceForm is the repeat section of the event form. Repeat is empty
+// for a one-off event, or a frequency. Until is a YYYY-MM-DD date and
+// Except a list of them. Scope matters when editing an occurrence.
+type RecurrenceForm struct {
+	Repeat   string   `form:"Repeat"`
+	Interval int      `form:"RepeatInterval"`
+	Days     []string `form:"RepeatDays"`
+	Ends     string   `form:"RepeatEnds"`
+	Count    int      `form:"RepeatCount"`
+	Until    string   `form:"RepeatUntil"`
+	Except   string   `form:"RepeatExcept"`
+	Scope    string   `form:"Scope"`
+}
+
+// HasDay reports whether the weekday code is ticked, for the form.
+func (f RecurrenceForm) HasDay(code string) bool {
+	for _, d := range f.Days {
+		if d == code {
+			return true
+		}
+	}
+	return false
+}
+
+// Rule builds the recurrence rule and exception dates from the form, for
+// a series starting at start. The last date is read in start's zone, which
+// should be the event's. Problems come back under "repeat".
+func (f RecurrenceForm) Rule(start time.Time) (rrule.Rule, models.DateList, *validate.Errors) {
+	verrs := validate.NewErrors()
+	if f.Repeat == "" {
+		if f.Scope == ScopeFuture {
+			verrs.Add("repeat", "Choose how the event repeats.")
+		}
+		return rrule.Rule{}, nil, verrs
+	}
+	rule := rrule.Rule{Freq: f.Repeat, Interval: f.Interval}
+	if rule.Interval < 1 {
+		rule.Interval = 1
+	}
+
+	if f.Repeat == rrule.Weekly && len(f.Days) > 0 {
+		parsed, err := rrule.Parse("FREQ=WEEKLY;BYDAY=" + strings.Join(f.Days, ","))
+		if err != nil {
+			verrs.Add("repeat", "Pick the days of the week from the list.")
+		}
+		rule.ByDay = parsed.ByDay
+	}
+
+	switch f.Ends {
+	case RepeatEndsCount:
+		if f.Count < 1 {
+			verrs.Add("repeat", "Repeat at least once.")
+		}
+		rule.Count = f.Count
+	case RepeatEndsUntil:
+		until, err := time.ParseInLocation(models.DateFormat, f.Until, start.Location())
+		if err != nil {
+			verrs.Add("repeat", "Give the last date as YYYY-MM-DD.")
+			break
+		}
+		rule.Until = until.AddDate(0, 0, 1).Add(-time.Second)
+		if rule.Until.Before(start) {
+			verrs.Add("repeat", "The last date can't be before the event.")
+		}
+	}
+
+	exdates, err := models.ParseDateList(f.Except)
+	if err != nil {
+		verrs.Add("repeat", "Exceptions: "+err.Error()+".")
+	}
+
+	if !verrs.HasAny() {
+		if err := rule.Validate(); err != nil {
+			verrs.Add("repeat", "That repeat rule isn't supported.")
+		}
+	}
+	return rule, exdates, verrs
+}
+
+// newRecurrenceForm is the repeat section for a new event.
+func newRecurrenceForm() RecurrenceForm {
+	return RecurrenceForm{Interval: 1, Ends: RepeatEndsNever, Scope: ScopeThis}
+}
+
+// recurrenceFormFor fills the repeat section from an occurrence's series,
+// as it would continue from that occurrence: a count is what's left of it
+// and earlier exceptions are left out. Series must be loaded.
+func recurrenceFormFor(e *models.Event) RecurrenceForm {
+	f := newRecurrenceForm()
+	if e.Series == nil {
+		return f
+	}
+	rule, err := e.Series.Rule()
+	if err != nil {
+		return f
+	}
+
+	f.Repeat, f.Interval = rule.Freq, rule.Interval
+	if f.Interval < 1 {
+		f.Interval = 1
+	}
+	for _, d := range rule.ByDay {
+		f.Days = append(f.Days, strings.ToUpper(d.String()[:2]))
+	}
+	switch {
+	case rule.Count > 0:
+		f.Ends = RepeatEndsCount
+		done := len(rule.Expand(e.Series.StartsAt.In(e.Series.Zone()), e.RecurrenceID.Time, rule.Count))
+		f.Count = rule.Count - done + 1
+		if f.Count < 1 {
+			f.Count = 1
+		}
+	case !rule.Until.IsZero():
+		f.Ends = RepeatEndsUntil
+		f.Until = rule.Until.In(e.Series.Zone()).Format(models.DateFormat)
+	}
+	f.Except = e.Series.ExDates.From(e.RecurrenceID.Time.In(e.Series.Zone())).String()
+	return f
+}
+
+// applyRecurrence makes a saved event repeat, or, for an occurrence and
+// ScopeFuture, changes it and every later occurrence. It returns false
+// with nothing done if the event isn't to repeat.
+func applyRecurrence(tx *pop.Connection, event *models.Event, f RecurrenceForm, rule rrule.Rule, exdates models.DateList) (bool, error) {
+	if event.IsOccurrence() {
+		if f.Scope != ScopeFuture {
+			return false, nil
+		}
+		_, err := models.UpdateFutureOccurrences(tx, event, rule, exdates, time.Now())
+		return true, err
+	}
+	if f.Repeat == "" {
+		return false, nil
+	}
+	_, err := models.StartSeries(tx, event, rule, exdates, time.Now())
+	return true, err
+}
+
+// extendSeriesJob is the background job that keeps open-ended series
+// generated a horizon ahead.
+const extendSeriesJob = "extend_series"
+
+// extendSeriesInterval is how often it runs; the horizon is a year, so
+// twice a day is plenty.
+const extendSeriesInterval = 12 * time.Hour
+
+// registerSeriesWorker adds the series extension job to w.
+func registerSeriesWorker(w worker.Worker) error {
+	return registerPollingJob(w, extendSeriesJob, extendSeriesInterval, func(now time.Time) error {
+		_, err := models.ExtendAllSeries(models.DB, now)
+		return err
+	})
+}
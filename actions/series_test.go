@@ -0,0 +1,201 @@
+package actions
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gobuffalo/nulls"
+
+	"event_planner/models"
+)
+
+func (as *ActionSuite) Test_RecurrenceForm_Rule() {
+	start := time.Date(2030, 1, 2, 19, 0, 0, 0, time.UTC)
+	f := RecurrenceForm{Repeat: "WEEKLY", Interval: 2, Days: []string{"WE", "MO"}, Ends: RepeatEndsCount, Count: 6, Except: "2030-01-09"}
+	rule, exdates, verrs := f.Rule(start)
+	as.False(verrs.HasAny())
+	as.Equal("FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE;COUNT=6", rule.String())
+	as.Equal("2030-01-09", exdates.String())
+
+	f = RecurrenceForm{Repeat: "DAILY", Ends: RepeatEndsUntil, Until: "soon"}
+	_, _, verrs = f.Rule(start)
+	as.NotEmpty(verrs.Get("repeat"))
+
+	f = RecurrenceForm{Scope: ScopeFuture}
+	_, _, verrs = f.Rule(start)
+	as.NotEmpty(verrs.Get("repeat"))
+
+	// The last date can be the event's own, but not before it.
+	f = RecurrenceForm{Repeat: "DAILY", Ends: RepeatEndsUntil, Until: "2030-01-02"}
+	_, _, verrs = f.Rule(start)
+	as.False(verrs.HasAny())
+	f.Until = "2030-01-01"
+	_, _, verrs = f.Rule(start)
+	as.NotEmpty(verrs.Get("repeat"))
+}
+
+func (as *ActionSuite) Test_Event_Create_Recurring() {
+	u, err := as.createUser()
+	as.NoError(err)
+	as.signIn(u)
+
+	date := time.Now().Add(48 * time.Hour).UTC().Format("2006-01-02T15:04")
+	res := as.HTML("/events/new").Post(url.Values{
+		"Title":          {"Run club"},
+		"Date":           {date},
+		"Repeat":         {"WEEKLY"},
+		"RepeatInterval": {"1"},
+		"RepeatEnds":     {RepeatEndsCount},
+		"RepeatCount":    {"3"},
+	})
+	as.Equal(http.StatusMovedPermanently, res.Code)
+
+	events := models.Events{}
+	as.NoError(as.DB.Where("title = ?", "Run club").Order("event_date asc").All(&events))
+	as.Len(events, 3)
+	as.True(events[0].IsOccurrence())
+	as.Equal(events[0].SeriesID, events[2].SeriesID)
+
+	page := as.HTML("/events/%s", events[0].ID).Get()
+	as.Equal(http.StatusOK, page.Code)
+	as.Contains(page.Body.String(), "Every week, 3 times")
+}
+
+func (as *ActionSuite) Test_Event_Create_Recurring_Bounds() {
+	u, err := as.createUser()
+	as.NoError(err)
+	as.signIn(u)
+
+	res := as.HTML("/events/new").Post(url.Values{
+		"Title":       {"Run club"},
+		"Date":        {"2030-01-02T19:00"},
+		"Repeat":      {"DAILY"},
+		"RepeatEnds":  {RepeatEndsUntil},
+		"RepeatUntil": {"2030-01-01"},
+	})
+	as.Equal(http.StatusUnprocessableEntity, res.Code)
+	count, err := as.DB.Where("title = ?", "Run club").Count(&models.Event{})
+	as.NoError(err)
+	as.Equal(0, count)
+
+	// A first date past the horizon still starts the series.
+	far := time.Now().AddDate(2, 0, 0).UTC().Format("2006-01-02T15:04")
+	res = as.HTML("/events/new").Post(url.Values{
+		"Title":  {"Reunion"},
+		"Date":   {far},
+		"Repeat": {"WEEKLY"},
+	})
+	as.Equal(http.StatusMovedPermanently, res.Code)
+	e := &models.Event{}
+	as.NoError(as.DB.Where("title = ?", "Reunion").First(e))
+	as.True(e.IsOccurrence())
+}
+
+func (as *ActionSuite) Test_Event_Update_Occurrence() {
+	e := as.createManagedEvent()
+	rule, _, _ := RecurrenceForm{Repeat: "WEEKLY", Ends: RepeatEndsCount, Count: 3}.Rule(e.Date)
+	s, err := models.StartSeries(as.DB, e, rule, nil, time.Now())
+	as.NoError(err)
+	events, err := models.SeriesOccurrences(as.DB, s.ID, time.Now(), 10)
+	as.NoError(err)
+	as.Len(events, 3)
+
+	// Changing just this date leaves the others alone.
+	res := as.HTML("/events/%s/edit", events[1].ID).Post(url.Values{
+		"Title": {"Moved"},
+		"Date":  {events[1].Date.Add(time.Hour).Format("2006-01-02T15:04")},
+		"Scope": {ScopeThis},
+	})
+	as.Equal(http.StatusSeeOther, res.Code)
+	as.NoError(as.DB.Reload(&events[1]))
+	as.Equal("Moved", events[1].Title)
+	as.True(events[1].IsOccurrence())
+	as.NoError(as.DB.Reload(&events[2]))
+	as.Equal(e.Title, events[2].Title)
+
+	// Changing this and later dates updates the rest of the series.
+	res = as.HTML("/events/%s/edit", events[1].ID).Post(url.Values{
+		"Title":          {"Renamed"},
+		"Date":           {events[1].Date.Format("2006-01-02T15:04")},
+		"Scope":          {ScopeFuture},
+		"Repeat":         {"WEEKLY"},
+		"RepeatInterval": {"1"},
+		"RepeatEnds":     {RepeatEndsCount},
+		"RepeatCount":    {"2"},
+	})
+	as.Equal(http.StatusSeeOther, res.Code)
+	as.NoError(as.DB.Reload(&events[2]))
+	as.Equal("Renamed", events[2].Title)
+	as.NoError(as.DB.Reload(&events[0]))
+	as.Equal(e.Title, events[0].Title)
+
+	// A series can't be made to end before the date being edited.
+	res = as.HTML("/events/%s/edit", events[1].ID).Post(url.Values{
+		"Title":       {"Renamed"},
+		"Date":        {events[1].Date.Format("2006-01-02T15:04")},
+		"Scope":       {ScopeFuture},
+		"Repeat":      {"WEEKLY"},
+		"RepeatEnds":  {RepeatEndsUntil},
+		"RepeatUntil": {events[0].Date.Format(models.DateFormat)},
+	})
+	as.Equal(http.StatusUnprocessableEntity, res.Code)
+	as.NoError(as.DB.Reload(&events[2]))
+	as.True(events[2].IsOccurrence())
+}
+
+func (as *ActionSuite) Test_API_Events_Recurring() {
+	u, err := as.createUser()
+	as.NoError(err)
+	as.signIn(u)
+
+	res := as.JSON("/api/v1/events").Post(map[string]interface{}{
+		"title":      "Quiz night",
+		"date":       "2030-01-02T19:00:00Z",
+		"recurrence": "FREQ=YEARLY",
+	})
+	as.Equal(http.StatusUnprocessableEntity, res.Code)
+	as.Contains(res.Body.String(), `"recurrence":[`)
+
+	res = as.JSON("/api/v1/events").Post(map[string]interface{}{
+		"title":      "Quiz night",
+		"date":       "2030-01-02T19:00:00Z",
+		"recurrence": "FREQ=DAILY;UNTIL=20000101",
+	})
+	as.Equal(http.StatusUnprocessableEntity, res.Code)
+	as.Contains(res.Body.String(), `"recurrence":[`)
+
+	event := &models.Event{}
+	res = as.JSON("/api/v1/events").Post(map[string]interface{}{
+		"title":      "Quiz night",
+		"date":       "2030-01-02T19:00:00Z",
+		"recurrence": "FREQ=WEEKLY;COUNT=4",
+		"exdates":    []string{"2030-01-16"},
+	})
+	as.Equal(http.StatusCreated, res.Code)
+	res.Bind(event)
+	as.True(event.IsOccurrence())
+
+	count, err := as.DB.Where("series_id = ?", event.SeriesID).Count(&models.Event{})
+	as.NoError(err)
+	as.Equal(3, count)
+
+	res = as.JSON("/api/v1/events/%s", event.ID).Get()
+	as.Equal(http.StatusOK, res.Code)
+	as.Contains(res.Body.String(), `"rrule":"FREQ=WEEKLY;COUNT=4"`)
+
+	// A scope only makes sense on an occurrence.
+	single := as.createEvent()
+	single.OwnerID = nulls.NewUUID(u.ID)
+	as.NoError(as.DB.Update(single))
+	res = as.JSON("/api/v1/events/%s", single.ID).Put(map[string]interface{}{"scope": ScopeFuture})
+	as.Equal(http.StatusUnprocessableEntity, res.Code)
+	as.Contains(res.Body.String(), `"scope":[`)
+
+	// Renaming this and later dates keeps the series' rule.
+	res = as.JSON("/api/v1/events/%s", event.ID).Put(map[string]interface{}{"title": "Pub quiz", "scope": ScopeFuture})
+	as.Equal(http.StatusOK, res.Code)
+	renamed, err := as.DB.Where("series_id = ? AND title = ?", event.SeriesID, "Pub quiz").Count(&models.Event{})
+	as.NoError(err)
+	as.Equal(3, renamed)
+}
@@ -0,0 +1,148 @@
+package actions
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/envy"
+	"github.com/gobuffalo/pop/v6"
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+
+	"event_planner/models"
+)
+
+// sessionIDKey holds the ID of the user_sessions row behind a login,
+// next to current_user_id.
+const sessionIDKey = "session_id"
+
+// NewSessionPolicy reads how long logins last from SESSION_IDLE_TIMEOUT
+// (default 12h without a request) and SESSION_MAX_AGE (default 720h, 30
+// days, in total). Both take Go durations such as "30m".
+func NewSessionPolicy() (models.SessionPolicy, error) {
+	idle, err := time.ParseDuration(envy.Get("SESSION_IDLE_TIMEOUT", "12h"))
+	if err != nil {
+		return models.SessionPolicy{}, errors.Wrap(err, "SESSION_IDLE_TIMEOUT")
+	}
+	maxAge, err := time.ParseDuration(envy.Get("SESSION_MAX_AGE", "720h"))
+	if err != nil {
+		return models.SessionPolicy{}, errors.Wrap(err, "SESSION_MAX_AGE")
+	}
+	return models.SessionPolicy{Idle: idle, MaxAge: maxAge}, nil
+}
+
+// SetupSessionPolicy sets the session timeouts on the context.
+func SetupSessionPolicy(p models.SessionPolicy) buffalo.MiddlewareFunc {
+	return func(next buffalo.Handler) buffalo.Handler {
+		return func(c buffalo.Context) error {
+			c.Set("session_policy", p)
+			return next(c)
+		}
+	}
+}
+
+func sessionPolicy(c buffalo.Context) models.SessionPolicy {
+	return c.Value("session_policy").(models.SessionPolicy)
+}
+
+// currentSession returns the session the current user logged in with, or
+// nil for anonymous and token requests.
+func currentSession(c buffalo.Context) *models.UserSession {
+	s, _ := c.Value("current_session").(*models.UserSession)
+	return s
+}
+
+// startSession records a login by u on this device and points the cookie
+// at it.
+func startSession(c buffalo.Context, u *models.User, method string) error {
+	tx := c.Value("tx").(*pop.Connection)
+	s, err := models.NewUserSession(tx, u.ID, c.Request().UserAgent(), clientIP(c), method, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	c.Session().Set("current_user_id", u.ID)
+	c.Session().Set(sessionIDKey, s.ID)
+	return nil
+}
+
+// loadSession checks the server-side session behind the cookie and
+// records the request on it. Cookies whose session was revoked, timed out
+// or predates server-side sessions are logged out.
+func loadSession(c buffalo.Context, uid interface{}) (*models.UserSession, error) {
+	tx := c.Value("tx").(*pop.Connection)
+	now := time.Now().UTC()
+
+	userID, _ := uid.(uuid.UUID)
+	sid, _ := c.Session().Get(sessionIDKey).(uuid.UUID)
+	s, err := models.FindUserSession(tx, sid, userID, sessionPolicy(c), now)
+	if err != nil {
+		return nil, err
+	}
+	return s, s.Touch(tx, clientIP(c), now)
+}
+
+// endSession forgets the login in the cookie.
+func endSession(c buffalo.Context) {
+	c.Session().Delete("current_user_id")
+	c.Session().Delete(sessionIDKey)
+}
+
+// SessionsIndex returns GET for the current user's active sessions.
+func SessionsIndex(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+
+	sessions, err := models.ActiveSessions(tx, currentUser(c).ID, sessionPolicy(c), time.Now().UTC())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	c.Set("sessions", sessions)
+	c.Set("current_session_id", currentSession(c).ID.String())
+	return c.Render(http.StatusOK, r.HTML("sessions/index.plush.html"))
+}
+
+// SessionsRevoke responds to DELETE to log one of the current user's
+// sessions out.
+func SessionsRevoke(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	u := currentUser(c)
+
+	s := &models.UserSession{}
+	err := tx.Where("user_id = ?", u.ID).Find(s, c.Param("id"))
+	if err != nil {
+		c.Flash().Add("warning", "Session not found.")
+		return c.Redirect(http.StatusSeeOther, "/account/sessions")
+	}
+
+	err = s.Revoke(tx, time.Now().UTC())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	audit(c, models.AuditSessionsRevoked, u.Email, u, s.Device()+" from "+s.IP)
+
+	if s.ID == currentSession(c).ID {
+		endSession(c)
+		c.Flash().Add("info", "You have been logged out.")
+		return c.Redirect(http.StatusSeeOther, "/")
+	}
+	c.Flash().Add("info", "That session was logged out.")
+	return c.Redirect(http.StatusSeeOther, "/account/sessions")
+}
+
+// SessionsRevokeAll responds to DELETE to log the current user out
+// everywhere, this browser included.
+func SessionsRevokeAll(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	u := currentUser(c)
+
+	_, err := models.RevokeUserSessions(tx, u.ID, uuid.Nil, time.Now().UTC())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	audit(c, models.AuditSessionsRevoked, u.Email, u, "all")
+
+	endSession(c)
+	c.Flash().Add("info", "You have been logged out everywhere.")
+	return c.Redirect(http.StatusSeeOther, "/login")
+}
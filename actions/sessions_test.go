@@ -0,0 +1,99 @@
+package actions
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"event_planner/models"
+)
+
+func (as *ActionSuite) Test_Sessions_LoginRecordsSession() {
+	u, err := as.createUser()
+	as.NoError(err)
+
+	res := as.HTML("/login").Post(&models.User{Email: u.Email, Password: "password"})
+	as.Equal(http.StatusFound, res.Code)
+
+	s := &models.UserSession{}
+	as.NoError(as.DB.Where("user_id = ?", u.ID).First(s))
+	as.Equal(s.ID, as.Session.Get(sessionIDKey))
+	as.Equal("password", s.Method)
+
+	res = as.HTML("/user").Get()
+	as.Equal(http.StatusOK, res.Code)
+
+	// Logging out revokes the session, so a copy of the cookie is useless.
+	as.HTML("/login").Delete()
+	as.NoError(as.DB.Reload(s))
+	as.True(s.RevokedAt.Valid)
+
+	as.Session.Set("current_user_id", u.ID)
+	as.Session.Set(sessionIDKey, s.ID)
+	res = as.HTML("/user").Get()
+	as.Equal(http.StatusFound, res.Code)
+	as.Nil(as.Session.Get("current_user_id"))
+}
+
+func (as *ActionSuite) Test_Sessions_CookieWithoutSession() {
+	u, err := as.createUser()
+	as.NoError(err)
+
+	as.Session.Set("current_user_id", u.ID)
+	res := as.HTML("/user").Get()
+	as.Equal(http.StatusFound, res.Code)
+}
+
+func (as *ActionSuite) Test_Sessions_IdleTimeout() {
+	u, err := as.createUser()
+	as.NoError(err)
+	as.signIn(u)
+
+	policy, err := NewSessionPolicy()
+	as.NoError(err)
+	as.NoError(as.DB.RawQuery("UPDATE user_sessions SET last_seen_at = ?", time.Now().UTC().Add(-policy.Idle-time.Minute)).Exec())
+
+	res := as.HTML("/user").Get()
+	as.Equal(http.StatusFound, res.Code)
+}
+
+func (as *ActionSuite) Test_Sessions_Revoke() {
+	u, err := as.createUser()
+	as.NoError(err)
+	other, err := models.NewUserSession(as.DB, u.ID, "Mozilla/5.0 (Windows NT 10.0) Chrome/120.0", "10.0.0.9", "password", time.Now().UTC())
+	as.NoError(err)
+	as.signIn(u)
+
+	res := as.HTML("/account/sessions").Get()
+	as.Equal(http.StatusOK, res.Code)
+	as.Contains(res.Body.String(), "Chrome on Windows")
+	as.Contains(res.Body.String(), "this browser")
+
+	res = as.HTML("/account/sessions/%s", other.ID).Post(url.Values{"_method": {"DELETE"}})
+	as.Equal(http.StatusSeeOther, res.Code)
+	as.Equal("/account/sessions", res.Location())
+	as.NoError(as.DB.Reload(other))
+	as.True(other.RevokedAt.Valid)
+
+	res = as.HTML("/account/sessions").Post(url.Values{"_method": {"DELETE"}})
+	as.Equal(http.StatusSeeOther, res.Code)
+	as.Nil(as.Session.Get("current_user_id"))
+	active, err := models.ActiveSessions(as.DB, u.ID, models.SessionPolicy{Idle: time.Hour, MaxAge: time.Hour}, time.Now().UTC())
+	as.NoError(err)
+	as.Len(active, 0)
+}
+
+func (as *ActionSuite) Test_Sessions_RevokedOnPasswordReset() {
+	u, err := as.createUser()
+	as.NoError(err)
+	s, err := models.NewUserSession(as.DB, u.ID, "test", "10.0.0.9", "password", time.Now().UTC())
+	as.NoError(err)
+
+	token, _, err := u.StartRecovery(as.DB, time.Now().UTC())
+	as.NoError(err)
+	res := as.HTML("/account_recovery/%s", token).Post(url.Values{"Password": {"newpassword"}, "PasswordConfirmation": {"newpassword"}})
+	as.Equal(http.StatusSeeOther, res.Code)
+
+	as.NoError(as.DB.Reload(s))
+	as.True(s.RevokedAt.Valid)
+}
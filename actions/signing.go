@@ -0,0 +1,39 @@
+package actions
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+
+	"github.com/gobuffalo/envy"
+)
+
+// signingKey returns the secret used to sign links that act on someone's
+// behalf without a login. It shares SESSION_SECRET with the cookie store;
+// outside production a fixed fallback keeps local links working.
+func signingKey() []byte {
+	secret := envy.Get("SESSION_SECRET", "")
+	if secret == "" && ENV != "production" {
+		secret = "event_planner-" + ENV
+	}
+	return []byte(secret)
+}
+
+// signToken returns a URL-safe signature over id. The purpose is part of
+// the signed data so a token for one kind of link can't be used on another.
+func signToken(purpose, id string) string {
+	mac := hmac.New(sha256.New, signingKey())
+	mac.Write([]byte(purpose + ":" + id))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verifyToken checks a token made by signToken in constant time.
+func verifyToken(purpose, id, token string) bool {
+	return hmac.Equal([]byte(signToken(purpose, id)), []byte(token))
+}
+
+// absoluteURL turns an app path into a full link, for use in emails.
+func absoluteURL(path string) string {
+	return strings.TrimRight(App().Options.Host, "/") + path
+}
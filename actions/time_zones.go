@@ -0,0 +1,76 @@
+package actions
+
+import (
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+
+	"event_planner/models"
+)
+
+// timeZoneCookie holds the viewer's time zone, as set by application.js
+// from the browser.
+const timeZoneCookie = "tz"
+
+// timeZoneChoices are suggested in the event form. Any IANA zone is
+// accepted.
+var timeZoneChoices = []string{
+	"UTC",
+	"America/Los_Angeles",
+	"America/Denver",
+	"America/Chicago",
+	"America/New_York",
+	"America/Sao_Paulo",
+	"Europe/London",
+	"Europe/Paris",
+	"Europe/Berlin",
+	"Europe/Helsinki",
+	"Africa/Johannesburg",
+	"Asia/Dubai",
+	"Asia/Kolkata",
+	"Asia/Singapore",
+	"Asia/Tokyo",
+	"Australia/Sydney",
+	"Pacific/Auckland",
+}
+
+// viewerZone returns the viewer's time zone, or nil if the browser hasn't
+// told us a valid one.
+func viewerZone(c buffalo.Context) *time.Location {
+	name, err := c.Cookies().Get(timeZoneCookie)
+	if err != nil {
+		return nil
+	}
+	loc, err := models.LoadTimeZone(name)
+	if err != nil {
+		return nil
+	}
+	return loc
+}
+
+// defaultTimeZone is the zone new events start in: the viewer's if known.
+func defaultTimeZone(c buffalo.Context) string {
+	if loc := viewerZone(c); loc != nil {
+		return loc.String()
+	}
+	return models.DefaultTimeZone
+}
+
+// setViewerTime sets "viewerTime" to when the event is in the viewer's
+// zone, or to "" if that's the event's zone or unknown.
+func setViewerTime(c buffalo.Context, e models.Event) {
+	c.Set("viewerTime", "")
+	loc := viewerZone(c)
+	if loc == nil {
+		return
+	}
+	if mine, theirs := e.WhenIn(loc), e.When(); mine != theirs {
+		c.Set("viewerTime", mine)
+	}
+}
+
+// setEventFormData sets what the event form needs besides the event.
+func setEventFormData(c buffalo.Context) {
+	c.Set("tFormat", "2006-01-02T15:04")
+	c.Set("timeZones", timeZoneChoices)
+}
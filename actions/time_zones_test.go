@@ -0,0 +1,107 @@
+package actions
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gobuffalo/httptest"
+
+	"event_planner/models"
+)
+
+// htmlFrom makes a request from a browser in the named time zone.
+func (as *ActionSuite) htmlFrom(zone, u string, args ...interface{}) *httptest.Request {
+	h := httptest.New(as.App)
+	h.Cookies = timeZoneCookie + "=" + zone
+	return h.HTML(u, args...)
+}
+
+func (as *ActionSuite) Test_Event_TimeZone() {
+	u, err := as.createUser()
+	as.NoError(err)
+	as.signIn(u)
+
+	// New events start in the viewer's zone.
+	page := as.htmlFrom("America/New_York", "/events/new").Get()
+	as.Equal(http.StatusOK, page.Code)
+	as.Contains(page.Body.String(), `value="America/New_York"`)
+
+	res := as.HTML("/events/new").Post(url.Values{
+		"Title":    {"Drinks"},
+		"Date":     {"2030-01-02T19:00"},
+		"TimeZone": {"Europe/Nowhere"},
+	})
+	as.Equal(http.StatusUnprocessableEntity, res.Code)
+
+	// The form's time is in the event's zone, and stored in UTC.
+	res = as.HTML("/events/new").Post(url.Values{
+		"Title":    {"Drinks"},
+		"Date":     {"2030-01-02T19:00"},
+		"TimeZone": {"Europe/Berlin"},
+		"Duration": {"120"},
+	})
+	as.Equal(http.StatusMovedPermanently, res.Code)
+	e := &models.Event{}
+	as.NoError(as.DB.Where("title = ?", "Drinks").First(e))
+	as.Equal("Europe/Berlin", e.TimeZone)
+	as.Equal(time.Date(2030, 1, 2, 18, 0, 0, 0, time.UTC), e.Date.UTC())
+
+	page = as.HTML("/events/%s", e.ID).Get()
+	as.Contains(page.Body.String(), "Jan. 02 2030 7:00 PM CET to 9:00 PM")
+	as.NotContains(page.Body.String(), "Your time")
+
+	page = as.htmlFrom("America/New_York", "/events/%s", e.ID).Get()
+	as.Contains(page.Body.String(), "Your time: Jan. 02 2030 1:00 PM EST to 3:00 PM")
+
+	// The edit form shows and takes the time in the event's zone.
+	page = as.HTML("/events/%s/edit", e.ID).Get()
+	as.Contains(page.Body.String(), `value="2030-01-02T19:00"`)
+	res = as.HTML("/events/%s/edit", e.ID).Post(url.Values{
+		"Title":    {"Drinks"},
+		"Date":     {"2030-01-02T19:00"},
+		"TimeZone": {"Asia/Tokyo"},
+	})
+	as.Equal(http.StatusSeeOther, res.Code)
+	as.NoError(as.DB.Reload(e))
+	as.Equal(time.Date(2030, 1, 2, 10, 0, 0, 0, time.UTC), e.Date.UTC())
+
+	jres := as.JSON("/api/v1/events/%s", e.ID).Get()
+	as.Contains(jres.Body.String(), `"time_zone":"Asia/Tokyo"`)
+	as.Contains(jres.Body.String(), `"date":"2030-01-02T10:00:00Z"`)
+}
+
+func (as *ActionSuite) Test_GuestList_Export_TimeZone() {
+	e := as.createManagedEvent()
+	e.TimeZone = "Asia/Tokyo"
+	as.NoError(as.DB.Update(e))
+	g := &models.Guest{Email: "ann@example.com", FullName: "Ann"}
+	as.NoError(as.DB.Create(g))
+	_, err := models.Reserve(as.DB, e.ID, g.ID)
+	as.NoError(err)
+
+	res := as.HTML("/events/%s/guests.csv", e.ID).Get()
+	as.Equal(http.StatusOK, res.Code)
+	as.Contains(res.Body.String(), "+09:00")
+	as.Equal(" (Asia/Tokyo)", headerUnit("Reserved at", e.Zone()))
+	as.Equal("", headerUnit("Email", e.Zone()))
+}
+
+func (as *ActionSuite) Test_CheckIn_TimeZone() {
+	e := as.createManagedEvent()
+	e.TimeZone = "Asia/Tokyo"
+	as.NoError(as.DB.Update(e))
+	g := &models.Guest{Email: "bob@example.com", FullName: "Bob"}
+	as.NoError(as.DB.Create(g))
+	res, err := models.Reserve(as.DB, e.ID, g.ID)
+	as.NoError(err)
+	as.NoError(models.CheckIn(as.DB, res, time.Date(2030, 1, 2, 10, 30, 0, 0, time.UTC)))
+
+	// Check-ins show at the event's time of day, not the server's.
+	page := as.HTML("/tickets/%s", res.CheckInToken).Get()
+	as.Contains(page.Body.String(), "Checked in at 7:30 PM")
+	page = as.HTML("/check-in/%s", res.CheckInToken).Get()
+	as.Contains(page.Body.String(), "Already checked in at 7:30 PM")
+	page = as.HTML("/events/%s/check-in", e.ID).Get()
+	as.Contains(page.Body.String(), "Checked in 7:30 PM")
+}
@@ -0,0 +1,176 @@
+package actions
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	csrf "github.com/gobuffalo/mw-csrf"
+	"github.com/gobuffalo/nulls"
+	"github.com/gobuffalo/pop/v6"
+
+	"event_planner/models"
+)
+
+// bearerToken returns the token from an "Authorization: Bearer" header, or
+// "" when there is none.
+func bearerToken(req *http.Request) string {
+	scheme, token, ok := strings.Cut(req.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// currentToken returns the API token the request was authenticated with,
+// or nil for session-authenticated requests.
+func currentToken(c buffalo.Context) *models.APIToken {
+	t, _ := c.Value("api_token").(*models.APIToken)
+	return t
+}
+
+// csrfUnlessToken applies CSRF protection to every request except those
+// with a bearer token. SetCurrentUser authenticates those by the token
+// alone and ignores the session cookie, so there is nothing to forge.
+func csrfUnlessToken(next buffalo.Handler) buffalo.Handler {
+	protected := csrf.New(next)
+	return func(c buffalo.Context) error {
+		if bearerToken(c.Request()) != "" {
+			return next(c)
+		}
+		return protected(c)
+	}
+}
+
+// setTokenUser authenticates a request carrying a bearer token. Requests
+// that change anything need the manage_events scope.
+func setTokenUser(c buffalo.Context, secret string, next buffalo.Handler) error {
+	tx := c.Value("tx").(*pop.Connection)
+	now := time.Now()
+
+	t, err := models.FindAPIToken(tx, secret, now)
+	if err != nil {
+		if err == models.ErrInvalidToken {
+			return apiFail(c, http.StatusUnauthorized, "invalid or expired token")
+		}
+		return apiServerError(c, err)
+	}
+
+	switch c.Request().Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+	default:
+		if !t.HasScope(models.ScopeManageEvents) {
+			return apiFail(c, http.StatusForbidden, "token is read-only")
+		}
+	}
+
+	u := &models.User{}
+	err = tx.Find(u, t.UserID)
+	if err != nil {
+		return apiServerError(c, err)
+	}
+
+	err = t.Touch(tx, now)
+	if err != nil {
+		log.Printf("error recording token use %s", err)
+	}
+
+	c.Set("current_user", u)
+	c.Set("api_token", t)
+	return next(c)
+}
+
+// RequireSession rejects token-authenticated requests, so a token can't be
+// used to mint or revoke other tokens, change the account or reach the
+// back office.
+func RequireSession(next buffalo.Handler) buffalo.Handler {
+	return func(c buffalo.Context) error {
+		if currentToken(c) != nil {
+			return apiFail(c, http.StatusForbidden, "sign in to do this")
+		}
+		return next(c)
+	}
+}
+
+// TokensIndex returns GET for the current user's tokens and the form to
+// create one.
+func TokensIndex(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	tokens := models.APITokens{}
+
+	err := tx.Where("user_id = ?", currentUser(c).ID).Order("created_at desc").All(&tokens)
+	if err != nil {
+		log.Printf("error listing tokens %s", err)
+		return c.Redirect(301, "/")
+	}
+
+	c.Set("tokens", tokens)
+	c.Set("scopes", models.TokenScopes)
+	c.Set("now", time.Now())
+	return c.Render(http.StatusOK, r.HTML("tokens/index"))
+}
+
+// TokenForm is the payload for creating a token. ExpiresInDays of 0 means
+// the token doesn't expire.
+type TokenForm struct {
+	Name          string   `form:"Name"`
+	Scopes        []string `form:"Scopes"`
+	ExpiresInDays int      `form:"ExpiresInDays"`
+}
+
+// TokensCreate responds to POST to create a token. The secret is shown
+// once, on the page this renders.
+func TokensCreate(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+
+	req := &TokenForm{}
+	err := c.Bind(req)
+	if err != nil {
+		log.Printf("form error %s", err)
+		return c.Redirect(301, "/")
+	}
+
+	expiresAt := nulls.Time{}
+	if req.ExpiresInDays > 0 {
+		expiresAt = nulls.NewTime(time.Now().AddDate(0, 0, req.ExpiresInDays))
+	}
+
+	_, secret, verrs, err := models.NewAPIToken(tx, currentUser(c).ID, req.Name, req.Scopes, expiresAt)
+	if err != nil {
+		log.Printf("error creating token %s", err)
+		return c.Redirect(301, "/")
+	}
+
+	if verrs.HasAny() {
+		c.Flash().Add("danger", verrs.Error())
+		return c.Redirect(http.StatusSeeOther, "/account/tokens")
+	}
+
+	c.Set("secret", secret)
+	return TokensIndex(c)
+}
+
+// TokensRevoke responds to DELETE to revoke one of the current user's
+// tokens.
+func TokensRevoke(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	t := &models.APIToken{}
+
+	err := tx.Where("user_id = ?", currentUser(c).ID).Find(t, c.Param("id"))
+	if err != nil {
+		log.Printf("error finding token %s", err)
+		c.Flash().Add("warning", "Token not found.")
+		return c.Redirect(http.StatusSeeOther, "/account/tokens")
+	}
+
+	err = t.Revoke(tx, time.Now())
+	if err != nil {
+		log.Printf("error revoking token %s", err)
+		return c.Redirect(301, "/")
+	}
+
+	c.Flash().Add("info", "Token revoked: "+t.Name)
+	return c.Redirect(http.StatusSeeOther, "/account/tokens")
+}
@@ -0,0 +1,64 @@
+package actions
+
+import (
+	"net/http"
+
+	"github.com/gobuffalo/nulls"
+
+	"event_planner/models"
+)
+
+func (as *ActionSuite) Test_Tokens_Bearer() {
+	u, err := as.createUser()
+	as.NoError(err)
+
+	_, readOnly, _, err := models.NewAPIToken(as.DB, u.ID, "reader", []string{models.ScopeRead}, nulls.Time{})
+	as.NoError(err)
+	_, manager, _, err := models.NewAPIToken(as.DB, u.ID, "deploy", []string{models.ScopeRead, models.ScopeManageEvents}, nulls.Time{})
+	as.NoError(err)
+
+	body := map[string]interface{}{"title": "Quiz night", "date": "2030-01-02T19:00:00Z"}
+
+	req := as.JSON("/api/v1/events")
+	req.Headers["Authorization"] = "Bearer nonsense"
+	res := req.Post(body)
+	as.Equal(http.StatusUnauthorized, res.Code)
+
+	req = as.JSON("/api/v1/events")
+	req.Headers["Authorization"] = "Bearer " + readOnly
+	res = req.Get()
+	as.Equal(http.StatusOK, res.Code)
+	res = req.Post(body)
+	as.Equal(http.StatusForbidden, res.Code)
+
+	req = as.JSON("/api/v1/events")
+	req.Headers["Authorization"] = "Bearer " + manager
+	res = req.Post(body)
+	as.Equal(http.StatusCreated, res.Code)
+
+	// A token can't be used to manage tokens.
+	hreq := as.HTML("/account/tokens")
+	hreq.Headers["Authorization"] = "Bearer " + manager
+	hres := hreq.Post(&TokenForm{Name: "more", Scopes: []string{models.ScopeManageEvents}})
+	as.Equal(http.StatusForbidden, hres.Code)
+}
+
+func (as *ActionSuite) Test_Tokens_Manage() {
+	u, err := as.createUser()
+	as.NoError(err)
+	as.signIn(u)
+
+	res := as.HTML("/account/tokens").Post(&TokenForm{Name: "laptop", Scopes: []string{models.ScopeRead}, ExpiresInDays: 30})
+	as.Equal(http.StatusOK, res.Code)
+	as.Contains(res.Body.String(), "won't be shown again")
+
+	t := &models.APIToken{}
+	as.NoError(as.DB.First(t))
+	as.Equal("laptop", t.Name)
+	as.True(t.ExpiresAt.Valid)
+
+	res = as.HTML("/account/tokens/%s", t.ID).Delete()
+	as.Equal(http.StatusSeeOther, res.Code)
+	as.NoError(as.DB.Reload(t))
+	as.True(t.RevokedAt.Valid)
+}
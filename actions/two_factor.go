@@ -0,0 +1,294 @@
+package actions
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image/png"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/pop/v6"
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+
+	"event_planner/models"
+)
+
+// Session keys for a login that passed the password check and waits for
+// the second factor.
+const (
+	pendingUserKey   = "pending_user_id"
+	pendingAtKey     = "pending_login_at"
+	pendingMethodKey = "pending_login_method"
+)
+
+// pendingLoginTTL is how long the second step may take.
+const pendingLoginTTL = 5 * time.Minute
+
+// startTwoFactor remembers a login that passed its first step, the
+// password check or single sign-on, and asks for the second factor.
+func startTwoFactor(c buffalo.Context, u *models.User, method string) error {
+	c.Session().Set(pendingUserKey, u.ID)
+	c.Session().Set(pendingAtKey, time.Now().Unix())
+	c.Session().Set(pendingMethodKey, method)
+	return c.Redirect(http.StatusSeeOther, "/login/two-factor")
+}
+
+// pendingUser loads the user of a login waiting for its second factor, or
+// returns nil if there is none or it took too long.
+func pendingUser(c buffalo.Context) (*models.User, error) {
+	id, ok := c.Session().Get(pendingUserKey).(uuid.UUID)
+	at, _ := c.Session().Get(pendingAtKey).(int64)
+	if !ok || time.Since(time.Unix(at, 0)) > pendingLoginTTL {
+		return nil, nil
+	}
+
+	tx := c.Value("tx").(*pop.Connection)
+	u := &models.User{}
+	err := tx.Find(u, id)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return u, nil
+}
+
+// TwoFactorForm is the payload of the second login step, and of the
+// account forms that ask for a code.
+type TwoFactorForm struct {
+	Code     string `form:"Code"`
+	Password string `form:"Password"`
+}
+
+// AuthTwoFactorNew asks for the second factor of a pending login.
+func AuthTwoFactorNew(c buffalo.Context) error {
+	u, err := pendingUser(c)
+	if err != nil {
+		return err
+	}
+	if u == nil {
+		c.Flash().Add("warning", "Please sign in again.")
+		return c.Redirect(http.StatusSeeOther, "/login")
+	}
+
+	return c.Render(http.StatusOK, r.HTML("auth/two_factor.plush.html"))
+}
+
+// AuthTwoFactor checks the second factor and completes the login. Wrong
+// codes count against the account like wrong passwords.
+func AuthTwoFactor(c buffalo.Context) error {
+	u, err := pendingUser(c)
+	if err != nil {
+		return err
+	}
+	if u == nil {
+		c.Flash().Add("warning", "Please sign in again.")
+		return c.Redirect(http.StatusSeeOther, "/login")
+	}
+
+	req := &TwoFactorForm{}
+	if err := c.Bind(req); err != nil {
+		return errors.WithStack(err)
+	}
+
+	keys := []string{accountKey(u.Email), ipKey(clientIP(c))}
+	until, err := lockedUntil(c, keys...)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if !until.IsZero() {
+		audit(c, models.AuditLoginBlocked, u.Email, u, "two-factor")
+		c.Session().Delete(pendingUserKey)
+		c.Flash().Add("danger", waitMessage(until))
+		return c.Redirect(http.StatusSeeOther, "/login")
+	}
+
+	tx := c.Value("tx").(*pop.Connection)
+	kind, err := u.VerifyTwoFactor(tx, req.Code, time.Now().UTC())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if kind == "" {
+		audit(c, models.AuditTwoFactorFailed, u.Email, u, "")
+		_, err = failAttempt(c, keys[0], accountLockout, models.AuditAccountLocked, u.Email, u)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		_, err = failAttempt(c, keys[1], ipLockout, models.AuditIPLocked, u.Email, u)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		c.Set("error", "That code is not valid.")
+		return c.Render(http.StatusUnauthorized, r.HTML("auth/two_factor.plush.html"))
+	}
+
+	if kind == models.SecondFactorBackupCode {
+		left, err := models.UnusedBackupCodes(tx, u.ID)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		c.Flash().Add("warning", fmt.Sprintf("You signed in with a backup code. %d of them are left.", left))
+	}
+
+	// Password logins are recorded by their second factor alone.
+	if first, _ := c.Session().Get(pendingMethodKey).(string); first != "" && first != "password" {
+		kind = first + "+" + kind
+	}
+	return logIn(c, u, kind)
+}
+
+// TwoFactorIndex returns GET for the two-factor settings of the current
+// user.
+func TwoFactorIndex(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	u := currentUser(c)
+
+	left, err := models.UnusedBackupCodes(tx, u.ID)
+	if err != nil {
+		log.Printf("error counting backup codes %s", err)
+		return c.Redirect(301, "/")
+	}
+
+	c.Set("backup_codes_left", left)
+	return c.Render(http.StatusOK, r.HTML("two_factor/index"))
+}
+
+// TwoFactorSetup responds to POST to start enrolling: it makes a new
+// secret and shows it as a QR code and otpauth URI, with a form to confirm
+// a first code.
+func TwoFactorSetup(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	u := currentUser(c)
+
+	if u.HasTwoFactor() {
+		c.Flash().Add("info", "Two-factor authentication is already on.")
+		return c.Redirect(http.StatusSeeOther, "/account/two-factor")
+	}
+
+	_, err := u.BeginTwoFactor(tx)
+	if err != nil {
+		log.Printf("error starting two-factor setup %s", err)
+		return c.Redirect(301, "/")
+	}
+	return renderTwoFactorSetup(c, u, "")
+}
+
+// renderTwoFactorSetup shows the enrollment page for the user's pending
+// secret.
+func renderTwoFactorSetup(c buffalo.Context, u *models.User, msg string) error {
+	key, err := u.TOTPKey()
+	if err != nil {
+		log.Printf("error loading two-factor key %s", err)
+		return c.Redirect(301, "/")
+	}
+
+	img, err := key.Image(200, 200)
+	if err != nil {
+		log.Printf("error drawing QR code %s", err)
+		return c.Redirect(301, "/")
+	}
+	buf := &bytes.Buffer{}
+	err = png.Encode(buf, img)
+	if err != nil {
+		log.Printf("error encoding QR code %s", err)
+		return c.Redirect(301, "/")
+	}
+
+	c.Set("otpauth_uri", key.URL())
+	c.Set("secret", key.Secret())
+	c.Set("qr_code", "data:image/png;base64,"+base64.StdEncoding.EncodeToString(buf.Bytes()))
+	c.Set("error", msg)
+	return c.Render(http.StatusOK, r.HTML("two_factor/setup"))
+}
+
+// TwoFactorEnable responds to POST with the first code from the user's
+// authenticator, and turns two-factor authentication on if it matches.
+// The backup codes are shown once, on the page this renders.
+func TwoFactorEnable(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	u := currentUser(c)
+
+	req := &TwoFactorForm{}
+	if err := c.Bind(req); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if u.HasTwoFactor() || !u.TOTPSecret.Valid {
+		return c.Redirect(http.StatusSeeOther, "/account/two-factor")
+	}
+
+	codes, err := u.EnableTwoFactor(tx, req.Code, time.Now().UTC())
+	if err != nil {
+		log.Printf("error enabling two-factor %s", err)
+		return c.Redirect(301, "/")
+	}
+	if codes == nil {
+		return renderTwoFactorSetup(c, u, "That code didn't match. Check the time on your device and try again.")
+	}
+
+	audit(c, models.AuditTwoFactorEnabled, u.Email, u, "")
+	c.Set("codes", codes)
+	return c.Render(http.StatusOK, r.HTML("two_factor/backup_codes"))
+}
+
+// TwoFactorBackupCodes responds to POST to replace the current user's
+// backup codes. It asks for a code from the authenticator first.
+func TwoFactorBackupCodes(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	u := currentUser(c)
+
+	req := &TwoFactorForm{}
+	if err := c.Bind(req); err != nil {
+		return errors.WithStack(err)
+	}
+
+	kind, err := u.VerifyTwoFactor(tx, req.Code, time.Now().UTC())
+	if err != nil {
+		log.Printf("error checking two-factor code %s", err)
+		return c.Redirect(301, "/")
+	}
+	if kind != models.SecondFactorTOTP {
+		c.Flash().Add("danger", "Enter a current code from your authenticator app.")
+		return c.Redirect(http.StatusSeeOther, "/account/two-factor")
+	}
+
+	codes, err := models.NewBackupCodes(tx, u.ID)
+	if err != nil {
+		log.Printf("error making backup codes %s", err)
+		return c.Redirect(301, "/")
+	}
+
+	c.Set("codes", codes)
+	return c.Render(http.StatusOK, r.HTML("two_factor/backup_codes"))
+}
+
+// TwoFactorDisable responds to DELETE to turn two-factor authentication
+// off. It takes the current password, so a session left open can't be
+// used to weaken the account.
+func TwoFactorDisable(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	u := currentUser(c)
+
+	req := &TwoFactorForm{}
+	if err := c.Bind(req); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if !confirmIdentity(c, u, req.Password) {
+		c.Flash().Add("danger", "Your password was not correct.")
+		return c.Redirect(http.StatusSeeOther, "/account/two-factor")
+	}
+
+	err := u.DisableTwoFactor(tx)
+	if err != nil {
+		log.Printf("error disabling two-factor %s", err)
+		return c.Redirect(301, "/")
+	}
+
+	audit(c, models.AuditTwoFactorDisabled, u.Email, u, "")
+	c.Flash().Add("info", "Two-factor authentication is off.")
+	return c.Redirect(http.StatusSeeOther, "/account/two-factor")
+}
@@ -0,0 +1,158 @@
+package actions
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pquerna/otp/totp"
+
+	"event_planner/models"
+)
+
+// enableTwoFactor turns on two-factor authentication for u and returns
+// its secret and backup codes.
+func (as *ActionSuite) enableTwoFactor(u *models.User) (string, []string) {
+	key, err := u.BeginTwoFactor(as.DB)
+	as.NoError(err)
+	// Enable with a code from a minute ago, so the current one is unused.
+	past := time.Now().UTC().Add(-time.Minute)
+	code, err := totp.GenerateCode(key.Secret(), past)
+	as.NoError(err)
+	codes, err := u.EnableTwoFactor(as.DB, code, past)
+	as.NoError(err)
+	as.Len(codes, models.BackupCodeCount)
+	return key.Secret(), codes
+}
+
+func (as *ActionSuite) Test_Auth_TwoFactor() {
+	u, err := as.createUser()
+	as.NoError(err)
+	secret, _ := as.enableTwoFactor(u)
+
+	res := as.HTML("/login").Post(&models.User{Email: u.Email, Password: "password"})
+	as.Equal(http.StatusSeeOther, res.Code)
+	as.Equal("/login/two-factor", res.Location())
+	as.Nil(as.Session.Get("current_user_id"))
+
+	res = as.HTML("/login/two-factor").Get()
+	as.Equal(http.StatusOK, res.Code)
+
+	res = as.HTML("/login/two-factor").Post(&TwoFactorForm{Code: "000000"})
+	as.Equal(http.StatusUnauthorized, res.Code)
+	as.Nil(as.Session.Get("current_user_id"))
+
+	code, err := totp.GenerateCode(secret, time.Now().UTC())
+	as.NoError(err)
+	res = as.HTML("/login/two-factor").Post(&TwoFactorForm{Code: code})
+	as.Equal(http.StatusFound, res.Code)
+	as.Equal("/", res.Location())
+	as.Equal(u.ID, as.Session.Get("current_user_id"))
+	as.Nil(as.Session.Get(pendingUserKey))
+
+	count, err := as.DB.Where("action = ? AND detail = ?", models.AuditLoginSucceeded, models.SecondFactorTOTP).Count(&models.AuditEvent{})
+	as.NoError(err)
+	as.Equal(1, count)
+}
+
+func (as *ActionSuite) Test_Auth_TwoFactorBackupCode() {
+	u, err := as.createUser()
+	as.NoError(err)
+	_, codes := as.enableTwoFactor(u)
+
+	as.HTML("/login").Post(&models.User{Email: u.Email, Password: "password"})
+	res := as.HTML("/login/two-factor").Post(&TwoFactorForm{Code: codes[0]})
+	as.Equal(http.StatusFound, res.Code)
+	as.Equal(u.ID, as.Session.Get("current_user_id"))
+
+	// The same backup code doesn't work twice.
+	as.Session.Clear()
+	as.HTML("/login").Post(&models.User{Email: u.Email, Password: "password"})
+	res = as.HTML("/login/two-factor").Post(&TwoFactorForm{Code: codes[0]})
+	as.Equal(http.StatusUnauthorized, res.Code)
+}
+
+func (as *ActionSuite) Test_Auth_TwoFactorLockout() {
+	u, err := as.createUser()
+	as.NoError(err)
+	secret, _ := as.enableTwoFactor(u)
+
+	as.HTML("/login").Post(&models.User{Email: u.Email, Password: "password"})
+	for i := 0; i < accountLockout.MaxFailures; i++ {
+		res := as.HTML("/login/two-factor").Post(&TwoFactorForm{Code: "000000"})
+		as.Equal(http.StatusUnauthorized, res.Code)
+	}
+
+	code, err := totp.GenerateCode(secret, time.Now().UTC())
+	as.NoError(err)
+	res := as.HTML("/login/two-factor").Post(&TwoFactorForm{Code: code})
+	as.Equal(http.StatusSeeOther, res.Code)
+	as.Equal("/login", res.Location())
+	as.Nil(as.Session.Get("current_user_id"))
+}
+
+func (as *ActionSuite) Test_Auth_TwoFactorNothingPending() {
+	res := as.HTML("/login/two-factor").Get()
+	as.Equal(http.StatusSeeOther, res.Code)
+	as.Equal("/login", res.Location())
+}
+
+func (as *ActionSuite) Test_TwoFactor_Enroll() {
+	u, err := as.createUser()
+	as.NoError(err)
+	as.signIn(u)
+
+	res := as.HTML("/account/two-factor").Post(url.Values{})
+	as.Equal(http.StatusOK, res.Code)
+	as.Contains(res.Body.String(), "data:image/png;base64,")
+	as.Contains(res.Body.String(), "otpauth://totp/")
+
+	as.NoError(as.DB.Reload(u))
+	as.True(u.TOTPSecret.Valid)
+	as.False(u.HasTwoFactor())
+
+	res = as.HTML("/account/two-factor/enable").Post(&TwoFactorForm{Code: "000000"})
+	as.Equal(http.StatusOK, res.Code)
+	as.Contains(res.Body.String(), "didn&#39;t match")
+
+	code, err := totp.GenerateCode(u.TOTPSecret.String, time.Now().UTC())
+	as.NoError(err)
+	res = as.HTML("/account/two-factor/enable").Post(&TwoFactorForm{Code: code})
+	as.Equal(http.StatusOK, res.Code)
+	as.Contains(res.Body.String(), "won&#39;t be shown again")
+
+	as.NoError(as.DB.Reload(u))
+	as.True(u.HasTwoFactor())
+
+	res = as.HTML("/account/two-factor").Post(url.Values{"_method": {"DELETE"}, "Password": {"wrong"}})
+	as.Equal(http.StatusSeeOther, res.Code)
+	as.NoError(as.DB.Reload(u))
+	as.True(u.HasTwoFactor(), "disabling needs the password")
+
+	res = as.HTML("/account/two-factor").Post(url.Values{"_method": {"DELETE"}, "Password": {"password"}})
+	as.Equal(http.StatusSeeOther, res.Code)
+	as.NoError(as.DB.Reload(u))
+	as.False(u.HasTwoFactor())
+}
+
+func (as *ActionSuite) Test_Admin_TwoFactorReset() {
+	admin := as.createUserWithRole("admin@example.com", models.RoleAdmin)
+	u, err := as.createUser()
+	as.NoError(err)
+	as.enableTwoFactor(u)
+
+	as.signIn(admin)
+	res := as.HTML("/admin/users/%s", u.ID).Get()
+	as.Equal(http.StatusOK, res.Code)
+	as.Contains(res.Body.String(), "/two-factor/reset")
+
+	res = as.HTML("/admin/users/%s/two-factor/reset", u.ID).Post(url.Values{})
+	as.Equal(http.StatusSeeOther, res.Code)
+
+	as.NoError(as.DB.Reload(u))
+	as.False(u.HasTwoFactor())
+
+	count, err := as.DB.Where("action = ? AND user_id = ?", models.AuditTwoFactorReset, u.ID).Count(&models.AuditEvent{})
+	as.NoError(err)
+	as.Equal(1, count)
+}
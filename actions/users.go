@@ -1,18 +1,22 @@
 package actions
 
 import (
+	"database/sql"
 	"fmt"
-	"math/rand"
 	"net/http"
-	"strconv"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/envy"
 	"github.com/gobuffalo/nulls"
 	"github.com/gobuffalo/pop/v6"
+	"github.com/gobuffalo/validate/v3"
+	"github.com/gofrs/uuid"
 	"github.com/pkg/errors"
 
+	"event_planner/mailers"
 	"event_planner/models"
 )
 
@@ -50,6 +54,11 @@ func UsersCreate(c buffalo.Context) error {
 		return errors.WithStack(err)
 	}
 
+	// Everyone signs up as an unconfirmed member; admins hand out other
+	// roles.
+	u.Role = models.RoleMember
+	u.VerifiedAt = nulls.Time{}
+
 	tx := c.Value("tx").(*pop.Connection)
 	verrs, err := u.Create(tx)
 	if err != nil {
@@ -62,8 +71,16 @@ func UsersCreate(c buffalo.Context) error {
 		return c.Render(http.StatusOK, r.HTML("users/new.plush.html"))
 	}
 
-	c.Session().Set("current_user_id", u.ID)
-	c.Flash().Add("success", "Welcome to event-planner")
+	err = sendVerification(c, u)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = startSession(c, u, "signup")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	c.Flash().Add("success", "Welcome to event-planner! We've sent you a link to confirm your email address.")
 
 	return c.Redirect(http.StatusFound, "/")
 }
@@ -72,10 +89,27 @@ func UsersCreate(c buffalo.Context) error {
 // in the session. If one is found it is set on the context.
 func SetCurrentUser(next buffalo.Handler) buffalo.Handler {
 	return func(c buffalo.Context) error {
+		// Token requests never fall back to the session cookie; they are
+		// exempt from CSRF checks on that basis.
+		if secret := bearerToken(c.Request()); secret != "" {
+			return setTokenUser(c, secret, next)
+		}
+
 		if uid := c.Session().Get("current_user_id"); uid != nil {
+			s, err := loadSession(c, uid)
+			if errors.Is(err, models.ErrSessionExpired) {
+				endSession(c)
+				c.Flash().Add("warning", "Your session has expired. Please sign in again.")
+				return next(c)
+			}
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			c.Set("current_session", s)
+
 			u := &models.User{}
 			tx := c.Value("tx").(*pop.Connection)
-			err := tx.Find(u, uid)
+			err = tx.Find(u, uid)
 			if err != nil {
 				c.Session().Delete("current_user_id")
 				c.Session().Set("redirectURL", c.Request().URL.String())
@@ -88,10 +122,17 @@ func SetCurrentUser(next buffalo.Handler) buffalo.Handler {
 	}
 }
 
+// currentUser returns the user set by SetCurrentUser, or nil when nobody
+// is logged in.
+func currentUser(c buffalo.Context) *models.User {
+	u, _ := c.Value("current_user").(*models.User)
+	return u
+}
+
 // Authorize require a user be logged in before accessing a route
 func Authorize(next buffalo.Handler) buffalo.Handler {
 	return func(c buffalo.Context) error {
-		if uid := c.Session().Get("current_user_id"); uid == nil {
+		if currentUser(c) == nil {
 			c.Session().Set("redirectURL", c.Request().URL.String())
 
 			err := c.Session().Save()
@@ -106,6 +147,20 @@ func Authorize(next buffalo.Handler) buffalo.Handler {
 	}
 }
 
+// RequireRole returns a middleware, layered on Authorize, that only lets
+// users with role (or a more privileged one) through.
+func RequireRole(role string) buffalo.MiddlewareFunc {
+	return func(next buffalo.Handler) buffalo.Handler {
+		return func(c buffalo.Context) error {
+			if !currentUser(c).HasRole(role) {
+				c.Flash().Add("danger", "You are not allowed to see that page")
+				return c.Redirect(http.StatusFound, "/")
+			}
+			return next(c)
+		}
+	}
+}
+
 // Sender interface for the recovery sender
 type Sender interface {
 	Send(map[string]interface{}) error
@@ -120,6 +175,33 @@ func (s MockSender) Send(data map[string]interface{}) error {
 	return nil
 }
 
+// NewRecoverySender picks the Sender for outgoing mail from MAIL_SENDER:
+// "smtp" delivers through the server in the SMTP_* variables, "outbox"
+// writes .eml files to OUTBOX_DIR and "mock" prints to stdout. Production
+// defaults to smtp and every other environment to the outbox.
+func NewRecoverySender() (Sender, error) {
+	kind := "outbox"
+	if ENV == "production" {
+		kind = "smtp"
+	}
+
+	switch envy.Get("MAIL_SENDER", kind) {
+	case "smtp":
+		m, err := mailers.NewSMTPSender()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return mailers.NewTemplateSender(m), nil
+	case "outbox":
+		dir := envy.Get("OUTBOX_DIR", filepath.Join("tmp", "outbox", ENV))
+		return mailers.NewTemplateSender(mailers.OutboxSender{Dir: dir}), nil
+	case "mock":
+		return MockSender{}, nil
+	default:
+		return nil, errors.Errorf("unknown MAIL_SENDER %q", envy.Get("MAIL_SENDER", kind))
+	}
+}
+
 // SetupRecoverySender sets the sender on the context.
 func SetupRecoverySender(s Sender) func(next buffalo.Handler) buffalo.Handler {
 	return func(next buffalo.Handler) buffalo.Handler {
@@ -130,24 +212,28 @@ func SetupRecoverySender(s Sender) func(next buffalo.Handler) buffalo.Handler {
 	}
 }
 
-func verifyCode() string {
-	i := rand.Intn(1000000)
-	code := strconv.Itoa(i)
-
-	for len(code) < 6 {
-		code = "0" + code
-	}
-
-	return code
-}
-
 // RecoveryRequest request struct for a recovery code
 type RecoveryRequest struct {
 	Email string `json:"email"`
 }
 
-// UserRequestRecovery handles requesting recovery for an account
-// when user provides matching email
+// recoverySentMessage is the answer to every recovery request, whether or
+// not the email has an account, so the form can't be used to find out.
+const recoverySentMessage = "If there is an account for that email, we've sent it a link to reset the password. The link and code in the email expire in 10 minutes."
+
+// recoveryURL is the one-click reset link mailed to a user.
+func recoveryURL(token string) string {
+	return absoluteURL("/account_recovery/" + token)
+}
+
+// recoveryThrottledMessage answers a reset request over the limit. Requests
+// are counted whether or not the email has an account.
+const recoveryThrottledMessage = "We've sent several emails already. Please check your spam folder, or try again later."
+
+// PasswordReset handles a request to recover an account. A reset link and
+// a code to type in are mailed if the email has an account; any earlier
+// link and code stop working. Requests are throttled per email and per
+// client.
 func PasswordReset(c buffalo.Context) error {
 	req := &RecoveryRequest{}
 
@@ -160,47 +246,61 @@ func PasswordReset(c buffalo.Context) error {
 		return errors.WithStack(errors.New("no transaction found"))
 	}
 
-	u := &models.User{}
-	if err := tx.Where(`Lower(email) = ?`, strings.ToLower(req.Email)).First(u); err != nil {
-		// return c.Error(404, errors.New("Could not recover"))
-		// TODO we cannot 404 on the email to obfuscate whether the email is found or not.
-		c.Flash().Add("danger", "Invalid data")
-		return c.Redirect(http.StatusMovedPermanently, "accountRecoveryPath()")
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	now := time.Now().UTC()
+	emailKey, ip := recoveryRequestKey(email), recoveryRequestIPKey(clientIP(c))
+	until, err := lockedUntil(c, emailKey, ip)
+	if err != nil {
+		return errors.WithStack(err)
 	}
-	u.RecoveryCode = nulls.NewString(verifyCode())
-	u.RecoveryExp = nulls.NewTime(time.Now().UTC().Add(time.Minute * 10))
-
-	verrs, err := u.Update(tx)
+	if !until.IsZero() {
+		audit(c, models.AuditRecoveryBlocked, email, nil, "too many reset requests")
+		if ct, ok := c.Value("contentType").(string); !ok || strings.Contains(ct, "html") || strings.Contains(ct, "form") {
+			c.Flash().Add("warning", recoveryThrottledMessage)
+			return c.Redirect(http.StatusSeeOther, "/password_reset")
+		}
+		return c.Render(http.StatusTooManyRequests, r.Auto(c, map[string]string{"message": recoveryThrottledMessage}))
+	}
+	_, err = throttle(c).Fail(emailKey, recoveryRequests, now)
 	if err != nil {
 		return errors.WithStack(err)
 	}
-	if verrs.HasAny() {
-		c.Set("errors", verrs)
-		c.Set("req", req)
-		return c.Render(http.StatusOK, r.HTML("users/recovery.html"))
+	_, err = throttle(c).Fail(ip, recoveryRequestsIP, now)
+	if err != nil {
+		return errors.WithStack(err)
 	}
-	go func(u *models.User) {
-		sender, ok := c.Value("recovery_sender").(Sender)
-		if !ok {
-			fmt.Printf("ERROR SENDING RECOVERY: no recovery sender found\n")
-			return
+
+	u := &models.User{}
+	err = tx.Where("email = ?", email).First(u)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		audit(c, models.AuditRecoveryRequested, email, nil, "no such account")
+	case err != nil:
+		return errors.WithStack(err)
+	default:
+		token, code, err := u.StartRecovery(tx, now)
+		if err != nil {
+			return errors.WithStack(err)
 		}
 
-		if err := sender.Send(map[string]interface{}{
-			"code":           u.RecoveryCode.String,
-			"sender_email":   "system@example.com",
+		err = queueMail(c, map[string]interface{}{
+			"template":       "recovery",
+			"subject":        "Reset your password",
+			"code":           code,
+			"reset_url":      recoveryURL(token),
 			"receiver_email": u.Email,
-		}); err != nil {
-			fmt.Printf("ERROR SENDING RECOVERY: %v\n", err)
+		})
+		if err != nil {
+			return errors.WithStack(err)
 		}
-	}(u)
+		audit(c, models.AuditRecoveryRequested, email, u, "")
+	}
 
-	// TODO what is this error?
 	if ct, ok := c.Value("contentType").(string); !ok || strings.Contains(ct, "html") || strings.Contains(ct, "form") {
-		c.Flash().Add("danger", "Something bad happened")
-		return c.Redirect(http.StatusFound, "accountRecoveryForm()")
+		c.Flash().Add("info", recoverySentMessage)
+		return c.Redirect(http.StatusSeeOther, "/account_recovery")
 	}
-	return c.Render(http.StatusOK, r.Auto(c, "Sent"))
+	return c.Render(http.StatusOK, r.Auto(c, map[string]string{"message": recoverySentMessage}))
 }
 
 // RecoveryUpdate request struct for using recovery code.
@@ -211,8 +311,8 @@ type RecoveryUpdate struct {
 	PasswordConfirmation string `json:"password_confirm"`
 }
 
-// UserRequestRecover is used to allow users to reset their passwords
-// using the recovery code we've sent them
+// AccountRecovery lets users who can't follow the emailed link reset their
+// password by typing in the code from the same email.
 func AccountRecovery(c buffalo.Context) error {
 	req := &models.RecoveryUpdate{}
 	if err := c.Bind(req); err != nil {
@@ -224,7 +324,6 @@ func AccountRecovery(c buffalo.Context) error {
 		return errors.WithStack(errors.New("no transaction found"))
 	}
 
-	u := &models.User{}
 	verrs := req.Validate()
 	if verrs.HasAny() {
 		c.Set("errors", verrs)
@@ -232,33 +331,156 @@ func AccountRecovery(c buffalo.Context) error {
 		return c.Render(http.StatusOK, r.HTML("users/recover.html"))
 	}
 
-	if err := tx.Where("Lower(email) = ?", strings.ToLower(req.Email)).First(u); err != nil {
-		c.Flash().Add("danger", "Recovery code is not valid")
-		return c.Redirect(http.StatusMovedPermanently, "accountRecoveryPath()")
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	keys := []string{recoveryKey(email), ipKey(clientIP(c))}
+	until, err := lockedUntil(c, keys...)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if !until.IsZero() {
+		audit(c, models.AuditRecoveryBlocked, email, nil, "")
+		c.Flash().Add("warning", waitMessage(until))
+		return c.Redirect(http.StatusSeeOther, "/account_recovery")
 	}
 
-	if u.RecoveryExp.Time.After(time.Now().UTC()) && u.RecoveryCode.String == req.Code {
-		u.Password = req.Password
-		u.PasswordConfirmation = req.PasswordConfirmation
-
-		u.RecoveryCode = nulls.NewString("")
-		verrs, err := u.Update(tx)
+	// invalid counts a wrong or expired code. Once the account runs out of
+	// tries its code is thrown away, so guessing on has no chance.
+	invalid := func(found *models.User) error {
+		audit(c, models.AuditRecoveryFailed, email, found, "")
+		a, err := failAttempt(c, keys[0], recoveryLockout, models.AuditRecoveryLocked, email, found)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		_, err = failAttempt(c, keys[1], ipLockout, models.AuditIPLocked, email, found)
 		if err != nil {
 			return errors.WithStack(err)
 		}
-		if verrs.HasAny() {
-			c.Set("errors", verrs)
-			c.Set("req", req)
-			return c.Render(http.StatusOK, r.HTML("users/recover.html"))
+		if found != nil && a.Failures >= recoveryLockout.MaxFailures {
+			err = found.ResetRecovery(tx)
+			if err != nil {
+				return errors.WithStack(err)
+			}
 		}
-	} else {
 		c.Flash().Add("warning", "Recovery code is not valid")
-		return c.Redirect(http.StatusMovedPermanently, "accountRecoveryPath()")
+		return c.Redirect(http.StatusSeeOther, "/account_recovery")
+	}
+
+	u, err := models.LockUserByEmail(tx, email)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return invalid(nil)
+		}
+		return errors.WithStack(err)
+	}
+
+	if !u.CheckRecoveryCode(req.Code, time.Now().UTC()) {
+		return invalid(u)
+	}
+
+	return completeRecovery(c, u, req.Password, req.PasswordConfirmation, func(verrs *validate.Errors) error {
+		c.Set("errors", verrs)
+		c.Set("req", req)
+		return c.Render(http.StatusOK, r.HTML("users/recover.html"))
+	})
+}
+
+// RecoveryLinkForm is the payload of the one-click reset page.
+type RecoveryLinkForm struct {
+	Password             string `form:"Password"`
+	PasswordConfirmation string `form:"PasswordConfirmation"`
+}
+
+// AccountRecoveryLinkForm shows the new password form for an emailed reset
+// link. Opening the link doesn't use it up, so mail scanners that follow
+// links do no harm.
+func AccountRecoveryLinkForm(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+
+	_, err := models.FindUserByRecoveryToken(tx, c.Param("token"), time.Now().UTC())
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidRecovery) {
+			c.Flash().Add("warning", "This reset link is invalid or has expired. Please ask for a new one.")
+			return c.Redirect(http.StatusSeeOther, "/password_reset")
+		}
+		return errors.WithStack(err)
+	}
+
+	c.Set("req", RecoveryLinkForm{})
+	c.Set("token", c.Param("token"))
+	return c.Render(http.StatusOK, r.HTML("users/reset.html"))
+}
+
+// AccountRecoveryLink sets the new password from the reset link's form.
+func AccountRecoveryLink(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+
+	req := &RecoveryLinkForm{}
+	if err := c.Bind(req); err != nil {
+		return errors.WithStack(err)
+	}
+
+	ip := ipKey(clientIP(c))
+	until, err := lockedUntil(c, ip)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if !until.IsZero() {
+		audit(c, models.AuditRecoveryBlocked, "", nil, "reset link")
+		c.Flash().Add("warning", waitMessage(until))
+		return c.Redirect(http.StatusSeeOther, "/password_reset")
+	}
+
+	u, err := models.FindUserByRecoveryToken(tx, c.Param("token"), time.Now().UTC())
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidRecovery) {
+			audit(c, models.AuditRecoveryFailed, "", nil, "reset link")
+			_, err = failAttempt(c, ip, ipLockout, models.AuditIPLocked, "", nil)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			c.Flash().Add("warning", "This reset link is invalid or has expired. Please ask for a new one.")
+			return c.Redirect(http.StatusSeeOther, "/password_reset")
+		}
+		return errors.WithStack(err)
+	}
+
+	return completeRecovery(c, u, req.Password, req.PasswordConfirmation, func(verrs *validate.Errors) error {
+		c.Set("errors", verrs)
+		c.Set("req", RecoveryLinkForm{})
+		c.Set("token", c.Param("token"))
+		return c.Render(http.StatusOK, r.HTML("users/reset.html"))
+	})
+}
+
+// completeRecovery sets the recovered account's new password, or hands
+// validation errors to invalid. It also lifts the account's lockouts.
+func completeRecovery(c buffalo.Context, u *models.User, password, confirmation string, invalid func(*validate.Errors) error) error {
+	tx := c.Value("tx").(*pop.Connection)
+
+	verrs, err := u.CompleteRecovery(tx, password, confirmation)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if verrs.HasAny() {
+		return invalid(verrs)
+	}
+
+	err = throttle(c).Reset(recoveryKey(u.Email), accountKey(u.Email))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	// Whoever reset the password may be locking someone else out, so every
+	// existing login ends.
+	_, err = models.RevokeUserSessions(tx, u.ID, uuid.Nil, time.Now().UTC())
+	if err != nil {
+		return errors.WithStack(err)
 	}
+	audit(c, models.AuditRecoveryCompleted, u.Email, u, "")
 
 	if ct, ok := c.Value("contentType").(string); !ok || strings.Contains(ct, "html") || strings.Contains(ct, "form") {
-		c.Flash().Add("success", "Your password has been reset")
-		return c.Redirect(http.StatusFound, "rootPath()")
+		c.Flash().Add("success", "Your password has been reset. You can log in with it now.")
+		return c.Redirect(http.StatusSeeOther, "/login")
 	}
 	return c.Render(http.StatusOK, r.Auto(c, u))
 }
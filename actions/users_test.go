@@ -2,7 +2,11 @@ package actions
 
 import (
 	"net/http"
+	"os"
+	"strings"
+	"time"
 
+	"event_planner/mailers"
 	"event_planner/models"
 )
 
@@ -40,79 +44,209 @@ func (as *ActionSuite) Test_Users_Create() {
 	as.CreateTestUser(u, false)
 }
 
+// lastMail returns the data of the most recently queued message.
+func (as *ActionSuite) lastMail() map[string]interface{} {
+	m := &models.OutboundMessage{}
+	as.NoError(as.DB.Order("created_at desc").First(m))
+	data, err := m.Data()
+	as.NoError(err)
+	return data
+}
+
 func (as *ActionSuite) Test_Users_Recover() {
-	password := "password"
-	u := &models.User{
-		Email:                "mark@example.com",
-		Password:             password,
-		PasswordConfirmation: password,
-	}
-	as.CreateTestUser(u, false)
+	u, err := as.createUser()
+	as.NoError(err)
 
-	res := as.HTML("/recovery").Get()
+	res := as.HTML("/password_reset").Get()
 	as.Equal(http.StatusOK, res.Code)
 
-	req := &RecoveryRequest{
-		Email: u.Email,
-	}
-	res = as.HTML("/requestRecovery").Post(req)
-	as.Equal(http.StatusFound, res.Code)
-	as.Equal("/recover", res.Location())
+	res = as.HTML("/password_reset").Post(&RecoveryRequest{Email: " Mark@Example.com"})
+	as.Equal(http.StatusSeeOther, res.Code)
+	as.Equal("/account_recovery", res.Location())
 
-	res = as.HTML("/recover").Get()
-	as.Equal(http.StatusOK, res.Code)
+	mail := as.lastMail()
+	as.Equal(u.Email, mail["receiver_email"])
+	code := mail["code"].(string)
+	as.Len(code, 6)
 
-	u2 := &models.User{}
-	as.DB.First(u2)
-	as.Equal(u.Email, u2.Email)
+	// Only hashes are stored.
+	as.NoError(as.DB.Reload(u))
+	as.NotEqual(code, u.RecoveryCodeHash.String)
 
 	upreq := &RecoveryUpdate{
 		Email:                u.Email,
-		Code:                 u2.RecoveryCode.String,
-		Password:             password + "2",
-		PasswordConfirmation: password + "2",
+		Code:                 code,
+		Password:             "password2",
+		PasswordConfirmation: "password2",
 	}
-	res = as.HTML("/completeRecover").Post(upreq)
-	as.Equal(http.StatusFound, res.Code)
+	res = as.HTML("/account_recovery").Post(upreq)
+	as.Equal(http.StatusSeeOther, res.Code)
+	as.Equal("/login", res.Location())
 
-	u2.Password = password + "2"
-	res = as.HTML("/signin").Post(u2)
+	// The code only works once.
+	upreq.Password, upreq.PasswordConfirmation = "password3", "password3"
+	res = as.HTML("/account_recovery").Post(upreq)
+	as.Equal("/account_recovery", res.Location())
+
+	res = as.HTML("/login").Post(&models.User{Email: u.Email, Password: "password2"})
 	as.Equal(http.StatusFound, res.Code)
 	as.Equal("/", res.Location())
 }
 
-func (as *ActionSuite) Test_Users_Recover_Fail() {
-	password := "password"
-	u := &models.User{
-		Email:                "mark@example.com",
-		Password:             password,
-		PasswordConfirmation: password,
-	}
-	as.CreateTestUser(u, false)
+func (as *ActionSuite) Test_Users_RecoverByLink() {
+	u, err := as.createUser()
+	as.NoError(err)
 
-	req := &RecoveryRequest{Email: u.Email}
-	res := as.HTML("/requestRecovery").Post(req)
-	as.Equal(http.StatusFound, res.Code)
-	as.Equal("/recover", res.Location())
+	as.HTML("/password_reset").Post(&RecoveryRequest{Email: u.Email})
+	first := as.lastMail()["reset_url"].(string)
 
-	res = as.HTML("/recover").Get()
+	// Asking again replaces the first link.
+	as.HTML("/password_reset").Post(&RecoveryRequest{Email: u.Email})
+	link := as.lastMail()["reset_url"].(string)
+	as.NotEqual(first, link)
+
+	path := link[strings.Index(link, "/account_recovery/"):]
+	oldPath := first[strings.Index(first, "/account_recovery/"):]
+
+	res := as.HTML(oldPath).Get()
+	as.Equal(http.StatusSeeOther, res.Code)
+	as.Equal("/password_reset", res.Location())
+
+	res = as.HTML(path).Get()
 	as.Equal(http.StatusOK, res.Code)
 
-	u2 := &models.User{}
-	as.DB.First(u2)
-	as.Equal(u.Email, u2.Email)
+	res = as.HTML(path).Post(&RecoveryLinkForm{Password: "password2", PasswordConfirmation: "password2"})
+	as.Equal(http.StatusSeeOther, res.Code)
+	as.Equal("/login", res.Location())
+
+	as.NoError(as.DB.Reload(u))
+	as.False(u.HasPendingRecovery())
+
+	res = as.HTML(path).Post(&RecoveryLinkForm{Password: "password3", PasswordConfirmation: "password3"})
+	as.Equal("/password_reset", res.Location())
+}
+
+func (as *ActionSuite) Test_Users_Recover_Fail() {
+	u, err := as.createUser()
+	as.NoError(err)
+
+	// Unknown emails get the same answer and no mail.
+	res := as.HTML("/password_reset").Post(&RecoveryRequest{Email: "nobody@example.com"})
+	as.Equal(http.StatusSeeOther, res.Code)
+	as.Equal("/account_recovery", res.Location())
+	count, err := as.DB.Count(&models.OutboundMessage{})
+	as.NoError(err)
+	as.Equal(0, count)
 
+	res = as.HTML("/password_reset").Post(&RecoveryRequest{Email: u.Email})
+	as.Equal(http.StatusSeeOther, res.Code)
+	code := as.lastMail()["code"].(string)
+
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
 	upreq := &RecoveryUpdate{
 		Email:                u.Email,
-		Code:                 u2.RecoveryCode.String + "nope",
-		Password:             password + "2",
-		PasswordConfirmation: password + "2",
+		Code:                 wrong,
+		Password:             "password2",
+		PasswordConfirmation: "password2",
 	}
-	res = as.HTML("/completeRecover").Post(upreq)
-	as.Equal(403, res.Code)
+	res = as.HTML("/account_recovery").Post(upreq)
+	as.Equal(http.StatusSeeOther, res.Code)
+	as.Equal("/account_recovery", res.Location())
 
-	u2.Password = password
-	res = as.HTML("/signin").Post(u2)
+	res = as.HTML("/login").Post(&models.User{Email: u.Email, Password: "password"})
 	as.Equal(http.StatusFound, res.Code)
 	as.Equal("/", res.Location())
 }
+
+func (as *ActionSuite) Test_Users_RecoveryEmail_Outbox() {
+	outbox := mailers.OutboxSender{Dir: as.T().TempDir()}
+	var s Sender = mailers.NewTemplateSender(outbox)
+
+	err := s.Send(map[string]interface{}{
+		"template":       "recovery",
+		"subject":        "Your password recovery code",
+		"code":           "012345",
+		"reset_url":      "http://127.0.0.1:3000/account_recovery/abc",
+		"receiver_email": "mark@example.com",
+	})
+	as.NoError(err)
+
+	files, err := outbox.Messages()
+	as.NoError(err)
+	as.Len(files, 1)
+
+	b, err := os.ReadFile(files[0])
+	as.NoError(err)
+	as.Contains(string(b), "To: mark@example.com")
+	as.Contains(string(b), "multipart/alternative")
+	as.Contains(string(b), "012345")
+	as.Contains(string(b), "/account_recovery/abc")
+}
+
+func (as *ActionSuite) Test_Users_RecoveryThrottle() {
+	u, err := as.createUser()
+	as.NoError(err)
+
+	for i := 0; i < recoveryRequests.MaxFailures; i++ {
+		res := as.HTML("/password_reset").Post(&RecoveryRequest{Email: u.Email})
+		as.Equal(http.StatusSeeOther, res.Code)
+		as.Equal("/account_recovery", res.Location())
+	}
+	as.NoError(as.DB.Reload(u))
+	pending := u.RecoveryCodeHash
+
+	// One more is refused, and the last code keeps working.
+	res := as.HTML("/password_reset").Post(&RecoveryRequest{Email: " " + strings.ToUpper(u.Email)})
+	as.Equal(http.StatusSeeOther, res.Code)
+	as.Equal("/password_reset", res.Location())
+	count, err := as.DB.Count(&models.OutboundMessage{})
+	as.NoError(err)
+	as.Equal(recoveryRequests.MaxFailures, count)
+	as.NoError(as.DB.Reload(u))
+	as.Equal(pending, u.RecoveryCodeHash)
+
+	// Addresses without an account count the same way.
+	for i := 0; i < recoveryRequests.MaxFailures; i++ {
+		as.HTML("/password_reset").Post(&RecoveryRequest{Email: "nobody@example.com"})
+	}
+	res = as.HTML("/password_reset").Post(&RecoveryRequest{Email: "nobody@example.com"})
+	as.Equal("/password_reset", res.Location())
+}
+
+func (as *ActionSuite) Test_Users_RecoveryLockout() {
+	u, err := as.createUser()
+	as.NoError(err)
+	_, code, err := u.StartRecovery(as.DB, time.Now().UTC())
+	as.NoError(err)
+	wrongCode := "000000"
+	if code == wrongCode {
+		wrongCode = "111111"
+	}
+
+	wrong := &RecoveryUpdate{
+		Email:                u.Email,
+		Code:                 wrongCode,
+		Password:             "new-password",
+		PasswordConfirmation: "new-password",
+	}
+	for i := 0; i < recoveryLockout.MaxFailures; i++ {
+		as.HTML("/account_recovery").Post(wrong)
+	}
+
+	// Too many wrong guesses throw the code away.
+	as.NoError(as.DB.Reload(u))
+	as.False(u.HasPendingRecovery())
+
+	right := *wrong
+	right.Code = code
+	res := as.HTML("/account_recovery").Post(&right)
+	as.Equal(http.StatusSeeOther, res.Code)
+	as.Equal("/account_recovery", res.Location())
+
+	count, err := as.DB.Where("action = ? AND user_id = ?", models.AuditRecoveryLocked, u.ID).Count(&models.AuditEvent{})
+	as.NoError(err)
+	as.Equal(1, count)
+}
@@ -0,0 +1,145 @@
+package actions
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/pop/v6"
+	"github.com/pkg/errors"
+
+	"event_planner/lockout"
+	"event_planner/models"
+)
+
+const verifyEmailTokenPurpose = "verify-email"
+
+// verificationTTL is how long an email confirmation link works.
+const verificationTTL = 72 * time.Hour
+
+// verificationResends limits how often a user can have the confirmation
+// mail sent again, so the resend button can't be used to flood an inbox.
+// Each send counts as a failure against the user's key.
+var verificationResends = lockout.Policy{
+	MaxFailures: 3,
+	BaseLockout: 10 * time.Minute,
+	MaxLockout:  time.Hour,
+	Window:      time.Hour,
+}
+
+func verifyKey(u *models.User) string {
+	return "verify:" + u.ID.String()
+}
+
+// verificationURL is the confirmation link mailed to a user. The address
+// is part of the signed data, so a link stops working if the user changes
+// their email before following it.
+func verificationURL(u *models.User, now time.Time) string {
+	id := u.ID.String()
+	exp := strconv.FormatInt(now.Add(verificationTTL).Unix(), 10)
+	token := signToken(verifyEmailTokenPurpose, id+":"+u.Email+":"+exp)
+	return absoluteURL("/users/verify/" + id + "?exp=" + exp + "&token=" + token)
+}
+
+// sendVerification queues the email with the user's confirmation link.
+func sendVerification(c buffalo.Context, u *models.User) error {
+	return queueMail(c, map[string]interface{}{
+		"template":       "verify_email",
+		"subject":        "Confirm your email address",
+		"verify_url":     verificationURL(u, time.Now().UTC()),
+		"receiver_email": u.Email,
+	})
+}
+
+// RequireVerified returns a middleware, layered on Authorize, that only
+// lets users who confirmed their email address through.
+func RequireVerified(next buffalo.Handler) buffalo.Handler {
+	return func(c buffalo.Context) error {
+		if !currentUser(c).IsVerified() {
+			c.Flash().Add("warning", "Please confirm your email address first.")
+			return c.Redirect(http.StatusSeeOther, "/users/verify")
+		}
+		return next(c)
+	}
+}
+
+// UsersVerifyPage tells the current user to check their inbox and offers
+// to send the confirmation mail again.
+func UsersVerifyPage(c buffalo.Context) error {
+	if currentUser(c).IsVerified() {
+		c.Flash().Add("info", "Your email address is confirmed.")
+		return c.Redirect(http.StatusSeeOther, "/")
+	}
+	return c.Render(http.StatusOK, r.HTML("users/verify.plush.html"))
+}
+
+// UsersVerifyResend sends the current user a new confirmation link.
+func UsersVerifyResend(c buffalo.Context) error {
+	u := currentUser(c)
+	if u.IsVerified() {
+		c.Flash().Add("info", "Your email address is confirmed.")
+		return c.Redirect(http.StatusSeeOther, "/")
+	}
+
+	until, err := lockedUntil(c, verifyKey(u))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if !until.IsZero() {
+		c.Flash().Add("warning", "We've sent several links already. Please check your spam folder, or try again later.")
+		return c.Redirect(http.StatusSeeOther, "/users/verify")
+	}
+	_, err = throttle(c).Fail(verifyKey(u), verificationResends, time.Now().UTC())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = sendVerification(c, u)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	c.Flash().Add("info", "We've sent a new link to "+u.Email+".")
+	return c.Redirect(http.StatusSeeOther, "/users/verify")
+}
+
+// UsersVerify confirms a user's email address from the link in their
+// mail. It doesn't need a login, so the link works on any device.
+func UsersVerify(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	now := time.Now().UTC()
+
+	invalid := func() error {
+		c.Flash().Add("danger", "This confirmation link is not valid or has expired.")
+		if currentUser(c) != nil {
+			return c.Redirect(http.StatusSeeOther, "/users/verify")
+		}
+		return c.Redirect(http.StatusSeeOther, "/")
+	}
+
+	exp, err := strconv.ParseInt(c.Param("exp"), 10, 64)
+	if err != nil || now.Unix() > exp {
+		return invalid()
+	}
+
+	u := &models.User{}
+	err = tx.Find(u, c.Param("id"))
+	if err != nil {
+		return invalid()
+	}
+	if !verifyToken(verifyEmailTokenPurpose, u.ID.String()+":"+u.Email+":"+c.Param("exp"), c.Param("token")) {
+		return invalid()
+	}
+
+	if !u.IsVerified() {
+		err = u.MarkVerified(tx, now)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		audit(c, models.AuditEmailVerified, u.Email, u, "")
+	}
+
+	c.Flash().Add("success", "Thanks, your email address is confirmed.")
+	return c.Redirect(http.StatusSeeOther, "/")
+}
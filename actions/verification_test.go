@@ -0,0 +1,110 @@
+package actions
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"event_planner/models"
+)
+
+func (as *ActionSuite) Test_Users_Verify() {
+	as.CreateTestUser(&models.User{
+		Email:                "new@example.com",
+		Password:             "password",
+		PasswordConfirmation: "password",
+	}, false)
+
+	u := &models.User{}
+	as.NoError(as.DB.Where("email = ?", "new@example.com").First(u))
+	as.False(u.IsVerified())
+
+	mail := as.lastMail()
+	as.Equal("verify_email", mail["template"])
+	link, err := url.Parse(mail["verify_url"].(string))
+	as.NoError(err)
+
+	// A tampered link does nothing.
+	res := as.HTML("%s?exp=%s&token=%sx", link.Path, link.Query().Get("exp"), link.Query().Get("token")).Get()
+	as.Equal(http.StatusSeeOther, res.Code)
+	as.NoError(as.DB.Reload(u))
+	as.False(u.IsVerified())
+
+	// The link works without being logged in.
+	as.Session.Clear()
+	res = as.HTML("%s?%s", link.Path, link.RawQuery).Get()
+	as.Equal(http.StatusSeeOther, res.Code)
+	as.Equal("/", res.Location())
+	as.NoError(as.DB.Reload(u))
+	as.True(u.IsVerified())
+}
+
+func (as *ActionSuite) Test_Users_VerifyLinkExpires() {
+	u, err := as.createUser()
+	as.NoError(err)
+
+	link, err := url.Parse(verificationURL(u, time.Now().Add(-verificationTTL-time.Minute)))
+	as.NoError(err)
+	u.VerifiedAt.Valid = false
+	as.NoError(as.DB.Update(u))
+
+	res := as.HTML("%s?%s", link.Path, link.RawQuery).Get()
+	as.Equal(http.StatusSeeOther, res.Code)
+	as.NoError(as.DB.Reload(u))
+	as.False(u.IsVerified())
+
+	// Nor does a link for an address the user has since changed.
+	link, err = url.Parse(verificationURL(u, time.Now()))
+	as.NoError(err)
+	u.Email = "changed@example.com"
+	as.NoError(as.DB.Update(u))
+
+	res = as.HTML("%s?%s", link.Path, link.RawQuery).Get()
+	as.Equal(http.StatusSeeOther, res.Code)
+	as.NoError(as.DB.Reload(u))
+	as.False(u.IsVerified())
+}
+
+func (as *ActionSuite) Test_Users_UnverifiedCantCreateEvents() {
+	u, err := as.createUser()
+	as.NoError(err)
+	u.VerifiedAt.Valid = false
+	as.NoError(as.DB.Update(u))
+	as.signIn(u)
+
+	res := as.HTML("/events/new").Get()
+	as.Equal(http.StatusSeeOther, res.Code)
+	as.Equal("/users/verify", res.Location())
+
+	jres := as.JSON("/api/v1/events").Post(map[string]interface{}{"title": "Quiz night", "date": "2030-01-02T19:00:00Z"})
+	as.Equal(http.StatusForbidden, jres.Code)
+	as.Contains(jres.Body.String(), "email address not confirmed")
+}
+
+func (as *ActionSuite) Test_Users_VerifyResend() {
+	u, err := as.createUser()
+	as.NoError(err)
+	u.VerifiedAt.Valid = false
+	as.NoError(as.DB.Update(u))
+	as.signIn(u)
+
+	res := as.HTML("/users/verify").Get()
+	as.Equal(http.StatusOK, res.Code)
+
+	for i := 0; i < verificationResends.MaxFailures; i++ {
+		res = as.HTML("/users/verify").Post(url.Values{})
+		as.Equal(http.StatusSeeOther, res.Code)
+	}
+	count, err := as.DB.Count(&models.OutboundMessage{})
+	as.NoError(err)
+	as.Equal(verificationResends.MaxFailures, count)
+
+	// Further resends are held back for a while.
+	res = as.HTML("/users/verify").Post(url.Values{})
+	as.Equal(http.StatusSeeOther, res.Code)
+	count, err = as.DB.Count(&models.OutboundMessage{})
+	as.NoError(err)
+	as.Equal(verificationResends.MaxFailures, count)
+	as.True(strings.HasPrefix(as.lastMail()["verify_url"].(string), absoluteURL("/users/verify/")))
+}
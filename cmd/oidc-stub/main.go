@@ -0,0 +1,31 @@
+// Command oidc-stub runs a throwaway OpenID Connect provider for trying
+// single sign-on locally. Point the app at it with
+//
+//	OIDC_ISSUER=http://127.0.0.1:5556 OIDC_CLIENT_ID=event-planner OIDC_CLIENT_SECRET=secret
+//
+// and sign in as any email address on its authorize page.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"event_planner/oidcstub"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:5556", "address to listen on")
+	issuer := flag.String("issuer", "http://127.0.0.1:5556", "issuer URL the provider is reached at")
+	clientID := flag.String("client-id", "event-planner", "client id of the app")
+	secret := flag.String("client-secret", "secret", "client secret of the app")
+	flag.Parse()
+
+	p, err := oidcstub.New(*issuer, *clientID, *secret)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("stub OIDC provider for %q at %s", *clientID, *issuer)
+	log.Fatal(http.ListenAndServe(*addr, p))
+}
@@ -13,7 +13,7 @@ var _ = grift.Namespace("db", func() {
 	grift.Add("seed", func(c *grift.Context) error {
 		// Add DB seeding stuff here
 
-		e1 := models.Event{Title: "Demo event", Description: "Demo event description", Date: time.Now()}
+		e1 := models.Event{Title: "Demo event", Description: "Demo event description", Date: time.Now(), Duration: models.DefaultEventDuration, Status: models.EventStatusScheduled}
 		_, err := models.DB.ValidateAndCreate(&e1)
 		if err != nil {
 			return err
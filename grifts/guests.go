@@ -0,0 +1,72 @@
+package grifts
+
+import (
+	"event_planner/models"
+	"fmt"
+
+	"github.com/gobuffalo/grift/grift"
+	"github.com/gobuffalo/pop/v6"
+	"github.com/pkg/errors"
+)
+
+var _ = grift.Namespace("guests", func() {
+
+	grift.Desc("duplicates", "Lists guests that share an email address")
+	grift.Add("duplicates", func(c *grift.Context) error {
+		groups, err := models.DuplicateGuests(models.DB)
+		if err != nil {
+			return err
+		}
+
+		for _, group := range groups {
+			keep := group.MergeSurvivor()
+			for _, g := range group {
+				mark := " "
+				if g.ID == keep.ID {
+					mark = "*"
+				}
+				fmt.Printf("%s %s\t%s\t%s\t%s\n", mark, g.ID, g.Email, g.FullName, g.CreatedAt.Format("2006-01-02"))
+			}
+			fmt.Println()
+		}
+		fmt.Printf("%d group(s) of duplicates, * marks the guest kept by guests:merge\n", len(groups))
+		return nil
+	})
+
+	grift.Desc("merge", "Merges duplicate guests; pass <into-id> <from-id>... or nothing to merge every group of duplicates")
+	grift.Add("merge", func(c *grift.Context) error {
+		return models.DB.Transaction(func(tx *pop.Connection) error {
+			if len(c.Args) == 0 {
+				n, err := models.MergeDuplicateGuests(tx)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("%d guest(s) merged\n", n)
+				return nil
+			}
+			if len(c.Args) < 2 {
+				return errors.New("usage: guests:merge [<into-id> <from-id>...]")
+			}
+
+			into := &models.Guest{}
+			err := tx.Find(into, c.Args[0])
+			if err != nil {
+				return errors.Wrapf(err, "finding guest %s", c.Args[0])
+			}
+			for _, id := range c.Args[1:] {
+				from := &models.Guest{}
+				err = tx.Find(from, id)
+				if err != nil {
+					return errors.Wrapf(err, "finding guest %s", id)
+				}
+				err = models.MergeGuests(tx, into, from)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("merged %s (%s) into %s\n", from.ID, from.Email, into.Email)
+			}
+			return nil
+		})
+	})
+
+})
@@ -0,0 +1,64 @@
+package grifts
+
+import (
+	"event_planner/models"
+	"fmt"
+	"time"
+
+	"github.com/gobuffalo/grift/grift"
+)
+
+var _ = grift.Namespace("outbox", func() {
+
+	grift.Desc("failed", "Lists outbound messages that ran out of delivery attempts")
+	grift.Add("failed", func(c *grift.Context) error {
+		messages := models.OutboundMessages{}
+		err := models.DB.Where("status = ?", models.MessageStatusDead).Order("updated_at desc").All(&messages)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range messages {
+			note := ""
+			if m.Redacted() {
+				note = "\t(links removed, can't be requeued)"
+			}
+			fmt.Printf("%s\t%s\tattempts=%d\t%s%s\n", m.ID, m.Recipient(), m.Attempts, m.LastError.String, note)
+		}
+		fmt.Printf("%d failed message(s)\n", len(messages))
+		return nil
+	})
+
+	grift.Desc("requeue", "Requeues failed messages; pass message IDs or nothing for all of them")
+	grift.Add("requeue", func(c *grift.Context) error {
+		messages := models.OutboundMessages{}
+		q := models.DB.Where("status = ?", models.MessageStatusDead)
+		if len(c.Args) > 0 {
+			q = q.Where("id IN (?)", c.Args)
+		}
+		err := q.All(&messages)
+		if err != nil {
+			return err
+		}
+
+		// Messages that lost their codes and links would arrive without
+		// them; the user has to ask for a new one instead.
+		now := time.Now().UTC()
+		requeued := 0
+		for i := range messages {
+			if messages[i].Redacted() {
+				fmt.Printf("%s\tskipped: links removed\n", messages[i].ID)
+				continue
+			}
+			messages[i].Requeue(now)
+			err = models.DB.Update(&messages[i])
+			if err != nil {
+				return err
+			}
+			requeued++
+		}
+		fmt.Printf("%d message(s) requeued\n", requeued)
+		return nil
+	})
+
+})
@@ -0,0 +1,43 @@
+package grifts
+
+import (
+	"event_planner/models"
+	"fmt"
+	"strings"
+
+	"github.com/gobuffalo/grift/grift"
+	"github.com/pkg/errors"
+)
+
+var _ = grift.Namespace("users", func() {
+
+	grift.Desc("promote", "Gives a user a role: users:promote <email> [admin|organizer|member], admin by default")
+	grift.Add("promote", func(c *grift.Context) error {
+		if len(c.Args) < 1 {
+			return errors.New("usage: users:promote <email> [role]")
+		}
+		role := models.RoleAdmin
+		if len(c.Args) > 1 {
+			role = c.Args[1]
+		}
+
+		u := &models.User{}
+		err := models.DB.Where("email = ?", strings.ToLower(strings.TrimSpace(c.Args[0]))).First(u)
+		if err != nil {
+			return errors.Wrapf(err, "finding user %s", c.Args[0])
+		}
+
+		u.Role = role
+		verrs, err := models.DB.ValidateAndUpdate(u)
+		if err != nil {
+			return err
+		}
+		if verrs.HasAny() {
+			return verrs
+		}
+
+		fmt.Printf("%s is now %s\n", u.Email, u.Role)
+		return nil
+	})
+
+})
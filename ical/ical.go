@@ -0,0 +1,165 @@
+// Package ical writes iCalendar (RFC 5545) files holding VEVENTs.
+package ical
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event statuses, as used in the STATUS property.
+const (
+	StatusConfirmed = "CONFIRMED"
+	StatusCancelled = "CANCELLED"
+)
+
+// ContentType is the MIME type of an iCalendar file.
+const ContentType = "text/calendar; charset=utf-8"
+
+// Event is one VEVENT. UID must stay the same across updates of the same
+// event and Sequence must grow with each change, so calendar clients
+// replace their copy instead of adding a duplicate.
+type Event struct {
+	UID          string
+	Sequence     int
+	Start        time.Time
+	End          time.Time
+	Summary      string
+	Description  string
+	Location     string
+	URL          string
+	Status       string
+	Created      time.Time
+	LastModified time.Time
+}
+
+// Calendar is a VCALENDAR. Name is shown by clients that subscribe to it.
+type Calendar struct {
+	Name   string
+	Method string
+	Events []Event
+}
+
+// timeFormat is the UTC DATE-TIME form.
+const timeFormat = "20060102T150405Z"
+
+// WriteTo encodes the calendar. Lines end in CRLF and are folded at 75
+// octets as the RFC requires.
+func (cal Calendar) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	l := lineWriter{w: bw}
+
+	l.line("BEGIN:VCALENDAR")
+	l.line("VERSION:2.0")
+	l.line("PRODID:-//event_planner//Event Planner//EN")
+	l.line("CALSCALE:GREGORIAN")
+	if cal.Method != "" {
+		l.line("METHOD:" + cal.Method)
+	}
+	if cal.Name != "" {
+		l.line("X-WR-CALNAME:" + escape(cal.Name))
+	}
+
+	stamp := time.Now().UTC().Format(timeFormat)
+	for _, e := range cal.Events {
+		l.line("BEGIN:VEVENT")
+		l.line("UID:" + e.UID)
+		l.line("SEQUENCE:" + strconv.Itoa(e.Sequence))
+		l.line("DTSTAMP:" + stamp)
+		l.line("DTSTART:" + e.Start.UTC().Format(timeFormat))
+		l.line("DTEND:" + e.End.UTC().Format(timeFormat))
+		l.line("SUMMARY:" + escape(e.Summary))
+		if e.Description != "" {
+			l.line("DESCRIPTION:" + escape(e.Description))
+		}
+		if e.Location != "" {
+			l.line("LOCATION:" + escape(e.Location))
+		}
+		if e.URL != "" {
+			l.line("URL:" + e.URL)
+		}
+		if e.Status != "" {
+			l.line("STATUS:" + e.Status)
+		}
+		if !e.Created.IsZero() {
+			l.line("CREATED:" + e.Created.UTC().Format(timeFormat))
+		}
+		if !e.LastModified.IsZero() {
+			l.line("LAST-MODIFIED:" + e.LastModified.UTC().Format(timeFormat))
+		}
+		l.line("END:VEVENT")
+	}
+	l.line("END:VCALENDAR")
+
+	if l.err != nil {
+		return cw.n, l.err
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// String returns the encoded calendar.
+func (cal Calendar) String() string {
+	sb := &strings.Builder{}
+	cal.WriteTo(sb)
+	return sb.String()
+}
+
+// escape applies TEXT value escaping.
+func escape(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\n", `\n`,
+		"\r", `\n`,
+	).Replace(s)
+}
+
+type lineWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+// line writes one content line, folding it so no physical line is longer
+// than 75 octets. Folds never split a UTF-8 sequence.
+func (l *lineWriter) line(s string) {
+	if l.err != nil {
+		return
+	}
+
+	limit := 75
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !isRuneStart(s[cut]) {
+			cut--
+		}
+		_, l.err = l.w.WriteString(s[:cut] + "\r\n ")
+		if l.err != nil {
+			return
+		}
+		s = s[cut:]
+		// Continuation lines start with a space, which counts.
+		limit = 74
+	}
+	_, l.err = l.w.WriteString(s + "\r\n")
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
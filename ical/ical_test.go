@@ -0,0 +1,45 @@
+package ical
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCalendarWriteTo(t *testing.T) {
+	start := time.Date(2026, 10, 17, 18, 30, 0, 0, time.FixedZone("CEST", 2*60*60))
+	cal := Calendar{Method: "PUBLISH", Events: []Event{{
+		UID:         "abc@event_planner",
+		Sequence:    3,
+		Start:       start,
+		End:         start.Add(time.Hour),
+		Summary:     "Dinner; drinks, etc.",
+		Description: "Line one\nLine two " + strings.Repeat("é", 60),
+		Status:      StatusCancelled,
+	}}}
+	out := cal.String()
+
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"DTSTART:20261017T163000Z\r\n",
+		"DTEND:20261017T173000Z\r\n",
+		"SEQUENCE:3\r\n",
+		`SUMMARY:Dinner\; drinks\, etc.` + "\r\n",
+		"STATUS:CANCELLED\r\n",
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in\n%s", want, out)
+		}
+	}
+
+	for _, line := range strings.Split(out, "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("line longer than 75 octets: %q", line)
+		}
+	}
+	unfolded := strings.ReplaceAll(out, "\r\n ", "")
+	if !strings.Contains(unfolded, `DESCRIPTION:Line one\nLine two `+strings.Repeat("é", 60)) {
+		t.Errorf("description not folded cleanly:\n%s", out)
+	}
+}
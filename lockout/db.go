@@ -0,0 +1,97 @@
+package lockout
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"time"
+
+	"github.com/gobuffalo/nulls"
+	"github.com/gobuffalo/pop/v6"
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+)
+
+// DBStore keeps counters in the login_attempts table so every app
+// instance sees them. Keys are stored hashed, which keeps them short and
+// keeps email addresses that were merely guessed out of the table.
+//
+// Use a connection outside the request's transaction: failed logins end in
+// an error response, which rolls that transaction back.
+type DBStore struct {
+	DB *pop.Connection
+}
+
+// loginAttempt maps a row of login_attempts.
+type loginAttempt struct {
+	ID            uuid.UUID  `db:"id"`
+	KeyHash       string     `db:"key_hash"`
+	Failures      int        `db:"failures"`
+	LastFailureAt time.Time  `db:"last_failure_at"`
+	LockedUntil   nulls.Time `db:"locked_until"`
+	CreatedAt     time.Time  `db:"created_at"`
+	UpdatedAt     time.Time  `db:"updated_at"`
+}
+
+// TableName overrides the table name used by pop.
+func (loginAttempt) TableName() string {
+	return "login_attempts"
+}
+
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Get implements Store.
+func (s DBStore) Get(key string) (Attempt, error) {
+	row := loginAttempt{}
+	err := s.DB.Where("key_hash = ?", hashKey(key)).First(&row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Attempt{Key: key}, nil
+	}
+	if err != nil {
+		return Attempt{}, errors.WithStack(err)
+	}
+	return Attempt{
+		Key:           key,
+		Failures:      row.Failures,
+		LastFailureAt: row.LastFailureAt,
+		LockedUntil:   row.LockedUntil.Time,
+	}, nil
+}
+
+// Fail implements Store. The counter is bumped in a single statement so
+// concurrent failures are all counted.
+func (s DBStore) Fail(key string, now time.Time, window time.Duration) (Attempt, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return Attempt{}, errors.WithStack(err)
+	}
+	now = now.UTC()
+
+	err = s.DB.RawQuery(`INSERT INTO login_attempts (id, key_hash, failures, last_failure_at, created_at, updated_at)
+		VALUES (?, ?, 1, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+			failures = IF(last_failure_at < ?, 1, failures + 1),
+			last_failure_at = VALUES(last_failure_at),
+			updated_at = VALUES(updated_at)`,
+		id, hashKey(key), now, now, now, now.Add(-window)).Exec()
+	if err != nil {
+		return Attempt{}, errors.WithStack(err)
+	}
+	return s.Get(key)
+}
+
+// Lock implements Store.
+func (s DBStore) Lock(key string, until time.Time) error {
+	err := s.DB.RawQuery("UPDATE login_attempts SET locked_until = ?, updated_at = ? WHERE key_hash = ?",
+		until.UTC(), time.Now().UTC(), hashKey(key)).Exec()
+	return errors.WithStack(err)
+}
+
+// Reset implements Store.
+func (s DBStore) Reset(key string) error {
+	err := s.DB.RawQuery("DELETE FROM login_attempts WHERE key_hash = ?", hashKey(key)).Exec()
+	return errors.WithStack(err)
+}
@@ -0,0 +1,115 @@
+// Package lockout counts failed authentication attempts per key (an
+// account, an IP address, ...) and locks a key out for a while once it has
+// failed too often. Each further failure doubles the lockout, up to a cap.
+//
+// Counters live in a Store: MemoryStore for a single process and DBStore to
+// share them between app instances.
+package lockout
+
+import (
+	"time"
+)
+
+// Attempt is what a Store knows about one key.
+type Attempt struct {
+	Key           string
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   time.Time
+}
+
+// IsLocked reports whether the key is locked out at now.
+func (a Attempt) IsLocked(now time.Time) bool {
+	return a.LockedUntil.After(now)
+}
+
+// Store keeps failure counters. Implementations must be safe for
+// concurrent use.
+type Store interface {
+	// Get returns the counters for key. Unknown keys have none.
+	Get(key string) (Attempt, error)
+	// Fail counts a failure at now and returns the updated counters.
+	// Failures older than window are forgotten first.
+	Fail(key string, now time.Time, window time.Duration) (Attempt, error)
+	// Lock locks key out until the given time.
+	Lock(key string, until time.Time) error
+	// Reset forgets key.
+	Reset(key string) error
+}
+
+// Policy says how much failing a key may do.
+type Policy struct {
+	// MaxFailures is how many failures lock the key.
+	MaxFailures int
+	// BaseLockout is the first lockout. It doubles with each failure
+	// after MaxFailures.
+	BaseLockout time.Duration
+	// MaxLockout caps the lockout.
+	MaxLockout time.Duration
+	// Window is how long a failure is remembered after the last one.
+	Window time.Duration
+}
+
+// LockoutFor returns how long a key with the given number of failures is
+// locked out, or 0 if it isn't.
+func (p Policy) LockoutFor(failures int) time.Duration {
+	if failures < p.MaxFailures {
+		return 0
+	}
+	d := p.BaseLockout
+	for i := p.MaxFailures; i < failures && d < p.MaxLockout; i++ {
+		d *= 2
+	}
+	if d > p.MaxLockout {
+		d = p.MaxLockout
+	}
+	return d
+}
+
+// Throttle applies policies to the counters in a Store.
+type Throttle struct {
+	Store Store
+}
+
+// LockedUntil returns the latest time any of keys is locked until, or the
+// zero time if none of them is locked at now.
+func (t Throttle) LockedUntil(now time.Time, keys ...string) (time.Time, error) {
+	var until time.Time
+	for _, key := range keys {
+		a, err := t.Store.Get(key)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if a.IsLocked(now) && a.LockedUntil.After(until) {
+			until = a.LockedUntil
+		}
+	}
+	return until, nil
+}
+
+// Fail counts a failure for key and locks it out if p says so. The
+// returned Attempt has LockedUntil set when this failure caused a lockout.
+func (t Throttle) Fail(key string, p Policy, now time.Time) (Attempt, error) {
+	a, err := t.Store.Fail(key, now, p.Window)
+	if err != nil {
+		return a, err
+	}
+
+	d := p.LockoutFor(a.Failures)
+	if d == 0 {
+		return a, nil
+	}
+	a.LockedUntil = now.Add(d)
+	return a, t.Store.Lock(key, a.LockedUntil)
+}
+
+// Reset forgets keys, e.g. after a successful login.
+func (t Throttle) Reset(keys ...string) error {
+	for _, key := range keys {
+		err := t.Store.Reset(key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
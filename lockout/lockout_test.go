@@ -0,0 +1,72 @@
+package lockout
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPolicyLockoutFor(t *testing.T) {
+	p := Policy{MaxFailures: 3, BaseLockout: time.Minute, MaxLockout: 10 * time.Minute}
+
+	for failures, want := range map[int]time.Duration{
+		0:  0,
+		2:  0,
+		3:  time.Minute,
+		4:  2 * time.Minute,
+		5:  4 * time.Minute,
+		6:  8 * time.Minute,
+		7:  10 * time.Minute,
+		50: 10 * time.Minute,
+	} {
+		if got := p.LockoutFor(failures); got != want {
+			t.Errorf("LockoutFor(%d) = %s, want %s", failures, got, want)
+		}
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	p := Policy{MaxFailures: 2, BaseLockout: time.Minute, MaxLockout: time.Hour, Window: time.Hour}
+	th := Throttle{Store: NewMemoryStore()}
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+
+	a, err := th.Fail("account:bob", p, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.IsLocked(now) {
+		t.Fatal("locked after one failure")
+	}
+
+	a, _ = th.Fail("account:bob", p, now)
+	if !a.LockedUntil.Equal(now.Add(time.Minute)) {
+		t.Fatalf("LockedUntil = %s, want a minute from now", a.LockedUntil)
+	}
+
+	until, _ := th.LockedUntil(now, "ip:10.0.0.1", "account:bob")
+	if !until.Equal(a.LockedUntil) {
+		t.Errorf("LockedUntil over keys = %s, want %s", until, a.LockedUntil)
+	}
+	until, _ = th.LockedUntil(now.Add(2*time.Minute), "account:bob")
+	if !until.IsZero() {
+		t.Errorf("still locked after the lockout ran out")
+	}
+
+	// The next failure doubles the lockout.
+	later := now.Add(2 * time.Minute)
+	a, _ = th.Fail("account:bob", p, later)
+	if !a.LockedUntil.Equal(later.Add(2 * time.Minute)) {
+		t.Errorf("LockedUntil = %s, want two minutes after the third failure", a.LockedUntil)
+	}
+
+	// Failures are forgotten after the window.
+	a, _ = th.Fail("account:bob", p, later.Add(2*time.Hour))
+	if a.Failures != 1 {
+		t.Errorf("Failures = %d after the window, want 1", a.Failures)
+	}
+
+	_ = th.Reset("account:bob")
+	a, _ = th.Store.Get("account:bob")
+	if a.Failures != 0 || a.IsLocked(now) {
+		t.Errorf("Reset kept %+v", a)
+	}
+}
@@ -0,0 +1,92 @@
+package lockout
+
+import (
+	"sync"
+	"time"
+)
+
+// memorySweepSize is how many keys a MemoryStore holds before it drops the
+// ones that can no longer matter.
+const memorySweepSize = 10000
+
+// MemoryStore keeps counters in the process. They are lost on restart and
+// not shared between instances.
+type MemoryStore struct {
+	mu       sync.Mutex
+	attempts map[string]*memoryAttempt
+}
+
+type memoryAttempt struct {
+	Attempt
+	window time.Duration
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{attempts: map[string]*memoryAttempt{}}
+}
+
+// Get implements Store.
+func (s *MemoryStore) Get(key string) (Attempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if a, ok := s.attempts[key]; ok {
+		return a.Attempt, nil
+	}
+	return Attempt{Key: key}, nil
+}
+
+// Fail implements Store.
+func (s *MemoryStore) Fail(key string, now time.Time, window time.Duration) (Attempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.attempts[key]
+	if !ok {
+		if len(s.attempts) >= memorySweepSize {
+			s.sweep(now)
+		}
+		a = &memoryAttempt{Attempt: Attempt{Key: key}}
+		s.attempts[key] = a
+	}
+	if now.Sub(a.LastFailureAt) > window {
+		a.Failures = 0
+	}
+	a.Failures++
+	a.LastFailureAt = now
+	a.window = window
+	return a.Attempt, nil
+}
+
+// Lock implements Store.
+func (s *MemoryStore) Lock(key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.attempts[key]
+	if !ok {
+		a = &memoryAttempt{Attempt: Attempt{Key: key}}
+		s.attempts[key] = a
+	}
+	a.LockedUntil = until
+	return nil
+}
+
+// Reset implements Store.
+func (s *MemoryStore) Reset(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.attempts, key)
+	return nil
+}
+
+// sweep drops keys that are neither locked nor within their window.
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, a := range s.attempts {
+		if !a.IsLocked(now) && now.Sub(a.LastFailureAt) > a.window {
+			delete(s.attempts, key)
+		}
+	}
+}
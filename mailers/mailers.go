@@ -0,0 +1,35 @@
+package mailers
+
+import (
+	"event_planner/templates"
+
+	"github.com/gobuffalo/buffalo/mail"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/gobuffalo/envy"
+)
+
+var r *render.Engine
+
+func init() {
+	r = render.New(render.Options{
+		// HTML layout to be used for all HTML emails:
+		HTMLLayout: "mail/layout.plush.html",
+
+		// fs.FS containing templates
+		TemplatesFS: templates.FS(),
+
+		// Add template helpers here:
+		Helpers: render.Helpers{},
+	})
+}
+
+// NewSMTPSender returns a mail.Sender for the server configured by the
+// SMTP_HOST, SMTP_PORT, SMTP_USER and SMTP_PASSWORD environment variables.
+func NewSMTPSender() (mail.Sender, error) {
+	return mail.NewSMTPSender(
+		envy.Get("SMTP_HOST", "localhost"),
+		envy.Get("SMTP_PORT", "1025"),
+		envy.Get("SMTP_USER", ""),
+		envy.Get("SMTP_PASSWORD", ""),
+	)
+}
@@ -0,0 +1,181 @@
+package mailers
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/buffalo/mail"
+	"github.com/pkg/errors"
+)
+
+// OutboxSender is a mail.Sender that writes each message to Dir as an
+// .eml file instead of delivering it. It is meant for development and
+// tests, where the files can be opened in a mail client or read back.
+type OutboxSender struct {
+	Dir string
+}
+
+// Send writes m to a new file in the outbox directory.
+func (s OutboxSender) Send(m mail.Message) error {
+	err := os.MkdirAll(s.Dir, 0o755)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	b := make([]byte, 4)
+	_, err = rand.Read(b)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	name := time.Now().UTC().Format("20060102T150405.000000000") + "-" + hex.EncodeToString(b) + ".eml"
+
+	buf := &bytes.Buffer{}
+	err = WriteMessage(buf, m)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(os.WriteFile(filepath.Join(s.Dir, name), buf.Bytes(), 0o644))
+}
+
+// Messages returns the paths of the .eml files in the outbox, oldest first.
+func (s OutboxSender) Messages() ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(s.Dir, "*.eml"))
+	return paths, errors.WithStack(err)
+}
+
+// WriteMessage encodes m in RFC 5322 format. Multiple bodies become a
+// multipart/alternative message and attachments wrap that in
+// multipart/mixed.
+func WriteMessage(w io.Writer, m mail.Message) error {
+	h := textproto.MIMEHeader{}
+	h.Set("From", m.From)
+	h.Set("To", strings.Join(m.To, ", "))
+	if len(m.CC) > 0 {
+		h.Set("Cc", strings.Join(m.CC, ", "))
+	}
+	h.Set("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	h.Set("Date", time.Now().Format(time.RFC1123Z))
+	h.Set("MIME-Version", "1.0")
+	for k, v := range m.Headers {
+		h.Set(k, v)
+	}
+
+	if len(m.Attachments) == 0 {
+		return writeBodies(w, h, m.Bodies)
+	}
+
+	mixed := multipart.NewWriter(w)
+	h.Set("Content-Type", "multipart/mixed; boundary="+mixed.Boundary())
+	writeHeader(w, h)
+
+	part, err := mixed.CreatePart(textproto.MIMEHeader{})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	err = writeBodies(part, textproto.MIMEHeader{}, m.Bodies)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, a := range m.Attachments {
+		ah := textproto.MIMEHeader{}
+		ah.Set("Content-Type", a.ContentType)
+		ah.Set("Content-Transfer-Encoding", "base64")
+		disposition := "attachment"
+		if a.Embedded {
+			// HTML bodies refer to inline parts as cid:<name>.
+			disposition = "inline"
+			ah.Set("Content-ID", "<"+a.Name+">")
+		}
+		ah.Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": a.Name}))
+		part, err := mixed.CreatePart(ah)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		err = writeBase64(part, a.Reader)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return errors.WithStack(mixed.Close())
+}
+
+func writeBodies(w io.Writer, h textproto.MIMEHeader, bodies []mail.Body) error {
+	if len(bodies) == 1 {
+		h.Set("Content-Type", bodies[0].ContentType)
+		h.Set("Content-Transfer-Encoding", "quoted-printable")
+		writeHeader(w, h)
+		return writeQuotedPrintable(w, bodies[0].Content)
+	}
+
+	alt := multipart.NewWriter(w)
+	h.Set("Content-Type", "multipart/alternative; boundary="+alt.Boundary())
+	writeHeader(w, h)
+	for _, b := range bodies {
+		bh := textproto.MIMEHeader{}
+		bh.Set("Content-Type", b.ContentType)
+		bh.Set("Content-Transfer-Encoding", "quoted-printable")
+		part, err := alt.CreatePart(bh)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		err = writeQuotedPrintable(part, b.Content)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return errors.WithStack(alt.Close())
+}
+
+func writeHeader(w io.Writer, h textproto.MIMEHeader) {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range h[k] {
+			fmt.Fprintf(w, "%s: %s\r\n", k, v)
+		}
+	}
+	fmt.Fprint(w, "\r\n")
+}
+
+func writeQuotedPrintable(w io.Writer, s string) error {
+	qp := quotedprintable.NewWriter(w)
+	_, err := qp.Write([]byte(s))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(qp.Close())
+}
+
+func writeBase64(w io.Writer, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	enc := base64.StdEncoding.EncodeToString(data)
+	for len(enc) > 76 {
+		_, err = io.WriteString(w, enc[:76]+"\r\n")
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		enc = enc[76:]
+	}
+	_, err = io.WriteString(w, enc+"\r\n")
+	return errors.WithStack(err)
+}
@@ -0,0 +1,102 @@
+package mailers
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/gobuffalo/buffalo/mail"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/gobuffalo/envy"
+	"github.com/pkg/errors"
+
+	"event_planner/ical"
+	"event_planner/qrcode"
+)
+
+// QRCodeImage is the name, and content ID, of the QR code embedded in
+// messages with a "qr_code".
+const QRCodeImage = "ticket-qr.png"
+
+// CalendarFile is the name of the iCalendar file attached to messages with
+// an "ics".
+const CalendarFile = "event.ics"
+
+// TemplateSender turns the data maps handed to the app's Sender interface
+// into rendered emails. The "template" key names a pair of templates,
+// mail/<name>.plush.txt and mail/<name>.plush.html, which both receive the
+// whole map. "receiver_email" and "subject" address the message and
+// "sender_email" overrides the default From. "qr_code", if set, is drawn
+// as a QR code and embedded as ticket-qr.png, so the HTML template can
+// show it with <img src="cid:ticket-qr.png">. "ics", if set, is attached
+// as event.ics.
+type TemplateSender struct {
+	Mailer mail.Sender
+	From   string
+}
+
+// NewTemplateSender wraps m, sending from MAIL_FROM.
+func NewTemplateSender(m mail.Sender) TemplateSender {
+	return TemplateSender{
+		Mailer: m,
+		From:   envy.Get("MAIL_FROM", "system@example.com"),
+	}
+}
+
+// Send renders and delivers one message.
+func (s TemplateSender) Send(data map[string]interface{}) error {
+	m, err := NewMessage(data)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if m.From == "" {
+		m.From = s.From
+	}
+	return errors.WithStack(s.Mailer.Send(m))
+}
+
+// NewMessage builds the email described by data, as documented on
+// TemplateSender. From is left empty unless data has "sender_email".
+func NewMessage(data map[string]interface{}) (mail.Message, error) {
+	name, _ := data["template"].(string)
+	to, _ := data["receiver_email"].(string)
+	if name == "" || to == "" {
+		return mail.Message{}, errors.Errorf("mail data needs a template and receiver_email, got %v", data)
+	}
+
+	m := mail.NewFromData(render.Data(data))
+	m.From, _ = data["sender_email"].(string)
+	m.To = []string{to}
+	m.Subject, _ = data["subject"].(string)
+
+	// The first body is the main one; later ones are alternatives, so the
+	// plain text goes first and mail clients prefer the HTML.
+	err := m.AddBodies(render.Data{},
+		r.Plain("mail/"+name+".plush.txt"),
+		r.HTML("mail/"+name+".plush.html"),
+	)
+	if err != nil {
+		return mail.Message{}, errors.Wrapf(err, "rendering %s email", name)
+	}
+
+	if content, _ := data["qr_code"].(string); content != "" {
+		png, err := qrcode.PNG(content, 240)
+		if err != nil {
+			return mail.Message{}, errors.Wrapf(err, "drawing QR code for %s email", name)
+		}
+		m.Attachments = append(m.Attachments, mail.Attachment{
+			Name:        QRCodeImage,
+			ContentType: qrcode.ContentType,
+			Reader:      bytes.NewReader(png),
+			Embedded:    true,
+		})
+	}
+
+	if ics, _ := data["ics"].(string); ics != "" {
+		m.Attachments = append(m.Attachments, mail.Attachment{
+			Name:        CalendarFile,
+			ContentType: ical.ContentType,
+			Reader:      strings.NewReader(ics),
+		})
+	}
+	return m, nil
+}
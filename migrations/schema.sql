@@ -15,6 +15,75 @@
 /*!40101 SET @OLD_SQL_MODE=@@SQL_MODE, SQL_MODE='NO_AUTO_VALUE_ON_ZERO' */;
 /*!40111 SET @OLD_SQL_NOTES=@@SQL_NOTES, SQL_NOTES=0 */;
 
+--
+-- Table structure for table `api_tokens`
+--
+
+DROP TABLE IF EXISTS `api_tokens`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `api_tokens` (
+  `id` char(36) NOT NULL,
+  `user_id` char(36) NOT NULL,
+  `name` varchar(255) NOT NULL,
+  `token_hash` varchar(255) NOT NULL,
+  `prefix` varchar(255) NOT NULL,
+  `scopes` varchar(255) NOT NULL,
+  `last_used_at` datetime DEFAULT NULL,
+  `expires_at` datetime DEFAULT NULL,
+  `revoked_at` datetime DEFAULT NULL,
+  `created_at` datetime NOT NULL,
+  `updated_at` datetime NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `api_tokens_token_hash_idx` (`token_hash`),
+  KEY `user_id` (`user_id`),
+  CONSTRAINT `api_tokens_ibfk_1` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Table structure for table `audit_events`
+--
+
+DROP TABLE IF EXISTS `audit_events`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `audit_events` (
+  `id` char(36) NOT NULL,
+  `action` varchar(255) NOT NULL,
+  `user_id` char(36) DEFAULT NULL,
+  `email` varchar(255) NOT NULL DEFAULT '',
+  `ip` varchar(255) NOT NULL DEFAULT '',
+  `detail` varchar(255) NOT NULL DEFAULT '',
+  `created_at` datetime NOT NULL,
+  `updated_at` datetime NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `audit_events_email_idx` (`email`),
+  KEY `audit_events_created_at_idx` (`created_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Table structure for table `backup_codes`
+--
+
+DROP TABLE IF EXISTS `backup_codes`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `backup_codes` (
+  `id` char(36) NOT NULL,
+  `user_id` char(36) NOT NULL,
+  `code_hash` varchar(255) NOT NULL,
+  `used_at` datetime DEFAULT NULL,
+  `created_at` datetime NOT NULL,
+  `updated_at` datetime NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `backup_codes_code_hash_idx` (`code_hash`),
+  KEY `user_id` (`user_id`),
+  CONSTRAINT `backup_codes_ibfk_1` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
 --
 -- Table structure for table `event_attendees`
 --
@@ -26,16 +95,83 @@ CREATE TABLE `event_attendees` (
   `id` char(36) NOT NULL,
   `event_id` char(36) NOT NULL,
   `guest_id` char(36) NOT NULL,
+  `status` varchar(255) NOT NULL DEFAULT 'confirmed',
+  `rsvp` varchar(255) NOT NULL DEFAULT 'going',
   `created_at` datetime NOT NULL,
   `updated_at` datetime NOT NULL,
+  `check_in_token` varchar(255) NOT NULL,
+  `checked_in_at` datetime DEFAULT NULL,
   PRIMARY KEY (`id`),
   UNIQUE KEY `event_attendees_event_id_guest_id_idx` (`event_id`,`guest_id`),
+  UNIQUE KEY `event_attendees_check_in_token_idx` (`check_in_token`),
+  KEY `event_attendees_event_id_status_created_at_idx` (`event_id`,`status`,`created_at`),
   KEY `guest_id` (`guest_id`),
   CONSTRAINT `event_attendees_ibfk_1` FOREIGN KEY (`event_id`) REFERENCES `events` (`id`),
   CONSTRAINT `event_attendees_ibfk_2` FOREIGN KEY (`guest_id`) REFERENCES `guests` (`id`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 /*!40101 SET character_set_client = @saved_cs_client */;
 
+--
+-- Table structure for table `event_organizers`
+--
+
+DROP TABLE IF EXISTS `event_organizers`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `event_organizers` (
+  `id` char(36) NOT NULL,
+  `event_id` char(36) NOT NULL,
+  `user_id` char(36) NOT NULL,
+  `created_at` datetime NOT NULL,
+  `updated_at` datetime NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `event_organizers_event_id_user_id_idx` (`event_id`,`user_id`),
+  KEY `user_id` (`user_id`),
+  CONSTRAINT `event_organizers_ibfk_1` FOREIGN KEY (`event_id`) REFERENCES `events` (`id`),
+  CONSTRAINT `event_organizers_ibfk_2` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Table structure for table `event_reminders`
+--
+
+DROP TABLE IF EXISTS `event_reminders`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `event_reminders` (
+  `id` char(36) NOT NULL,
+  `event_attendee_id` char(36) NOT NULL,
+  `offset_minutes` int(11) NOT NULL,
+  `sent_at` datetime DEFAULT NULL,
+  `last_error` text,
+  `created_at` datetime NOT NULL,
+  `updated_at` datetime NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `event_reminders_event_attendee_id_offset_minutes_idx` (`event_attendee_id`,`offset_minutes`),
+  CONSTRAINT `event_reminders_ibfk_1` FOREIGN KEY (`event_attendee_id`) REFERENCES `event_attendees` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Table structure for table `event_series`
+--
+
+DROP TABLE IF EXISTS `event_series`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `event_series` (
+  `id` char(36) NOT NULL,
+  `rrule` varchar(255) NOT NULL,
+  `starts_at` datetime NOT NULL,
+  `exdates` text NOT NULL,
+  `created_at` datetime NOT NULL,
+  `updated_at` datetime NOT NULL,
+  `time_zone` varchar(64) NOT NULL DEFAULT 'UTC',
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
 --
 -- Table structure for table `events`
 --
@@ -48,9 +184,24 @@ CREATE TABLE `events` (
   `title` varchar(255) NOT NULL,
   `desc` varchar(255) NOT NULL,
   `event_date` datetime NOT NULL,
+  `status` varchar(255) NOT NULL DEFAULT 'scheduled',
+  `cancel_reason` varchar(255) DEFAULT NULL,
+  `cancelled_at` datetime DEFAULT NULL,
+  `owner_id` char(36) DEFAULT NULL,
+  `capacity` int(11) NOT NULL DEFAULT '0',
+  `duration_minutes` int(11) NOT NULL DEFAULT '60',
+  `location` varchar(255) NOT NULL DEFAULT '',
+  `sequence` int(11) NOT NULL DEFAULT '0',
   `created_at` datetime NOT NULL,
   `updated_at` datetime NOT NULL,
-  PRIMARY KEY (`id`)
+  `series_id` char(36) DEFAULT NULL,
+  `recurrence_id` datetime DEFAULT NULL,
+  `time_zone` varchar(64) NOT NULL DEFAULT 'UTC',
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `events_series_id_recurrence_id_idx` (`series_id`,`recurrence_id`),
+  KEY `events_owner_id_fk` (`owner_id`),
+  CONSTRAINT `events_owner_id_fk` FOREIGN KEY (`owner_id`) REFERENCES `users` (`id`),
+  CONSTRAINT `events_series_id_fk` FOREIGN KEY (`series_id`) REFERENCES `event_series` (`id`) ON DELETE SET NULL
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 /*!40101 SET character_set_client = @saved_cs_client */;
 
@@ -67,7 +218,51 @@ CREATE TABLE `guests` (
   `full_name` varchar(255) NOT NULL,
   `created_at` datetime NOT NULL,
   `updated_at` datetime NOT NULL,
-  PRIMARY KEY (`id`)
+  `email_key` varchar(255) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `guests_email_key_idx` (`email_key`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Table structure for table `login_attempts`
+--
+
+DROP TABLE IF EXISTS `login_attempts`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `login_attempts` (
+  `id` char(36) NOT NULL,
+  `key_hash` varchar(255) NOT NULL,
+  `failures` int(11) NOT NULL DEFAULT '0',
+  `last_failure_at` datetime NOT NULL,
+  `locked_until` datetime DEFAULT NULL,
+  `created_at` datetime NOT NULL,
+  `updated_at` datetime NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `login_attempts_key_hash_idx` (`key_hash`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Table structure for table `outbound_messages`
+--
+
+DROP TABLE IF EXISTS `outbound_messages`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `outbound_messages` (
+  `id` char(36) NOT NULL,
+  `payload` text NOT NULL,
+  `status` varchar(255) NOT NULL DEFAULT 'pending',
+  `attempts` int(11) NOT NULL DEFAULT '0',
+  `last_error` text,
+  `next_attempt_at` datetime NOT NULL,
+  `sent_at` datetime DEFAULT NULL,
+  `created_at` datetime NOT NULL,
+  `updated_at` datetime NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `outbound_messages_status_next_attempt_at_idx` (`status`,`next_attempt_at`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 /*!40101 SET character_set_client = @saved_cs_client */;
 
@@ -84,6 +279,29 @@ CREATE TABLE `schema_migration` (
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 /*!40101 SET character_set_client = @saved_cs_client */;
 
+--
+-- Table structure for table `user_sessions`
+--
+
+DROP TABLE IF EXISTS `user_sessions`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `user_sessions` (
+  `id` char(36) NOT NULL,
+  `user_id` char(36) NOT NULL,
+  `user_agent` varchar(512) NOT NULL,
+  `ip` varchar(255) NOT NULL,
+  `method` varchar(255) NOT NULL,
+  `last_seen_at` datetime NOT NULL,
+  `revoked_at` datetime DEFAULT NULL,
+  `created_at` datetime NOT NULL,
+  `updated_at` datetime NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `user_id` (`user_id`),
+  CONSTRAINT `user_sessions_ibfk_1` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
 --
 -- Table structure for table `users`
 --
@@ -95,11 +313,21 @@ CREATE TABLE `users` (
   `id` char(36) NOT NULL,
   `email` varchar(255) NOT NULL,
   `password_hash` varchar(255) NOT NULL,
-  `recovery_code` varchar(255) DEFAULT NULL,
+  `recovery_code_hash` varchar(255) DEFAULT NULL,
   `recovery_expiration` datetime DEFAULT NULL,
+  `role` varchar(255) NOT NULL DEFAULT 'member',
   `created_at` datetime NOT NULL,
   `updated_at` datetime NOT NULL,
-  PRIMARY KEY (`id`)
+  `recovery_token_hash` varchar(255) DEFAULT NULL,
+  `totp_secret` varchar(255) DEFAULT NULL,
+  `totp_enabled_at` datetime DEFAULT NULL,
+  `totp_last_step` bigint(20) NOT NULL DEFAULT '0',
+  `verified_at` datetime DEFAULT NULL,
+  `oidc_issuer` varchar(255) DEFAULT NULL,
+  `oidc_subject` varchar(255) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `users_recovery_token_hash_idx` (`recovery_token_hash`),
+  UNIQUE KEY `users_oidc_issuer_oidc_subject_idx` (`oidc_issuer`,`oidc_subject`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 /*!40101 SET character_set_client = @saved_cs_client */;
 /*!40103 SET TIME_ZONE=@OLD_TIME_ZONE */;
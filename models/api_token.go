@@ -0,0 +1,192 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/nulls"
+	"github.com/gobuffalo/pop/v6"
+	"github.com/gobuffalo/validate/v3"
+	"github.com/gobuffalo/validate/v3/validators"
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+)
+
+// Token scopes. A read token may only make safe (GET) requests; a
+// manage_events token may also create and change events, guests and
+// reservations the user has access to.
+const (
+	ScopeRead         = "read"
+	ScopeManageEvents = "manage_events"
+)
+
+// TokenScopes lists every scope, for forms.
+var TokenScopes = []string{ScopeRead, ScopeManageEvents}
+
+// tokenPrefix marks personal access tokens so they are easy to spot in
+// logs and secret scanners.
+const tokenPrefix = "ep_"
+
+// ErrInvalidToken is returned for tokens that are unknown, revoked or
+// expired.
+var ErrInvalidToken = errors.New("invalid API token")
+
+// APIToken is used by pop to map your api_tokens database table to your go code.
+// It is a personal access token; only a hash of the secret is stored.
+type APIToken struct {
+	ID         uuid.UUID  `json:"id" db:"id"`
+	UserID     uuid.UUID  `json:"user_id" db:"user_id"`
+	Name       string     `json:"name" db:"name"`
+	Hash       string     `json:"-" db:"token_hash"`
+	Prefix     string     `json:"prefix" db:"prefix"`
+	Scopes     string     `json:"scopes" db:"scopes"`
+	LastUsedAt nulls.Time `json:"last_used_at" db:"last_used_at"`
+	ExpiresAt  nulls.Time `json:"expires_at" db:"expires_at"`
+	RevokedAt  nulls.Time `json:"revoked_at" db:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// String is not required by pop and may be deleted
+func (t APIToken) String() string {
+	jt, _ := json.Marshal(t)
+	return string(jt)
+}
+
+// APITokens is not required by pop and may be deleted
+type APITokens []APIToken
+
+// hashToken returns the stored form of a token secret.
+func hashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewAPIToken creates a token for the user and returns it with the secret.
+// The secret is not stored and can't be shown again.
+func NewAPIToken(tx *pop.Connection, userID uuid.UUID, name string, scopes []string, expiresAt nulls.Time) (*APIToken, string, *validate.Errors, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", nil, errors.WithStack(err)
+	}
+	secret := tokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+
+	t := &APIToken{
+		UserID:    userID,
+		Name:      strings.TrimSpace(name),
+		Hash:      hashToken(secret),
+		Prefix:    secret[:len(tokenPrefix)+6],
+		Scopes:    strings.Join(scopes, ","),
+		ExpiresAt: expiresAt,
+	}
+	verrs, err := tx.ValidateAndCreate(t)
+	if err != nil || verrs.HasAny() {
+		return nil, "", verrs, errors.WithStack(err)
+	}
+	return t, secret, verrs, nil
+}
+
+// FindAPIToken looks up an active token by its secret.
+func FindAPIToken(tx *pop.Connection, secret string, now time.Time) (*APIToken, error) {
+	t := &APIToken{}
+	if !strings.HasPrefix(secret, tokenPrefix) {
+		return nil, ErrInvalidToken
+	}
+
+	err := tx.Where("token_hash = ?", hashToken(secret)).First(t)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidToken
+		}
+		return nil, errors.WithStack(err)
+	}
+
+	if !t.IsActive(now) {
+		return nil, ErrInvalidToken
+	}
+	return t, nil
+}
+
+// ScopeList returns the token's scopes.
+func (t APIToken) ScopeList() []string {
+	if t.Scopes == "" {
+		return []string{}
+	}
+	return strings.Split(t.Scopes, ",")
+}
+
+// HasScope reports whether the token was granted scope.
+func (t APIToken) HasScope(scope string) bool {
+	for _, s := range t.ScopeList() {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// IsActive reports whether the token can still be used.
+func (t APIToken) IsActive(now time.Time) bool {
+	if t.RevokedAt.Valid {
+		return false
+	}
+	return !t.ExpiresAt.Valid || now.Before(t.ExpiresAt.Time)
+}
+
+// Touch records that the token was used. It only writes once a minute so
+// busy scripts don't turn every request into an UPDATE.
+func (t *APIToken) Touch(tx *pop.Connection, now time.Time) error {
+	if t.LastUsedAt.Valid && now.Sub(t.LastUsedAt.Time) < time.Minute {
+		return nil
+	}
+	t.LastUsedAt = nulls.NewTime(now)
+	err := tx.RawQuery("UPDATE api_tokens SET last_used_at = ? WHERE id = ?", t.LastUsedAt, t.ID).Exec()
+	return errors.WithStack(err)
+}
+
+// Revoke stops the token from working. Revoked tokens are kept so the
+// owner can see what existed.
+func (t *APIToken) Revoke(tx *pop.Connection, now time.Time) error {
+	if t.RevokedAt.Valid {
+		return nil
+	}
+	t.RevokedAt = nulls.NewTime(now)
+	return errors.WithStack(tx.Update(t))
+}
+
+// Validate gets run every time you call a "pop.Validate*" (pop.ValidateAndSave, pop.ValidateAndCreate, pop.ValidateAndUpdate) method.
+func (t *APIToken) Validate(tx *pop.Connection) (*validate.Errors, error) {
+	return validate.Validate(
+		&validators.StringIsPresent{Field: t.Name, Name: "Name"},
+		&validators.StringLengthInRange{Field: t.Name, Name: "Name", Max: 255},
+		&validators.StringIsPresent{Field: t.Scopes, Name: "Scopes", Message: "Choose at least one scope."},
+		&validators.FuncValidator{
+			Field:   t.Scopes,
+			Name:    "Scopes",
+			Message: "%s includes an unknown scope",
+			Fn: func() bool {
+				for _, s := range t.ScopeList() {
+					if !contains(TokenScopes, s) {
+						return false
+					}
+				}
+				return true
+			},
+		},
+	), nil
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/nulls"
+)
+
+func (ms *ModelSuite) Test_APIToken() {
+	u := &User{Email: "mark@example.com", Password: "password", PasswordConfirmation: "password"}
+	verrs, err := u.Create(ms.DB)
+	ms.NoError(err)
+	ms.False(verrs.HasAny())
+
+	_, _, verrs, err = NewAPIToken(ms.DB, u.ID, "script", []string{"admin"}, nulls.Time{})
+	ms.NoError(err)
+	ms.NotEmpty(verrs.Get("scopes"))
+
+	now := time.Now()
+	t, secret, verrs, err := NewAPIToken(ms.DB, u.ID, "script", []string{ScopeRead}, nulls.NewTime(now.Add(time.Hour)))
+	ms.NoError(err)
+	ms.False(verrs.HasAny())
+	ms.True(strings.HasPrefix(secret, t.Prefix))
+	ms.NotContains(t.Hash, secret)
+
+	found, err := FindAPIToken(ms.DB, secret, now)
+	ms.NoError(err)
+	ms.Equal(t.ID, found.ID)
+	ms.True(found.HasScope(ScopeRead))
+	ms.False(found.HasScope(ScopeManageEvents))
+
+	_, err = FindAPIToken(ms.DB, secret, now.Add(2*time.Hour))
+	ms.Equal(ErrInvalidToken, err)
+
+	_, err = FindAPIToken(ms.DB, secret+"x", now)
+	ms.Equal(ErrInvalidToken, err)
+
+	ms.NoError(found.Revoke(ms.DB, now))
+	_, err = FindAPIToken(ms.DB, secret, now)
+	ms.Equal(ErrInvalidToken, err)
+}
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gobuffalo/nulls"
+	"github.com/gobuffalo/pop/v6"
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+)
+
+// Audited actions.
+const (
+	AuditLoginSucceeded    = "login_succeeded"
+	AuditLoginFailed       = "login_failed"
+	AuditLoginBlocked      = "login_blocked"
+	AuditAccountLocked     = "account_locked"
+	AuditIPLocked          = "ip_locked"
+	AuditRecoveryRequested = "recovery_requested"
+	AuditRecoveryCompleted = "recovery_completed"
+	AuditRecoveryFailed    = "recovery_failed"
+	AuditRecoveryLocked    = "recovery_locked"
+	AuditRecoveryBlocked   = "recovery_blocked"
+	AuditUnlocked          = "unlocked"
+	AuditTwoFactorEnabled  = "two_factor_enabled"
+	AuditTwoFactorDisabled = "two_factor_disabled"
+	AuditTwoFactorFailed   = "two_factor_failed"
+	AuditTwoFactorReset    = "two_factor_reset"
+	AuditEmailVerified     = "email_verified"
+	AuditEmailChanged      = "email_changed"
+	AuditPasswordChanged   = "password_changed"
+	AuditAccountDeleted    = "account_deleted"
+	AuditSessionsRevoked   = "sessions_revoked"
+	AuditSSOLinked         = "sso_linked"
+)
+
+// AuditEvent is used by pop to map your audit_events database table to your go code.
+// It records one security-relevant thing that happened to an account. Email
+// is what was typed, so attempts on unknown accounts are kept too.
+type AuditEvent struct {
+	ID        uuid.UUID  `json:"id" db:"id"`
+	Action    string     `json:"action" db:"action"`
+	UserID    nulls.UUID `json:"user_id" db:"user_id"`
+	Email     string     `json:"email" db:"email"`
+	IP        string     `json:"ip" db:"ip"`
+	Detail    string     `json:"detail" db:"detail"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// String is not required by pop and may be deleted
+func (a AuditEvent) String() string {
+	ja, _ := json.Marshal(a)
+	return string(ja)
+}
+
+// AuditEvents is not required by pop and may be deleted
+type AuditEvents []AuditEvent
+
+// String is not required by pop and may be deleted
+func (a AuditEvents) String() string {
+	ja, _ := json.Marshal(a)
+	return string(ja)
+}
+
+// RecordAudit stores a. Pass a connection outside the request's
+// transaction for failures, or the record is rolled back with it.
+func RecordAudit(db *pop.Connection, a *AuditEvent) error {
+	for _, f := range []*string{&a.Email, &a.Detail} {
+		if len(*f) > 255 {
+			*f = (*f)[:255]
+		}
+	}
+	return errors.WithStack(db.Create(a))
+}
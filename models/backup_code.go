@@ -0,0 +1,95 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/nulls"
+	"github.com/gobuffalo/pop/v6"
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+)
+
+// BackupCodeCount is how many backup codes a user gets at a time.
+const BackupCodeCount = 10
+
+// backupEncoding spells codes in lowercase letters and digits 2-7, which
+// are hard to confuse with each other.
+var backupEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// BackupCode is used by pop to map your backup_codes database table to your go code.
+// Each one stands in for a two-factor code once, for users who have lost
+// their authenticator.
+type BackupCode struct {
+	ID        uuid.UUID  `json:"id" db:"id"`
+	UserID    uuid.UUID  `json:"user_id" db:"user_id"`
+	Hash      string     `json:"-" db:"code_hash"`
+	UsedAt    nulls.Time `json:"used_at" db:"used_at"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// String is not required by pop and may be deleted
+func (b BackupCode) String() string {
+	jb, _ := json.Marshal(b)
+	return string(jb)
+}
+
+// BackupCodes is not required by pop and may be deleted
+type BackupCodes []BackupCode
+
+// normalizeBackupCode lets users type codes with or without the dash and
+// in any case.
+func normalizeBackupCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.ReplaceAll(code, "-", "")
+}
+
+// NewBackupCodes replaces the user's backup codes with a fresh set and
+// returns them. Only hashes are stored, so they can be shown only now.
+func NewBackupCodes(tx *pop.Connection, userID uuid.UUID) ([]string, error) {
+	err := tx.RawQuery("DELETE FROM backup_codes WHERE user_id = ?", userID).Exec()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	codes := make([]string, 0, BackupCodeCount)
+	for i := 0; i < BackupCodeCount; i++ {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		code := backupEncoding.EncodeToString(b)
+
+		err = tx.Create(&BackupCode{UserID: userID, Hash: hashToken(code)})
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		codes = append(codes, code[:4]+"-"+code[4:])
+	}
+	return codes, nil
+}
+
+// UseBackupCode spends one of the user's unused backup codes. It reports
+// false if code isn't one of them.
+func UseBackupCode(tx *pop.Connection, userID uuid.UUID, code string, now time.Time) (bool, error) {
+	code = normalizeBackupCode(code)
+	if code == "" {
+		return false, nil
+	}
+
+	// Marking the code used in the same statement that checks it means
+	// two concurrent logins can't both spend it.
+	n, err := tx.RawQuery("UPDATE backup_codes SET used_at = ?, updated_at = ? WHERE user_id = ? AND code_hash = ? AND used_at IS NULL",
+		now, now, userID, hashToken(code)).ExecWithCount()
+	return n == 1, errors.WithStack(err)
+}
+
+// UnusedBackupCodes counts the backup codes the user has left.
+func UnusedBackupCodes(tx *pop.Connection, userID uuid.UUID) (int, error) {
+	n, err := tx.Where("user_id = ? AND used_at IS NULL", userID).Count(&BackupCode{})
+	return n, errors.WithStack(err)
+}
@@ -0,0 +1,94 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/gobuffalo/nulls"
+	"github.com/gobuffalo/pop/v6"
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+)
+
+// Reasons a guest can't be checked in.
+var (
+	ErrAlreadyCheckedIn = errors.New("guest is already checked in")
+	ErrNotAdmitted      = errors.New("reservation does not hold a seat")
+)
+
+// BeforeCreate gives every reservation its check-in token.
+func (e *EventAttendee) BeforeCreate(tx *pop.Connection) error {
+	if e.CheckInToken != "" {
+		return nil
+	}
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return errors.WithStack(err)
+	}
+	e.CheckInToken = hex.EncodeToString(b)
+	return nil
+}
+
+// IsCheckedIn reports whether the guest has arrived.
+func (e EventAttendee) IsCheckedIn() bool {
+	return e.CheckedInAt.Valid
+}
+
+// IsAdmitted reports whether the guest has a seat, and so a ticket that
+// lets them in.
+func (e EventAttendee) IsAdmitted() bool {
+	return e.HoldsSpot() && !e.IsWaitlisted()
+}
+
+// FindReservationByCheckInToken loads the reservation a ticket is for,
+// with its guest and event.
+func FindReservationByCheckInToken(tx *pop.Connection, token string) (*EventAttendee, error) {
+	res := &EventAttendee{}
+	err := tx.Eager("Guest", "Event.Organizers").Where("check_in_token = ?", token).First(res)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return res, nil
+}
+
+// CheckIn records the guest's arrival. Only guests with a seat can be
+// checked in, and only once: of two scans racing each other, one gets
+// ErrAlreadyCheckedIn.
+func CheckIn(tx *pop.Connection, res *EventAttendee, now time.Time) error {
+	if !res.IsAdmitted() {
+		return ErrNotAdmitted
+	}
+
+	n, err := tx.RawQuery("UPDATE event_attendees SET checked_in_at = ?, updated_at = ? WHERE id = ? AND checked_in_at IS NULL",
+		now, now, res.ID).ExecWithCount()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if n == 0 {
+		err = tx.Reload(res)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		return ErrAlreadyCheckedIn
+	}
+
+	res.CheckedInAt = nulls.NewTime(now)
+	res.UpdatedAt = now
+	return nil
+}
+
+// CheckInCount is how many of an event's seated guests have arrived.
+type CheckInCount struct {
+	CheckedIn int `json:"checked_in" db:"checked_in"`
+	Expected  int `json:"expected" db:"expected"`
+}
+
+// CountCheckIns counts the event's arrivals against its seated guests.
+func CountCheckIns(tx *pop.Connection, eventID uuid.UUID) (CheckInCount, error) {
+	count := CheckInCount{}
+	err := tx.RawQuery(`SELECT COUNT(*) AS expected, COUNT(checked_in_at) AS checked_in FROM event_attendees
+		WHERE event_id = ? AND status = ? AND rsvp IN (?)`,
+		eventID, AttendeeStatusConfirmed, []string{RSVPGoing, RSVPMaybe}).First(&count)
+	return count, errors.WithStack(err)
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+)
+
+func (ms *ModelSuite) Test_CheckIn() {
+	event := &Event{Title: "Party", Date: time.Now().Add(24 * time.Hour), Status: EventStatusScheduled, Capacity: 1}
+	ms.NoError(ms.DB.Create(event))
+	guests := ms.createGuests("ann@example.com", "bob@example.com")
+
+	seated, err := Reserve(ms.DB, event.ID, guests[0].ID)
+	ms.NoError(err)
+	waiting, err := Reserve(ms.DB, event.ID, guests[1].ID)
+	ms.NoError(err)
+	ms.Len(seated.CheckInToken, 40)
+	ms.NotEqual(seated.CheckInToken, waiting.CheckInToken)
+
+	found, err := FindReservationByCheckInToken(ms.DB, seated.CheckInToken)
+	ms.NoError(err)
+	ms.Equal(seated.ID, found.ID)
+	ms.Equal("ann@example.com", found.Guest.Email)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	ms.NoError(CheckIn(ms.DB, found, now))
+	ms.True(found.IsCheckedIn())
+
+	// A second scan is turned away and sees the first one's time.
+	again, err := FindReservationByCheckInToken(ms.DB, seated.CheckInToken)
+	ms.NoError(err)
+	ms.ErrorIs(CheckIn(ms.DB, again, now.Add(time.Minute)), ErrAlreadyCheckedIn)
+	ms.Equal(now, again.CheckedInAt.Time.UTC())
+
+	ms.ErrorIs(CheckIn(ms.DB, waiting, now), ErrNotAdmitted)
+
+	count, err := CountCheckIns(ms.DB, event.ID)
+	ms.NoError(err)
+	ms.Equal(CheckInCount{CheckedIn: 1, Expected: 1}, count)
+}
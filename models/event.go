@@ -2,22 +2,71 @@ package models
 
 import (
 	"encoding/json"
+	"strings"
 	"time"
 
+	"github.com/gobuffalo/nulls"
 	"github.com/gobuffalo/pop/v6"
 	"github.com/gobuffalo/validate/v3"
+	"github.com/gobuffalo/validate/v3/validators"
 	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
 )
 
+// Event statuses.
+const (
+	EventStatusScheduled = "scheduled"
+	EventStatusCancelled = "cancelled"
+)
+
+// DefaultEventDuration is the length, in minutes, new events start with.
+const DefaultEventDuration = 60
+
+// DefaultTimeZone is the zone of events that weren't given one.
+const DefaultTimeZone = "UTC"
+
+// LoadTimeZone looks up an IANA time zone such as "Europe/Berlin". Unlike
+// time.LoadLocation it refuses "" and "Local", which would depend on the
+// server.
+func LoadTimeZone(name string) (*time.Location, error) {
+	if name == "" || name == "Local" {
+		return nil, errors.Errorf("%q is not a time zone", name)
+	}
+	loc, err := time.LoadLocation(name)
+	return loc, errors.WithStack(err)
+}
+
+// InZone reads t's date and clock time as a time in loc. Form inputs carry
+// no zone, so a bound time is the one the organizer meant in loc.
+func InZone(t time.Time, loc *time.Location) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+}
+
 // Event is used by pop to map your events database table to your go code.
 type Event struct {
-	ID          uuid.UUID `json:"id" db:"id"`
-	Title       string    `db:"title"`
-	Description string    `db:"desc"`
-	Date        time.Time `db:"event_date"`
-	EventGuests Guests    `many_to_many:"event_attendees"`
-	CreatedAt   time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+	ID           uuid.UUID      `json:"id" db:"id"`
+	Title        string         `json:"title" db:"title"`
+	Description  string         `json:"description" db:"desc"`
+	Date         time.Time      `json:"date" db:"event_date"`
+	TimeZone     string         `json:"time_zone" db:"time_zone"`
+	Status       string         `json:"status" db:"status"`
+	CancelReason nulls.String   `json:"cancel_reason" db:"cancel_reason"`
+	CancelledAt  nulls.Time     `json:"cancelled_at" db:"cancelled_at"`
+	OwnerID      nulls.UUID     `json:"-" db:"owner_id"`
+	Capacity     int            `json:"capacity" db:"capacity"`
+	Duration     int            `json:"duration_minutes" db:"duration_minutes"`
+	Location     string         `json:"location" db:"location"`
+	Sequence     int            `json:"sequence" db:"sequence"`
+	SeriesID     nulls.UUID     `json:"series_id" db:"series_id"`
+	RecurrenceID nulls.Time     `json:"recurrence_id" db:"recurrence_id"`
+	Series       *EventSeries   `json:"series,omitempty" db:"-"`
+	Organizers   Users          `json:"-" many_to_many:"event_organizers"`
+	Attendees    EventAttendees `json:"-" has_many:"event_attendees" order_by:"created_at asc"`
+	EventGuests  Guests         `json:"-" many_to_many:"event_attendees"`
+	RSVPCounts   map[string]int `json:"rsvp_counts,omitempty" db:"-"`
+	CreatedAt    time.Time      `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at" db:"updated_at"`
 }
 
 // String is not required by pop and may be deleted
@@ -34,6 +83,212 @@ func (e Event) HasGuests() bool {
 	return len(e.EventGuests) > 0
 }
 
+// ConfirmedCount returns the number of seats taken. Attendees must be
+// loaded.
+func (e Event) ConfirmedCount() int {
+	n := 0
+	for _, a := range e.Attendees {
+		if a.Status == AttendeeStatusConfirmed && a.HoldsSpot() {
+			n++
+		}
+	}
+	return n
+}
+
+// WaitlistCount returns the number of guests waiting for a seat.
+// Attendees must be loaded.
+func (e Event) WaitlistCount() int {
+	n := 0
+	for _, a := range e.Attendees {
+		if a.IsWaitlisted() && a.HoldsSpot() {
+			n++
+		}
+	}
+	return n
+}
+
+// CountRSVPs tallies the attendees by RSVP answer and stores the result in
+// RSVPCounts. Attendees must be loaded.
+func (e *Event) CountRSVPs() map[string]int {
+	e.RSVPCounts = newRSVPCounts()
+	for _, a := range e.Attendees {
+		e.RSVPCounts[a.RSVP]++
+	}
+	return e.RSVPCounts
+}
+
+func newRSVPCounts() map[string]int {
+	counts := make(map[string]int, len(RSVPs))
+	for _, rsvp := range RSVPs {
+		counts[rsvp] = 0
+	}
+	return counts
+}
+
+// IsFull reports whether new guests go to the waitlist. A zero capacity
+// means the event has no limit. Attendees must be loaded.
+func (e Event) IsFull() bool {
+	return e.Capacity > 0 && e.ConfirmedCount() >= e.Capacity
+}
+
+// EndsAt returns when the event is over, from its duration in minutes.
+func (e Event) EndsAt() time.Time {
+	return e.Date.Add(time.Duration(e.Duration) * time.Minute)
+}
+
+// HasEnded reports whether the event is over at now. Lists count an event
+// as past from then on.
+func (e Event) HasEnded(now time.Time) bool {
+	return e.EndsAt().Before(now)
+}
+
+// Zone is the event's time zone, or UTC if it has none.
+func (e Event) Zone() *time.Location {
+	loc, err := LoadTimeZone(e.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// LocalDate is when the event starts, in its own zone.
+func (e Event) LocalDate() time.Time {
+	return e.Date.In(e.Zone())
+}
+
+// FormatDate formats the start in the event's zone.
+func (e Event) FormatDate(layout string) string {
+	return e.LocalDate().Format(layout)
+}
+
+// FormatTime formats another time to do with the event, such as a
+// check-in, in the event's zone.
+func (e Event) FormatTime(t time.Time, layout string) string {
+	return t.In(e.Zone()).Format(layout)
+}
+
+// When describes the event's time in its own zone, like "Jan. 02 2006
+// 7:00 PM CET to 9:00 PM".
+func (e Event) When() string {
+	return e.WhenIn(e.Zone())
+}
+
+// WhenIn describes the event's time in loc, as When does.
+func (e Event) WhenIn(loc *time.Location) string {
+	start, end := e.Date.In(loc), e.EndsAt().In(loc)
+	if start.Format(DateFormat) != end.Format(DateFormat) {
+		return start.Format("Jan. 02 2006 3:04 PM MST") + " to " + end.Format("Jan. 02 2006 3:04 PM MST")
+	}
+	return start.Format("Jan. 02 2006 3:04 PM MST") + " to " + end.Format("3:04 PM")
+}
+
+// ToICSLink is the path of the event's calendar file.
+func (e Event) ToICSLink() string {
+	return e.ToLink() + ".ics"
+}
+
+// IsCancelled reports whether the event has been called off.
+func (e Event) IsCancelled() bool {
+	return e.Status == EventStatusCancelled
+}
+
+// IsOwner reports whether u created the event.
+func (e Event) IsOwner(u *User) bool {
+	return u != nil && e.OwnerID.Valid && e.OwnerID.UUID == u.ID
+}
+
+// IsOrganizer reports whether u was added as a co-organizer. Organizers
+// must be loaded.
+func (e Event) IsOrganizer(u *User) bool {
+	if u == nil {
+		return false
+	}
+	for _, o := range e.Organizers {
+		if o.ID == u.ID {
+			return true
+		}
+	}
+	return false
+}
+
+// CanManage reports whether u may edit the event, see its full guest list
+// and remove guests. Organizers must be loaded. Admins can manage every
+// event. Events created before ownership was recorded have no owner and
+// are open to every organizer.
+func (e Event) CanManage(u *User) bool {
+	if u == nil {
+		return false
+	}
+	if u.IsAdmin() || e.IsOwner(u) || e.IsOrganizer(u) {
+		return true
+	}
+	return !e.OwnerID.Valid && u.HasRole(RoleOrganizer)
+}
+
+// HasOwnerRights reports whether u may delete the event and choose its
+// co-organizers. Admins have owner rights on every event; ownerless events
+// fall back to CanManage.
+func (e Event) HasOwnerRights(u *User) bool {
+	return e.IsOwner(u) || u.IsAdmin() || (!e.OwnerID.Valid && e.CanManage(u))
+}
+
+// Cancel marks the event as cancelled. The attendee list is kept so guests
+// can still see what they had signed up for.
+func (e *Event) Cancel(reason string) {
+	e.Status = EventStatusCancelled
+	e.CancelReason = nulls.NewString(strings.TrimSpace(reason))
+	e.CancelledAt = nulls.NewTime(time.Now().UTC())
+}
+
+// Destroy removes the event along with its event_attendees and
+// event_organizers rows, so nothing is left pointing at a missing event.
+// Guests themselves are kept since they may be attending other events.
+// An occurrence's date becomes an exception of its series, so it isn't
+// created again.
+func (e *Event) Destroy(tx *pop.Connection) error {
+	if e.SeriesID.Valid {
+		s := &EventSeries{}
+		err := tx.Find(s, e.SeriesID.UUID)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if d := e.RecurrenceID.Time.In(s.Zone()); !s.ExDates.Contains(d) {
+			s.ExDates, _ = ParseDateList(s.ExDates.String() + "," + d.Format(DateFormat))
+			err = tx.Update(s)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	}
+	for _, table := range []string{"event_attendees", "event_organizers"} {
+		err := tx.RawQuery("DELETE FROM "+table+" WHERE event_id = ?", e.ID).Exec()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return errors.WithStack(tx.Destroy(e))
+}
+
+// BeforeSave stores times in UTC, whatever zone they were given in, and
+// gives events without a zone the default one.
+func (e *Event) BeforeSave(tx *pop.Connection) error {
+	e.Date = e.Date.UTC()
+	if e.RecurrenceID.Valid {
+		e.RecurrenceID.Time = e.RecurrenceID.Time.UTC()
+	}
+	if e.TimeZone == "" {
+		e.TimeZone = DefaultTimeZone
+	}
+	return nil
+}
+
+// BeforeUpdate bumps the revision number on every change, so calendar
+// clients that already imported the event replace their copy.
+func (e *Event) BeforeUpdate(tx *pop.Connection) error {
+	e.Sequence++
+	return nil
+}
+
 // Events is not required by pop and may be deleted
 type Events []Event
 
@@ -43,10 +298,87 @@ func (e Events) String() string {
 	return string(je)
 }
 
+// OwnedEvents lists the events userID created, newest first.
+func OwnedEvents(tx *pop.Connection, userID uuid.UUID) (Events, error) {
+	events := Events{}
+	err := tx.Where("owner_id = ?", userID).Order("event_date desc").All(&events)
+	return events, errors.WithStack(err)
+}
+
+// OrganizedEvents lists the events userID co-organizes, newest first.
+func OrganizedEvents(tx *pop.Connection, userID uuid.UUID) (Events, error) {
+	events := Events{}
+	err := tx.RawQuery("SELECT events.* FROM events JOIN event_organizers ON event_organizers.event_id = events.id WHERE event_organizers.user_id = ? ORDER BY events.event_date DESC", userID).All(&events)
+	return events, errors.WithStack(err)
+}
+
+type rsvpCount struct {
+	EventID uuid.UUID `db:"event_id"`
+	RSVP    string    `db:"rsvp"`
+	Count   int       `db:"n"`
+}
+
+// LoadRSVPCounts fills RSVPCounts on every event with a single query.
+func (e Events) LoadRSVPCounts(tx *pop.Connection) error {
+	if len(e) == 0 {
+		return nil
+	}
+
+	ids := make([]uuid.UUID, len(e))
+	for i := range e {
+		ids[i] = e[i].ID
+		e[i].RSVPCounts = newRSVPCounts()
+	}
+
+	rows := []rsvpCount{}
+	err := tx.RawQuery("SELECT event_id, rsvp, COUNT(*) AS n FROM event_attendees WHERE event_id IN (?) GROUP BY event_id, rsvp", ids).All(&rows)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, row := range rows {
+		for i := range e {
+			if e[i].ID == row.EventID {
+				e[i].RSVPCounts[row.RSVP] = row.Count
+			}
+		}
+	}
+	return nil
+}
+
 // Validate gets run every time you call a "pop.Validate*" (pop.ValidateAndSave, pop.ValidateAndCreate, pop.ValidateAndUpdate) method.
-// This method is not required and may be deleted.
 func (e *Event) Validate(tx *pop.Connection) (*validate.Errors, error) {
-	return validate.NewErrors(), nil
+	return validate.Validate(
+		&validators.StringIsPresent{Field: e.Title, Name: "Title"},
+		&validators.StringLengthInRange{Field: e.Title, Name: "Title", Max: 255},
+		&validators.StringLengthInRange{Field: e.Description, Name: "Description", Max: 255},
+		&validators.TimeIsPresent{Field: e.Date, Name: "Date"},
+		&validators.IntIsGreaterThan{Field: e.Capacity, Name: "Capacity", Compared: -1, Message: "Capacity can't be negative"},
+		&validators.IntIsGreaterThan{Field: e.Duration, Name: "Duration", Compared: 0, Message: "Duration must be at least one minute"},
+		&validators.StringLengthInRange{Field: e.Location, Name: "Location", Max: 255},
+		&validators.FuncValidator{
+			Field:   e.TimeZone,
+			Name:    "TimeZone",
+			Message: "%q is not a known time zone",
+			Fn: func() bool {
+				_, err := LoadTimeZone(e.TimeZone)
+				return e.TimeZone == "" || err == nil
+			},
+		},
+		&validators.StringInclusion{
+			Field: e.Status,
+			Name:  "Status",
+			List:  []string{EventStatusScheduled, EventStatusCancelled},
+		},
+		&validators.FuncValidator{
+			Field:   "A reason",
+			Name:    "CancelReason",
+			Message: "%s is required to cancel an event",
+			Fn: func() bool {
+				return !e.IsCancelled() || strings.TrimSpace(e.CancelReason.String) != ""
+			},
+		},
+	), nil
 }
 
 // ValidateCreate gets run every time you call "pop.ValidateAndCreate" method.
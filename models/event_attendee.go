@@ -2,22 +2,50 @@ package models
 
 import (
 	"encoding/json"
+	"strconv"
 	"time"
 
+	"github.com/gobuffalo/nulls"
 	"github.com/gobuffalo/pop/v6"
 	"github.com/gobuffalo/validate/v3"
+	"github.com/gobuffalo/validate/v3/validators"
 	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
 )
 
+// Reservation statuses.
+const (
+	AttendeeStatusConfirmed  = "confirmed"
+	AttendeeStatusWaitlisted = "waitlisted"
+)
+
+// RSVP answers a guest can give.
+const (
+	RSVPGoing     = "going"
+	RSVPMaybe     = "maybe"
+	RSVPDeclined  = "declined"
+	RSVPCancelled = "cancelled"
+)
+
+// RSVPs lists the RSVP answers in display order.
+var RSVPs = []string{RSVPGoing, RSVPMaybe, RSVPDeclined, RSVPCancelled}
+
 // EventAttendee is used by pop to map your event_attendees database table to your go code.
 type EventAttendee struct {
 	ID        uuid.UUID `json:"id" db:"id"`
-	GuestID   uuid.UUID `db:"guest_id"`
-	Guest     *Guest    `belongs_to:"guests"`
-	EventID   uuid.UUID `db:"event_id"`
-	Event     *Event    `belongs_to:"events"`
+	GuestID   uuid.UUID `json:"guest_id" db:"guest_id"`
+	Guest     *Guest    `json:"guest,omitempty" belongs_to:"guests"`
+	EventID   uuid.UUID `json:"event_id" db:"event_id"`
+	Event     *Event    `json:"event,omitempty" belongs_to:"events"`
+	Status    string    `json:"status" db:"status"`
+	RSVP      string    `json:"rsvp" db:"rsvp"`
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+
+	// CheckInToken admits the guest at the door. It is shown to the guest
+	// as a QR code and is the only secret on their ticket.
+	CheckInToken string     `json:"-" db:"check_in_token"`
+	CheckedInAt  nulls.Time `json:"checked_in_at" db:"checked_in_at"`
 }
 
 // String is not required by pop and may be deleted
@@ -26,6 +54,17 @@ func (e EventAttendee) String() string {
 	return string(je)
 }
 
+// IsWaitlisted reports whether the guest is waiting for a free spot.
+func (e EventAttendee) IsWaitlisted() bool {
+	return e.Status == AttendeeStatusWaitlisted
+}
+
+// HoldsSpot reports whether the guest still intends to come, and so takes
+// up a seat or a place on the waitlist.
+func (e EventAttendee) HoldsSpot() bool {
+	return e.RSVP == RSVPGoing || e.RSVP == RSVPMaybe
+}
+
 // EventAttendees is not required by pop and may be deleted
 type EventAttendees []EventAttendee
 
@@ -36,9 +75,15 @@ func (e EventAttendees) String() string {
 }
 
 // Validate gets run every time you call a "pop.Validate*" (pop.ValidateAndSave, pop.ValidateAndCreate, pop.ValidateAndUpdate) method.
-// This method is not required and may be deleted.
 func (e *EventAttendee) Validate(tx *pop.Connection) (*validate.Errors, error) {
-	return validate.NewErrors(), nil
+	return validate.Validate(
+		&validators.StringInclusion{
+			Field: e.Status,
+			Name:  "Status",
+			List:  []string{AttendeeStatusConfirmed, AttendeeStatusWaitlisted},
+		},
+		&validators.StringInclusion{Field: e.RSVP, Name: "RSVP", List: RSVPs},
+	), nil
 }
 
 // ValidateCreate gets run every time you call "pop.ValidateAndCreate" method.
@@ -52,3 +97,223 @@ func (e *EventAttendee) ValidateCreate(tx *pop.Connection) (*validate.Errors, er
 func (e *EventAttendee) ValidateUpdate(tx *pop.Connection) (*validate.Errors, error) {
 	return validate.NewErrors(), nil
 }
+
+// lockEvent loads the event with a row lock held until tx ends. Every
+// change to an event's seat count takes this lock first, so concurrent
+// sign-ups are counted one after the other.
+func lockEvent(tx *pop.Connection, eventID uuid.UUID) (*Event, error) {
+	event := &Event{}
+	err := tx.RawQuery("SELECT * FROM events WHERE id = ? FOR UPDATE", eventID).First(event)
+	return event, errors.WithStack(err)
+}
+
+// confirmedCount counts the taken seats. It is a locking read so it sees
+// rows committed by other transactions after ours started.
+func confirmedCount(tx *pop.Connection, eventID uuid.UUID) (int, error) {
+	confirmed := EventAttendees{}
+	err := tx.RawQuery("SELECT * FROM event_attendees WHERE event_id = ? AND status = ? AND rsvp IN (?) FOR UPDATE",
+		eventID, AttendeeStatusConfirmed, []string{RSVPGoing, RSVPMaybe}).All(&confirmed)
+	return len(confirmed), errors.WithStack(err)
+}
+
+// Reserve books a guest onto an event, or adds them to the waitlist when
+// the event is at capacity.
+func Reserve(tx *pop.Connection, eventID, guestID uuid.UUID) (*EventAttendee, error) {
+	event, err := lockEvent(tx, eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &EventAttendee{
+		EventID: event.ID,
+		GuestID: guestID,
+		RSVP:    RSVPGoing,
+	}
+
+	res.Status, err = seatStatus(tx, event)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Create(res)
+	return res, errors.WithStack(err)
+}
+
+// seatStatus decides whether a new seat holder is confirmed or waitlisted.
+// The event must be locked.
+func seatStatus(tx *pop.Connection, event *Event) (string, error) {
+	if event.Capacity == 0 {
+		return AttendeeStatusConfirmed, nil
+	}
+	n, err := confirmedCount(tx, event.ID)
+	if err != nil {
+		return "", err
+	}
+	if n >= event.Capacity {
+		return AttendeeStatusWaitlisted, nil
+	}
+	return AttendeeStatusConfirmed, nil
+}
+
+// SetRSVP records a guest's answer. Declining or cancelling frees their
+// seat for the waitlist; coming back is treated like a new sign-up, so a
+// returning guest may land at the back of the waitlist. It returns any
+// reservations promoted off the waitlist.
+func SetRSVP(tx *pop.Connection, res *EventAttendee, rsvp string) (EventAttendees, error) {
+	event, err := lockEvent(tx, res.EventID)
+	if err != nil {
+		return nil, err
+	}
+
+	held := res.HoldsSpot()
+	res.RSVP = rsvp
+	rejoined := !held && res.HoldsSpot()
+	if rejoined {
+		res.Status, err = seatStatus(tx, event)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	verrs, err := tx.ValidateAndUpdate(res)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if verrs.HasAny() {
+		return nil, verrs
+	}
+
+	if rejoined && res.IsWaitlisted() {
+		// The waitlist is ordered by join time.
+		res.CreatedAt = time.Now()
+		err = tx.RawQuery("UPDATE event_attendees SET created_at = ? WHERE id = ?", res.CreatedAt, res.ID).Exec()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	if held && !res.HoldsSpot() {
+		return PromoteWaitlist(tx, res.EventID)
+	}
+	return EventAttendees{}, nil
+}
+
+// CancelReservation drops a reservation and hands any freed seat to the
+// waitlist.
+func CancelReservation(tx *pop.Connection, res *EventAttendee) (EventAttendees, error) {
+	_, err := lockEvent(tx, res.EventID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Destroy(res)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return PromoteWaitlist(tx, res.EventID)
+}
+
+// ErrAlreadyReserved is returned when moving a reservation onto an event
+// the guest already has a reservation for.
+var ErrAlreadyReserved = errors.New("guest already has a reservation for that event")
+
+// MoveReservation re-points a reservation at another event. The guest
+// joins the new event like a fresh sign-up, so they may be waitlisted, and
+// the seat they leave goes to the old event's waitlist. It returns any
+// reservations promoted on the old event.
+func MoveReservation(tx *pop.Connection, res *EventAttendee, toEventID uuid.UUID) (EventAttendees, error) {
+	fromEventID := res.EventID
+	if fromEventID == toEventID {
+		return EventAttendees{}, nil
+	}
+
+	// Lock both events in a fixed order so two opposite moves can't
+	// deadlock.
+	first, second := fromEventID, toEventID
+	if first.String() > second.String() {
+		first, second = second, first
+	}
+	locked := map[uuid.UUID]*Event{}
+	for _, id := range []uuid.UUID{first, second} {
+		event, err := lockEvent(tx, id)
+		if err != nil {
+			return nil, err
+		}
+		locked[id] = event
+	}
+
+	exists, err := tx.Where("event_id = ? AND guest_id = ?", toEventID, res.GuestID).Exists(&EventAttendee{})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if exists {
+		return nil, ErrAlreadyReserved
+	}
+
+	res.EventID = toEventID
+	res.Status = AttendeeStatusConfirmed
+	res.CheckedInAt = nulls.Time{}
+	if res.HoldsSpot() {
+		res.Status, err = seatStatus(tx, locked[toEventID])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.Update(res)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	// The waitlist is ordered by join time.
+	res.CreatedAt = time.Now()
+	err = tx.RawQuery("UPDATE event_attendees SET created_at = ? WHERE id = ?", res.CreatedAt, res.ID).Exec()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	// Reminders already sent were for the old event.
+	err = tx.RawQuery("DELETE FROM event_reminders WHERE event_attendee_id = ?", res.ID).Exec()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return PromoteWaitlist(tx, fromEventID)
+}
+
+// PromoteWaitlist confirms waitlisted guests, in the order they joined,
+// until the event is full. It returns the promoted reservations.
+func PromoteWaitlist(tx *pop.Connection, eventID uuid.UUID) (EventAttendees, error) {
+	event, err := lockEvent(tx, eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	q := "SELECT * FROM event_attendees WHERE event_id = ? AND status = ? AND rsvp IN (?) ORDER BY created_at, id"
+	if event.Capacity > 0 {
+		n, err := confirmedCount(tx, event.ID)
+		if err != nil {
+			return nil, err
+		}
+		free := event.Capacity - n
+		if free <= 0 {
+			return EventAttendees{}, nil
+		}
+		q += " LIMIT " + strconv.Itoa(free)
+	}
+
+	promoted := EventAttendees{}
+	err = tx.RawQuery(q+" FOR UPDATE", event.ID, AttendeeStatusWaitlisted, []string{RSVPGoing, RSVPMaybe}).All(&promoted)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	for i := range promoted {
+		promoted[i].Status = AttendeeStatusConfirmed
+		err = tx.Update(&promoted[i])
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	return promoted, nil
+}
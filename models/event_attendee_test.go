@@ -1,5 +1,128 @@
 package models
 
-func (ms *ModelSuite) Test_EventAttendee() {
-	ms.Fail("This test needs to be implemented!")
+import (
+	"time"
+)
+
+func (ms *ModelSuite) createGuests(emails ...string) Guests {
+	guests := Guests{}
+	for _, email := range emails {
+		g := Guest{Email: email, FullName: email}
+		ms.NoError(ms.DB.Create(&g))
+		guests = append(guests, g)
+	}
+	return guests
+}
+
+func (ms *ModelSuite) Test_EventAttendee_Waitlist() {
+	e := &Event{Title: "Cooking class", Date: time.Now(), Status: EventStatusScheduled, Capacity: 1}
+	ms.NoError(ms.DB.Create(e))
+	guests := ms.createGuests("a@example.com", "b@example.com", "c@example.com")
+
+	first, err := Reserve(ms.DB, e.ID, guests[0].ID)
+	ms.NoError(err)
+	ms.Equal(AttendeeStatusConfirmed, first.Status)
+
+	second, err := Reserve(ms.DB, e.ID, guests[1].ID)
+	ms.NoError(err)
+	ms.True(second.IsWaitlisted())
+
+	third, err := Reserve(ms.DB, e.ID, guests[2].ID)
+	ms.NoError(err)
+	ms.True(third.IsWaitlisted())
+
+	promoted, err := CancelReservation(ms.DB, first)
+	ms.NoError(err)
+	ms.Len(promoted, 1)
+	ms.Equal(second.ID, promoted[0].ID)
+
+	ms.NoError(ms.DB.Reload(third))
+	ms.True(third.IsWaitlisted())
+}
+
+func (ms *ModelSuite) Test_EventAttendee_PromoteOnCapacityChange() {
+	e := &Event{Title: "Cooking class", Date: time.Now(), Status: EventStatusScheduled, Capacity: 1}
+	ms.NoError(ms.DB.Create(e))
+	guests := ms.createGuests("a@example.com", "b@example.com")
+
+	for _, g := range guests {
+		_, err := Reserve(ms.DB, e.ID, g.ID)
+		ms.NoError(err)
+	}
+
+	e.Capacity = 0
+	ms.NoError(ms.DB.Update(e))
+
+	promoted, err := PromoteWaitlist(ms.DB, e.ID)
+	ms.NoError(err)
+	ms.Len(promoted, 1)
+
+	count, err := ms.DB.Where("event_id = ? AND status = ?", e.ID, AttendeeStatusConfirmed).Count(&EventAttendee{})
+	ms.NoError(err)
+	ms.Equal(2, count)
+}
+
+func (ms *ModelSuite) Test_EventAttendee_SetRSVP() {
+	e := &Event{Title: "Cooking class", Date: time.Now(), Status: EventStatusScheduled, Capacity: 1}
+	ms.NoError(ms.DB.Create(e))
+	guests := ms.createGuests("a@example.com", "b@example.com")
+
+	first, err := Reserve(ms.DB, e.ID, guests[0].ID)
+	ms.NoError(err)
+	second, err := Reserve(ms.DB, e.ID, guests[1].ID)
+	ms.NoError(err)
+	ms.True(second.IsWaitlisted())
+
+	// Maybe still holds the seat.
+	promoted, err := SetRSVP(ms.DB, first, RSVPMaybe)
+	ms.NoError(err)
+	ms.Len(promoted, 0)
+
+	promoted, err = SetRSVP(ms.DB, first, RSVPCancelled)
+	ms.NoError(err)
+	ms.Len(promoted, 1)
+	ms.Equal(second.ID, promoted[0].ID)
+
+	// Coming back to a full event means waiting.
+	_, err = SetRSVP(ms.DB, first, RSVPGoing)
+	ms.NoError(err)
+	ms.True(first.IsWaitlisted())
+
+	_, err = SetRSVP(ms.DB, first, "sometimes")
+	ms.Error(err)
+
+	ms.NoError(ms.DB.Eager("Attendees").Reload(e))
+	counts := e.CountRSVPs()
+	ms.Equal(2, counts[RSVPGoing])
+	ms.Equal(0, counts[RSVPCancelled])
+}
+
+func (ms *ModelSuite) Test_EventAttendee_MoveReservation() {
+	from := &Event{Title: "Cooking class", Date: time.Now(), Status: EventStatusScheduled, Capacity: 1}
+	ms.NoError(ms.DB.Create(from))
+	to := &Event{Title: "Pottery class", Date: time.Now(), Status: EventStatusScheduled, Capacity: 1}
+	ms.NoError(ms.DB.Create(to))
+	guests := ms.createGuests("a@example.com", "b@example.com", "c@example.com")
+
+	moving, err := Reserve(ms.DB, from.ID, guests[0].ID)
+	ms.NoError(err)
+	waiting, err := Reserve(ms.DB, from.ID, guests[1].ID)
+	ms.NoError(err)
+	ms.True(waiting.IsWaitlisted())
+	_, err = Reserve(ms.DB, to.ID, guests[2].ID)
+	ms.NoError(err)
+	duplicate, err := Reserve(ms.DB, from.ID, guests[2].ID)
+	ms.NoError(err)
+
+	promoted, err := MoveReservation(ms.DB, moving, to.ID)
+	ms.NoError(err)
+	ms.Len(promoted, 1)
+	ms.Equal(waiting.ID, promoted[0].ID)
+
+	ms.NoError(ms.DB.Reload(moving))
+	ms.Equal(to.ID, moving.EventID)
+	ms.True(moving.IsWaitlisted())
+
+	_, err = MoveReservation(ms.DB, duplicate, to.ID)
+	ms.ErrorIs(err, ErrAlreadyReserved)
 }
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/pop/v6"
+	"github.com/pkg/errors"
+)
+
+// Which events a listing covers, judged by whether they have ended.
+const (
+	EventsUpcoming = "upcoming"
+	EventsPast     = "past"
+	EventsAll      = "all"
+)
+
+// MaxEventsPerPage caps the page size a client can ask for.
+const MaxEventsPerPage = 100
+
+// eventSorts maps the accepted sort keys to ORDER BY clauses. A leading
+// "-" means descending. The id breaks ties so pages don't overlap.
+var eventSorts = map[string]string{
+	"date":     "event_date ASC, id ASC",
+	"-date":    "event_date DESC, id ASC",
+	"title":    "title ASC, id ASC",
+	"-title":   "title DESC, id ASC",
+	"created":  "created_at ASC, id ASC",
+	"-created": "created_at DESC, id ASC",
+}
+
+// EventListOptions filters, sorts and pages a list of events. The zero
+// value lists upcoming events, soonest first, 20 to a page.
+type EventListOptions struct {
+	When    string    // EventsUpcoming, EventsPast or EventsAll
+	From    time.Time // only events starting at or after From
+	To      time.Time // only events starting before To
+	Search  string    // matched against title and description
+	Sort    string    // a key of eventSorts
+	Page    int
+	PerPage int
+}
+
+// Normalize replaces unknown or missing values with defaults, so the
+// options can be echoed back to the client.
+func (o EventListOptions) Normalize() EventListOptions {
+	switch o.When {
+	case EventsUpcoming, EventsPast, EventsAll:
+	default:
+		o.When = EventsUpcoming
+	}
+
+	if _, ok := eventSorts[o.Sort]; !ok {
+		o.Sort = "date"
+		if o.When == EventsPast {
+			o.Sort = "-date"
+		}
+	}
+
+	o.Search = strings.TrimSpace(o.Search)
+	if o.Page < 1 {
+		o.Page = 1
+	}
+	if o.PerPage < 1 {
+		o.PerPage = 20
+	}
+	if o.PerPage > MaxEventsPerPage {
+		o.PerPage = MaxEventsPerPage
+	}
+	return o
+}
+
+// ListEvents returns one page of events matching o, along with the
+// paginator holding the totals. An event counts as past once it has ended.
+func ListEvents(tx *pop.Connection, o EventListOptions, now time.Time) (Events, *pop.Paginator, error) {
+	o = o.Normalize()
+	q := tx.Paginate(o.Page, o.PerPage)
+
+	endsAt := "DATE_ADD(event_date, INTERVAL duration_minutes MINUTE)"
+	switch o.When {
+	case EventsUpcoming:
+		q = q.Where(endsAt+" >= ?", now)
+	case EventsPast:
+		q = q.Where(endsAt+" < ?", now)
+	}
+
+	if !o.From.IsZero() {
+		q = q.Where("event_date >= ?", o.From)
+	}
+	if !o.To.IsZero() {
+		q = q.Where("event_date < ?", o.To)
+	}
+
+	if o.Search != "" {
+		pattern := SearchPattern(o.Search)
+		q = q.Where("(title LIKE ? OR `desc` LIKE ?)", pattern, pattern)
+	}
+
+	events := Events{}
+	err := q.Order(eventSorts[o.Sort]).All(&events)
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	return events, q.Paginator, nil
+}
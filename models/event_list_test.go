@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+)
+
+func (ms *ModelSuite) Test_ListEvents() {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	for _, e := range []*Event{
+		{Title: "Yesterday's picnic", Date: now.Add(-24 * time.Hour)},
+		{Title: "Lunch talk", Description: "Still going", Date: now.Add(-30 * time.Minute)},
+		{Title: "Board games", Description: "100% fun", Date: now.Add(48 * time.Hour)},
+		{Title: "Allotment tour", Date: now.Add(24 * time.Hour)},
+	} {
+		e.Status = EventStatusScheduled
+		e.Duration = 60
+		ms.NoError(ms.DB.Create(e))
+	}
+
+	events, pagination, err := ListEvents(ms.DB, EventListOptions{}, now)
+	ms.NoError(err)
+	ms.Len(events, 3)
+	ms.Equal(3, pagination.TotalEntriesSize)
+	ms.Equal("Lunch talk", events[0].Title)
+
+	events, _, err = ListEvents(ms.DB, EventListOptions{When: EventsPast}, now)
+	ms.NoError(err)
+	ms.Len(events, 1)
+
+	events, _, err = ListEvents(ms.DB, EventListOptions{When: EventsAll, Sort: "title", PerPage: 2, Page: 2}, now)
+	ms.NoError(err)
+	ms.Len(events, 2)
+	ms.Equal("Lunch talk", events[0].Title)
+
+	events, _, err = ListEvents(ms.DB, EventListOptions{When: EventsAll, Search: "100%"}, now)
+	ms.NoError(err)
+	ms.Len(events, 1)
+	ms.Equal("Board games", events[0].Title)
+
+	events, _, err = ListEvents(ms.DB, EventListOptions{When: EventsAll, From: now, To: now.Add(36 * time.Hour)}, now)
+	ms.NoError(err)
+	ms.Len(events, 1)
+	ms.Equal("Allotment tour", events[0].Title)
+}
+
+func (ms *ModelSuite) Test_EventListOptions_Normalize() {
+	o := EventListOptions{When: "someday", Sort: "; DROP TABLE events", PerPage: 5000}.Normalize()
+	ms.Equal(EventsUpcoming, o.When)
+	ms.Equal("date", o.Sort)
+	ms.Equal(1, o.Page)
+	ms.Equal(MaxEventsPerPage, o.PerPage)
+
+	o = EventListOptions{When: EventsPast}.Normalize()
+	ms.Equal("-date", o.Sort)
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gobuffalo/pop/v6"
+	"github.com/gobuffalo/validate/v3"
+	"github.com/gofrs/uuid"
+)
+
+// EventOrganizer is used by pop to map your event_organizers database table to your go code.
+// It grants a user other than the owner the right to manage an event.
+type EventOrganizer struct {
+	ID        uuid.UUID `json:"id" db:"id"`
+	EventID   uuid.UUID `db:"event_id"`
+	Event     *Event    `belongs_to:"events"`
+	UserID    uuid.UUID `db:"user_id"`
+	User      *User     `belongs_to:"users"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// String is not required by pop and may be deleted
+func (e EventOrganizer) String() string {
+	je, _ := json.Marshal(e)
+	return string(je)
+}
+
+// EventOrganizers is not required by pop and may be deleted
+type EventOrganizers []EventOrganizer
+
+// String is not required by pop and may be deleted
+func (e EventOrganizers) String() string {
+	je, _ := json.Marshal(e)
+	return string(je)
+}
+
+// Validate gets run every time you call a "pop.Validate*" (pop.ValidateAndSave, pop.ValidateAndCreate, pop.ValidateAndUpdate) method.
+// This method is not required and may be deleted.
+func (e *EventOrganizer) Validate(tx *pop.Connection) (*validate.Errors, error) {
+	return validate.NewErrors(), nil
+}
+
+// ValidateCreate gets run every time you call "pop.ValidateAndCreate" method.
+// This method is not required and may be deleted.
+func (e *EventOrganizer) ValidateCreate(tx *pop.Connection) (*validate.Errors, error) {
+	return validate.NewErrors(), nil
+}
+
+// ValidateUpdate gets run every time you call "pop.ValidateAndUpdate" method.
+// This method is not required and may be deleted.
+func (e *EventOrganizer) ValidateUpdate(tx *pop.Connection) (*validate.Errors, error) {
+	return validate.NewErrors(), nil
+}
@@ -0,0 +1,85 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/nulls"
+	"github.com/gobuffalo/pop/v6"
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+)
+
+// EventReminder is used by pop to map your event_reminders database table to your go code.
+// It records the reminder sent to a guest some time before their event.
+// The row is written before the email goes out and there can only be one
+// per reservation and offset, so no reminder is ever sent twice; one that
+// fails is recorded but not retried.
+type EventReminder struct {
+	ID              uuid.UUID    `json:"id" db:"id"`
+	EventAttendeeID uuid.UUID    `json:"event_attendee_id" db:"event_attendee_id"`
+	OffsetMinutes   int          `json:"offset_minutes" db:"offset_minutes"`
+	SentAt          nulls.Time   `json:"sent_at" db:"sent_at"`
+	LastError       nulls.String `json:"last_error" db:"last_error"`
+	CreatedAt       time.Time    `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time    `json:"updated_at" db:"updated_at"`
+}
+
+// String is not required by pop and may be deleted
+func (r EventReminder) String() string {
+	jr, _ := json.Marshal(r)
+	return string(jr)
+}
+
+// EventReminders is not required by pop and may be deleted
+type EventReminders []EventReminder
+
+// DueReminders returns up to limit reservations owed the reminder sent
+// offset before their event, with the guest and event loaded. The event
+// must be scheduled and not yet started, and the guest must have a seat.
+// Guests who reserved after the reminder time are skipped, as they have
+// just had their confirmation, and so are guests who already had this
+// reminder or one closer to the event.
+func DueReminders(tx *pop.Connection, offset time.Duration, now time.Time, limit int) (EventAttendees, error) {
+	minutes := int(offset / time.Minute)
+	due := EventAttendees{}
+	err := tx.Eager("Guest", "Event").
+		Where("event_attendees.status = ? AND event_attendees.rsvp IN (?)",
+			AttendeeStatusConfirmed, []string{RSVPGoing, RSVPMaybe}).
+		Join("events", "events.id = event_attendees.event_id").
+		Where("events.status = ? AND events.event_date > ? AND events.event_date <= ?",
+			EventStatusScheduled, now, now.Add(offset)).
+		Where("event_attendees.created_at <= DATE_SUB(events.event_date, INTERVAL ? MINUTE)", minutes).
+		Where("NOT EXISTS (SELECT 1 FROM event_reminders WHERE event_reminders.event_attendee_id = event_attendees.id AND event_reminders.offset_minutes <= ?)", minutes).
+		Order("events.event_date asc").
+		Limit(limit).
+		All(&due)
+	return due, errors.WithStack(err)
+}
+
+// ClaimReminder records that the reminder at offset is going out for res.
+// It reports false if it already has, in which case it must not be sent.
+// Run it outside a transaction so the claim holds even if sending fails.
+func ClaimReminder(tx *pop.Connection, res *EventAttendee, offset time.Duration) (*EventReminder, bool, error) {
+	r := &EventReminder{EventAttendeeID: res.ID, OffsetMinutes: int(offset / time.Minute)}
+	err := tx.Create(r)
+	if err != nil && strings.Contains(err.Error(), "Duplicate entry") {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, errors.WithStack(err)
+	}
+	return r, true, nil
+}
+
+// MarkSent records a successful delivery.
+func (r *EventReminder) MarkSent(now time.Time) {
+	r.SentAt = nulls.NewTime(now)
+	r.LastError = nulls.String{}
+}
+
+// MarkFailed records why the reminder couldn't be sent.
+func (r *EventReminder) MarkFailed(err error) {
+	r.LastError = nulls.NewString(err.Error())
+}
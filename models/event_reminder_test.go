@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+)
+
+func (ms *ModelSuite) Test_DueReminders() {
+	now := time.Now().UTC().Truncate(time.Second)
+	event := &Event{Title: "Party", Date: now.Add(30 * time.Minute), Status: EventStatusScheduled}
+	ms.NoError(ms.DB.Create(event))
+	guests := ms.createGuests("ann@example.com", "bob@example.com", "cat@example.com")
+
+	early, err := Reserve(ms.DB, event.ID, guests[0].ID)
+	ms.NoError(err)
+	// Bob reserved just now and has only had his confirmation.
+	_, err = Reserve(ms.DB, event.ID, guests[1].ID)
+	ms.NoError(err)
+	declined, err := Reserve(ms.DB, event.ID, guests[2].ID)
+	ms.NoError(err)
+	_, err = SetRSVP(ms.DB, declined, RSVPDeclined)
+	ms.NoError(err)
+	ms.NoError(ms.DB.RawQuery("UPDATE event_attendees SET created_at = ? WHERE id IN (?)",
+		now.Add(-48*time.Hour), []string{early.ID.String(), declined.ID.String()}).Exec())
+
+	// Only Ann reserved before the hour-before mark and still has a seat.
+	due, err := DueReminders(ms.DB, time.Hour, now, 10)
+	ms.NoError(err)
+	ms.Len(due, 1)
+	ms.Equal(early.ID, due[0].ID)
+	ms.Equal("ann@example.com", due[0].Guest.Email)
+	ms.Equal(event.ID, due[0].Event.ID)
+
+	r, ok, err := ClaimReminder(ms.DB, &due[0], time.Hour)
+	ms.NoError(err)
+	ms.True(ok)
+	ms.Equal(60, r.OffsetMinutes)
+	_, ok, err = ClaimReminder(ms.DB, &due[0], time.Hour)
+	ms.NoError(err)
+	ms.False(ok)
+
+	// Having had the hour-before reminder, she's past the day-before one.
+	due, err = DueReminders(ms.DB, 24*time.Hour, now, 10)
+	ms.NoError(err)
+	ms.Len(due, 0)
+	due, err = DueReminders(ms.DB, time.Hour, now, 10)
+	ms.NoError(err)
+	ms.Len(due, 0)
+
+	// Nothing is due once the event has started.
+	ms.NoError(ms.DB.RawQuery("DELETE FROM event_reminders").Exec())
+	due, err = DueReminders(ms.DB, time.Hour, now.Add(time.Hour), 10)
+	ms.NoError(err)
+	ms.Len(due, 0)
+}
@@ -0,0 +1,531 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/nulls"
+	"github.com/gobuffalo/pop/v6"
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+
+	"event_planner/rrule"
+)
+
+// SeriesHorizon is how far ahead occurrences of a series without an end
+// are created. A background job keeps extending them.
+const SeriesHorizon = 365 * 24 * time.Hour
+
+// MaxSeriesOccurrences caps the occurrences created for a series at once.
+const MaxSeriesOccurrences = 500
+
+// DateFormat is how exception dates are written.
+const DateFormat = "2006-01-02"
+
+// seriesDropReason is given when an occurrence with guests is cancelled
+// because a change to the series left it out.
+const seriesDropReason = "This date is no longer part of the series."
+
+// DateList is a list of YYYY-MM-DD dates, stored comma-separated.
+type DateList []string
+
+// ParseDateList reads dates separated by commas or whitespace, sorted and
+// without repeats.
+func ParseDateList(s string) (DateList, error) {
+	seen := map[string]bool{}
+	dates := DateList{}
+	for _, f := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' || r == '\n' || r == '\r' || r == '\t' }) {
+		t, err := time.Parse(DateFormat, f)
+		if err != nil {
+			return nil, errors.Errorf("%q is not a YYYY-MM-DD date", f)
+		}
+		d := t.Format(DateFormat)
+		if !seen[d] {
+			seen[d] = true
+			dates = append(dates, d)
+		}
+	}
+	sort.Strings(dates)
+	return dates, nil
+}
+
+// Contains reports whether t falls on one of the dates, in t's location.
+func (l DateList) Contains(t time.Time) bool {
+	d := t.Format(DateFormat)
+	for _, x := range l {
+		if x == d {
+			return true
+		}
+	}
+	return false
+}
+
+// From returns the dates on or after t's date.
+func (l DateList) From(t time.Time) DateList {
+	d := t.Format(DateFormat)
+	out := DateList{}
+	for _, x := range l {
+		if x >= d {
+			out = append(out, x)
+		}
+	}
+	return out
+}
+
+// Before returns the dates before t's date.
+func (l DateList) Before(t time.Time) DateList {
+	d := t.Format(DateFormat)
+	out := DateList{}
+	for _, x := range l {
+		if x < d {
+			out = append(out, x)
+		}
+	}
+	return out
+}
+
+// String joins the dates with commas.
+func (l DateList) String() string {
+	return strings.Join(l, ", ")
+}
+
+// Value stores the list as text.
+func (l DateList) Value() (driver.Value, error) {
+	return strings.Join(l, ","), nil
+}
+
+// Scan reads the list back.
+func (l *DateList) Scan(src interface{}) error {
+	var s string
+	switch v := src.(type) {
+	case nil:
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return errors.Errorf("can't scan %T into a DateList", src)
+	}
+	*l = DateList{}
+	if s != "" {
+		*l = strings.Split(s, ",")
+	}
+	return nil
+}
+
+// EventSeries is used by pop to map your event_series database table to your go code.
+// It holds the recurrence rule of a repeating event. Every occurrence is
+// an event of its own, pointing back at the series, so guests reserve a
+// seat at one date and each date can be changed or cancelled on its own.
+// ExDates lists the dates the rule skips. The rule is expanded in
+// TimeZone, so dates keep their clock time when daylight saving changes.
+type EventSeries struct {
+	ID        uuid.UUID `json:"id" db:"id"`
+	RRule     string    `json:"rrule" db:"rrule"`
+	StartsAt  time.Time `json:"starts_at" db:"starts_at"`
+	TimeZone  string    `json:"time_zone" db:"time_zone"`
+	ExDates   DateList  `json:"exdates" db:"exdates"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// TableName overrides the table name used by pop.
+func (s EventSeries) TableName() string {
+	return "event_series"
+}
+
+// String is not required by pop and may be deleted
+func (s EventSeries) String() string {
+	js, _ := json.Marshal(s)
+	return string(js)
+}
+
+// Rule parses the recurrence rule.
+func (s EventSeries) Rule() (rrule.Rule, error) {
+	r, err := rrule.Parse(s.RRule)
+	return r, errors.WithStack(err)
+}
+
+// Text describes how the series repeats, for people.
+func (s EventSeries) Text() string {
+	r, err := s.Rule()
+	if err != nil {
+		return ""
+	}
+	return r.Text()
+}
+
+// Zone is the series' time zone, or UTC if it has none.
+func (s EventSeries) Zone() *time.Location {
+	loc, err := LoadTimeZone(s.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// start is the first occurrence, in the series' zone.
+func (s EventSeries) start() time.Time {
+	return s.StartsAt.In(s.Zone())
+}
+
+// dates returns the start times of the occurrences up to horizon, without
+// the exceptions. The first occurrence is always included, even past the
+// horizon or the rule's end.
+func (s EventSeries) dates(horizon time.Time) ([]time.Time, error) {
+	r, err := s.Rule()
+	if err != nil {
+		return nil, err
+	}
+	start := s.start()
+	if horizon.Before(start) {
+		horizon = start
+	}
+	dates := r.Expand(start, horizon, MaxSeriesOccurrences)
+	if len(dates) == 0 {
+		dates = []time.Time{start}
+	}
+	return s.filter(dates, s.StartsAt), nil
+}
+
+// filter drops exceptions, except for first, and sub-second precision the
+// database wouldn't keep.
+func (s EventSeries) filter(dates []time.Time, first time.Time) []time.Time {
+	out := []time.Time{}
+	for _, d := range dates {
+		if d.Equal(first) || !s.ExDates.Contains(d) {
+			out = append(out, d.Truncate(time.Second))
+		}
+	}
+	return out
+}
+
+// IsOccurrence reports whether the event is one date of a series.
+func (e Event) IsOccurrence() bool {
+	return e.SeriesID.Valid
+}
+
+// LoadSeries fills in Series if the event is an occurrence.
+func (e *Event) LoadSeries(tx *pop.Connection) error {
+	if !e.SeriesID.Valid {
+		return nil
+	}
+	s := &EventSeries{}
+	err := tx.Find(s, e.SeriesID.UUID)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	e.Series = s
+	return nil
+}
+
+// LoadSeries fills in Series on every occurrence with a single query.
+func (e Events) LoadSeries(tx *pop.Connection) error {
+	ids := []uuid.UUID{}
+	for _, ev := range e {
+		if ev.SeriesID.Valid {
+			ids = append(ids, ev.SeriesID.UUID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	series := []EventSeries{}
+	err := tx.Where("id IN (?)", ids).All(&series)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	for i := range series {
+		for j := range e {
+			if e[j].SeriesID.Valid && e[j].SeriesID.UUID == series[i].ID {
+				e[j].Series = &series[i]
+			}
+		}
+	}
+	return nil
+}
+
+// SeriesOccurrences returns up to limit occurrences of a series that end
+// after now, soonest first.
+func SeriesOccurrences(tx *pop.Connection, seriesID uuid.UUID, now time.Time, limit int) (Events, error) {
+	events := Events{}
+	err := tx.Where("series_id = ? AND DATE_ADD(event_date, INTERVAL duration_minutes MINUTE) >= ?", seriesID, now).
+		Order("event_date asc").Limit(limit).All(&events)
+	return events, errors.WithStack(err)
+}
+
+// StartSeries makes first, which must already be saved, the first
+// occurrence of a new series and creates the later ones. Series without an
+// end are created SeriesHorizon ahead of now.
+func StartSeries(tx *pop.Connection, first *Event, rule rrule.Rule, exdates DateList, now time.Time) (*EventSeries, error) {
+	err := rule.Validate()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	first.Date = first.Date.Truncate(time.Second)
+	s := &EventSeries{RRule: rule.String(), StartsAt: first.Date, TimeZone: first.Zone().String(), ExDates: exdates}
+	err = tx.Create(s)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	first.SeriesID = nulls.NewUUID(s.ID)
+	first.RecurrenceID = nulls.NewTime(first.Date)
+	first.Series = s
+	err = tx.Update(first)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	dates, err := s.dates(now.Add(SeriesHorizon))
+	if err != nil {
+		return nil, err
+	}
+	if len(dates) < 2 {
+		return s, nil
+	}
+	for _, d := range dates[1:] {
+		_, err = createOccurrence(tx, first, s, d)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// createOccurrence adds the occurrence of s at d, copying the details and
+// co-organizers of template.
+func createOccurrence(tx *pop.Connection, template *Event, s *EventSeries, d time.Time) (*Event, error) {
+	e := &Event{
+		Title:        template.Title,
+		Description:  template.Description,
+		Date:         d,
+		TimeZone:     template.TimeZone,
+		Status:       EventStatusScheduled,
+		OwnerID:      template.OwnerID,
+		Capacity:     template.Capacity,
+		Duration:     template.Duration,
+		Location:     template.Location,
+		SeriesID:     nulls.NewUUID(s.ID),
+		RecurrenceID: nulls.NewTime(d),
+	}
+	err := tx.Create(e)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	now := time.Now()
+	err = tx.RawQuery("INSERT INTO event_organizers (id, event_id, user_id, created_at, updated_at) SELECT UUID(), ?, user_id, ?, ? FROM event_organizers WHERE event_id = ?",
+		e.ID, now, now, template.ID).Exec()
+	return e, errors.WithStack(err)
+}
+
+// ExtendSeries creates the occurrences of a series without an end that
+// fall within SeriesHorizon of now and don't exist yet. New occurrences
+// copy the latest one. It returns how many were created.
+func ExtendSeries(tx *pop.Connection, s *EventSeries, now time.Time) (int, error) {
+	rule, err := s.Rule()
+	if err != nil || rule.Bounded() {
+		return 0, err
+	}
+
+	latest := &Event{}
+	err = tx.Where("series_id = ?", s.ID).Order("recurrence_id desc").First(latest)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	// Expanding from the latest occurrence rather than the start keeps
+	// long-running series under MaxSeriesOccurrences.
+	from := latest.RecurrenceID.Time.In(s.Zone())
+	dates := s.filter(rule.Expand(from, now.Add(SeriesHorizon), MaxSeriesOccurrences), time.Time{})
+	n := 0
+	for _, d := range dates {
+		if !d.After(from) {
+			continue
+		}
+		_, err = createOccurrence(tx, latest, s, d)
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// ExtendAllSeries runs ExtendSeries on every series, each in its own
+// transaction, and returns how many occurrences were created.
+func ExtendAllSeries(db *pop.Connection, now time.Time) (int, error) {
+	all := []EventSeries{}
+	err := db.All(&all)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	total := 0
+	for i := range all {
+		err = db.Transaction(func(tx *pop.Connection) error {
+			n, err := ExtendSeries(tx, &all[i], now)
+			total += n
+			return err
+		})
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// UpdateFutureOccurrences applies a change to an occurrence and every
+// later one in its series. event holds the new details but isn't saved
+// yet; rule and exdates replace the series' from this occurrence on.
+//
+// Earlier occurrences are left alone: the old series is cut off before
+// this one and a new series takes over, unless this is the first
+// occurrence, in which case the series is changed in place. Later
+// occurrences are matched to the new dates by day, after shifting them
+// by however far this one moved, and keep their reservations. Those with
+// no match are deleted, or cancelled and taken out of the series if they
+// have guests. New dates get new occurrences.
+func UpdateFutureOccurrences(tx *pop.Connection, event *Event, rule rrule.Rule, exdates DateList, now time.Time) (*EventSeries, error) {
+	err := rule.Validate()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if !event.IsOccurrence() {
+		return nil, errors.New("event is not part of a series")
+	}
+
+	old := &EventSeries{}
+	err = tx.Find(old, event.SeriesID.UUID)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	from := event.RecurrenceID.Time
+
+	future := Events{}
+	err = tx.Where("series_id = ? AND recurrence_id >= ?", old.ID, from).Order("recurrence_id asc").All(&future)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	earlier, err := tx.Where("series_id = ? AND recurrence_id < ?", old.ID, from).Count(&Event{})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	s := old
+	if earlier > 0 {
+		oldRule, err := old.Rule()
+		if err != nil {
+			return nil, err
+		}
+		oldRule.Count, oldRule.Until = 0, from.Add(-time.Second)
+		old.RRule = oldRule.String()
+		old.ExDates = old.ExDates.Before(from.In(old.Zone()))
+		err = tx.Update(old)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		s = &EventSeries{}
+	}
+	event.Date = event.Date.Truncate(time.Second)
+	s.RRule, s.StartsAt, s.TimeZone, s.ExDates = rule.String(), event.Date, event.Zone().String(), exdates
+	err = tx.Save(s)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	horizon := now.Add(SeriesHorizon)
+	if n := len(future); n > 0 && future[n-1].RecurrenceID.Time.After(horizon) {
+		horizon = future[n-1].RecurrenceID.Time
+	}
+	dates, err := s.dates(horizon)
+	if err != nil {
+		return nil, err
+	}
+	wanted := map[string]time.Time{}
+	for _, d := range dates {
+		wanted[d.Format(DateFormat)] = d
+	}
+
+	// Clear the recurrence IDs first, so occurrences can move onto each
+	// other's old times.
+	err = tx.RawQuery("UPDATE events SET recurrence_id = NULL WHERE series_id = ? AND recurrence_id >= ?", old.ID, from).Exec()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	shift := event.Date.Sub(from)
+	for i := range future {
+		f := &future[i]
+		key := f.RecurrenceID.Time.Add(shift).In(s.Zone()).Format(DateFormat)
+		d, ok := wanted[key]
+		if !ok {
+			err = dropOccurrence(tx, f)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		delete(wanted, key)
+
+		if f.ID == event.ID {
+			f.Status, f.CancelReason, f.CancelledAt = event.Status, event.CancelReason, event.CancelledAt
+		}
+		f.Title, f.Description, f.Location = event.Title, event.Description, event.Location
+		f.Capacity, f.Duration, f.TimeZone = event.Capacity, event.Duration, event.TimeZone
+		f.Date = d
+		f.SeriesID, f.RecurrenceID = nulls.NewUUID(s.ID), nulls.NewTime(d)
+		err = tx.Update(f)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if !f.IsCancelled() {
+			_, err = PromoteWaitlist(tx, f.ID)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if f.ID == event.ID {
+			*event = *f
+		}
+	}
+
+	added := []time.Time{}
+	for _, d := range wanted {
+		added = append(added, d)
+	}
+	sort.Slice(added, func(i, j int) bool { return added[i].Before(added[j]) })
+	for _, d := range added {
+		_, err = createOccurrence(tx, event, s, d)
+		if err != nil {
+			return nil, err
+		}
+	}
+	event.Series = s
+	return s, nil
+}
+
+// dropOccurrence takes an occurrence out of its series. Guests who
+// reserved a seat still see it, cancelled; otherwise it is deleted.
+func dropOccurrence(tx *pop.Connection, e *Event) error {
+	e.SeriesID, e.RecurrenceID = nulls.UUID{}, nulls.Time{}
+
+	guests, err := tx.Where("event_id = ?", e.ID).Count(&EventAttendee{})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if guests == 0 {
+		return e.Destroy(tx)
+	}
+
+	if !e.IsCancelled() {
+		e.Cancel(seriesDropReason)
+	}
+	return errors.WithStack(tx.Update(e))
+}
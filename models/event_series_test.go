@@ -0,0 +1,172 @@
+package models
+
+import (
+	"time"
+
+	"event_planner/rrule"
+)
+
+func (ms *ModelSuite) Test_DateList() {
+	l, err := ParseDateList(" 2026-11-04, 2026-10-28 ,2026-11-04")
+	ms.NoError(err)
+	ms.Equal("2026-10-28, 2026-11-04", l.String())
+	ms.True(l.Contains(time.Date(2026, 11, 4, 19, 0, 0, 0, time.UTC)))
+	ms.Equal("2026-11-04", l.From(time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)).String())
+
+	_, err = ParseDateList("next tuesday")
+	ms.Error(err)
+}
+
+func (ms *ModelSuite) Test_StartSeries() {
+	now := time.Now().UTC().Truncate(time.Second)
+	first := &Event{Title: "Book club", Date: now.Add(24 * time.Hour), Capacity: 8, Status: EventStatusScheduled}
+	ms.NoError(ms.DB.Create(first))
+
+	rule, err := rrule.Parse("FREQ=WEEKLY;COUNT=4")
+	ms.NoError(err)
+	skip := DateList{first.Date.AddDate(0, 0, 14).Format(DateFormat)}
+	s, err := StartSeries(ms.DB, first, rule, skip, now)
+	ms.NoError(err)
+	ms.True(first.IsOccurrence())
+
+	// The count includes the skipped date.
+	events, err := SeriesOccurrences(ms.DB, s.ID, now, 10)
+	ms.NoError(err)
+	ms.Len(events, 3)
+	ms.Equal(first.ID, events[0].ID)
+	ms.Equal(first.Date.AddDate(0, 0, 7).Unix(), events[1].Date.Unix())
+	ms.Equal(first.Date.AddDate(0, 0, 21).Unix(), events[2].Date.Unix())
+	ms.Equal("Book club", events[2].Title)
+	ms.Equal(8, events[2].Capacity)
+
+	// Deleting an occurrence keeps it from coming back.
+	ms.NoError(events[1].Destroy(ms.DB))
+	ms.NoError(ms.DB.Reload(s))
+	ms.True(s.ExDates.Contains(events[1].Date))
+}
+
+func (ms *ModelSuite) Test_StartSeries_FirstDateOnly() {
+	now := time.Now().UTC().Truncate(time.Second)
+
+	// Past the horizon, and after the rule's end: either way the series
+	// holds just the first date.
+	far := &Event{Title: "Reunion", Date: now.AddDate(2, 0, 0), Status: EventStatusScheduled}
+	ms.NoError(ms.DB.Create(far))
+	rule, err := rrule.Parse("FREQ=WEEKLY")
+	ms.NoError(err)
+	s, err := StartSeries(ms.DB, far, rule, nil, now)
+	ms.NoError(err)
+	events, err := SeriesOccurrences(ms.DB, s.ID, now, 10)
+	ms.NoError(err)
+	ms.Len(events, 1)
+
+	ended := &Event{Title: "Reunion", Date: now.Add(24 * time.Hour), Status: EventStatusScheduled}
+	ms.NoError(ms.DB.Create(ended))
+	rule, err = rrule.Parse("FREQ=DAILY;UNTIL=20000101")
+	ms.NoError(err)
+	s, err = StartSeries(ms.DB, ended, rule, nil, now)
+	ms.NoError(err)
+	events, err = SeriesOccurrences(ms.DB, s.ID, now, 10)
+	ms.NoError(err)
+	ms.Len(events, 1)
+	ms.Equal(ended.ID, events[0].ID)
+}
+
+func (ms *ModelSuite) Test_ExtendSeries() {
+	now := time.Now().UTC().Truncate(time.Second)
+	first := &Event{Title: "Standup", Date: now.Add(time.Hour), Status: EventStatusScheduled}
+	ms.NoError(ms.DB.Create(first))
+
+	rule, err := rrule.Parse("FREQ=WEEKLY")
+	ms.NoError(err)
+	s, err := StartSeries(ms.DB, first, rule, nil, now)
+	ms.NoError(err)
+	count, err := ms.DB.Where("series_id = ?", s.ID).Count(&Event{})
+	ms.NoError(err)
+	ms.Equal(53, count)
+
+	// Nothing to add until time moves on.
+	n, err := ExtendSeries(ms.DB, s, now)
+	ms.NoError(err)
+	ms.Equal(0, n)
+	n, err = ExtendSeries(ms.DB, s, now.Add(4*7*24*time.Hour))
+	ms.NoError(err)
+	ms.Equal(4, n)
+}
+
+func (ms *ModelSuite) Test_UpdateFutureOccurrences() {
+	now := time.Now().UTC().Truncate(time.Second)
+	first := &Event{Title: "Yoga", Date: now.Add(24 * time.Hour), Capacity: 10, Status: EventStatusScheduled}
+	ms.NoError(ms.DB.Create(first))
+	rule, err := rrule.Parse("FREQ=WEEKLY;COUNT=4")
+	ms.NoError(err)
+	old, err := StartSeries(ms.DB, first, rule, nil, now)
+	ms.NoError(err)
+
+	events, err := SeriesOccurrences(ms.DB, old.ID, now, 10)
+	ms.NoError(err)
+	ms.Len(events, 4)
+	guests := ms.createGuests("ann@example.com", "bob@example.com")
+	kept, err := Reserve(ms.DB, events[2].ID, guests[0].ID)
+	ms.NoError(err)
+	_, err = Reserve(ms.DB, events[3].ID, guests[1].ID)
+	ms.NoError(err)
+
+	// From the third date on, an hour later and for two more weeks only.
+	third := events[2]
+	third.Title = "Evening yoga"
+	third.Date = third.Date.Add(time.Hour)
+	rule, err = rrule.Parse("FREQ=WEEKLY;COUNT=1")
+	ms.NoError(err)
+	s, err := UpdateFutureOccurrences(ms.DB, &third, rule, nil, now)
+	ms.NoError(err)
+	ms.NotEqual(old.ID, s.ID)
+
+	// The earlier dates stay in the old series, which now ends before.
+	ms.NoError(ms.DB.Reload(old))
+	before, err := SeriesOccurrences(ms.DB, old.ID, now, 10)
+	ms.NoError(err)
+	ms.Len(before, 2)
+	ms.Equal("Yoga", before[1].Title)
+	oldRule, err := old.Rule()
+	ms.NoError(err)
+	ms.True(oldRule.Until.Before(third.Date))
+
+	// The third date moved with its reservation.
+	after, err := SeriesOccurrences(ms.DB, s.ID, now, 10)
+	ms.NoError(err)
+	ms.Len(after, 1)
+	ms.Equal(events[2].ID, after[0].ID)
+	ms.Equal("Evening yoga", after[0].Title)
+	ms.Equal(events[2].Date.Add(time.Hour).Unix(), after[0].Date.Unix())
+	ms.NoError(ms.DB.Reload(kept))
+	ms.Equal(events[2].ID, kept.EventID)
+
+	// The fourth had a guest, so it's cancelled rather than deleted.
+	dropped := &Event{}
+	ms.NoError(ms.DB.Find(dropped, events[3].ID))
+	ms.True(dropped.IsCancelled())
+	ms.False(dropped.IsOccurrence())
+}
+
+func (ms *ModelSuite) Test_StartSeries_TimeZone() {
+	// 6 PM in New York, the week before daylight saving ends.
+	ny := mustZone("America/New_York")
+	now := time.Date(2030, 10, 20, 12, 0, 0, 0, time.UTC)
+	first := &Event{Title: "Choir", Date: time.Date(2030, 10, 27, 18, 0, 0, 0, ny), TimeZone: "America/New_York", Status: EventStatusScheduled}
+	ms.NoError(ms.DB.Create(first))
+
+	rule, err := rrule.Parse("FREQ=WEEKLY;COUNT=2")
+	ms.NoError(err)
+	s, err := StartSeries(ms.DB, first, rule, nil, now)
+	ms.NoError(err)
+	ms.Equal("America/New_York", s.TimeZone)
+
+	events, err := SeriesOccurrences(ms.DB, s.ID, now, 10)
+	ms.NoError(err)
+	ms.Len(events, 2)
+	ms.Equal("America/New_York", events[1].TimeZone)
+	ms.Equal(22, events[0].Date.UTC().Hour())
+	ms.Equal(23, events[1].Date.UTC().Hour())
+	ms.Equal("6:00 PM", events[1].FormatDate("3:04 PM"))
+}
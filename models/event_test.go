@@ -1,5 +1,146 @@
 package models
 
-func (ms *ModelSuite) Test_Event() {
-	ms.Fail("This test needs to be implemented!")
+import (
+	"time"
+
+	"github.com/gobuffalo/nulls"
+	"github.com/gofrs/uuid"
+)
+
+func (ms *ModelSuite) Test_Event_Validate() {
+	e := &Event{
+		Title:    "Board games night",
+		Date:     time.Now().Add(24 * time.Hour),
+		Duration: 120,
+		Status:   EventStatusScheduled,
+	}
+	verrs, err := e.Validate(ms.DB)
+	ms.NoError(err)
+	ms.False(verrs.HasAny())
+
+	e.Title = ""
+	e.Date = time.Time{}
+	e.Status = "postponed"
+	e.Duration = 0
+	verrs, err = e.Validate(ms.DB)
+	ms.NoError(err)
+	ms.NotEmpty(verrs.Get("title"))
+	ms.NotEmpty(verrs.Get("duration"))
+	ms.NotEmpty(verrs.Get("date"))
+	ms.NotEmpty(verrs.Get("status"))
+}
+
+func (ms *ModelSuite) Test_Event_Cancel() {
+	e := &Event{Title: "Picnic", Date: time.Now(), Duration: 60, Status: EventStatusScheduled}
+
+	e.Cancel("  ")
+	ms.True(e.IsCancelled())
+	verrs, err := e.Validate(ms.DB)
+	ms.NoError(err)
+	ms.NotEmpty(verrs.Get("cancel_reason"))
+
+	e.Cancel("Rain")
+	verrs, err = e.Validate(ms.DB)
+	ms.NoError(err)
+	ms.False(verrs.HasAny())
+	ms.True(e.CancelledAt.Valid)
+}
+
+func (ms *ModelSuite) Test_Event_HasEnded() {
+	now := time.Now()
+	e := Event{Date: now.Add(-time.Hour), Duration: 90}
+	ms.False(e.HasEnded(now))
+	ms.True(e.HasEnded(now.Add(time.Hour)))
+}
+
+func (ms *ModelSuite) Test_Event_Destroy() {
+	e := &Event{Title: "Picnic", Date: time.Now(), Status: EventStatusScheduled}
+	ms.NoError(ms.DB.Create(e))
+	g := &Guest{Email: "bob@example.com", FullName: "Bob"}
+	ms.NoError(ms.DB.Create(g))
+	ms.NoError(ms.DB.Create(&EventAttendee{EventID: e.ID, GuestID: g.ID}))
+
+	ms.NoError(e.Destroy(ms.DB))
+
+	count, err := ms.DB.Count("event_attendees")
+	ms.NoError(err)
+	ms.Equal(0, count)
+
+	count, err = ms.DB.Count("guests")
+	ms.NoError(err)
+	ms.Equal(1, count)
+}
+
+func (ms *ModelSuite) Test_Event_CanManage() {
+	owner := &User{ID: uuid.Must(uuid.NewV4())}
+	organizer := &User{ID: uuid.Must(uuid.NewV4())}
+	stranger := &User{ID: uuid.Must(uuid.NewV4())}
+
+	e := Event{OwnerID: nulls.NewUUID(owner.ID), Organizers: Users{*organizer}}
+	ms.True(e.CanManage(owner))
+	ms.True(e.CanManage(organizer))
+	ms.False(e.CanManage(stranger))
+	ms.False(e.CanManage(nil))
+
+	ms.True(e.HasOwnerRights(owner))
+	ms.False(e.HasOwnerRights(organizer))
+
+	admin := &User{ID: uuid.Must(uuid.NewV4()), Role: RoleAdmin}
+	ms.True(e.CanManage(admin))
+	ms.True(e.HasOwnerRights(admin))
+
+	// Events from before ownership was recorded are open to organizers.
+	legacy := Event{}
+	ms.False(legacy.CanManage(stranger))
+	ms.False(legacy.CanManage(nil))
+	ms.True(legacy.CanManage(&User{ID: uuid.Must(uuid.NewV4()), Role: RoleOrganizer}))
+}
+
+func (ms *ModelSuite) Test_Event_TimeZone() {
+	_, err := LoadTimeZone("Local")
+	ms.Error(err)
+	_, err = LoadTimeZone("")
+	ms.Error(err)
+	berlin, err := LoadTimeZone("Europe/Berlin")
+	ms.NoError(err)
+
+	// A form's 7 PM, read in the event's zone.
+	formTime := time.Date(2030, 1, 2, 19, 0, 0, 0, time.UTC)
+	e := &Event{
+		Title:    "New year drinks",
+		Date:     InZone(formTime, berlin),
+		TimeZone: "Europe/Berlin",
+		Duration: 180,
+		Status:   EventStatusScheduled,
+	}
+	verrs, err := ms.DB.ValidateAndCreate(e)
+	ms.NoError(err)
+	ms.False(verrs.HasAny())
+
+	// Stored in UTC, shown in Berlin.
+	ms.NoError(ms.DB.Reload(e))
+	ms.Equal(time.Date(2030, 1, 2, 18, 0, 0, 0, time.UTC), e.Date.UTC())
+	ms.Equal("Jan. 02 2030 7:00 PM CET to 10:00 PM", e.When())
+	ms.Equal("Jan. 02 2030 1:00 PM EST to 4:00 PM", e.WhenIn(mustZone("America/New_York")))
+	ms.Equal("Jan. 02 2030 6:00 PM UTC to 9:00 PM", e.WhenIn(time.UTC))
+	ms.Equal("8:30 PM", e.FormatTime(time.Date(2030, 1, 2, 19, 30, 0, 0, time.UTC), "3:04 PM"))
+
+	e.TimeZone = "Mars/Olympus_Mons"
+	verrs, err = e.Validate(ms.DB)
+	ms.NoError(err)
+	ms.NotEmpty(verrs.Get("time_zone"))
+
+	// Events without a zone are in UTC.
+	legacy := &Event{Title: "Old", Date: formTime, Duration: 60, Status: EventStatusScheduled}
+	ms.NoError(ms.DB.Create(legacy))
+	ms.Equal(DefaultTimeZone, legacy.TimeZone)
+	ms.Equal(time.UTC, legacy.Zone())
+}
+
+func mustZone(name string) *time.Location {
+	loc, err := LoadTimeZone(name)
+	if err != nil {
+		panic(err)
+	}
+	return loc
 }
@@ -1,22 +1,32 @@
 package models
 
 import (
+	"database/sql"
 	"encoding/json"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/gobuffalo/nulls"
 	"github.com/gobuffalo/pop/v6"
 	"github.com/gobuffalo/validate/v3"
+	"github.com/gobuffalo/validate/v3/validators"
 	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
 )
 
 // Attendee is used by pop to map your attendees database table to your go code.
+// Guests are matched by their normalized email, EmailKey, which is unique.
+// Guests created before emails were normalized may share an address; they
+// have no EmailKey until they are merged.
 type Guest struct {
-	ID              uuid.UUID `json:"id" db:"id"`
-	Email           string    `db:"email"`
-	FullName        string    `db:"full_name"`
-	AttendingEvents Events    `many_to_many:"event_attendees"`
-	CreatedAt       time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt       time.Time `json:"updated_at" db:"updated_at"`
+	ID              uuid.UUID    `json:"id" db:"id"`
+	Email           string       `json:"email" db:"email"`
+	EmailKey        nulls.String `json:"-" db:"email_key"`
+	FullName        string       `json:"full_name" db:"full_name"`
+	AttendingEvents Events       `json:"-" many_to_many:"event_attendees"`
+	CreatedAt       time.Time    `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time    `json:"updated_at" db:"updated_at"`
 }
 
 // String is not required by pop and may be deleted
@@ -34,10 +44,272 @@ func (a Guests) String() string {
 	return string(ja)
 }
 
+// NormalizeEmail returns the form guest emails are matched in: trimmed and
+// lower case.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// BeforeSave keeps EmailKey in step with Email.
+func (a *Guest) BeforeSave(tx *pop.Connection) error {
+	a.Email = strings.TrimSpace(a.Email)
+	a.FullName = strings.TrimSpace(a.FullName)
+	a.EmailKey = nulls.NewString(NormalizeEmail(a.Email))
+	return nil
+}
+
+// FindGuestByEmail finds the guest with email, however it is spelled. If
+// several unmerged guests have it, the oldest is returned.
+func FindGuestByEmail(tx *pop.Connection, email string) (*Guest, error) {
+	key := NormalizeEmail(email)
+	g := &Guest{}
+	err := tx.Where("email_key = ?", key).First(g)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = tx.Where("email_key IS NULL AND LOWER(TRIM(email)) = ?", key).Order("created_at asc").First(g)
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return g, nil
+}
+
+// FindOrCreateGuest returns the guest with email, creating them with
+// fullName if there is none. An existing guest's name is only filled in,
+// never replaced: anyone can sign up with any address, so only the guest,
+// through their reservation link, and admins can change it.
+func FindOrCreateGuest(tx *pop.Connection, email, fullName string) (*Guest, error) {
+	g, err := FindGuestByEmail(tx, email)
+	if err == nil {
+		return g, g.FillName(tx, fullName)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	g = &Guest{Email: email, FullName: fullName}
+	err = tx.Create(g)
+	if err != nil && strings.Contains(err.Error(), "Duplicate entry") {
+		// Someone else signed up with the address at the same moment. A
+		// locking read sees their row.
+		g = &Guest{}
+		err = tx.RawQuery("SELECT * FROM guests WHERE email_key = ? LOCK IN SHARE MODE", NormalizeEmail(email)).First(g)
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return g, nil
+}
+
+// FillName sets the guest's name if they don't have one yet.
+func (a *Guest) FillName(tx *pop.Connection, fullName string) error {
+	fullName = strings.TrimSpace(fullName)
+	if a.FullName != "" || fullName == "" {
+		return nil
+	}
+	return a.Rename(tx, fullName)
+}
+
+// Rename changes the guest's name.
+func (a *Guest) Rename(tx *pop.Connection, fullName string) error {
+	a.FullName = strings.TrimSpace(fullName)
+	verrs, err := a.Validate(tx)
+	if err != nil {
+		return err
+	}
+	if verrs.HasAny() {
+		return verrs
+	}
+	return errors.WithStack(tx.UpdateColumns(a, "full_name", "updated_at"))
+}
+
+// LoadAttendingEvents fills AttendingEvents with the events the guest still
+// plans to go to, soonest first. Reservations that were declined or
+// cancelled are left out.
+func (a *Guest) LoadAttendingEvents(tx *pop.Connection) error {
+	a.AttendingEvents = Events{}
+	err := tx.RawQuery(`SELECT events.* FROM events
+		JOIN event_attendees ON event_attendees.event_id = events.id
+		WHERE event_attendees.guest_id = ? AND event_attendees.rsvp IN (?)
+		ORDER BY events.event_date`, a.ID, []string{RSVPGoing, RSVPMaybe}).All(&a.AttendingEvents)
+	return errors.WithStack(err)
+}
+
+// Destroy removes the guest and their reservations. Seats they held are
+// handed to the waitlist.
+func (a *Guest) Destroy(tx *pop.Connection) error {
+	reservations := EventAttendees{}
+	err := tx.Where("guest_id = ?", a.ID).All(&reservations)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	for i := range reservations {
+		_, err = CancelReservation(tx, &reservations[i])
+		if err != nil {
+			return err
+		}
+	}
+	return errors.WithStack(tx.Destroy(a))
+}
+
+// rsvpRanks orders RSVP answers by how firmly the guest intends to come.
+var rsvpRanks = map[string]int{RSVPGoing: 4, RSVPMaybe: 3, RSVPDeclined: 2, RSVPCancelled: 1}
+
+// betterReservation reports whether a should be kept over b when one guest
+// ends up with both: a place held beats none, a seat beats the waitlist,
+// a firmer RSVP beats a looser one, and otherwise the earlier sign-up wins.
+func betterReservation(a, b EventAttendee) bool {
+	switch {
+	case a.HoldsSpot() != b.HoldsSpot():
+		return a.HoldsSpot()
+	case a.IsWaitlisted() != b.IsWaitlisted():
+		return !a.IsWaitlisted()
+	case a.RSVP != b.RSVP:
+		return rsvpRanks[a.RSVP] > rsvpRanks[b.RSVP]
+	}
+	return a.CreatedAt.Before(b.CreatedAt)
+}
+
+// MergeGuests folds from into into and deletes from. Reservations move
+// over with their IDs, so links already mailed keep working. Where both
+// guests have a reservation for an event, the better one is kept and the
+// other cancelled, handing a freed seat to the waitlist. into keeps its
+// email and its name, unless it has none.
+func MergeGuests(tx *pop.Connection, into, from *Guest) error {
+	if into.ID == from.ID {
+		return nil
+	}
+
+	reservations := EventAttendees{}
+	err := tx.Where("guest_id = ?", from.ID).All(&reservations)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	for i := range reservations {
+		res := &reservations[i]
+		kept := &EventAttendee{}
+		err = tx.Where("event_id = ? AND guest_id = ?", res.EventID, into.ID).First(kept)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+		case err != nil:
+			return errors.WithStack(err)
+		case betterReservation(*kept, *res):
+			_, err = CancelReservation(tx, res)
+			if err != nil {
+				return err
+			}
+			continue
+		default:
+			_, err = CancelReservation(tx, kept)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = tx.RawQuery("UPDATE event_attendees SET guest_id = ?, updated_at = ? WHERE id = ?", into.ID, time.Now(), res.ID).Exec()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	err = tx.Destroy(from)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	// into takes over the email key unless another unmerged guest holds
+	// it.
+	key := NormalizeEmail(into.Email)
+	taken, err := tx.Where("email_key = ? AND id <> ?", key, into.ID).Exists(&Guest{})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	columns := []string{"full_name", "updated_at"}
+	if !taken {
+		columns = append(columns, "email_key")
+	}
+	if into.FullName == "" {
+		into.FullName = from.FullName
+	}
+	return errors.WithStack(tx.UpdateColumns(into, columns...))
+}
+
+// DuplicateGuests lists the groups of guests who share an email address,
+// however it is spelled. Each group is oldest first.
+func DuplicateGuests(tx *pop.Connection) ([]Guests, error) {
+	guests := Guests{}
+	err := tx.RawQuery(`SELECT * FROM guests WHERE LOWER(TRIM(email)) IN (
+		SELECT k FROM (SELECT LOWER(TRIM(email)) AS k FROM guests GROUP BY k HAVING COUNT(*) > 1) d
+	) ORDER BY created_at`).All(&guests)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	byKey := map[string]Guests{}
+	keys := []string{}
+	for _, g := range guests {
+		k := NormalizeEmail(g.Email)
+		if _, ok := byKey[k]; !ok {
+			keys = append(keys, k)
+		}
+		byKey[k] = append(byKey[k], g)
+	}
+	sort.Strings(keys)
+
+	groups := make([]Guests, 0, len(keys))
+	for _, k := range keys {
+		groups = append(groups, byKey[k])
+	}
+	return groups, nil
+}
+
+// MergeSurvivor picks the guest a duplicate group is merged into: the one
+// holding the email key, or else the oldest.
+func (a Guests) MergeSurvivor() *Guest {
+	if len(a) == 0 {
+		return nil
+	}
+	for i := range a {
+		if a[i].EmailKey.Valid {
+			return &a[i]
+		}
+	}
+	return &a[0]
+}
+
+// MergeDuplicateGuests merges every group of DuplicateGuests into its
+// MergeSurvivor and returns how many guests were merged away.
+func MergeDuplicateGuests(tx *pop.Connection) (int, error) {
+	groups, err := DuplicateGuests(tx)
+	if err != nil {
+		return 0, err
+	}
+
+	merged := 0
+	for _, group := range groups {
+		into := group.MergeSurvivor()
+		for i := range group {
+			if group[i].ID == into.ID {
+				continue
+			}
+			err = MergeGuests(tx, into, &group[i])
+			if err != nil {
+				return merged, err
+			}
+			merged++
+		}
+	}
+	return merged, nil
+}
+
 // Validate gets run every time you call a "pop.Validate*" (pop.ValidateAndSave, pop.ValidateAndCreate, pop.ValidateAndUpdate) method.
-// This method is not required and may be deleted.
 func (a *Guest) Validate(tx *pop.Connection) (*validate.Errors, error) {
-	return validate.NewErrors(), nil
+	return validate.Validate(
+		&validators.EmailIsPresent{Field: a.Email, Name: "Email"},
+		&validators.StringLengthInRange{Field: a.Email, Name: "Email", Max: 255},
+		&validators.StringLengthInRange{Field: a.FullName, Name: "FullName", Max: 255},
+	), nil
 }
 
 // ValidateCreate gets run every time you call "pop.ValidateAndCreate" method.
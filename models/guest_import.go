@@ -0,0 +1,273 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/gobuffalo/pop/v6"
+	"github.com/gobuffalo/validate/v3"
+	"github.com/gobuffalo/validate/v3/validators"
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+)
+
+// MaxGuestImportRows caps how many guests one CSV file can add.
+const MaxGuestImportRows = 5000
+
+// Outcomes of importing one row.
+const (
+	ImportReserved  = "reserved"
+	ImportExisting  = "existing"
+	ImportDeclined  = "declined"
+	ImportDuplicate = "duplicate"
+	ImportInvalid   = "invalid"
+)
+
+// ErrTooManyImportRows is returned for files over MaxGuestImportRows.
+var ErrTooManyImportRows = errors.New("too many rows to import")
+
+// GuestImportRow is one guest read from a CSV file and, once imported, what
+// became of them. Guest and Reservation are set for reserved rows.
+type GuestImportRow struct {
+	Line        int
+	Email       string
+	FullName    string
+	Result      string
+	Status      string
+	Message     string
+	Guest       *Guest
+	Reservation *EventAttendee
+}
+
+// GuestImport is the outcome of importing a list of guests.
+type GuestImport struct {
+	Rows []GuestImportRow
+}
+
+// Count returns how many rows had the result.
+func (g GuestImport) Count(result string) int {
+	n := 0
+	for _, row := range g.Rows {
+		if row.Result == result {
+			n++
+		}
+	}
+	return n
+}
+
+// Waitlisted returns how many reserved rows landed on the waitlist.
+func (g GuestImport) Waitlisted() int {
+	n := 0
+	for _, row := range g.Rows {
+		if row.Result == ImportReserved && row.Status == AttendeeStatusWaitlisted {
+			n++
+		}
+	}
+	return n
+}
+
+// importHeaders maps the column titles we recognize to the field they hold.
+var importHeaders = map[string]string{
+	"email":         "email",
+	"e-mail":        "email",
+	"email address": "email",
+	"name":          "name",
+	"full name":     "name",
+	"full_name":     "name",
+	"fullname":      "name",
+	"first name":    "first",
+	"first_name":    "first",
+	"last name":     "last",
+	"last_name":     "last",
+}
+
+// ParseGuestCSV reads guests from CSV. A header row naming an email column
+// (and optionally name, or first and last name, columns) is used if
+// present; otherwise the first column is the email and the second the
+// name. Blank lines are skipped.
+func ParseGuestCSV(r io.Reader) ([]GuestImportRow, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	cr.ReuseRecord = true
+
+	cols := map[string]int{"email": 0, "name": 1}
+	rows := []GuestImportRow{}
+	first := true
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if first {
+			first = false
+			// Spreadsheet programs often start UTF-8 files with a BOM.
+			rec[0] = strings.TrimPrefix(rec[0], "\ufeff")
+			if header, ok := parseImportHeader(rec); ok {
+				cols = header
+				continue
+			}
+		}
+
+		row := GuestImportRow{
+			Email:    strings.TrimSpace(field(rec, cols["email"])),
+			FullName: importName(rec, cols),
+		}
+		row.Line, _ = cr.FieldPos(0)
+		if row.Email == "" && row.FullName == "" {
+			continue
+		}
+
+		if len(rows) == MaxGuestImportRows {
+			return nil, ErrTooManyImportRows
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// parseImportHeader returns the column of each field if rec is a header
+// row. A header must at least name the email column.
+func parseImportHeader(rec []string) (map[string]int, bool) {
+	cols := map[string]int{}
+	for i, title := range rec {
+		f, ok := importHeaders[strings.ToLower(strings.TrimSpace(title))]
+		if _, seen := cols[f]; ok && !seen {
+			cols[f] = i
+		}
+	}
+	if _, ok := cols["email"]; !ok {
+		return nil, false
+	}
+	return cols, true
+}
+
+// importName returns the guest's name from the name column, or from the
+// first and last name columns. Missing columns are left out, so a file
+// without any gives no name.
+func importName(rec []string, cols map[string]int) string {
+	if i, ok := cols["name"]; ok {
+		return strings.TrimSpace(field(rec, i))
+	}
+	parts := []string{}
+	for _, f := range []string{"first", "last"} {
+		if i, ok := cols[f]; ok {
+			if v := strings.TrimSpace(field(rec, i)); v != "" {
+				parts = append(parts, v)
+			}
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// field returns rec[i], or "" if the row is too short.
+func field(rec []string, i int) string {
+	if i < 0 || i >= len(rec) {
+		return ""
+	}
+	return rec[i]
+}
+
+// ImportGuests reserves a spot on the event for each row, creating guests
+// as needed. Invalid emails, repeats within the file and guests already on
+// the list are reported and skipped. Guests who declined or cancelled are
+// left alone rather than signed up again on their behalf. Any database
+// error aborts the import; run it in a transaction so nothing is half
+// done.
+func ImportGuests(tx *pop.Connection, eventID uuid.UUID, rows []GuestImportRow) (*GuestImport, error) {
+	// Lock the event up front so the whole import is counted against
+	// capacity in one go.
+	event, err := lockEvent(tx, eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]int{}
+	for i := range rows {
+		row := &rows[i]
+
+		verrs := validate.Validate(&validators.EmailIsPresent{Field: row.Email, Name: "Email"})
+		if verrs.HasAny() {
+			row.Result = ImportInvalid
+			row.Message = "Not a valid email address"
+			continue
+		}
+
+		key := NormalizeEmail(row.Email)
+		if line, ok := seen[key]; ok {
+			row.Result = ImportDuplicate
+			row.Message = "Repeats line " + strconv.Itoa(line)
+			continue
+		}
+		seen[key] = row.Line
+
+		err := importGuest(tx, event, row)
+		if err != nil {
+			return nil, errors.Wrapf(err, "importing line %d", row.Line)
+		}
+	}
+	return &GuestImport{Rows: rows}, nil
+}
+
+func importGuest(tx *pop.Connection, event *Event, row *GuestImportRow) error {
+	g, err := FindOrCreateGuest(tx, row.Email, row.FullName)
+	if err != nil {
+		return err
+	}
+
+	res := &EventAttendee{}
+	err = tx.Where("event_id = ? AND guest_id = ?", event.ID, g.ID).First(res)
+	if err == nil {
+		row.Status = res.Status
+		if res.HoldsSpot() {
+			row.Result = ImportExisting
+			row.Message = "Already on the guest list"
+		} else {
+			row.Result = ImportDeclined
+			row.Message = "Guest answered " + res.RSVP + "; left as is"
+		}
+		return nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return errors.WithStack(err)
+	}
+
+	res, err = Reserve(tx, event.ID, g.ID)
+	if err != nil {
+		return err
+	}
+	row.Result = ImportReserved
+	row.Status = res.Status
+	row.Guest = g
+	row.Reservation = res
+	if g.FullName != row.FullName && row.FullName != "" {
+		row.Message = "Kept existing name " + g.FullName
+	}
+	return nil
+}
+
+// PreviewGuestImport works out what ImportGuests would do without keeping
+// any of it. tx must be a transaction; the import runs to a savepoint that
+// is then rolled back.
+func PreviewGuestImport(tx *pop.Connection, eventID uuid.UUID, rows []GuestImportRow) (*GuestImport, error) {
+	if tx.TX == nil {
+		return nil, errors.New("guest import preview needs a transaction")
+	}
+
+	err := tx.RawQuery("SAVEPOINT guest_import").Exec()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	result, err := ImportGuests(tx, eventID, rows)
+	rerr := tx.RawQuery("ROLLBACK TO SAVEPOINT guest_import").Exec()
+	if err != nil {
+		return nil, err
+	}
+	return result, errors.WithStack(rerr)
+}
@@ -0,0 +1,108 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/pop/v6"
+)
+
+func (ms *ModelSuite) Test_ParseGuestCSV() {
+	rows, err := ParseGuestCSV(strings.NewReader("\ufeffFirst Name,Last Name,E-mail\nAnn,Lee, ann@example.com\n\n,,\nBob,,bob@example.com\n"))
+	ms.NoError(err)
+	ms.Equal([]GuestImportRow{
+		{Line: 2, Email: "ann@example.com", FullName: "Ann Lee"},
+		{Line: 5, Email: "bob@example.com", FullName: "Bob"},
+	}, rows)
+
+	// Without a header the email comes first.
+	rows, err = ParseGuestCSV(strings.NewReader("ann@example.com,Ann Lee\nbob@example.com\n"))
+	ms.NoError(err)
+	ms.Equal([]GuestImportRow{
+		{Line: 1, Email: "ann@example.com", FullName: "Ann Lee"},
+		{Line: 2, Email: "bob@example.com"},
+	}, rows)
+
+	// Headers without a name column give no names.
+	rows, err = ParseGuestCSV(strings.NewReader("email\nbob@example.com\n"))
+	ms.NoError(err)
+	ms.Equal([]GuestImportRow{{Line: 2, Email: "bob@example.com"}}, rows)
+
+	rows, err = ParseGuestCSV(strings.NewReader("Phone,Email\n555-1234,bob@example.com\n"))
+	ms.NoError(err)
+	ms.Equal([]GuestImportRow{{Line: 2, Email: "bob@example.com"}}, rows)
+
+	rows, err = ParseGuestCSV(strings.NewReader("Email,Last Name\nbob@example.com,Lee\n"))
+	ms.NoError(err)
+	ms.Equal([]GuestImportRow{{Line: 2, Email: "bob@example.com", FullName: "Lee"}}, rows)
+
+	_, err = ParseGuestCSV(strings.NewReader("email\n" + strings.Repeat("a@example.com\n", MaxGuestImportRows+1)))
+	ms.ErrorIs(err, ErrTooManyImportRows)
+
+	_, err = ParseGuestCSV(strings.NewReader("\"unterminated\n"))
+	ms.Error(err)
+}
+
+func (ms *ModelSuite) Test_ImportGuests() {
+	event := &Event{Title: "Party", Date: time.Now().Add(24 * time.Hour), Status: EventStatusScheduled, Capacity: 2}
+	ms.NoError(ms.DB.Create(event))
+
+	existing := ms.createGuests("ann@example.com", "cat@example.com")
+	_, err := Reserve(ms.DB, event.ID, existing[0].ID)
+	ms.NoError(err)
+	declined, err := Reserve(ms.DB, event.ID, existing[1].ID)
+	ms.NoError(err)
+	_, err = SetRSVP(ms.DB, declined, RSVPDeclined)
+	ms.NoError(err)
+
+	rows := []GuestImportRow{
+		{Line: 2, Email: "ANN@example.com", FullName: "Ann"},
+		{Line: 3, Email: "bob@example.com", FullName: "Bob"},
+		{Line: 4, Email: "not an email", FullName: "Nobody"},
+		{Line: 5, Email: " Bob@Example.com", FullName: "Bobby"},
+		{Line: 6, Email: "cat@example.com"},
+		{Line: 7, Email: "dan@example.com", FullName: "Dan"},
+	}
+
+	result, err := ImportGuests(ms.DB, event.ID, rows)
+	ms.NoError(err)
+	ms.Equal(ImportExisting, result.Rows[0].Result)
+	ms.Equal(ImportReserved, result.Rows[1].Result)
+	ms.Equal(AttendeeStatusConfirmed, result.Rows[1].Status)
+	ms.Equal(ImportInvalid, result.Rows[2].Result)
+	ms.Equal(ImportDuplicate, result.Rows[3].Result)
+	ms.Equal("Repeats line 3", result.Rows[3].Message)
+	ms.Equal(ImportDeclined, result.Rows[4].Result)
+	ms.Equal(ImportReserved, result.Rows[5].Result)
+	ms.Equal(AttendeeStatusWaitlisted, result.Rows[5].Status)
+	ms.Equal(2, result.Count(ImportReserved))
+	ms.Equal(1, result.Waitlisted())
+
+	count, err := ms.DB.Where("event_id = ?", event.ID).Count(&EventAttendee{})
+	ms.NoError(err)
+	ms.Equal(4, count)
+}
+
+func (ms *ModelSuite) Test_PreviewGuestImport() {
+	event := &Event{Title: "Party", Date: time.Now().Add(24 * time.Hour), Status: EventStatusScheduled}
+	ms.NoError(ms.DB.Create(event))
+
+	rows := []GuestImportRow{{Line: 1, Email: "bob@example.com", FullName: "Bob"}}
+	_, err := PreviewGuestImport(ms.DB, event.ID, rows)
+	ms.Error(err)
+
+	err = ms.DB.Transaction(func(tx *pop.Connection) error {
+		result, err := PreviewGuestImport(tx, event.ID, rows)
+		ms.NoError(err)
+		ms.Equal(ImportReserved, result.Rows[0].Result)
+		return err
+	})
+	ms.NoError(err)
+
+	count, err := ms.DB.Count("guests")
+	ms.NoError(err)
+	ms.Equal(0, count)
+	count, err = ms.DB.Count("event_attendees")
+	ms.NoError(err)
+	ms.Equal(0, count)
+}
@@ -0,0 +1,123 @@
+package models
+
+import (
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// createLegacyGuest inserts a guest the way they were stored before emails
+// were normalized, without an email key.
+func (ms *ModelSuite) createLegacyGuest(email, name string, createdAt time.Time) *Guest {
+	g := &Guest{ID: uuid.Must(uuid.NewV4()), Email: email, FullName: name, CreatedAt: createdAt, UpdatedAt: createdAt}
+	ms.NoError(ms.DB.RawQuery("INSERT INTO guests (id, email, full_name, created_at, updated_at) VALUES (?, ?, ?, ?, ?)",
+		g.ID, g.Email, g.FullName, g.CreatedAt, g.UpdatedAt).Exec())
+	return g
+}
+
+func (ms *ModelSuite) Test_FindOrCreateGuest_NormalizesEmail() {
+	g, err := FindOrCreateGuest(ms.DB, " Bob@Example.com ", "")
+	ms.NoError(err)
+	ms.Equal("Bob@Example.com", g.Email)
+	ms.Equal("bob@example.com", g.EmailKey.String)
+
+	// A missing name is filled in, an existing one is kept.
+	again, err := FindOrCreateGuest(ms.DB, "bob@example.com", "Bob")
+	ms.NoError(err)
+	ms.Equal(g.ID, again.ID)
+	ms.Equal("Bob", again.FullName)
+
+	again, err = FindOrCreateGuest(ms.DB, "BOB@example.com", "Mallory")
+	ms.NoError(err)
+	ms.Equal(g.ID, again.ID)
+	ms.Equal("Bob", again.FullName)
+
+	count, err := ms.DB.Count("guests")
+	ms.NoError(err)
+	ms.Equal(1, count)
+
+	// The database refuses a second guest with the address too.
+	ms.Error(ms.DB.Create(&Guest{Email: "bob@EXAMPLE.com"}))
+}
+
+func (ms *ModelSuite) Test_FindGuestByEmail_Legacy() {
+	now := time.Now().UTC().Truncate(time.Second)
+	older := ms.createLegacyGuest("Ann@example.com", "Ann", now.Add(-time.Hour))
+	ms.createLegacyGuest("ann@example.com ", "", now)
+
+	g, err := FindGuestByEmail(ms.DB, "ANN@example.com")
+	ms.NoError(err)
+	ms.Equal(older.ID, g.ID)
+}
+
+func (ms *ModelSuite) Test_MergeGuests() {
+	now := time.Now().UTC().Truncate(time.Second)
+	full := &Event{Title: "Full", Date: now.Add(24 * time.Hour), Status: EventStatusScheduled, Capacity: 1}
+	ms.NoError(ms.DB.Create(full))
+	other := &Event{Title: "Other", Date: now.Add(24 * time.Hour), Status: EventStatusScheduled}
+	ms.NoError(ms.DB.Create(other))
+
+	into := ms.createLegacyGuest("bob@example.com", "", now.Add(-time.Hour))
+	from := ms.createLegacyGuest("Bob@Example.com", "Bob", now)
+	waiting := ms.createGuests("ann@example.com")[0]
+
+	// from holds the only seat, into and ann wait for it.
+	seat, err := Reserve(ms.DB, full.ID, from.ID)
+	ms.NoError(err)
+	waitlisted, err := Reserve(ms.DB, full.ID, into.ID)
+	ms.NoError(err)
+	ms.True(waitlisted.IsWaitlisted())
+	ann, err := Reserve(ms.DB, full.ID, waiting.ID)
+	ms.NoError(err)
+	moved, err := Reserve(ms.DB, other.ID, from.ID)
+	ms.NoError(err)
+
+	ms.NoError(MergeGuests(ms.DB, into, from))
+
+	// The seat is kept, the waitlist entry dropped, and nobody else moved
+	// up.
+	ms.NoError(ms.DB.Reload(seat))
+	ms.Equal(into.ID, seat.GuestID)
+	ms.Equal(AttendeeStatusConfirmed, seat.Status)
+	exists, err := ms.DB.Where("id = ?", waitlisted.ID).Exists(&EventAttendee{})
+	ms.NoError(err)
+	ms.False(exists)
+	ms.NoError(ms.DB.Reload(ann))
+	ms.True(ann.IsWaitlisted())
+
+	ms.NoError(ms.DB.Reload(moved))
+	ms.Equal(into.ID, moved.GuestID)
+
+	exists, err = ms.DB.Where("id = ?", from.ID).Exists(&Guest{})
+	ms.NoError(err)
+	ms.False(exists)
+
+	ms.NoError(ms.DB.Reload(into))
+	ms.Equal("Bob", into.FullName)
+	ms.Equal("bob@example.com", into.EmailKey.String)
+}
+
+func (ms *ModelSuite) Test_MergeDuplicateGuests() {
+	now := time.Now().UTC().Truncate(time.Second)
+	keep := ms.createLegacyGuest("cat@example.com", "Cat", now.Add(-2*time.Hour))
+	ms.createLegacyGuest("CAT@example.com", "", now.Add(-time.Hour))
+	ms.createLegacyGuest(" cat@example.com", "", now)
+	ms.createGuests("dan@example.com")
+
+	groups, err := DuplicateGuests(ms.DB)
+	ms.NoError(err)
+	ms.Len(groups, 1)
+	ms.Len(groups[0], 3)
+	ms.Equal(keep.ID, groups[0].MergeSurvivor().ID)
+
+	n, err := MergeDuplicateGuests(ms.DB)
+	ms.NoError(err)
+	ms.Equal(2, n)
+
+	count, err := ms.DB.Count("guests")
+	ms.NoError(err)
+	ms.Equal(2, count)
+	groups, err = DuplicateGuests(ms.DB)
+	ms.NoError(err)
+	ms.Len(groups, 0)
+}
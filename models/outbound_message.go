@@ -0,0 +1,208 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gobuffalo/nulls"
+	"github.com/gobuffalo/pop/v6"
+	"github.com/gobuffalo/validate/v3"
+	"github.com/gobuffalo/validate/v3/validators"
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+)
+
+// Outbound message statuses. Dead messages ran out of attempts and wait
+// for someone to requeue them.
+const (
+	MessageStatusPending = "pending"
+	MessageStatusSent    = "sent"
+	MessageStatusDead    = "dead"
+)
+
+// MaxMessageAttempts is how many times delivery is tried before a message
+// is dead-lettered.
+const MaxMessageAttempts = 8
+
+// messageBaseBackoff is the wait after the first failure; it doubles with
+// each further attempt.
+const messageBaseBackoff = time.Minute
+
+// secretMessageFields are the payload keys holding codes and signed links.
+// They are dropped once a message is sent or dead, so the outbox doesn't
+// keep working credentials around.
+var secretMessageFields = []string{"code", "reset_url", "verify_url", "manage_url", "ticket_url", "calendar_url", "qr_code"}
+
+// redactedField lists the secret fields dropped from a payload.
+const redactedField = "redacted"
+
+// OutboundMessage is used by pop to map your outbound_messages database table to your go code.
+// It holds the data for one Sender.Send call until it has been delivered.
+type OutboundMessage struct {
+	ID            uuid.UUID    `json:"id" db:"id"`
+	Payload       string       `json:"-" db:"payload"`
+	Status        string       `json:"status" db:"status"`
+	Attempts      int          `json:"attempts" db:"attempts"`
+	LastError     nulls.String `json:"last_error" db:"last_error"`
+	NextAttemptAt time.Time    `json:"next_attempt_at" db:"next_attempt_at"`
+	SentAt        nulls.Time   `json:"sent_at" db:"sent_at"`
+	CreatedAt     time.Time    `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time    `json:"updated_at" db:"updated_at"`
+}
+
+// EnqueueMessage stores data for delivery. Called with a request's
+// transaction, the message is only sent if the request commits.
+func EnqueueMessage(tx *pop.Connection, data map[string]interface{}) (*OutboundMessage, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	m := &OutboundMessage{
+		Payload:       string(payload),
+		Status:        MessageStatusPending,
+		NextAttemptAt: time.Now().UTC(),
+	}
+	return m, errors.WithStack(tx.Create(m))
+}
+
+// Data decodes the payload handed to the Sender.
+func (m OutboundMessage) Data() (map[string]interface{}, error) {
+	data := map[string]interface{}{}
+	err := json.Unmarshal([]byte(m.Payload), &data)
+	return data, errors.WithStack(err)
+}
+
+// Recipient returns the receiver_email from the payload, for listings.
+func (m OutboundMessage) Recipient() string {
+	data, _ := m.Data()
+	to, _ := data["receiver_email"].(string)
+	return to
+}
+
+// Redacted reports whether the payload's secrets were dropped, in which
+// case the message can't be sent again as it was.
+func (m OutboundMessage) Redacted() bool {
+	data, _ := m.Data()
+	_, ok := data[redactedField]
+	return ok
+}
+
+// redact drops the secret fields from the payload.
+func (m *OutboundMessage) redact() {
+	data, err := m.Data()
+	if err != nil {
+		return
+	}
+	dropped := []string{}
+	for _, k := range secretMessageFields {
+		if _, ok := data[k]; ok {
+			delete(data, k)
+			dropped = append(dropped, k)
+		}
+	}
+	if len(dropped) == 0 {
+		return
+	}
+	data[redactedField] = dropped
+	if payload, err := json.Marshal(data); err == nil {
+		m.Payload = string(payload)
+	}
+}
+
+// MessageBackoff returns how long to wait before the next try after the
+// given number of failed attempts.
+func MessageBackoff(attempts int) time.Duration {
+	if attempts < 1 {
+		return 0
+	}
+	return messageBaseBackoff << (attempts - 1)
+}
+
+// MarkSent records a successful delivery and drops the payload's secrets.
+func (m *OutboundMessage) MarkSent(now time.Time) {
+	m.Status = MessageStatusSent
+	m.SentAt = nulls.NewTime(now)
+	m.LastError = nulls.String{}
+	m.redact()
+}
+
+// MarkFailed records a failed attempt and schedules the retry, or
+// dead-letters the message once MaxMessageAttempts is reached. Dead
+// messages lose their secrets like sent ones.
+func (m *OutboundMessage) MarkFailed(err error, now time.Time) {
+	m.Attempts++
+	m.LastError = nulls.NewString(err.Error())
+	if m.Attempts >= MaxMessageAttempts {
+		m.Status = MessageStatusDead
+		m.redact()
+		return
+	}
+	m.NextAttemptAt = now.Add(MessageBackoff(m.Attempts))
+}
+
+// Requeue gives a dead message a fresh set of attempts, starting now.
+func (m *OutboundMessage) Requeue(now time.Time) {
+	m.Status = MessageStatusPending
+	m.Attempts = 0
+	m.NextAttemptAt = now
+}
+
+// ClaimMessage takes a due message for delivery by pushing its next attempt
+// out by lease, so another worker polling in the meantime skips it. It
+// reports false if someone else got there first.
+func ClaimMessage(tx *pop.Connection, m *OutboundMessage, now time.Time, lease time.Duration) (bool, error) {
+	n, err := tx.RawQuery("UPDATE outbound_messages SET next_attempt_at = ? WHERE id = ? AND status = ? AND next_attempt_at = ?",
+		now.Add(lease), m.ID, MessageStatusPending, m.NextAttemptAt).ExecWithCount()
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	return n == 1, nil
+}
+
+// DueMessages returns up to limit pending messages whose next attempt is due.
+func DueMessages(tx *pop.Connection, now time.Time, limit int) (OutboundMessages, error) {
+	messages := OutboundMessages{}
+	err := tx.Where("status = ? AND next_attempt_at <= ?", MessageStatusPending, now).
+		Order("next_attempt_at asc").Limit(limit).All(&messages)
+	return messages, errors.WithStack(err)
+}
+
+// String is not required by pop and may be deleted
+func (m OutboundMessage) String() string {
+	jm, _ := json.Marshal(m)
+	return string(jm)
+}
+
+// OutboundMessages is not required by pop and may be deleted
+type OutboundMessages []OutboundMessage
+
+// String is not required by pop and may be deleted
+func (m OutboundMessages) String() string {
+	jm, _ := json.Marshal(m)
+	return string(jm)
+}
+
+// Validate gets run every time you call a "pop.Validate*" (pop.ValidateAndSave, pop.ValidateAndCreate, pop.ValidateAndUpdate) method.
+func (m *OutboundMessage) Validate(tx *pop.Connection) (*validate.Errors, error) {
+	return validate.Validate(
+		&validators.StringIsPresent{Field: m.Payload, Name: "Payload"},
+		&validators.StringInclusion{
+			Field: m.Status,
+			Name:  "Status",
+			List:  []string{MessageStatusPending, MessageStatusSent, MessageStatusDead},
+		},
+	), nil
+}
+
+// ValidateCreate gets run every time you call "pop.ValidateAndCreate" method.
+// This method is not required and may be deleted.
+func (m *OutboundMessage) ValidateCreate(tx *pop.Connection) (*validate.Errors, error) {
+	return validate.NewErrors(), nil
+}
+
+// ValidateUpdate gets run every time you call "pop.ValidateAndUpdate" method.
+// This method is not required and may be deleted.
+func (m *OutboundMessage) ValidateUpdate(tx *pop.Connection) (*validate.Errors, error) {
+	return validate.NewErrors(), nil
+}
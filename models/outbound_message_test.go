@@ -0,0 +1,73 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+func (ms *ModelSuite) Test_OutboundMessage_Backoff() {
+	ms.Equal(time.Duration(0), MessageBackoff(0))
+	ms.Equal(time.Minute, MessageBackoff(1))
+	ms.Equal(4*time.Minute, MessageBackoff(3))
+
+	now := time.Now().UTC()
+	m := &OutboundMessage{Status: MessageStatusPending}
+	for i := 1; i < MaxMessageAttempts; i++ {
+		m.MarkFailed(errors.New("connection refused"), now)
+		ms.Equal(MessageStatusPending, m.Status)
+		ms.Equal(now.Add(MessageBackoff(i)), m.NextAttemptAt)
+	}
+
+	m.MarkFailed(errors.New("connection refused"), now)
+	ms.Equal(MessageStatusDead, m.Status)
+	ms.Equal("connection refused", m.LastError.String)
+
+	m.Requeue(now)
+	ms.Equal(MessageStatusPending, m.Status)
+	ms.Equal(0, m.Attempts)
+}
+
+func (ms *ModelSuite) Test_OutboundMessage_Enqueue() {
+	m, err := EnqueueMessage(ms.DB, map[string]interface{}{"receiver_email": "mark@example.com"})
+	ms.NoError(err)
+	ms.Equal("mark@example.com", m.Recipient())
+
+	due, err := DueMessages(ms.DB, time.Now().UTC().Add(time.Second), 10)
+	ms.NoError(err)
+	ms.Len(due, 1)
+
+	ok, err := ClaimMessage(ms.DB, &due[0], time.Now().UTC(), time.Minute)
+	ms.NoError(err)
+	ms.True(ok)
+
+	// A second claim on the same snapshot loses.
+	ok, err = ClaimMessage(ms.DB, &due[0], time.Now().UTC(), time.Minute)
+	ms.NoError(err)
+	ms.False(ok)
+}
+
+func (ms *ModelSuite) Test_OutboundMessage_Redact() {
+	m, err := EnqueueMessage(ms.DB, map[string]interface{}{
+		"receiver_email": "mark@example.com",
+		"code":           "123456",
+		"reset_url":      "https://example.com/password_reset?token=abc",
+	})
+	ms.NoError(err)
+	ms.False(m.Redacted())
+
+	m.MarkSent(time.Now().UTC())
+	ms.True(m.Redacted())
+	ms.NotContains(m.Payload, "123456")
+	ms.NotContains(m.Payload, "token=abc")
+	ms.Equal("mark@example.com", m.Recipient())
+
+	// Dead messages lose them too.
+	m, err = EnqueueMessage(ms.DB, map[string]interface{}{"verify_url": "https://example.com/users/verify/1?token=abc"})
+	ms.NoError(err)
+	for i := 0; i < MaxMessageAttempts; i++ {
+		ms.False(m.Redacted())
+		m.MarkFailed(errors.New("connection refused"), time.Now().UTC())
+	}
+	ms.True(m.Redacted())
+	ms.NotContains(m.Payload, "token=abc")
+}
@@ -0,0 +1,10 @@
+package models
+
+import "strings"
+
+// SearchPattern returns a LIKE pattern matching values that contain s.
+// Wildcards in s are matched literally.
+func SearchPattern(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(strings.TrimSpace(s))
+	return "%" + s + "%"
+}
@@ -0,0 +1,136 @@
+package models
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/nulls"
+	"github.com/gobuffalo/pop/v6"
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+)
+
+// ErrUnverifiedSSOEmail is returned when an identity provider signs in
+// someone it hasn't confirmed the email address of, so the address can't
+// be trusted to pick or create an account.
+var ErrUnverifiedSSOEmail = errors.New("identity provider has not verified the email address")
+
+// ErrSSOAccountLinked is returned when the account with the email address
+// is already linked to another identity at the provider.
+var ErrSSOAccountLinked = errors.New("account is linked to another identity")
+
+// SSOIdentity is someone signed in by an OpenID Connect provider.
+type SSOIdentity struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+}
+
+// FindOrCreateSSOUser returns the user for a provider identity. A user
+// already linked to it is returned as is, whatever their address is now.
+// Otherwise the identity is linked to the user with its email address, or
+// a new member is created for it; both need the provider to have verified
+// the address. linked reports whether the identity was linked just now.
+func FindOrCreateSSOUser(tx *pop.Connection, id SSOIdentity, now time.Time) (u *User, linked bool, err error) {
+	u = &User{}
+	err = tx.Where("oidc_issuer = ? AND oidc_subject = ?", id.Issuer, id.Subject).First(u)
+	if err == nil {
+		return u, false, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, false, errors.WithStack(err)
+	}
+
+	email := strings.ToLower(strings.TrimSpace(id.Email))
+	if email == "" || !id.EmailVerified {
+		return nil, false, ErrUnverifiedSSOEmail
+	}
+
+	err = tx.Where("email = ?", email).First(u)
+	switch {
+	case err == nil:
+		err = u.linkSSO(tx, id, now)
+		if err != nil {
+			return nil, false, err
+		}
+		return u, true, nil
+	case !errors.Is(err, sql.ErrNoRows):
+		return nil, false, errors.WithStack(err)
+	}
+
+	// The account gets a password nobody knows; the person can set one
+	// through recovery if password login is enabled.
+	password, err := randomPassword()
+	if err != nil {
+		return nil, false, err
+	}
+	u = &User{
+		Email:                email,
+		Password:             password,
+		PasswordConfirmation: password,
+		Role:                 RoleMember,
+		VerifiedAt:           nulls.NewTime(now),
+		OIDCIssuer:           nulls.NewString(id.Issuer),
+		OIDCSubject:          nulls.NewString(id.Subject),
+	}
+	verrs, err := u.Create(tx)
+	if err != nil {
+		return nil, false, err
+	}
+	if verrs.HasAny() {
+		return nil, false, errors.New(verrs.Error())
+	}
+	return u, true, nil
+}
+
+// linkSSO links the user to a provider identity with the same, verified,
+// email address. If the user never confirmed the address, whoever chose
+// their password hadn't proved they own it, so the password and any logins
+// made with it are dropped.
+func (u *User) linkSSO(tx *pop.Connection, id SSOIdentity, now time.Time) error {
+	if u.OIDCSubject.Valid {
+		return ErrSSOAccountLinked
+	}
+
+	columns := []string{"oidc_issuer", "oidc_subject", "updated_at"}
+	if !u.IsVerified() {
+		password, err := randomPassword()
+		if err != nil {
+			return err
+		}
+		hash, err := encryptPassword(password)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		u.PasswordHash = hash
+		u.VerifiedAt = nulls.NewTime(now)
+		u.clearRecovery()
+		columns = append(columns, "password_hash", "verified_at", "recovery_code_hash", "recovery_token_hash", "recovery_expiration")
+
+		_, err = RevokeUserSessions(tx, u.ID, uuid.Nil, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	u.OIDCIssuer = nulls.NewString(id.Issuer)
+	u.OIDCSubject = nulls.NewString(id.Subject)
+	return errors.WithStack(tx.UpdateColumns(u, columns...))
+}
+
+// HasSSO reports whether the user is linked to an identity provider.
+func (u *User) HasSSO() bool {
+	return u != nil && u.OIDCSubject.Valid
+}
+
+func randomPassword() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.WithStack(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
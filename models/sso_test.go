@@ -0,0 +1,77 @@
+package models
+
+import (
+	"time"
+
+	"github.com/gobuffalo/nulls"
+)
+
+func (ms *ModelSuite) Test_FindOrCreateSSOUser_Creates() {
+	now := time.Now().UTC().Truncate(time.Second)
+	id := SSOIdentity{Issuer: "https://idp.test", Subject: "s1", Email: " Ann@Example.com", EmailVerified: true}
+
+	u, linked, err := FindOrCreateSSOUser(ms.DB, id, now)
+	ms.NoError(err)
+	ms.True(linked)
+	ms.Equal("ann@example.com", u.Email)
+	ms.Equal(RoleMember, u.Role)
+	ms.True(u.IsVerified())
+	ms.True(u.HasSSO())
+
+	// The same identity finds the same user, even after an email change.
+	ms.NoError(ms.DB.RawQuery("UPDATE users SET email = ? WHERE id = ?", "ann@other.test", u.ID).Exec())
+	again, linked, err := FindOrCreateSSOUser(ms.DB, id, now)
+	ms.NoError(err)
+	ms.False(linked)
+	ms.Equal(u.ID, again.ID)
+}
+
+func (ms *ModelSuite) Test_FindOrCreateSSOUser_Links() {
+	now := time.Now().UTC().Truncate(time.Second)
+	u := &User{Email: "bob@example.com", Password: "password", PasswordConfirmation: "password", VerifiedAt: nulls.NewTime(now)}
+	verrs, err := u.Create(ms.DB)
+	ms.NoError(err)
+	ms.False(verrs.HasAny())
+
+	found, linked, err := FindOrCreateSSOUser(ms.DB, SSOIdentity{Issuer: "https://idp.test", Subject: "s2", Email: "BOB@example.com", EmailVerified: true}, now)
+	ms.NoError(err)
+	ms.True(linked)
+	ms.Equal(u.ID, found.ID)
+
+	ms.NoError(ms.DB.Reload(u))
+	ms.Equal("s2", u.OIDCSubject.String)
+	ms.True(u.CheckPassword("password"))
+
+	// Another identity with the same address can't take the account over.
+	_, _, err = FindOrCreateSSOUser(ms.DB, SSOIdentity{Issuer: "https://idp.test", Subject: "s3", Email: "bob@example.com", EmailVerified: true}, now)
+	ms.ErrorIs(err, ErrSSOAccountLinked)
+}
+
+func (ms *ModelSuite) Test_FindOrCreateSSOUser_LinkUnverified() {
+	now := time.Now().UTC().Truncate(time.Second)
+	u := &User{Email: "cat@example.com", Password: "password", PasswordConfirmation: "password"}
+	verrs, err := u.Create(ms.DB)
+	ms.NoError(err)
+	ms.False(verrs.HasAny())
+	s, err := NewUserSession(ms.DB, u.ID, "", "", "password", now)
+	ms.NoError(err)
+
+	_, _, err = FindOrCreateSSOUser(ms.DB, SSOIdentity{Issuer: "https://idp.test", Subject: "s4", Email: "cat@example.com", EmailVerified: true}, now)
+	ms.NoError(err)
+
+	// Whoever registered the address first loses the password and logins.
+	ms.NoError(ms.DB.Reload(u))
+	ms.True(u.IsVerified())
+	ms.False(u.CheckPassword("password"))
+	ms.NoError(ms.DB.Reload(s))
+	ms.True(s.RevokedAt.Valid)
+}
+
+func (ms *ModelSuite) Test_FindOrCreateSSOUser_UnverifiedEmail() {
+	_, _, err := FindOrCreateSSOUser(ms.DB, SSOIdentity{Issuer: "https://idp.test", Subject: "s5", Email: "dan@example.com"}, time.Now())
+	ms.ErrorIs(err, ErrUnverifiedSSOEmail)
+
+	count, err := ms.DB.Count("users")
+	ms.NoError(err)
+	ms.Equal(0, count)
+}
@@ -0,0 +1,151 @@
+package models
+
+import (
+	"crypto/subtle"
+	"encoding/base32"
+	"time"
+
+	"github.com/gobuffalo/nulls"
+	"github.com/gobuffalo/pop/v6"
+	"github.com/pkg/errors"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+// TOTPIssuer names the app in authenticator apps.
+const TOTPIssuer = "Event Planner"
+
+// Kinds of second factor.
+const (
+	SecondFactorTOTP       = "totp"
+	SecondFactorBackupCode = "backup_code"
+)
+
+// totpOpts are the parameters every common authenticator app uses. Skew
+// accepts the code from one step either side, for clock drift.
+var totpOpts = totp.ValidateOpts{
+	Period:    30,
+	Skew:      1,
+	Digits:    otp.DigitsSix,
+	Algorithm: otp.AlgorithmSHA1,
+}
+
+// HasTwoFactor reports whether the user must give a second factor to log
+// in.
+func (u User) HasTwoFactor() bool {
+	return u.TOTPEnabledAt.Valid
+}
+
+// BeginTwoFactor gives the user a new, not yet enabled, TOTP secret. It
+// takes effect once EnableTwoFactor sees a code made from it.
+func (u *User) BeginTwoFactor(tx *pop.Connection) (*otp.Key, error) {
+	if u.HasTwoFactor() {
+		return nil, errors.New("two-factor authentication is already enabled")
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{Issuer: TOTPIssuer, AccountName: u.Email})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	u.TOTPSecret = nulls.NewString(key.Secret())
+	return key, errors.WithStack(tx.UpdateColumns(u, "totp_secret", "updated_at"))
+}
+
+// TOTPKey returns the user's TOTP key, for showing the otpauth URI and QR
+// code while enrolling.
+func (u User) TOTPKey() (*otp.Key, error) {
+	if !u.TOTPSecret.Valid {
+		return nil, errors.New("no two-factor secret")
+	}
+	secret, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(u.TOTPSecret.String)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	key, err := totp.Generate(totp.GenerateOpts{Issuer: TOTPIssuer, AccountName: u.Email, Secret: secret})
+	return key, errors.WithStack(err)
+}
+
+// EnableTwoFactor turns on two-factor authentication if code matches the
+// secret from BeginTwoFactor. It returns a first set of backup codes, or
+// nil if the code was wrong.
+func (u *User) EnableTwoFactor(tx *pop.Connection, code string, now time.Time) ([]string, error) {
+	if u.HasTwoFactor() || !u.TOTPSecret.Valid {
+		return nil, nil
+	}
+	if !u.checkTOTP(code, now) {
+		return nil, nil
+	}
+
+	u.TOTPEnabledAt = nulls.NewTime(now)
+	err := tx.UpdateColumns(u, "totp_enabled_at", "totp_last_step", "updated_at")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return NewBackupCodes(tx, u.ID)
+}
+
+// VerifyTwoFactor checks a login's second factor: a code from the user's
+// authenticator or one of their backup codes. Each TOTP code and backup
+// code is accepted only once. It returns which kind matched, or "".
+func (u *User) VerifyTwoFactor(tx *pop.Connection, code string, now time.Time) (string, error) {
+	if !u.HasTwoFactor() {
+		return "", nil
+	}
+
+	if u.checkTOTP(code, now) {
+		// Only one of two logins racing with the same code moves the step
+		// forward.
+		n, err := tx.RawQuery("UPDATE users SET totp_last_step = ?, updated_at = ? WHERE id = ? AND totp_last_step < ?",
+			u.TOTPLastStep, now, u.ID, u.TOTPLastStep).ExecWithCount()
+		if err != nil || n != 1 {
+			return "", errors.WithStack(err)
+		}
+		return SecondFactorTOTP, nil
+	}
+
+	ok, err := UseBackupCode(tx, u.ID, code, now)
+	if err != nil || !ok {
+		return "", err
+	}
+	return SecondFactorBackupCode, nil
+}
+
+// checkTOTP compares code with the codes for the steps around now, and
+// records the matching step so the same code can't be replayed.
+func (u *User) checkTOTP(code string, now time.Time) bool {
+	if len(code) != totpOpts.Digits.Length() {
+		return false
+	}
+
+	period := int64(totpOpts.Period)
+	current := now.Unix() / period
+	for step := current - int64(totpOpts.Skew); step <= current+int64(totpOpts.Skew); step++ {
+		if step <= u.TOTPLastStep {
+			continue
+		}
+		want, err := totp.GenerateCodeCustom(u.TOTPSecret.String, time.Unix(step*period, 0), totpOpts)
+		if err != nil {
+			return false
+		}
+		if subtle.ConstantTimeCompare([]byte(want), []byte(code)) == 1 {
+			u.TOTPLastStep = step
+			return true
+		}
+	}
+	return false
+}
+
+// DisableTwoFactor turns two-factor authentication off and throws away
+// the secret and backup codes.
+func (u *User) DisableTwoFactor(tx *pop.Connection) error {
+	u.TOTPSecret = nulls.String{}
+	u.TOTPEnabledAt = nulls.Time{}
+	u.TOTPLastStep = 0
+	err := tx.UpdateColumns(u, "totp_secret", "totp_enabled_at", "totp_last_step", "updated_at")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	err = tx.RawQuery("DELETE FROM backup_codes WHERE user_id = ?", u.ID).Exec()
+	return errors.WithStack(err)
+}
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"time"
+
+	"github.com/pquerna/otp/totp"
+)
+
+func (ms *ModelSuite) Test_User_TwoFactor() {
+	u := &User{Email: "mark@example.com", Password: "password", PasswordConfirmation: "password"}
+	verrs, err := u.Create(ms.DB)
+	ms.NoError(err)
+	ms.False(verrs.HasAny())
+
+	key, err := u.BeginTwoFactor(ms.DB)
+	ms.NoError(err)
+	ms.False(u.HasTwoFactor())
+	ms.Contains(key.URL(), "otpauth://totp/")
+
+	now := time.Now().UTC()
+	codes, err := u.EnableTwoFactor(ms.DB, "000000", now)
+	ms.NoError(err)
+	ms.Nil(codes)
+	ms.False(u.HasTwoFactor())
+
+	code, err := totp.GenerateCode(key.Secret(), now)
+	ms.NoError(err)
+	codes, err = u.EnableTwoFactor(ms.DB, code, now)
+	ms.NoError(err)
+	ms.Len(codes, BackupCodeCount)
+	ms.NoError(ms.DB.Reload(u))
+	ms.True(u.HasTwoFactor())
+
+	// The code used to enable can't be used again to log in.
+	kind, err := u.VerifyTwoFactor(ms.DB, code, now)
+	ms.NoError(err)
+	ms.Equal("", kind)
+
+	later := now.Add(time.Minute)
+	code, err = totp.GenerateCode(key.Secret(), later)
+	ms.NoError(err)
+	kind, err = u.VerifyTwoFactor(ms.DB, code, later)
+	ms.NoError(err)
+	ms.Equal(SecondFactorTOTP, kind)
+	kind, err = u.VerifyTwoFactor(ms.DB, code, later)
+	ms.NoError(err)
+	ms.Equal("", kind)
+
+	// Backup codes work once, with or without the dash.
+	kind, err = u.VerifyTwoFactor(ms.DB, " "+codes[0][:4]+codes[0][5:]+" ", later)
+	ms.NoError(err)
+	ms.Equal(SecondFactorBackupCode, kind)
+	kind, err = u.VerifyTwoFactor(ms.DB, codes[0], later)
+	ms.NoError(err)
+	ms.Equal("", kind)
+
+	left, err := UnusedBackupCodes(ms.DB, u.ID)
+	ms.NoError(err)
+	ms.Equal(BackupCodeCount-1, left)
+
+	ms.NoError(u.DisableTwoFactor(ms.DB))
+	ms.NoError(ms.DB.Reload(u))
+	ms.False(u.HasTwoFactor())
+	ms.False(u.TOTPSecret.Valid)
+	left, err = UnusedBackupCodes(ms.DB, u.ID)
+	ms.NoError(err)
+	ms.Equal(0, left)
+}
@@ -1,8 +1,12 @@
 package models
 
 import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"math/big"
 	"strings"
 	"time"
 
@@ -17,18 +21,52 @@ import (
 
 const minPasswordLength int = 8
 
+// RecoveryTTL is how long a password recovery link and code stay valid.
+const RecoveryTTL = 10 * time.Minute
+
+// ErrOwnsUpcomingEvents is returned when deleting a user who owns upcoming
+// events that nobody else could take over.
+var ErrOwnsUpcomingEvents = errors.New("user owns upcoming events without co-organizers")
+
+// ErrInvalidRecovery is returned for recovery links that are unknown,
+// already used or expired.
+var ErrInvalidRecovery = errors.New("recovery link is not valid")
+
+// User roles, from most to least privileged. Admins can manage every
+// event and user, organizers can create events, members can only take
+// part.
+const (
+	RoleAdmin     = "admin"
+	RoleOrganizer = "organizer"
+	RoleMember    = "member"
+)
+
+// Roles lists every role, most privileged first.
+var Roles = []string{RoleAdmin, RoleOrganizer, RoleMember}
+
+// roleRanks orders the roles; each one includes the rights of those below.
+var roleRanks = map[string]int{RoleMember: 1, RoleOrganizer: 2, RoleAdmin: 3}
+
 // User is a generated model from buffalo-auth, it serves as the base for username/password authentication.
 type User struct {
-	ID           uuid.UUID `json:"id" db:"id"`
-	CreatedAt    time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
-	Email        string    `json:"email" db:"email"`
-	PasswordHash string    `json:"password_hash" db:"password_hash"`
+	ID           uuid.UUID  `json:"id" db:"id"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at" db:"updated_at"`
+	Email        string     `json:"email" db:"email"`
+	PasswordHash string     `json:"-" db:"password_hash"`
+	Role         string     `json:"role" db:"role"`
+	VerifiedAt   nulls.Time `json:"verified_at" db:"verified_at"`
 
 	Password             string       `json:"-" db:"-"`
 	PasswordConfirmation string       `json:"-" db:"-"`
-	RecoveryCode         nulls.String `json:"-" db:"recovery_code"`
+	RecoveryCodeHash     nulls.String `json:"-" db:"recovery_code_hash"`
+	RecoveryTokenHash    nulls.String `json:"-" db:"recovery_token_hash"`
 	RecoveryExp          nulls.Time   `json:"-" db:"recovery_expiration"`
+	TOTPSecret           nulls.String `json:"-" db:"totp_secret"`
+	TOTPEnabledAt        nulls.Time   `json:"-" db:"totp_enabled_at"`
+	TOTPLastStep         int64        `json:"-" db:"totp_last_step"`
+	OIDCIssuer           nulls.String `json:"-" db:"oidc_issuer"`
+	OIDCSubject          nulls.String `json:"-" db:"oidc_subject"`
 }
 
 // Create wraps up the pattern of encrypting the password and
@@ -44,6 +82,9 @@ func (u *User) Create(tx *pop.Connection) (*validate.Errors, error) {
 		return validate.NewErrors(), errors.WithStack(err)
 	}
 	u.PasswordHash = string(ph)
+	if u.Role == "" {
+		u.Role = RoleMember
+	}
 	u = u.sanitizeFields()
 	return tx.ValidateAndCreate(u)
 }
@@ -67,6 +108,89 @@ func (u *User) Update(tx *pop.Connection) (*validate.Errors, error) {
 	return tx.ValidateAndUpdate(u)
 }
 
+// ChangeEmail moves the account to a new address. The new address has to
+// be confirmed again, and pending recovery links, which went to the old
+// one, stop working. The user is left as it was if the new address
+// doesn't validate.
+func (u *User) ChangeEmail(tx *pop.Connection, email string) (*validate.Errors, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == u.Email {
+		return validate.NewErrors(), nil
+	}
+
+	changed := *u
+	changed.Email = email
+	changed.VerifiedAt = nulls.Time{}
+	changed.clearRecovery()
+	verrs, err := changed.Update(tx)
+	if err != nil || verrs.HasAny() {
+		return verrs, err
+	}
+	*u = changed
+	return verrs, nil
+}
+
+// CheckPassword reports whether password is the user's password.
+func (u User) CheckPassword(password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) == nil
+}
+
+// UndeletableEvents lists the events that keep the user from deleting
+// their account: upcoming, not cancelled, and with no co-organizer to
+// take them over.
+func (u *User) UndeletableEvents(tx *pop.Connection, now time.Time) (Events, error) {
+	events := Events{}
+	err := tx.RawQuery(`SELECT * FROM events
+		WHERE owner_id = ? AND event_date > ? AND status = ?
+		AND NOT EXISTS (SELECT 1 FROM event_organizers WHERE event_organizers.event_id = events.id)
+		ORDER BY event_date`, u.ID, now, EventStatusScheduled).All(&events)
+	return events, errors.WithStack(err)
+}
+
+// Destroy deletes the account. Each event the user owns passes to its
+// longest-serving co-organizer; events without one are deleted with their
+// reservations if they are over or cancelled. Upcoming events without a
+// co-organizer would leave guests with nobody to run them, so the user has
+// to hand them over or cancel them first; until then Destroy returns
+// ErrOwnsUpcomingEvents.
+func (u *User) Destroy(tx *pop.Connection, now time.Time) error {
+	blocking, err := u.UndeletableEvents(tx, now)
+	if err != nil {
+		return err
+	}
+	if len(blocking) > 0 {
+		return ErrOwnsUpcomingEvents
+	}
+
+	owned, err := OwnedEvents(tx, u.ID)
+	if err != nil {
+		return err
+	}
+	for i := range owned {
+		e := &owned[i]
+		o := &EventOrganizer{}
+		err = tx.Where("event_id = ?", e.ID).Order("created_at asc").First(o)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			err = e.Destroy(tx)
+		case err == nil:
+			err = tx.RawQuery("UPDATE events SET owner_id = ?, updated_at = ? WHERE id = ?", o.UserID, now, e.ID).Exec()
+			if err == nil {
+				err = tx.Destroy(o)
+			}
+		}
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	err = tx.RawQuery("DELETE FROM event_organizers WHERE user_id = ?", u.ID).Exec()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(tx.Destroy(u))
+}
+
 func (u *User) sanitizeFields() *User {
 	// force email to lowercase for better matching
 	u.Email = strings.ToLower(u.Email)
@@ -77,6 +201,132 @@ func (u *User) sanitizeFields() *User {
 	return u
 }
 
+// HasRole reports whether the user has role or a more privileged one.
+func (u *User) HasRole(role string) bool {
+	return u != nil && roleRanks[u.Role] >= roleRanks[role] && roleRanks[role] > 0
+}
+
+// IsAdmin reports whether the user is an admin.
+func (u *User) IsAdmin() bool {
+	return u.HasRole(RoleAdmin)
+}
+
+// IsVerified reports whether the user has confirmed their email address.
+func (u *User) IsVerified() bool {
+	return u != nil && u.VerifiedAt.Valid
+}
+
+// MarkVerified records that the user confirmed their email address.
+func (u *User) MarkVerified(tx *pop.Connection, now time.Time) error {
+	u.VerifiedAt = nulls.NewTime(now)
+	return errors.WithStack(tx.UpdateColumns(u, "verified_at", "updated_at"))
+}
+
+// StartRecovery issues a recovery link token and a 6-digit code for the
+// user, replacing any pending ones. Only their hashes are stored; the
+// returned secrets are for the email and can't be recovered later.
+func (u *User) StartRecovery(tx *pop.Connection, now time.Time) (token, code string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", errors.WithStack(err)
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", "", errors.WithStack(err)
+	}
+	code = fmt.Sprintf("%06d", n.Int64())
+
+	// The code is short enough to brute force from a plain hash, so it
+	// gets bcrypt like a password.
+	codeHash, err := bcrypt.GenerateFromPassword([]byte(code), bcrypt.DefaultCost)
+	if err != nil {
+		return "", "", errors.WithStack(err)
+	}
+
+	u.RecoveryTokenHash = nulls.NewString(hashToken(token))
+	u.RecoveryCodeHash = nulls.NewString(string(codeHash))
+	u.RecoveryExp = nulls.NewTime(now.Add(RecoveryTTL))
+	err = tx.UpdateColumns(u, "recovery_token_hash", "recovery_code_hash", "recovery_expiration", "updated_at")
+	return token, code, errors.WithStack(err)
+}
+
+// CheckRecoveryCode reports whether code is the user's pending code and
+// hasn't expired.
+func (u User) CheckRecoveryCode(code string, now time.Time) bool {
+	if !u.HasPendingRecovery() || !now.Before(u.RecoveryExp.Time) {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(u.RecoveryCodeHash.String), []byte(code)) == nil
+}
+
+// FindUserByRecoveryToken loads the user a recovery link was sent to and
+// locks the row, so two uses of the same link can't both succeed.
+func FindUserByRecoveryToken(tx *pop.Connection, token string, now time.Time) (*User, error) {
+	u := &User{}
+	if token == "" {
+		return nil, ErrInvalidRecovery
+	}
+
+	err := tx.RawQuery("SELECT * FROM users WHERE recovery_token_hash = ? FOR UPDATE", hashToken(token)).First(u)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidRecovery
+		}
+		return nil, errors.WithStack(err)
+	}
+
+	if !u.RecoveryExp.Valid || !now.Before(u.RecoveryExp.Time) {
+		return nil, ErrInvalidRecovery
+	}
+	return u, nil
+}
+
+// LockUserByEmail loads the user with email and locks the row until the
+// transaction ends.
+func LockUserByEmail(tx *pop.Connection, email string) (*User, error) {
+	u := &User{}
+	err := tx.RawQuery("SELECT * FROM users WHERE email = ? FOR UPDATE", strings.ToLower(strings.TrimSpace(email))).First(u)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return u, nil
+}
+
+// CompleteRecovery sets a new password and discards the recovery link and
+// code, so each works only once.
+func (u *User) CompleteRecovery(tx *pop.Connection, password, confirmation string) (*validate.Errors, error) {
+	u.Password = password
+	u.PasswordConfirmation = confirmation
+	if u.Password == "" {
+		verrs := validate.NewErrors()
+		verrs.Add("password", "Password can not be blank.")
+		return verrs, nil
+	}
+
+	u.clearRecovery()
+	return u.Update(tx)
+}
+
+// ResetRecovery discards any pending password recovery link and code.
+func (u *User) ResetRecovery(tx *pop.Connection) error {
+	u.clearRecovery()
+	return errors.WithStack(tx.UpdateColumns(u, "recovery_token_hash", "recovery_code_hash", "recovery_expiration", "updated_at"))
+}
+
+func (u *User) clearRecovery() {
+	u.RecoveryTokenHash = nulls.String{}
+	u.RecoveryCodeHash = nulls.String{}
+	u.RecoveryExp = nulls.Time{}
+}
+
+// HasPendingRecovery reports whether a recovery link and code have been
+// issued and not yet used.
+func (u User) HasPendingRecovery() bool {
+	return u.RecoveryCodeHash.Valid && u.RecoveryCodeHash.String != ""
+}
+
 // String is not required by pop and may be deleted
 func (u User) String() string {
 	ju, _ := json.Marshal(u)
@@ -99,6 +349,7 @@ func (u *User) Validate(tx *pop.Connection) (*validate.Errors, error) {
 	return validate.Validate(
 		&validators.StringIsPresent{Field: u.Email, Name: "Email"},
 		&validators.StringIsPresent{Field: u.PasswordHash, Name: "PasswordHash"},
+		&validators.StringInclusion{Field: u.Role, Name: "Role", List: Roles},
 		// check to see if the email address is already taken:
 		&validators.FuncValidator{
 			Field:   u.Email,
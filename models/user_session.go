@@ -0,0 +1,176 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/nulls"
+	"github.com/gobuffalo/pop/v6"
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+)
+
+// ErrSessionExpired is returned for sessions that are unknown, revoked or
+// timed out.
+var ErrSessionExpired = errors.New("session expired")
+
+// sessionTouchInterval limits how often a session's last_seen_at is
+// written, so busy pages don't update the row on every request.
+const sessionTouchInterval = time.Minute
+
+// maxUserAgentLength matches the user_agent column.
+const maxUserAgentLength = 512
+
+// SessionPolicy says how long a login lasts: Idle without any request,
+// and MaxAge in total however active it is.
+type SessionPolicy struct {
+	Idle   time.Duration
+	MaxAge time.Duration
+}
+
+// IsActive reports whether s can still be used at now.
+func (p SessionPolicy) IsActive(s UserSession, now time.Time) bool {
+	if s.RevokedAt.Valid {
+		return false
+	}
+	return now.Before(s.LastSeenAt.Add(p.Idle)) && now.Before(s.CreatedAt.Add(p.MaxAge))
+}
+
+// UserSession is used by pop to map your user_sessions database table to your go code.
+// It is one login on one device; the session cookie only holds its ID, so
+// it can be revoked from the server.
+type UserSession struct {
+	ID         uuid.UUID  `json:"id" db:"id"`
+	UserID     uuid.UUID  `json:"user_id" db:"user_id"`
+	UserAgent  string     `json:"user_agent" db:"user_agent"`
+	IP         string     `json:"ip" db:"ip"`
+	Method     string     `json:"method" db:"method"`
+	LastSeenAt time.Time  `json:"last_seen_at" db:"last_seen_at"`
+	RevokedAt  nulls.Time `json:"revoked_at" db:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// String is not required by pop and may be deleted
+func (s UserSession) String() string {
+	js, _ := json.Marshal(s)
+	return string(js)
+}
+
+// UserSessions is not required by pop and may be deleted
+type UserSessions []UserSession
+
+// String is not required by pop and may be deleted
+func (s UserSessions) String() string {
+	js, _ := json.Marshal(s)
+	return string(js)
+}
+
+// NewUserSession records a login by the user. method says how they
+// authenticated, as in the login audit.
+func NewUserSession(tx *pop.Connection, userID uuid.UUID, userAgent, ip, method string, now time.Time) (*UserSession, error) {
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+	s := &UserSession{
+		UserID:     userID,
+		UserAgent:  userAgent,
+		IP:         ip,
+		Method:     method,
+		LastSeenAt: now,
+		CreatedAt:  now,
+	}
+	return s, errors.WithStack(tx.Create(s))
+}
+
+// FindUserSession loads the session with id if it belongs to userID and
+// is still active under p.
+func FindUserSession(tx *pop.Connection, id, userID uuid.UUID, p SessionPolicy, now time.Time) (*UserSession, error) {
+	s := &UserSession{}
+	err := tx.Find(s, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrSessionExpired
+		}
+		return nil, errors.WithStack(err)
+	}
+	if s.UserID != userID || !p.IsActive(*s, now) {
+		return nil, ErrSessionExpired
+	}
+	return s, nil
+}
+
+// Touch records activity on the session from ip.
+func (s *UserSession) Touch(tx *pop.Connection, ip string, now time.Time) error {
+	if now.Sub(s.LastSeenAt) < sessionTouchInterval && ip == s.IP {
+		return nil
+	}
+	s.LastSeenAt = now
+	s.IP = ip
+	return errors.WithStack(tx.UpdateColumns(s, "last_seen_at", "ip", "updated_at"))
+}
+
+// Revoke logs the session out.
+func (s *UserSession) Revoke(tx *pop.Connection, now time.Time) error {
+	s.RevokedAt = nulls.NewTime(now)
+	return errors.WithStack(tx.UpdateColumns(s, "revoked_at", "updated_at"))
+}
+
+// RevokeUserSessions logs the user out of every session but except, which
+// may be uuid.Nil. It returns how many sessions were revoked.
+func RevokeUserSessions(tx *pop.Connection, userID, except uuid.UUID, now time.Time) (int, error) {
+	n, err := tx.RawQuery("UPDATE user_sessions SET revoked_at = ?, updated_at = ? WHERE user_id = ? AND id != ? AND revoked_at IS NULL",
+		now, now, userID, except).ExecWithCount()
+	return n, errors.WithStack(err)
+}
+
+// ActiveSessions lists the user's sessions that are still active under p,
+// most recently used first.
+func ActiveSessions(tx *pop.Connection, userID uuid.UUID, p SessionPolicy, now time.Time) (UserSessions, error) {
+	sessions := UserSessions{}
+	err := tx.Where("user_id = ? AND revoked_at IS NULL AND last_seen_at > ? AND created_at > ?",
+		userID, now.Add(-p.Idle), now.Add(-p.MaxAge)).Order("last_seen_at desc").All(&sessions)
+	return sessions, errors.WithStack(err)
+}
+
+// Device describes the browser and system from the session's user agent,
+// like "Firefox on Windows". It only knows the common ones.
+func (s UserSession) Device() string {
+	ua := s.UserAgent
+	browser := "Unknown browser"
+	for _, b := range []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+	} {
+		if strings.Contains(ua, b.token) {
+			browser = b.name
+			break
+		}
+	}
+
+	system := ""
+	for _, o := range []struct{ token, name string }{
+		{"iPhone", "iPhone"},
+		{"iPad", "iPad"},
+		{"Android", "Android"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"Linux", "Linux"},
+	} {
+		if strings.Contains(ua, o.token) {
+			system = o.name
+			break
+		}
+	}
+
+	if system == "" {
+		return browser
+	}
+	return browser + " on " + system
+}
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+func (ms *ModelSuite) Test_UserSession() {
+	u := &User{Email: "mark@example.com", Password: "password", PasswordConfirmation: "password"}
+	verrs, err := u.Create(ms.DB)
+	ms.NoError(err)
+	ms.False(verrs.HasAny())
+
+	p := SessionPolicy{Idle: time.Hour, MaxAge: 24 * time.Hour}
+	start := time.Now().UTC().Truncate(time.Second)
+	s, err := NewUserSession(ms.DB, u.ID, "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 Version/17.0 Mobile/15E148 Safari/604.1", "10.0.0.1", "password", start)
+	ms.NoError(err)
+	ms.Equal("Safari on iPhone", s.Device())
+
+	found, err := FindUserSession(ms.DB, s.ID, u.ID, p, start.Add(time.Minute))
+	ms.NoError(err)
+	ms.Equal(s.ID, found.ID)
+
+	_, err = FindUserSession(ms.DB, s.ID, uuid.Must(uuid.NewV4()), p, start)
+	ms.Equal(ErrSessionExpired, err)
+
+	// Idle timeout, pushed back by activity.
+	_, err = FindUserSession(ms.DB, s.ID, u.ID, p, start.Add(2*time.Hour))
+	ms.Equal(ErrSessionExpired, err)
+	ms.NoError(found.Touch(ms.DB, "10.0.0.2", start.Add(50*time.Minute)))
+	found, err = FindUserSession(ms.DB, s.ID, u.ID, p, start.Add(100*time.Minute))
+	ms.NoError(err)
+	ms.Equal("10.0.0.2", found.IP)
+
+	// Absolute timeout, however active.
+	ms.NoError(found.Touch(ms.DB, "10.0.0.2", start.Add(24*time.Hour)))
+	_, err = FindUserSession(ms.DB, s.ID, u.ID, p, start.Add(24*time.Hour+time.Minute))
+	ms.Equal(ErrSessionExpired, err)
+
+	other, err := NewUserSession(ms.DB, u.ID, "curl/8.0", "10.0.0.3", "password", start)
+	ms.NoError(err)
+	third, err := NewUserSession(ms.DB, u.ID, "curl/8.0", "10.0.0.3", "password", start)
+	ms.NoError(err)
+
+	active, err := ActiveSessions(ms.DB, u.ID, p, start.Add(time.Minute))
+	ms.NoError(err)
+	ms.Len(active, 3)
+
+	n, err := RevokeUserSessions(ms.DB, u.ID, third.ID, start)
+	ms.NoError(err)
+	ms.Equal(2, n)
+	_, err = FindUserSession(ms.DB, other.ID, u.ID, p, start.Add(time.Minute))
+	ms.Equal(ErrSessionExpired, err)
+	_, err = FindUserSession(ms.DB, third.ID, u.ID, p, start.Add(time.Minute))
+	ms.NoError(err)
+
+	ms.NoError(third.Revoke(ms.DB, start))
+	active, err = ActiveSessions(ms.DB, u.ID, p, start.Add(time.Minute))
+	ms.NoError(err)
+	ms.Len(active, 0)
+}
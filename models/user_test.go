@@ -1,5 +1,11 @@
 package models
 
+import (
+	"time"
+
+	"github.com/gobuffalo/nulls"
+)
+
 func (ms *ModelSuite) Test_User_Create() {
 	count, err := ms.DB.Count("users")
 	ms.NoError(err)
@@ -78,3 +84,188 @@ func (ms *ModelSuite) Test_User_Create_UserExists() {
 	ms.NoError(err)
 	ms.Equal(1, count)
 }
+
+func (ms *ModelSuite) Test_User_HasRole() {
+	u := &User{
+		Email:                "mark@example.com",
+		Password:             "password",
+		PasswordConfirmation: "password",
+	}
+	verrs, err := u.Create(ms.DB)
+	ms.NoError(err)
+	ms.False(verrs.HasAny())
+	ms.Equal(RoleMember, u.Role)
+
+	ms.True(u.HasRole(RoleMember))
+	ms.False(u.HasRole(RoleOrganizer))
+
+	u.Role = RoleAdmin
+	ms.True(u.HasRole(RoleOrganizer))
+	ms.True(u.IsAdmin())
+
+	u.Role = "superuser"
+	verrs, err = u.Validate(ms.DB)
+	ms.NoError(err)
+	ms.NotEmpty(verrs.Get("role"))
+
+	var nobody *User
+	ms.False(nobody.HasRole(RoleMember))
+}
+
+func (ms *ModelSuite) Test_User_MarkVerified() {
+	u := &User{
+		Email:                "mark@example.com",
+		Password:             "password",
+		PasswordConfirmation: "password",
+	}
+	verrs, err := u.Create(ms.DB)
+	ms.NoError(err)
+	ms.False(verrs.HasAny())
+	ms.False(u.IsVerified())
+
+	ms.NoError(u.MarkVerified(ms.DB, time.Now().UTC()))
+	ms.NoError(ms.DB.Reload(u))
+	ms.True(u.IsVerified())
+
+	var nobody *User
+	ms.False(nobody.IsVerified())
+}
+
+func (ms *ModelSuite) Test_User_ResetRecovery() {
+	u := &User{
+		Email:                "mark@example.com",
+		Password:             "password",
+		PasswordConfirmation: "password",
+	}
+	verrs, err := u.Create(ms.DB)
+	ms.NoError(err)
+	ms.False(verrs.HasAny())
+
+	_, _, err = u.StartRecovery(ms.DB, time.Now().UTC())
+	ms.NoError(err)
+	ms.True(u.HasPendingRecovery())
+
+	ms.NoError(u.ResetRecovery(ms.DB))
+	ms.NoError(ms.DB.Reload(u))
+	ms.False(u.HasPendingRecovery())
+	ms.False(u.RecoveryExp.Valid)
+}
+
+func (ms *ModelSuite) Test_User_Recovery() {
+	u := &User{
+		Email:                "mark@example.com",
+		Password:             "password",
+		PasswordConfirmation: "password",
+	}
+	verrs, err := u.Create(ms.DB)
+	ms.NoError(err)
+	ms.False(verrs.HasAny())
+
+	now := time.Now().UTC()
+	token, code, err := u.StartRecovery(ms.DB, now)
+	ms.NoError(err)
+	ms.NotEqual(token, u.RecoveryTokenHash.String)
+	ms.NotEqual(code, u.RecoveryCodeHash.String)
+
+	ms.True(u.CheckRecoveryCode(code, now))
+	ms.False(u.CheckRecoveryCode(code, now.Add(RecoveryTTL)))
+
+	found, err := FindUserByRecoveryToken(ms.DB, token, now)
+	ms.NoError(err)
+	ms.Equal(u.ID, found.ID)
+	_, err = FindUserByRecoveryToken(ms.DB, token, now.Add(RecoveryTTL))
+	ms.ErrorIs(err, ErrInvalidRecovery)
+
+	verrs, err = found.CompleteRecovery(ms.DB, "password2", "password2")
+	ms.NoError(err)
+	ms.False(verrs.HasAny())
+
+	_, err = FindUserByRecoveryToken(ms.DB, token, now)
+	ms.ErrorIs(err, ErrInvalidRecovery)
+	ms.NoError(ms.DB.Reload(u))
+	ms.False(u.CheckRecoveryCode(code, now))
+}
+
+func (ms *ModelSuite) Test_User_ChangeEmail() {
+	other := &User{Email: "taken@example.com", Password: "password", PasswordConfirmation: "password"}
+	verrs, err := other.Create(ms.DB)
+	ms.NoError(err)
+	ms.False(verrs.HasAny())
+
+	u := &User{Email: "mark@example.com", Password: "password", PasswordConfirmation: "password", VerifiedAt: nulls.NewTime(time.Now())}
+	verrs, err = u.Create(ms.DB)
+	ms.NoError(err)
+	ms.False(verrs.HasAny())
+	_, _, err = u.StartRecovery(ms.DB, time.Now().UTC())
+	ms.NoError(err)
+
+	verrs, err = u.ChangeEmail(ms.DB, "Taken@example.com")
+	ms.NoError(err)
+	ms.NotEmpty(verrs.Get("email"))
+	ms.Equal("mark@example.com", u.Email)
+	ms.True(u.IsVerified())
+
+	verrs, err = u.ChangeEmail(ms.DB, " MARK@example.com ")
+	ms.NoError(err)
+	ms.False(verrs.HasAny())
+	ms.True(u.IsVerified(), "the same address stays confirmed")
+
+	verrs, err = u.ChangeEmail(ms.DB, " New@Example.com")
+	ms.NoError(err)
+	ms.False(verrs.HasAny())
+	ms.NoError(ms.DB.Reload(u))
+	ms.Equal("new@example.com", u.Email)
+	ms.False(u.IsVerified())
+	ms.False(u.HasPendingRecovery())
+	ms.True(u.CheckPassword("password"))
+}
+
+func (ms *ModelSuite) Test_User_Destroy() {
+	u := &User{Email: "mark@example.com", Password: "password", PasswordConfirmation: "password"}
+	verrs, err := u.Create(ms.DB)
+	ms.NoError(err)
+	ms.False(verrs.HasAny())
+	helper := &User{Email: "helper@example.com", Password: "password", PasswordConfirmation: "password"}
+	verrs, err = helper.Create(ms.DB)
+	ms.NoError(err)
+	ms.False(verrs.HasAny())
+
+	now := time.Now().UTC()
+	event := func(title string, date time.Time) *Event {
+		e := &Event{Title: title, Date: date, Duration: 60, Status: EventStatusScheduled, OwnerID: nulls.NewUUID(u.ID)}
+		ms.NoError(ms.DB.Create(e))
+		return e
+	}
+	past := event("Last year's picnic", now.AddDate(-1, 0, 0))
+	shared := event("Quiz night", now.AddDate(0, 1, 0))
+	ms.NoError(ms.DB.Create(&EventOrganizer{EventID: shared.ID, UserID: helper.ID}))
+	upcoming := event("Board games", now.AddDate(0, 0, 7))
+
+	err = u.Destroy(ms.DB, now)
+	ms.Equal(ErrOwnsUpcomingEvents, err)
+
+	blocking, err := u.UndeletableEvents(ms.DB, now)
+	ms.NoError(err)
+	ms.Len(blocking, 1)
+	ms.Equal(upcoming.ID, blocking[0].ID)
+
+	upcoming.Cancel("Venue closed")
+	ms.NoError(ms.DB.Update(upcoming))
+	ms.NoError(u.Destroy(ms.DB, now))
+
+	exists, err := ms.DB.Where("id = ?", u.ID).Exists(&User{})
+	ms.NoError(err)
+	ms.False(exists)
+
+	for _, e := range []*Event{past, upcoming} {
+		exists, err = ms.DB.Where("id = ?", e.ID).Exists(&Event{})
+		ms.NoError(err)
+		ms.False(exists, e.Title)
+	}
+
+	ms.NoError(ms.DB.Reload(shared))
+	ms.Equal(helper.ID, shared.OwnerID.UUID)
+	count, err := ms.DB.Where("event_id = ?", shared.ID).Count(&EventOrganizer{})
+	ms.NoError(err)
+	ms.Equal(0, count)
+}
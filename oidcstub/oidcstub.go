@@ -0,0 +1,301 @@
+// Package oidcstub is a small OpenID Connect provider for development and
+// tests. It implements just enough of the authorization code flow (with
+// PKCE) for a relying party to sign someone in: discovery, an authorize
+// page, a token endpoint and the signing keys.
+//
+// It trusts whoever uses it. The authorize page asks for an email and a
+// name and signs that identity in, or signs in Provider.Identity without
+// asking when it is set. Never expose it to a network you don't control.
+package oidcstub
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+)
+
+const keyID = "oidcstub"
+
+// codeTTL is how long an authorization code can be exchanged.
+const codeTTL = time.Minute
+
+// Identity is who the provider signs in.
+type Identity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// grant is an issued authorization code waiting to be exchanged.
+type grant struct {
+	identity    Identity
+	clientID    string
+	redirectURI string
+	nonce       string
+	challenge   string
+	expires     time.Time
+}
+
+// Provider is the stub identity provider. Set Issuer to the URL it is
+// served at before handling requests.
+type Provider struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// Identity, if set, is signed in without showing the authorize page.
+	Identity *Identity
+
+	key    *rsa.PrivateKey
+	mu     sync.Mutex
+	codes  map[string]grant
+	router *http.ServeMux
+}
+
+// New returns a provider for one client, with a fresh signing key.
+func New(issuer, clientID, clientSecret string) (*Provider, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Provider{
+		Issuer:       strings.TrimRight(issuer, "/"),
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		key:          key,
+		codes:        map[string]grant{},
+		router:       http.NewServeMux(),
+	}
+	p.router.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	p.router.HandleFunc("/authorize", p.authorize)
+	p.router.HandleFunc("/token", p.token)
+	p.router.HandleFunc("/keys", p.keys)
+	return p, nil
+}
+
+// ServeHTTP implements http.Handler.
+func (p *Provider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.router.ServeHTTP(w, r)
+}
+
+func (p *Provider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                p.Issuer,
+		"authorization_endpoint":                p.Issuer + "/authorize",
+		"token_endpoint":                        p.Issuer + "/token",
+		"jwks_uri":                              p.Issuer + "/keys",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"scopes_supported":                      []string{"openid", "email", "profile"},
+		"claims_supported":                      []string{"sub", "email", "email_verified", "name"},
+	})
+}
+
+func (p *Provider) keys(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{
+		Key:       &p.key.PublicKey,
+		KeyID:     keyID,
+		Algorithm: string(jose.RS256),
+		Use:       "sig",
+	}}})
+}
+
+var authorizePage = template.Must(template.New("authorize").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Stub sign-in</title></head>
+<body style="font-family: sans-serif; max-width: 30em; margin: 3em auto;">
+  <h1>Stub sign-in</h1>
+  <p>This development provider signs in whoever you say.</p>
+  <form method="POST">
+    <p><label>Email<br><input type="email" name="email" required autofocus></label></p>
+    <p><label>Name<br><input type="text" name="name"></label></p>
+    <p><label><input type="checkbox" name="email_verified" value="true" checked> Email is verified</label></p>
+    <button>Sign in</button>
+  </form>
+</body>
+</html>
+`))
+
+// authorize checks the request and issues a code for the identity, from
+// p.Identity or the form on the page.
+func (p *Provider) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	redirect, err := url.Parse(q.Get("redirect_uri"))
+	switch {
+	case q.Get("client_id") != p.ClientID:
+		http.Error(w, "unknown client_id", http.StatusBadRequest)
+		return
+	case err != nil || !redirect.IsAbs():
+		http.Error(w, "redirect_uri must be an absolute URL", http.StatusBadRequest)
+		return
+	case q.Get("response_type") != "code":
+		http.Error(w, "only the code response type is supported", http.StatusBadRequest)
+		return
+	case q.Get("code_challenge") != "" && q.Get("code_challenge_method") != "S256":
+		http.Error(w, "only S256 code challenges are supported", http.StatusBadRequest)
+		return
+	}
+
+	identity := p.Identity
+	if identity == nil {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_ = authorizePage.Execute(w, nil)
+			return
+		}
+		email := strings.TrimSpace(r.PostFormValue("email"))
+		identity = &Identity{
+			Subject:       subjectFor(email),
+			Email:         email,
+			EmailVerified: r.PostFormValue("email_verified") == "true",
+			Name:          strings.TrimSpace(r.PostFormValue("name")),
+		}
+	}
+
+	code := randomString()
+	p.mu.Lock()
+	p.codes[code] = grant{
+		identity:    *identity,
+		clientID:    p.ClientID,
+		redirectURI: redirect.String(),
+		nonce:       q.Get("nonce"),
+		challenge:   q.Get("code_challenge"),
+		expires:     time.Now().Add(codeTTL),
+	}
+	p.mu.Unlock()
+
+	back := redirect.Query()
+	back.Set("code", code)
+	back.Set("state", q.Get("state"))
+	redirect.RawQuery = back.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+// token exchanges a code for an ID token. Each code works once.
+func (p *Provider) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST only", http.StatusMethodNotAllowed)
+		return
+	}
+
+	clientID, secret, ok := r.BasicAuth()
+	if !ok {
+		clientID, secret = r.PostFormValue("client_id"), r.PostFormValue("client_secret")
+	}
+	if clientID != p.ClientID || subtle.ConstantTimeCompare([]byte(secret), []byte(p.ClientSecret)) != 1 {
+		tokenError(w, http.StatusUnauthorized, "invalid_client")
+		return
+	}
+
+	p.mu.Lock()
+	g, found := p.codes[r.PostFormValue("code")]
+	delete(p.codes, r.PostFormValue("code"))
+	p.mu.Unlock()
+
+	switch {
+	case r.PostFormValue("grant_type") != "authorization_code":
+		tokenError(w, http.StatusBadRequest, "unsupported_grant_type")
+		return
+	case !found || time.Now().After(g.expires) || g.clientID != clientID || g.redirectURI != r.PostFormValue("redirect_uri"):
+		tokenError(w, http.StatusBadRequest, "invalid_grant")
+		return
+	case g.challenge != "" && g.challenge != s256(r.PostFormValue("code_verifier")):
+		tokenError(w, http.StatusBadRequest, "invalid_grant")
+		return
+	}
+
+	idToken, err := p.sign(g)
+	if err != nil {
+		tokenError(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+// sign makes the ID token for a grant.
+func (p *Provider) sign(g grant) (string, error) {
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.RS256, Key: jose.JSONWebKey{Key: p.key, KeyID: keyID}},
+		(&jose.SignerOptions{}).WithType("JWT"),
+	)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims := map[string]interface{}{
+		"iss":            p.Issuer,
+		"sub":            g.identity.Subject,
+		"aud":            g.clientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+		"email":          g.identity.Email,
+		"email_verified": g.identity.EmailVerified,
+	}
+	if g.nonce != "" {
+		claims["nonce"] = g.nonce
+	}
+	if g.identity.Name != "" {
+		claims["name"] = g.identity.Name
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	obj, err := signer.Sign(payload)
+	if err != nil {
+		return "", err
+	}
+	return obj.CompactSerialize()
+}
+
+// subjectFor gives each email a stable subject, so signing in twice with
+// the same address is the same person.
+func subjectFor(email string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(email)))
+	return fmt.Sprintf("stub-%x", sum[:8])
+}
+
+func s256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func randomString() string {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func tokenError(w http.ResponseWriter, status int, code string) {
+	writeJSON(w, status, map[string]string{"error": code})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
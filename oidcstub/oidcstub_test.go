@@ -0,0 +1,156 @@
+package oidcstub
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// flow runs the authorization code flow against the stub up to the
+// redirect back to the client, and returns the code.
+func flow(t *testing.T, srv *httptest.Server, cfg oauth2.Config, opts ...oauth2.AuthCodeOption) string {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+
+	res, err := client.Get(cfg.AuthCodeURL("the-state", opts...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusFound {
+		t.Fatalf("authorize returned %d", res.StatusCode)
+	}
+
+	back, err := url.Parse(res.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := back.Query().Get("state"); got != "the-state" {
+		t.Fatalf("state = %q", got)
+	}
+	return back.Query().Get("code")
+}
+
+func setup(t *testing.T) (*Provider, *httptest.Server, oauth2.Config) {
+	t.Helper()
+	var p *Provider
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	p, err := New(srv.URL, "client", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Identity = &Identity{Subject: "s1", Email: "ann@example.com", EmailVerified: true, Name: "Ann"}
+
+	cfg := oauth2.Config{
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RedirectURL:  "http://app.test/callback",
+		Endpoint:     oauth2.Endpoint{AuthURL: srv.URL + "/authorize", TokenURL: srv.URL + "/token"},
+		Scopes:       []string{oidc.ScopeOpenID, "email"},
+	}
+	return p, srv, cfg
+}
+
+func TestFlow(t *testing.T) {
+	_, srv, cfg := setup(t)
+	ctx := context.Background()
+
+	provider, err := oidc.NewProvider(ctx, srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifier := oauth2.GenerateVerifier()
+	code := flow(t, srv, cfg, oidc.Nonce("n-1"), oauth2.S256ChallengeOption(verifier))
+
+	tok, err := cfg.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := tok.Extra("id_token").(string)
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: "client"}).Verify(ctx, raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var claims struct {
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+		Name          string `json:"name"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		t.Fatal(err)
+	}
+	if idToken.Subject != "s1" || idToken.Nonce != "n-1" || claims.Email != "ann@example.com" || !claims.EmailVerified || claims.Name != "Ann" {
+		t.Fatalf("unexpected token: %+v %+v", idToken, claims)
+	}
+
+	// Codes work once.
+	if _, err := cfg.Exchange(ctx, code, oauth2.VerifierOption(verifier)); err == nil {
+		t.Fatal("code was accepted twice")
+	}
+}
+
+func TestPKCEMismatch(t *testing.T) {
+	_, srv, cfg := setup(t)
+
+	code := flow(t, srv, cfg, oauth2.S256ChallengeOption(oauth2.GenerateVerifier()))
+	_, err := cfg.Exchange(context.Background(), code, oauth2.VerifierOption(oauth2.GenerateVerifier()))
+	if err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Fatalf("err = %v, want invalid_grant", err)
+	}
+}
+
+func TestClientSecret(t *testing.T) {
+	_, srv, cfg := setup(t)
+
+	code := flow(t, srv, cfg)
+	cfg.ClientSecret = "wrong"
+	_, err := cfg.Exchange(context.Background(), code)
+	if err == nil || !strings.Contains(err.Error(), "invalid_client") {
+		t.Fatalf("err = %v, want invalid_client", err)
+	}
+}
+
+func TestAuthorizeForm(t *testing.T) {
+	p, _, cfg := setup(t)
+	p.Identity = nil
+
+	res, err := http.Get(cfg.AuthCodeURL("s"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("authorize page returned %d", res.StatusCode)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	res, err = client.PostForm(cfg.AuthCodeURL("s"), url.Values{"email": {"Bob@Example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	back, _ := url.Parse(res.Header.Get("Location"))
+
+	p.mu.Lock()
+	g := p.codes[back.Query().Get("code")]
+	p.mu.Unlock()
+	if g.identity.Email != "Bob@Example.com" || g.identity.EmailVerified || g.identity.Subject != subjectFor("bob@example.com") {
+		t.Fatalf("unexpected identity %+v", g.identity)
+	}
+}
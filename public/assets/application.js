@@ -0,0 +1,12 @@
+// Tell the server the browser's time zone, so event pages can show times
+// in it as well as in the event's own zone.
+(function () {
+  try {
+    var zone = Intl.DateTimeFormat().resolvedOptions().timeZone;
+    if (zone) {
+      document.cookie = 'tz=' + zone + '; path=/; max-age=31536000; samesite=lax';
+    }
+  } catch (e) {
+    // Old browsers without Intl just see event times.
+  }
+})();
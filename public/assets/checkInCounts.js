@@ -0,0 +1,32 @@
+// Keeps the arrival counts on the check-in page current while guests are
+// checked in at other doors.
+const checkInCounts = document.getElementById('checkInCounts');
+
+new Vue({
+  el: '#checkInCounts',
+  data() {
+    return {
+      url: checkInCounts.dataset.url,
+      checkedIn: Number(checkInCounts.dataset.checkedIn),
+      expected: Number(checkInCounts.dataset.expected)
+    }
+  },
+  methods: {
+    async refresh() {
+      const resp = await fetch(this.url, {headers: {'Accept': 'application/json'}});
+      if (!resp.ok) {
+        return;
+      }
+      const counts = await resp.json();
+      this.checkedIn = counts.checked_in;
+      this.expected = counts.expected;
+    }
+  },
+  mounted() {
+    setInterval(this.refresh, 5000);
+  },
+  template: `
+<p id="checkInCounts" class="lead">
+  <strong>{{checkedIn}}</strong> of {{expected}} guests checked in
+</p>`
+})
@@ -23,7 +23,7 @@ new Vue({
       }).catch((error) => {
         if (error) {
           if (error.response) {
-            this.formReturn = 'Error ' + error.response.data;
+            this.formReturn = 'Error: ' + error.response.data.error;
             return
           } else {
             this.formReturn = 'Server error'
@@ -34,7 +34,7 @@ new Vue({
         return
       }
 
-      this.formReturn = 'Reservation complete';
+      this.formReturn = resp.data.message;
     }
   },
   mounted() {
@@ -45,14 +45,18 @@ new Vue({
     }
     else {
       for (let i = 0; i < data.length; i++) {
-        let d = new Date(data[i].Date).toLocaleDateString('en-us', {
+        if (data[i].status === 'cancelled') {
+          continue
+        }
+        let d = new Date(data[i].date).toLocaleDateString('en-us', {
           year: 'numeric',
           month: 'short',
           day: 'numeric',
+          timeZone: data[i].time_zone || 'UTC',
         })
         const item = {
           ID: data[i].id,
-          Label: data[i].Title + " (" + d + ")",
+          Label: data[i].title + " (" + d + ")",
         }
         options.push(item)
       }
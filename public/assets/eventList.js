@@ -29,17 +29,20 @@ new Vue({
     }
     else {
       for (let i = 0; i < data.length; i++) {
-        let d = new Date(data[i].Date).toLocaleDateString('en-us', {
+        let d = new Date(data[i].date).toLocaleDateString('en-us', {
           year: 'numeric',
           month: 'short',
           day: 'numeric',
           hour: '2-digit',
-          minute: '2-digit'
+          minute: '2-digit',
+          timeZone: data[i].time_zone || 'UTC',
+          timeZoneName: 'short'
         })
         const item = {
-          Title: data[i].Title,
+          Title: data[i].title,
           Link: "/events/" + data[i].id,
-          EventDate: d
+          EventDate: d,
+          Cancelled: data[i].status === 'cancelled'
         }
         events.push(item)
       }
@@ -58,7 +61,7 @@ new Vue({
   </div>
   <ul class="event-list list-group">
     <li v-for="ev in filteredEvents" class="event-list-item list-group-item">
-      <p><a v-bind:href="ev.Link">{{ev.Title}}</a> &#8212; {{ev.EventDate}}</p>
+      <p><a v-bind:href="ev.Link">{{ev.Title}}</a> &#8212; {{ev.EventDate}} <span v-if="ev.Cancelled" class="badge badge-danger">Cancelled</span></p>
     </li>
   </ul>
 </div>`
@@ -68,8 +71,8 @@ new Vue({
 // [
 //   {
 //     id: "2bdd0040-ac01-4127-a767-bdc681a15545",
-//     "Title": "Event one",
-//     "Description": "This is event one.",
-//     "Date": "2023-11-14T02:35:55Z"
+//     "title": "Event one",
+//     "description": "This is event one.",
+//     "date": "2023-11-14T02:35:55Z"
 //   }
 // ]
\ No newline at end of file
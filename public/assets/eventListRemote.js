@@ -3,7 +3,8 @@ new Vue({
   data() {
     return {
       events: [],
-      titleSearch: ""
+      titleSearch: "",
+      pagination: {page: 1, total_pages: 1, total_entries_size: 0}
     }
   },
   computed: {
@@ -22,34 +23,43 @@ new Vue({
     }
   },
   methods: {
-    async getEvents() {
-      const resp = fetch('/events/', {headers: {'Content-Type': 'application/json'}});
+    async getEvents(page) {
+      const resp = fetch('/events/json?page=' + page, {headers: {'Content-Type': 'application/json'}});
       return (await resp).json();
-    }
-  },
-  async mounted() {
-    let events = [];
-    let data = [];
-    // Make request to load event list.
-    await this.getEvents().then(res => data = res);
+    },
+    async loadPage(page) {
+      let events = [];
+      let data = [];
+      // Make request to load one page of the event list.
+      await this.getEvents(page).then(res => {
+        data = res.events;
+        this.pagination = res.pagination;
+      });
 
-    for (let i = 0; i < data.length; i++) {
-      let d = new Date(data[i].Date).toLocaleDateString('en-us', {
-        year: 'numeric',
-        month: 'short',
-        day: 'numeric',
-        hour: '2-digit',
-        minute: '2-digit'
-      })
-      const item = {
-        Title: data[i].Title,
-        Link: "/events/" + data[i].id,
-        EventDate: d
+      for (let i = 0; i < data.length; i++) {
+        let d = new Date(data[i].date).toLocaleDateString('en-us', {
+          year: 'numeric',
+          month: 'short',
+          day: 'numeric',
+          hour: '2-digit',
+          minute: '2-digit',
+          timeZone: data[i].time_zone || 'UTC',
+          timeZoneName: 'short'
+        })
+        const item = {
+          Title: data[i].title,
+          Link: "/events/" + data[i].id,
+          EventDate: d,
+          Cancelled: data[i].status === 'cancelled'
+        }
+        events.push(item)
       }
-      events.push(item)
-    }
 
-    this.events = events;
+      this.events = events;
+    }
+  },
+  async mounted() {
+    await this.loadPage(1);
   },
   template: `
 <div class="event-list">
@@ -62,9 +72,14 @@ new Vue({
   </div>
   <ul class="event-list">
     <li v-for="ev in filteredEvents" class="event-list-item">
-      <p><a v-bind:href="ev.Link">{{ev.Title}}</a> &#8212; {{ev.EventDate}}</p>
+      <p><a v-bind:href="ev.Link">{{ev.Title}}</a> &#8212; {{ev.EventDate}} <span v-if="ev.Cancelled" class="badge badge-danger">Cancelled</span></p>
     </li>
   </ul>
+  <p>
+    <button :disabled="pagination.page <= 1" @click="loadPage(pagination.page - 1)">Previous</button>
+    Page {{pagination.page}} of {{pagination.total_pages}} ({{pagination.total_entries_size}} events)
+    <button :disabled="pagination.page >= pagination.total_pages" @click="loadPage(pagination.page + 1)">Next</button>
+  </p>
 </div>`
 })
 
@@ -72,8 +87,8 @@ new Vue({
 // [
 //   {
 //     id: "2bdd0040-ac01-4127-a767-bdc681a15545",
-//     "Title": "Event one",
-//     "Description": "This is event one.",
-//     "Date": "2023-11-14T02:35:55Z"
+//     "title": "Event one",
+//     "description": "This is event one.",
+//     "date": "2023-11-14T02:35:55Z"
 //   }
 // ]
\ No newline at end of file
@@ -0,0 +1,45 @@
+// Package qrcode draws QR codes as PNG images, for tickets shown on screen
+// and embedded in email.
+package qrcode
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image/png"
+
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/qr"
+)
+
+// ContentType is the MIME type of the images PNG returns.
+const ContentType = "image/png"
+
+// PNG encodes content as a QR code size pixels square. Medium error
+// correction leaves room for a phone camera to read a smudged or glaring
+// screen.
+func PNG(content string, size int) ([]byte, error) {
+	code, err := qr.Encode(content, qr.M, qr.Auto)
+	if err != nil {
+		return nil, err
+	}
+	code, err = barcode.Scale(code, size, size)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	err = png.Encode(buf, code)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// DataURI is PNG as a data: URI, for an img tag's src.
+func DataURI(content string, size int) (string, error) {
+	b, err := PNG(content, size)
+	if err != nil {
+		return "", err
+	}
+	return "data:" + ContentType + ";base64," + base64.StdEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,42 @@
+package qrcode
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestPNG(t *testing.T) {
+	b, err := PNG("https://example.com/check-in/abc123", 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := img.Bounds().Dx(); got != 200 {
+		t.Errorf("width = %d, want 200", got)
+	}
+	if got := img.Bounds().Dy(); got != 200 {
+		t.Errorf("height = %d, want 200", got)
+	}
+}
+
+func TestPNGTooSmall(t *testing.T) {
+	// A version 1 code is 21 modules wide and can't be scaled down.
+	if _, err := PNG("hello", 10); err == nil {
+		t.Error("expected an error for a size smaller than the code")
+	}
+}
+
+func TestDataURI(t *testing.T) {
+	uri, err := DataURI("hello", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(uri, "data:image/png;base64,") {
+		t.Errorf("unexpected data URI %.40s", uri)
+	}
+}
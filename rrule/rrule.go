@@ -0,0 +1,278 @@
+// Package rrule parses and expands the recurrence rules events use: the
+// daily, weekly and monthly subset of iCalendar's RRULE (RFC 5545), with
+// an interval, weekdays for weekly rules, and an end given by a count or
+// an until time.
+package rrule
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Frequencies, as used in FREQ.
+const (
+	Daily   = "DAILY"
+	Weekly  = "WEEKLY"
+	Monthly = "MONTHLY"
+)
+
+// untilFormat is the UTC DATE-TIME form of UNTIL.
+const untilFormat = "20060102T150405Z"
+
+// dayCodes are the BYDAY codes, indexed by time.Weekday.
+var dayCodes = []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// Rule is one recurrence rule. The first occurrence is always the start
+// the rule is expanded from.
+type Rule struct {
+	Freq     string
+	Interval int            // 1 if zero
+	ByDay    []time.Weekday // weekly rules only; the start's weekday if empty
+	Count    int            // total occurrences, 0 for no limit
+	Until    time.Time      // last possible start, zero for no limit
+}
+
+// Parse reads a rule such as "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=10". A leading
+// "RRULE:" is allowed.
+func Parse(s string) (Rule, error) {
+	r := Rule{}
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	for _, part := range strings.Split(s, ";") {
+		if part == "" {
+			continue
+		}
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return Rule{}, fmt.Errorf("rrule: bad part %q", part)
+		}
+		key, value := strings.ToUpper(kv[0]), strings.ToUpper(kv[1])
+
+		var err error
+		switch key {
+		case "FREQ":
+			r.Freq = value
+		case "INTERVAL":
+			r.Interval, err = strconv.Atoi(value)
+		case "COUNT":
+			r.Count, err = strconv.Atoi(value)
+		case "UNTIL":
+			r.Until, err = parseUntil(value)
+		case "BYDAY":
+			for _, code := range strings.Split(value, ",") {
+				day, ok := parseDay(code)
+				if !ok {
+					return Rule{}, fmt.Errorf("rrule: bad BYDAY %q", code)
+				}
+				r.ByDay = append(r.ByDay, day)
+			}
+		default:
+			return Rule{}, fmt.Errorf("rrule: %s is not supported", key)
+		}
+		if err != nil {
+			return Rule{}, fmt.Errorf("rrule: bad %s %q", key, value)
+		}
+	}
+	return r, r.Validate()
+}
+
+// parseUntil accepts a UTC date-time or a date, which includes the whole
+// day.
+func parseUntil(s string) (time.Time, error) {
+	if t, err := time.Parse(untilFormat, s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("20060102", s)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.Add(24*time.Hour - time.Second), nil
+}
+
+func parseDay(code string) (time.Weekday, bool) {
+	for i, c := range dayCodes {
+		if c == strings.TrimSpace(code) {
+			return time.Weekday(i), true
+		}
+	}
+	return 0, false
+}
+
+// Validate reports whether the rule is one this package can expand.
+func (r Rule) Validate() error {
+	switch r.Freq {
+	case Daily, Weekly, Monthly:
+	case "":
+		return errors.New("rrule: FREQ is required")
+	default:
+		return fmt.Errorf("rrule: FREQ=%s is not supported", r.Freq)
+	}
+	if r.Interval < 0 {
+		return errors.New("rrule: INTERVAL must be positive")
+	}
+	if r.Count < 0 {
+		return errors.New("rrule: COUNT must be positive")
+	}
+	if r.Count > 0 && !r.Until.IsZero() {
+		return errors.New("rrule: COUNT and UNTIL can't both be set")
+	}
+	if len(r.ByDay) > 0 && r.Freq != Weekly {
+		return errors.New("rrule: BYDAY is only supported on weekly rules")
+	}
+	return nil
+}
+
+// Bounded reports whether the rule ends, by count or until.
+func (r Rule) Bounded() bool {
+	return r.Count > 0 || !r.Until.IsZero()
+}
+
+// String encodes the rule in RRULE form, without the "RRULE:" prefix.
+func (r Rule) String() string {
+	parts := []string{"FREQ=" + r.Freq}
+	if r.interval() > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.interval()))
+	}
+	if len(r.ByDay) > 0 {
+		codes := []string{}
+		for _, day := range r.days() {
+			codes = append(codes, dayCodes[day])
+		}
+		parts = append(parts, "BYDAY="+strings.Join(codes, ","))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format(untilFormat))
+	}
+	return strings.Join(parts, ";")
+}
+
+// Text describes the rule for people, like "Every 2 weeks on Monday and
+// Wednesday, 10 times".
+func (r Rule) Text() string {
+	units := map[string]string{Daily: "day", Weekly: "week", Monthly: "month"}
+	s := "Every " + units[r.Freq]
+	if n := r.interval(); n > 1 {
+		s = "Every " + strconv.Itoa(n) + " " + units[r.Freq] + "s"
+	}
+
+	if len(r.ByDay) > 0 {
+		names := []string{}
+		for _, day := range r.days() {
+			names = append(names, day.String())
+		}
+		if len(names) > 1 {
+			names = append(names[:len(names)-2], names[len(names)-2]+" and "+names[len(names)-1])
+		}
+		s += " on " + strings.Join(names, ", ")
+	}
+
+	switch {
+	case r.Count == 1:
+		s += ", once"
+	case r.Count > 1:
+		s += ", " + strconv.Itoa(r.Count) + " times"
+	case !r.Until.IsZero():
+		s += ", until " + r.Until.Format("Jan. 02 2006")
+	}
+	return s
+}
+
+func (r Rule) interval() int {
+	if r.Interval < 1 {
+		return 1
+	}
+	return r.Interval
+}
+
+// days returns ByDay sorted Monday first, without repeats.
+func (r Rule) days() []time.Weekday {
+	seen := map[time.Weekday]bool{}
+	days := []time.Weekday{}
+	for _, day := range r.ByDay {
+		if !seen[day] {
+			seen[day] = true
+			days = append(days, day)
+		}
+	}
+	sort.Slice(days, func(i, j int) bool { return mondayFirst(days[i]) < mondayFirst(days[j]) })
+	return days
+}
+
+func mondayFirst(day time.Weekday) int {
+	return (int(day) + 6) % 7
+}
+
+// Expand returns the occurrences of the rule from start, in start's
+// location, so they keep its wall clock time across daylight saving
+// changes. It stops at the rule's count and until, at horizon unless that
+// is zero, and after limit occurrences. Monthly rules skip months without
+// start's day, as RFC 5545 does.
+func (r Rule) Expand(start, horizon time.Time, limit int) []time.Time {
+	out := []time.Time{}
+	add := func(t time.Time) bool {
+		if (!r.Until.IsZero() && t.After(r.Until)) || (!horizon.IsZero() && t.After(horizon)) {
+			return false
+		}
+		out = append(out, t)
+		return len(out) < limit && (r.Count == 0 || len(out) < r.Count)
+	}
+	if limit < 1 || !add(start) {
+		return out
+	}
+
+	y, m, d := start.Date()
+	hh, mm, ss := start.Clock()
+	at := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, hh, mm, ss, start.Nanosecond(), start.Location())
+	}
+	n := r.interval()
+
+	switch r.Freq {
+	case Daily:
+		for i := 1; ; i++ {
+			if !add(at(y, m, d+i*n)) {
+				return out
+			}
+		}
+
+	case Weekly:
+		days := r.days()
+		if len(days) == 0 {
+			days = []time.Weekday{start.Weekday()}
+		}
+		monday := d - mondayFirst(start.Weekday())
+		for week := 0; ; week += n {
+			for _, day := range days {
+				t := at(y, m, monday+week*7+mondayFirst(day))
+				if !t.After(start) {
+					continue
+				}
+				if !add(t) {
+					return out
+				}
+			}
+		}
+
+	case Monthly:
+		// A day like the 31st is missing from most months, but never from
+		// more than a few in a row.
+		for i, misses := n, 0; misses < 12; i += n {
+			t := at(y, m+time.Month(i), d)
+			if t.Day() != d {
+				misses++
+				continue
+			}
+			misses = 0
+			if !add(t) {
+				return out
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,107 @@
+package rrule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	for in, want := range map[string]string{
+		"FREQ=DAILY": "FREQ=DAILY",
+		"RRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=WE,MO": "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE",
+		"freq=monthly;count=6":                     "FREQ=MONTHLY;COUNT=6",
+		"FREQ=WEEKLY;INTERVAL=1;UNTIL=20270101":    "FREQ=WEEKLY;UNTIL=20270101T235959Z",
+		"FREQ=DAILY;UNTIL=20270101T090000Z":        "FREQ=DAILY;UNTIL=20270101T090000Z",
+	} {
+		r, err := Parse(in)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", in, err)
+			continue
+		}
+		if got := r.String(); got != want {
+			t.Errorf("Parse(%q).String() = %q, want %q", in, got, want)
+		}
+	}
+
+	for _, in := range []string{
+		"",
+		"FREQ=YEARLY",
+		"FREQ=DAILY;COUNT=2;UNTIL=20270101",
+		"FREQ=DAILY;BYDAY=MO",
+		"FREQ=WEEKLY;BYDAY=XX",
+		"FREQ=WEEKLY;BYMONTHDAY=1",
+		"FREQ=DAILY;INTERVAL=two",
+	} {
+		if _, err := Parse(in); err == nil {
+			t.Errorf("Parse(%q) should fail", in)
+		}
+	}
+}
+
+func TestText(t *testing.T) {
+	r, _ := Parse("FREQ=WEEKLY;INTERVAL=2;BYDAY=FR,MO,WE;COUNT=10")
+	if got, want := r.Text(), "Every 2 weeks on Monday, Wednesday and Friday, 10 times"; got != want {
+		t.Errorf("Text() = %q, want %q", got, want)
+	}
+	r, _ = Parse("FREQ=MONTHLY")
+	if got, want := r.Text(), "Every month"; got != want {
+		t.Errorf("Text() = %q, want %q", got, want)
+	}
+}
+
+func dates(ts []time.Time) []string {
+	out := []string{}
+	for _, t := range ts {
+		out = append(out, t.Format("2006-01-02 15:04"))
+	}
+	return out
+}
+
+func expect(t *testing.T, got []time.Time, want ...string) {
+	t.Helper()
+	g := dates(got)
+	if len(g) != len(want) {
+		t.Fatalf("got %v, want %v", g, want)
+	}
+	for i := range want {
+		if g[i] != want[i] {
+			t.Fatalf("got %v, want %v", g, want)
+		}
+	}
+}
+
+func TestExpand(t *testing.T) {
+	// Wednesday.
+	start := time.Date(2026, 10, 21, 19, 0, 0, 0, time.UTC)
+
+	r, _ := Parse("FREQ=DAILY;INTERVAL=2;COUNT=3")
+	expect(t, r.Expand(start, time.Time{}, 100), "2026-10-21 19:00", "2026-10-23 19:00", "2026-10-25 19:00")
+
+	r, _ = Parse("FREQ=WEEKLY;BYDAY=MO,WE;COUNT=4")
+	expect(t, r.Expand(start, time.Time{}, 100), "2026-10-21 19:00", "2026-10-26 19:00", "2026-10-28 19:00", "2026-11-02 19:00")
+
+	r, _ = Parse("FREQ=WEEKLY;INTERVAL=2;UNTIL=20261118")
+	expect(t, r.Expand(start, time.Time{}, 100), "2026-10-21 19:00", "2026-11-04 19:00", "2026-11-18 19:00")
+
+	r, _ = Parse("FREQ=MONTHLY;COUNT=4")
+	expect(t, r.Expand(time.Date(2027, 1, 31, 9, 0, 0, 0, time.UTC), time.Time{}, 100),
+		"2027-01-31 09:00", "2027-03-31 09:00", "2027-05-31 09:00", "2027-07-31 09:00")
+
+	// Open-ended rules stop at the horizon or the limit.
+	r, _ = Parse("FREQ=DAILY")
+	expect(t, r.Expand(start, start.Add(36*time.Hour), 100), "2026-10-21 19:00", "2026-10-22 19:00")
+	expect(t, r.Expand(start, time.Time{}, 1), "2026-10-21 19:00")
+}
+
+func TestExpandKeepsWallClock(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	r, _ := Parse("FREQ=WEEKLY;COUNT=3")
+	got := r.Expand(time.Date(2026, 10, 25, 18, 0, 0, 0, loc), time.Time{}, 100)
+	expect(t, got, "2026-10-25 18:00", "2026-11-01 18:00", "2026-11-08 18:00")
+	if got[0].UTC().Hour() == got[2].UTC().Hour() {
+		t.Errorf("expected the UTC time to move with daylight saving: %v", got)
+	}
+}
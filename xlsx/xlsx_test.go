@@ -0,0 +1,94 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestColumnName(t *testing.T) {
+	for i, want := range map[int]string{0: "A", 25: "Z", 26: "AA", 27: "AB", 701: "ZZ", 702: "AAA"} {
+		if got := ColumnName(i); got != want {
+			t.Errorf("ColumnName(%d) = %q, want %q", i, got, want)
+		}
+	}
+}
+
+func TestSheetWrite(t *testing.T) {
+	at := time.Date(2026, 10, 17, 18, 0, 0, 0, time.UTC)
+	s := Sheet{Name: "Guests: a/b", Header: true, Rows: [][]interface{}{
+		{"Email", "Name", "Count", "At"},
+		{"bob@example.com", "Bob <& Co>\x01", 3, at},
+		{"ann@example.com", nil, 1.5, time.Time{}},
+	}}
+
+	buf := &bytes.Buffer{}
+	if err := s.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	z, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{}
+	for _, f := range z.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(b)
+
+		// Every part has to be well-formed XML.
+		d := xml.NewDecoder(bytes.NewReader(b))
+		for {
+			_, err := d.Token()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%s: %v", f.Name, err)
+			}
+		}
+	}
+
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/styles.xml", "xl/worksheets/sheet1.xml"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("missing %s", name)
+		}
+	}
+
+	if !strings.Contains(files["xl/workbook.xml"], `name="Guests- a-b"`) {
+		t.Errorf("sheet name not cleaned up: %s", files["xl/workbook.xml"])
+	}
+
+	sheet := files["xl/worksheets/sheet1.xml"]
+	for _, want := range []string{
+		`<c r="A1" s="2" t="inlineStr"><is><t xml:space="preserve">Email</t></is></c>`,
+		`<t xml:space="preserve">Bob &lt;&amp; Co&gt;</t>`,
+		`<c r="C2" s="0"><v>3</v></c>`,
+		// 2026-10-17 is day 46312; 18:00 is three quarters of it.
+		`<c r="D2" s="1"><v>46312.75</v></c>`,
+		`<c r="C3" s="0"><v>1.5</v></c>`,
+	} {
+		if !strings.Contains(sheet, want) {
+			t.Errorf("missing %s in\n%s", want, sheet)
+		}
+	}
+	if strings.Contains(sheet, `r="B3"`) || strings.Contains(sheet, `r="D3"`) {
+		t.Errorf("empty cells should be left out:\n%s", sheet)
+	}
+}
+
+func TestSheetWriteUnsupported(t *testing.T) {
+	err := Sheet{Rows: [][]interface{}{{struct{}{}}}}.Write(io.Discard)
+	if err == nil {
+		t.Fatal("expected an error for an unsupported cell")
+	}
+}